@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Anthropic defaults, overridable with ANTHROPIC_MODEL, ANTHROPIC_MAX_TOKENS and ANTHROPIC_BASE_URL
+const (
+	defaultAnthropicModel     = "claude-3-5-sonnet-latest"
+	defaultAnthropicMaxTokens = 8192
+	defaultAnthropicBaseURL   = "https://api.anthropic.com"
+	anthropicAPIVersion       = "2023-06-01"
+)
+
+// anthropicGenerator writes blogs with the Anthropic Messages API
+type anthropicGenerator struct{}
+
+// anthropicRequest is the body of a Messages API request
+type anthropicRequest struct {
+	Model     string        `json:"model"`
+	MaxTokens int           `json:"max_tokens"`
+	System    string        `json:"system"`
+	Messages  []chatMessage `json:"messages"`
+}
+
+// anthropicResponse is the part of a Messages API response the generator uses
+type anthropicResponse struct {
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	StopReason string `json:"stop_reason"`
+	Usage      struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+}
+
+func (anthropicGenerator) Ready(ctx context.Context) error {
+	_, err := requireEnv("ANTHROPIC_API_KEY")
+	return err
+}
+
+// Generate writes the blog with the Anthropic Messages API and fills its images from Pexels
+func (g anthropicGenerator) Generate(ctx context.Context, request LlamaIndexRequest) (LlamaIndexResponse, error) {
+	text, usage, err := g.Complete(ctx, blogSystemPrompt, blogUserPrompt(request))
+	if err != nil {
+		return LlamaIndexResponse{Usage: usage}, err
+	}
+	blog, err := completeBlog(ctx, request.Topic, text, len(request.Contents))
+	blog.Usage = usage
+	return blog, err
+}
+
+// Complete asks the Anthropic Messages API to answer the prompt
+func (anthropicGenerator) Complete(ctx context.Context, system, prompt string) (string, TokenUsage, error) {
+	apiKey, err := requireEnv("ANTHROPIC_API_KEY")
+	if err != nil {
+		return "", TokenUsage{}, err
+	}
+
+	request := anthropicRequest{
+		Model:     getEnv("ANTHROPIC_MODEL", defaultAnthropicModel),
+		MaxTokens: getEnvInt("ANTHROPIC_MAX_TOKENS", defaultAnthropicMaxTokens),
+		System:    system,
+		Messages:  []chatMessage{{Role: "user", Content: prompt}},
+	}
+	headers := map[string]string{
+		"x-api-key":         apiKey,
+		"anthropic-version": anthropicAPIVersion,
+	}
+
+	endpoint := strings.TrimRight(getEnv("ANTHROPIC_BASE_URL", defaultAnthropicBaseURL), "/") + "/v1/messages"
+	var message anthropicResponse
+	if err := postJSON(ctx, endpoint, headers, request, &message); err != nil {
+		return "", TokenUsage{}, fmt.Errorf("Anthropic request failed: %w", err)
+	}
+	usage := TokenUsage{InputTokens: message.Usage.InputTokens, OutputTokens: message.Usage.OutputTokens}
+	if message.StopReason == "max_tokens" {
+		return "", usage, &RetryableError{Err: fmt.Errorf("%w: Anthropic stopped at the token limit", errTruncatedOutput)}
+	}
+
+	var text strings.Builder
+	for _, block := range message.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+	if text.Len() == 0 {
+		return "", usage, fmt.Errorf("%w: Anthropic returned no text", errInvalidLlamaResponse)
+	}
+	return text.String(), usage, nil
+}
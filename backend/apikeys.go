@@ -0,0 +1,315 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// API key sources
+const (
+	KeySourceConfig = "config"
+	KeySourceAdmin  = "admin"
+)
+
+// Errors returned when revoking an API key
+var (
+	errAPIKeyNotFound   = errors.New("API key not found")
+	errConfiguredAPIKey = errors.New("keys from the configuration can't be revoked, remove them from the configuration instead")
+)
+
+// ConfigAPIKey is an API key provisioned in the config file
+type ConfigAPIKey struct {
+	Name  string `yaml:"name" toml:"name"`
+	Key   string `yaml:"key" toml:"key"`
+	Admin bool   `yaml:"admin" toml:"admin"`
+}
+
+// APIKey describes a key that may call the protected endpoints. The key itself is never
+// returned; only its hash is kept.
+type APIKey struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Admin bool   `json:"admin"`
+	// Source is KeySourceConfig for keys from the configuration or KeySourceAdmin for
+	// keys created through the admin endpoint
+	Source    string    `json:"source"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Requests counts the requests made with the key
+	Requests   int64      `json:"requests"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+}
+
+// storedAPIKey is how keys created through the admin endpoint are saved
+type storedAPIKey struct {
+	APIKey
+	Hash string `json:"hash"`
+}
+
+// CreatedAPIKey is returned once when a key is created, with the only copy of the key
+type CreatedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// APIKeyStore holds the configured keys and those created through the admin endpoint,
+// which are saved to a file along with their usage counters
+type APIKeyStore struct {
+	mu   sync.Mutex
+	path string
+	// keys maps the hash of each key to its description
+	keys map[string]*APIKey
+}
+
+var apiKeys = &APIKeyStore{keys: make(map[string]*APIKey)}
+
+// hashAPIKey returns the hex SHA-256 of the key
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// apiKeysFile is where keys created through the admin endpoint are saved, API_KEYS_FILE or
+// api-keys.json in the data directory
+func apiKeysFile() string {
+	return getEnv("API_KEYS_FILE", dataPath("api-keys.json"))
+}
+
+// Load replaces the store's keys with the configured keys, the API_KEY environment
+// variable as an admin key named "default", and the keys saved at path
+func (s *APIKeyStore) Load(configured []ConfigAPIKey, path string) error {
+	keys := make(map[string]*APIKey)
+	now := time.Now()
+	if key := getEnv("API_KEY", ""); key != "" {
+		configured = append([]ConfigAPIKey{{Name: "default", Key: key, Admin: true}}, configured...)
+	}
+	for _, entry := range configured {
+		keys[hashAPIKey(entry.Key)] = &APIKey{
+			ID:        KeySourceConfig + ":" + entry.Name,
+			Name:      entry.Name,
+			Admin:     entry.Admin,
+			Source:    KeySourceConfig,
+			CreatedAt: now,
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		var stored []storedAPIKey
+		if err := json.Unmarshal(data, &stored); err != nil {
+			return fmt.Errorf("failed to parse %s: %v", path, err)
+		}
+		for _, entry := range stored {
+			key := entry.APIKey
+			keys[entry.Hash] = &key
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.path = path
+	s.keys = keys
+	return nil
+}
+
+// Enabled reports whether any key exists. Without keys, auth is disabled.
+func (s *APIKeyStore) Enabled() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.keys) > 0
+}
+
+// Authenticate looks up the key and counts the request against it
+func (s *APIKeyStore) Authenticate(key string) (APIKey, bool) {
+	if key == "" {
+		return APIKey{}, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	found, ok := s.keys[hashAPIKey(key)]
+	if !ok {
+		return APIKey{}, false
+	}
+	now := time.Now()
+	found.Requests++
+	found.LastUsedAt = &now
+	return *found, true
+}
+
+// List returns the keys, oldest first
+func (s *APIKeyStore) List() []APIKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]APIKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, *key)
+	}
+	slices.SortFunc(keys, func(a, b APIKey) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	return keys
+}
+
+// Create generates a new key and saves it
+func (s *APIKeyStore) Create(name string, admin bool) (CreatedAPIKey, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return CreatedAPIKey{}, err
+	}
+	key := "bg_" + base64.RawURLEncoding.EncodeToString(secret)
+
+	created := APIKey{
+		ID:        uuid.New().String(),
+		Name:      name,
+		Admin:     admin,
+		Source:    KeySourceAdmin,
+		CreatedAt: time.Now(),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hash := hashAPIKey(key)
+	s.keys[hash] = &created
+	if err := s.save(); err != nil {
+		delete(s.keys, hash)
+		return CreatedAPIKey{}, err
+	}
+	return CreatedAPIKey{APIKey: created, Key: key}, nil
+}
+
+// Revoke deletes a key created through the admin endpoint
+func (s *APIKeyStore) Revoke(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hash, key := range s.keys {
+		if key.ID != id {
+			continue
+		}
+		if key.Source == KeySourceConfig {
+			return errConfiguredAPIKey
+		}
+		delete(s.keys, hash)
+		return s.save()
+	}
+	return errAPIKeyNotFound
+}
+
+// Save writes the keys created through the admin endpoint, with their usage counters
+func (s *APIKeyStore) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.save()
+}
+
+// save writes the store's file. The caller must hold s.mu.
+func (s *APIKeyStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	stored := []storedAPIKey{}
+	for hash, key := range s.keys {
+		if key.Source == KeySourceAdmin {
+			stored = append(stored, storedAPIKey{APIKey: *key, Hash: hash})
+		}
+	}
+	slices.SortFunc(stored, func(a, b storedAPIKey) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	if len(stored) == 0 {
+		err := os.Remove(s.path)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(s.path), 0755)
+	if err != nil {
+		return err
+	}
+	// The file only holds hashes, but keep it private like a credentials file
+	return os.WriteFile(s.path, data, 0600)
+}
+
+func listAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(apiKeys.List())
+}
+
+func createAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var reqBody struct {
+		Name  string `json:"name"`
+		Admin bool   `json:"admin"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&reqBody); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	reqBody.Name = strings.TrimSpace(reqBody.Name)
+	if reqBody.Name == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+
+	created, err := apiKeys.Create(reqBody.Name, reqBody.Admin)
+	if err != nil {
+		http.Error(w, "Failed to create API key: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Created API key %s (%s)", created.ID, created.Name)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+func deleteAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	err := apiKeys.Revoke(id)
+	switch {
+	case errors.Is(err, errAPIKeyNotFound):
+		http.Error(w, "API key not found", http.StatusNotFound)
+		return
+	case errors.Is(err, errConfiguredAPIKey):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, "Failed to revoke API key: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Revoked API key %s", id)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// publicPaths stay reachable without an API key even when reads are protected.
+// The image proxy is included because browsers load it from <img> tags without headers,
+// as are the stored images under publicPathPrefixes, the feeds because feed readers
+// can't send keys, and the sitemaps for search engine crawlers.
+var publicPaths = map[string]bool{
+	"/healthz":         true,
+	"/api/healthz":     true,
+	"/api/readyz":      true,
+	"/api/version":     true,
+	"/api/proxy-image": true,
+	"/api/feed.xml":    true,
+	"/feed.xml":        true,
+	"/feed.atom":       true,
+	"/feed.json":       true,
+	"/sitemap.xml":     true,
+}
+
+// publicPathPrefixes are path prefixes that are public like publicPaths
+var publicPathPrefixes = []string{"/api/images/", "/sitemap-"}
+
+// isPublicPath reports whether the path is reachable without credentials
+func isPublicPath(path string) bool {
+	if publicPaths[path] {
+		return true
+	}
+	for _, prefix := range publicPathPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// accountPaths are the POST endpoints that log users in, reachable without credentials.
+// Registration checks who may create an account itself, see registrationRole.
+var accountPaths = map[string]bool{
+	"/api/auth/register": true,
+	"/api/auth/login":    true,
+}
+
+// generatingReadPaths are GET endpoints that start a generation, so they need the API key
+// like mutating requests do
+var generatingReadPaths = map[string]bool{
+	"/api/generate-blog/stream": true,
+}
+
+// requiresAuth reports whether the request must carry an API key or login token. Mutating
+// requests other than logging in always do; reads only when API_KEY_PROTECT_READS=true.
+func requiresAuth(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		if generatingReadPaths[r.URL.Path] {
+			return r.Method == http.MethodGet
+		}
+		return !isPublicPath(r.URL.Path) && getEnvBool("API_KEY_PROTECT_READS", false)
+	default:
+		return !accountPaths[r.URL.Path]
+	}
+}
+
+// providedCredential returns the API key or login token sent as "Authorization: Bearer <token>"
+// or "X-API-Key: <key>"
+func providedCredential(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return r.Header.Get("X-API-Key")
+}
+
+// Principal identifies who made a request: a logged-in user, an API key, or neither
+type Principal struct {
+	User   *User
+	APIKey *APIKey
+}
+
+type principalContextKey struct{}
+
+// requestPrincipal returns who made the request, as identified by authMiddleware
+func requestPrincipal(r *http.Request) Principal {
+	principal, _ := r.Context().Value(principalContextKey{}).(Principal)
+	return principal
+}
+
+// requestUser returns the logged-in user who made the request
+func requestUser(r *http.Request) (User, bool) {
+	if user := requestPrincipal(r).User; user != nil {
+		return *user, true
+	}
+	return User{}, false
+}
+
+// authEnabled reports whether credentials are enforced, which is once any API key or
+// user account exists
+func authEnabled() bool {
+	return apiKeys.Enabled() || users.Enabled()
+}
+
+// authMiddleware identifies the request's user from a login token, or its API key,
+// counting the request against the key, and rejects requests that need credentials but
+// carry no valid ones. Routes check the caller's role with requireRole. While no keys or
+// accounts exist requests are let through so local development keeps working.
+func authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var principal Principal
+		if credential := providedCredential(r); credential != "" {
+			if user, ok := userFromToken(credential); ok {
+				principal.User = &user
+			} else if key, ok := apiKeys.Authenticate(credential); ok {
+				principal.APIKey = &key
+			}
+		}
+		r = r.WithContext(context.WithValue(r.Context(), principalContextKey{}, principal))
+
+		if !authEnabled() || !requiresAuth(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if principal.User == nil && principal.APIKey == nil {
+			writeJSONError(w, http.StatusUnauthorized, "invalid or missing API key or login token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// errNotBlogOwner is returned when a user tries to change another user's blog
+var errNotBlogOwner = errors.New("only the blog's owner can change it")
+
+// canManageBlog reports whether the request may change or delete the blog. Admins may
+// manage every blog, logged-in editors only their own, and other API keys the blogs
+// without an owner, which were generated with keys.
+func canManageBlog(r *http.Request, blog BlogPost) bool {
+	return canManageOwnedBy(r, blog.OwnerID)
+}
+
+// canManageOwnedBy reports whether the request may manage something owned by ownerID,
+// following the same rules as canManageBlog
+func canManageOwnedBy(r *http.Request, ownerID string) bool {
+	if !authEnabled() {
+		return true
+	}
+	principal := requestPrincipal(r)
+	switch {
+	case principal.Role() == RoleAdmin:
+		return true
+	case principal.User != nil:
+		return ownerID == principal.User.ID
+	default:
+		return ownerID == ""
+	}
+}
+
+// writeJSONError responds with {"error": message} and the given status
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
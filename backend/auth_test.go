@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		key          string
+		protectReads string
+		wantStatus   int
+	}{
+		{"POST without a key", http.MethodPost, "/api/generate-blog", "", "", http.StatusUnauthorized},
+		{"POST with a bad key", http.MethodPost, "/api/generate-blog", "wrong", "", http.StatusUnauthorized},
+		{"POST with a good key", http.MethodPost, "/api/generate-blog", "secret", "", http.StatusOK},
+		{"DELETE without a key", http.MethodDelete, "/api/blogs/1", "", "", http.StatusUnauthorized},
+		{"login without a key", http.MethodPost, "/api/auth/login", "", "", http.StatusOK},
+		{"GET without a key", http.MethodGet, "/api/blogs", "", "", http.StatusOK},
+		{"generating GET without a key", http.MethodGet, "/api/generate-blog/stream", "", "", http.StatusUnauthorized},
+		{"generating GET with a good key", http.MethodGet, "/api/generate-blog/stream", "secret", "", http.StatusOK},
+		{"protected GET without a key", http.MethodGet, "/api/blogs", "", "true", http.StatusUnauthorized},
+		{"protected GET with a bad key", http.MethodGet, "/api/blogs", "wrong", "true", http.StatusUnauthorized},
+		{"protected GET with a good key", http.MethodGet, "/api/blogs", "secret", "true", http.StatusOK},
+		{"health check with protected reads", http.MethodGet, "/api/healthz", "", "true", http.StatusOK},
+		{"feed with protected reads", http.MethodGet, "/feed.xml", "", "true", http.StatusOK},
+		{"stored image with protected reads", http.MethodGet, "/api/images/photo.jpg", "", "true", http.StatusOK},
+		{"sitemap with protected reads", http.MethodGet, "/sitemap-1.xml", "", "true", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useAuthStores(t, ConfigAPIKey{Name: "ci", Key: "secret"})
+			t.Setenv("API_KEY_PROTECT_READS", tt.protectReads)
+
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.key != "" {
+				req.Header.Set("X-API-Key", tt.key)
+			}
+			rec := httptest.NewRecorder()
+			authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})).ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestAuthMiddlewareBearerToken(t *testing.T) {
+	useAuthStores(t, ConfigAPIKey{Name: "ci", Key: "secret"})
+
+	var principal Principal
+	handler := authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal = requestPrincipal(r)
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/api/generate-blog", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, want %d", rec.Code, http.StatusOK)
+	}
+	if principal.APIKey == nil || principal.APIKey.Name != "ci" {
+		t.Errorf("principal = %+v, want the ci key", principal)
+	}
+}
+
+func TestAuthMiddlewareWithoutKeys(t *testing.T) {
+	useAuthStores(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/generate-blog", nil)
+	rec := httptest.NewRecorder()
+	authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("status %d without any keys, want %d", rec.Code, http.StatusOK)
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// maxBatchTopics bounds how many topics one batch may generate
+const maxBatchTopics = 50
+
+// Batch statuses: queued until one of its jobs starts, running until all are done, have
+// failed or were cancelled, then done
+const (
+	BatchQueued  = "queued"
+	BatchRunning = "running"
+	BatchDone    = "done"
+)
+
+// Batch groups the generation jobs queued by one POST /api/generate-blogs
+type Batch struct {
+	ID        string
+	Items     []BatchItem
+	CreatedAt time.Time
+}
+
+// BatchItem is one topic of a batch and the job generating it. Topics that couldn't be
+// queued have no job and an error.
+type BatchItem struct {
+	Topic  string `json:"topic"`
+	JobID  string `json:"jobId,omitempty"`
+	Status string `json:"status"`
+	BlogID string `json:"blogId,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// BatchStatus reports the progress of a batch's jobs
+type BatchStatus struct {
+	ID        string      `json:"batchId"`
+	Status    string      `json:"status"`
+	Total     int         `json:"total"`
+	Queued    int         `json:"queued"`
+	Running   int         `json:"running"`
+	Done      int         `json:"done"`
+	Failed    int         `json:"failed"`
+	Cancelled int         `json:"cancelled"`
+	Items     []BatchItem `json:"items"`
+	// CreatedAt is when the batch was submitted
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// BatchStore holds the batches in memory for as long as their jobs are kept
+type BatchStore struct {
+	mu      sync.Mutex
+	batches map[string]*Batch
+}
+
+var batches = &BatchStore{batches: make(map[string]*Batch)}
+
+// Submit queues a generation job with the options for each topic and records them as a
+// batch. Topics the queue has no room for are recorded as failed.
+func (s *BatchStore) Submit(topics []string, ownerID string, opts GenerationOptions) BatchStatus {
+	batch := &Batch{
+		ID:        uuid.New().String(),
+		CreatedAt: time.Now(),
+	}
+	for _, topic := range topics {
+		item := BatchItem{Topic: topic}
+		job, err := jobManager.Submit(topic, ownerID, opts)
+		if err != nil {
+			item.Status = JobFailed
+			item.Error = err.Error()
+		} else {
+			item.JobID = job.ID
+			item.Status = job.Status
+		}
+		batch.Items = append(batch.Items, item)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune()
+	s.batches[batch.ID] = batch
+	return s.status(batch)
+}
+
+// Get returns the progress of the batch
+func (s *BatchStore) Get(id string) (BatchStatus, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	batch, ok := s.batches[id]
+	if !ok {
+		return BatchStatus{}, false
+	}
+	return s.status(batch), true
+}
+
+// status reports the batch's progress from its jobs. The caller must hold s.mu.
+func (s *BatchStore) status(batch *Batch) BatchStatus {
+	status := BatchStatus{
+		ID:        batch.ID,
+		Total:     len(batch.Items),
+		Items:     make([]BatchItem, 0, len(batch.Items)),
+		CreatedAt: batch.CreatedAt,
+	}
+	for _, item := range batch.Items {
+		if job, ok := jobManager.Get(item.JobID); ok {
+			item.Status = job.Status
+			item.BlogID = job.BlogID
+			item.Error = job.Error
+		}
+		switch item.Status {
+		case JobQueued:
+			status.Queued++
+		case JobDone:
+			status.Done++
+		case JobFailed:
+			status.Failed++
+		case JobCancelled:
+			status.Cancelled++
+		default:
+			status.Running++
+		}
+		status.Items = append(status.Items, item)
+	}
+
+	switch {
+	case status.Done+status.Failed+status.Cancelled == status.Total:
+		status.Status = BatchDone
+	case status.Queued+status.Failed+status.Cancelled == status.Total:
+		status.Status = BatchQueued
+	default:
+		status.Status = BatchRunning
+	}
+	return status
+}
+
+// prune drops the batches none of whose jobs are kept anymore. The caller must hold s.mu.
+func (s *BatchStore) prune() {
+	for id, batch := range s.batches {
+		kept := false
+		for _, item := range batch.Items {
+			if _, ok := jobManager.Get(item.JobID); ok {
+				kept = true
+				break
+			}
+		}
+		if !kept {
+			delete(s.batches, id)
+		}
+	}
+}
+
+// generateBlogsHandler queues one generation job per topic of {"topics": [...]}, with the
+// generation options given next to them, returning the batch's status with 202
+func generateBlogsHandler(w http.ResponseWriter, r *http.Request) {
+	var reqBody struct {
+		Topics []string `json:"topics"`
+		GenerationOptions
+	}
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var topics []string
+	for _, topic := range reqBody.Topics {
+		if topic = strings.TrimSpace(topic); topic != "" {
+			topics = append(topics, topic)
+		}
+	}
+	if len(topics) == 0 {
+		http.Error(w, "At least one topic is required", http.StatusBadRequest)
+		return
+	}
+	if len(topics) > maxBatchTopics {
+		http.Error(w, fmt.Sprintf("A batch can have at most %d topics", maxBatchTopics), http.StatusBadRequest)
+		return
+	}
+	if err := reqBody.GenerationOptions.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Each topic is a generation, charged like a single one
+	if !generationLimiters.Allow(w, r, len(topics)) {
+		return
+	}
+
+	user, _ := requestUser(r)
+	status := batches.Submit(topics, user.ID, reqBody.GenerationOptions)
+	if status.Failed == status.Total {
+		http.Error(w, "Failed to queue generation: "+status.Items[0].Error, http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/batches/"+status.ID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(status)
+}
+
+func getBatchHandler(w http.ResponseWriter, r *http.Request) {
+	status, ok := batches.Get(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Batch not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
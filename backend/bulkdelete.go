@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// BulkDeleteFilter selects the blogs to delete. At least one field must be set.
+type BulkDeleteFilter struct {
+	Topic     string `json:"topic"`
+	Tag       string `json:"tag"`
+	Status    string `json:"status"`
+	OlderThan string `json:"olderThan"`
+}
+
+// BulkDeleteResponse reports which blogs were (or would be) deleted, including the
+// translations deleted along with matching blogs
+type BulkDeleteResponse struct {
+	Count  int      `json:"count"`
+	IDs    []string `json:"ids"`
+	DryRun bool     `json:"dryRun"`
+}
+
+// matches reports whether the blog satisfies every set field of the filter
+func (f BulkDeleteFilter) matches(blog BlogPost, olderThan time.Time) bool {
+	if f.Topic != "" && !strings.EqualFold(blog.Topic, f.Topic) {
+		return false
+	}
+	if f.Tag != "" && !hasTag(blog, f.Tag) {
+		return false
+	}
+	if f.Status != "" && blogStatus(blog) != f.Status {
+		return false
+	}
+	if !olderThan.IsZero() {
+		date, err := time.Parse("2006-01-02", blog.Date)
+		if err != nil || !date.Before(olderThan) {
+			return false
+		}
+	}
+	return true
+}
+
+// deletedWithBlog returns the IDs of the blogs deleting the blog removes: the blog itself
+// and its translations, as deleteBlogPost deletes them
+func deletedWithBlog(blog BlogPost, byID map[string]BlogPost) []string {
+	ids := []string{blog.ID}
+	for _, translationID := range slices.Sorted(maps.Values(blog.Translations)) {
+		if translation, ok := byID[translationID]; ok && translationID != blog.ID {
+			ids = append(ids, deletedWithBlog(translation, byID)...)
+		}
+	}
+	return ids
+}
+
+// hasTag reports whether the blog has the tag, ignoring case
+func hasTag(blog BlogPost, tag string) bool {
+	for _, t := range blog.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+func bulkDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	var filter BulkDeleteFilter
+	err := json.NewDecoder(r.Body).Decode(&filter)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if filter.Topic == "" && filter.Tag == "" && filter.Status == "" && filter.OlderThan == "" {
+		http.Error(w, "At least one filter is required", http.StatusBadRequest)
+		return
+	}
+
+	var olderThan time.Time
+	if filter.OlderThan != "" {
+		olderThan, err = time.Parse("2006-01-02", filter.OlderThan)
+		if err != nil {
+			http.Error(w, "olderThan must be a YYYY-MM-DD date", http.StatusBadRequest)
+			return
+		}
+	}
+
+	dryRun := r.URL.Query().Get("dryRun") == "true"
+
+	// Hold the storage lock for the whole operation so blogs saved by concurrent
+	// generations are either fully considered or not at all
+	blogStorageMu.Lock()
+	defer blogStorageMu.Unlock()
+
+	blogs, err := getAllBlogs()
+	if err != nil {
+		http.Error(w, "Failed to retrieve blogs: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	byID := make(map[string]BlogPost, len(blogs))
+	for _, blog := range blogs {
+		byID[blog.ID] = blog
+	}
+
+	response := BulkDeleteResponse{IDs: []string{}, DryRun: dryRun}
+	deleted := make(map[string]bool)
+	for _, blog := range blogs {
+		// Logged-in users only delete their own blogs. Translations of a blog deleted
+		// earlier in the loop are already gone.
+		if deleted[blog.ID] || !filter.matches(blog, olderThan) || !canManageBlog(r, blog) {
+			continue
+		}
+		if !dryRun {
+			err = deleteBlogPost(blog.ID)
+			if err != nil && !errors.Is(err, errBlogNotFound) {
+				http.Error(w, "Failed to delete blog "+blog.ID+": "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		for _, id := range deletedWithBlog(blog, byID) {
+			if !deleted[id] {
+				deleted[id] = true
+				response.IDs = append(response.IDs, id)
+			}
+		}
+	}
+	response.Count = len(response.IDs)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
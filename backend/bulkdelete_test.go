@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// bulkDelete posts the filter to the bulk delete endpoint, returning the response
+func bulkDelete(t *testing.T, r *http.Request) (*httptest.ResponseRecorder, BulkDeleteResponse) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	bulkDeleteHandler(rec, r)
+	var response BulkDeleteResponse
+	if rec.Code == http.StatusOK {
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rec, response
+}
+
+func TestBulkDeleteTranslations(t *testing.T) {
+	const originalID, translationID = "00000000-0000-4000-8000-000000000001", "00000000-0000-4000-8000-000000000002"
+	for _, tc := range []struct {
+		name   string
+		filter string
+	}{
+		// The translation matches the filter too and is listed after its original
+		{"both match", `{"topic": "solar power"}`},
+		// Only the original matches, yet its translation is deleted with it
+		{"original matches", `{"tag": "energy"}`},
+	} {
+		for _, dryRun := range []bool{true, false} {
+			useImageURLStore(t, "https://blog.example.com")
+			useAuthStores(t)
+			original := BlogPost{ID: originalID, Topic: "Solar power", Date: "2024-05-01", Status: StatusDraft,
+				Tags: []string{"Energy"}, Translations: map[string]string{"de": translationID}}
+			translation := BlogPost{ID: translationID, Topic: "Solar power", Date: "2024-05-01", Status: StatusDraft,
+				TranslationOf: originalID, GenerationOptions: GenerationOptions{Language: "de"}}
+			for _, blog := range []BlogPost{original, translation} {
+				if err := saveBlogPost(blog); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			target := "/api/blogs/bulk-delete"
+			if dryRun {
+				target += "?dryRun=true"
+			}
+			rec, response := bulkDelete(t, httptest.NewRequest("POST", target, strings.NewReader(tc.filter)))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("%s, dry run %v: status %d: %s", tc.name, dryRun, rec.Code, rec.Body)
+			}
+			if want := []string{originalID, translationID}; !slices.Equal(response.IDs, want) || response.Count != 2 {
+				t.Errorf("%s, dry run %v: deleted %v (count %d), want %v", tc.name, dryRun, response.IDs, response.Count, want)
+			}
+			for _, id := range []string{originalID, translationID} {
+				if _, err := getBlogByID(id); (err == nil) != dryRun {
+					t.Errorf("%s, dry run %v: blog %s still stored: %v", tc.name, dryRun, id, err == nil)
+				}
+			}
+		}
+	}
+}
+
+func TestBulkDelete(t *testing.T) {
+	const aliceOld, aliceNew, bob = "00000000-0000-4000-8000-00000000000a", "00000000-0000-4000-8000-00000000000b", "00000000-0000-4000-8000-00000000000c"
+	alice := User{ID: "alice", Role: RoleEditor}
+
+	tests := []struct {
+		name       string
+		target     string
+		filter     string
+		wantStatus int
+		wantIDs    []string
+		wantKept   []string
+	}{
+		{"no filter", "/api/blogs/bulk-delete", `{}`, http.StatusBadRequest, nil, []string{aliceOld, aliceNew, bob}},
+		{"invalid date", "/api/blogs/bulk-delete", `{"olderThan": "last week"}`, http.StatusBadRequest, nil, []string{aliceOld, aliceNew, bob}},
+		{"dry run", "/api/blogs/bulk-delete?dryRun=true", `{"tag": "solar"}`, http.StatusOK, []string{aliceNew, aliceOld}, []string{aliceOld, aliceNew, bob}},
+		// Bob's blog matches the filter but isn't Alice's to delete
+		{"own blogs only", "/api/blogs/bulk-delete", `{"tag": "solar"}`, http.StatusOK, []string{aliceNew, aliceOld}, []string{bob}},
+		{"older than", "/api/blogs/bulk-delete", `{"olderThan": "2024-03-01", "status": "draft"}`, http.StatusOK, []string{aliceOld}, []string{aliceNew, bob}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useImageURLStore(t, "https://blog.example.com")
+			useAuthStores(t, ConfigAPIKey{Name: "ci", Key: "ci-key"})
+			for _, blog := range []BlogPost{
+				{ID: aliceOld, OwnerID: "alice", Topic: "Solar", Date: "2024-01-01", Status: StatusDraft, Tags: []string{"Solar"}},
+				{ID: aliceNew, OwnerID: "alice", Topic: "Solar", Date: "2024-06-01", Status: StatusDraft, Tags: []string{"solar"}},
+				{ID: bob, OwnerID: "bob", Topic: "Solar", Date: "2024-01-01", Status: StatusDraft, Tags: []string{"solar"}},
+			} {
+				if err := saveBlogPost(blog); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			rec, response := bulkDelete(t, withUser(httptest.NewRequest("POST", tt.target, strings.NewReader(tt.filter)), alice))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if rec.Code == http.StatusOK && (!slices.Equal(response.IDs, tt.wantIDs) || response.Count != len(tt.wantIDs)) {
+				t.Errorf("deleted %v (count %d), want %v", response.IDs, response.Count, tt.wantIDs)
+			}
+			for _, id := range tt.wantKept {
+				if _, err := getBlogByID(id); err != nil {
+					t.Errorf("blog %s was deleted: %v", id, err)
+				}
+			}
+			for _, id := range response.IDs {
+				if _, err := getBlogByID(id); !response.DryRun && err == nil {
+					t.Errorf("blog %s is still stored", id)
+				}
+			}
+		})
+	}
+}
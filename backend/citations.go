@@ -0,0 +1,61 @@
+package main
+
+import (
+	"slices"
+	"strings"
+)
+
+// citationKey returns the form of a source URL citations are matched by, ignoring
+// surrounding space and a trailing slash
+func citationKey(raw string) string {
+	return strings.TrimSuffix(strings.TrimSpace(raw), "/")
+}
+
+// attributeSources resolves the sources cited by the content's paragraphs against the
+// blog's sources, replacing each citation with the URL and title of the source it names.
+// Citations of articles the blog wasn't written from, which the model made up or which
+// are simulated sources left out of the blog, are dropped, as are citations on other
+// block types.
+func attributeSources(content []BlogContent, sources []BlogSource) {
+	known := make(map[string]BlogSource, len(sources))
+	for _, source := range sources {
+		known[citationKey(source.URL)] = BlogSource{URL: source.URL, Title: source.Title}
+	}
+
+	for i, block := range content {
+		if block.Type != "paragraph" {
+			content[i].Sources = nil
+			continue
+		}
+		var cited []BlogSource
+		for _, citation := range block.Sources {
+			source, ok := known[citationKey(citation.URL)]
+			if ok && !slices.Contains(cited, source) {
+				cited = append(cited, source)
+			}
+		}
+		content[i].Sources = cited
+	}
+}
+
+// exportCitation is a paragraph's citation numbered by the position of its source in the
+// blog's sources, counting from 1
+type exportCitation struct {
+	Number int
+	BlogSource
+}
+
+// blockCitations numbers the block's citations of the blog's sources, leaving out those
+// that aren't among them
+func blockCitations(block BlogContent, sources []BlogSource) []exportCitation {
+	var citations []exportCitation
+	for _, cited := range block.Sources {
+		i := slices.IndexFunc(sources, func(source BlogSource) bool {
+			return citationKey(source.URL) == citationKey(cited.URL)
+		})
+		if i >= 0 {
+			citations = append(citations, exportCitation{Number: i + 1, BlogSource: sources[i]})
+		}
+	}
+	return citations
+}
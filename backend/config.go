@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Server defaults, overridable in the config file, with PORT, DATA_DIR and PYTHON_SCRIPT,
+// or with flags
+const (
+	defaultPort         = 8080
+	defaultDataDir      = "./data"
+	defaultPythonScript = "llamaindex_service.py"
+)
+
+// Generation rate limit defaults. Requests made with an API key share the key's budget,
+// which is larger since keys usually belong to integrations.
+const (
+	defaultRateLimitPerMinute    = 5
+	defaultRateLimitBurst        = 2
+	defaultKeyRateLimitPerMinute = 30
+	defaultKeyRateLimitBurst     = 5
+)
+
+// Login and registration rate limit defaults, per client IP
+const (
+	defaultAuthRateLimitPerMinute = 10
+	defaultAuthRateLimitBurst     = 5
+)
+
+// Config holds the server settings. loadConfig reads them from the config file, then
+// environment variables, then command-line flags, each overriding the one before.
+type Config struct {
+	Port int `yaml:"port" toml:"port"`
+	// DataDir holds the blogs, caches and saved jobs unless their own paths are set
+	DataDir string `yaml:"dataDir" toml:"dataDir"`
+	// BaseURL is the URL clients reach this backend at
+	BaseURL string `yaml:"baseURL" toml:"baseURL"`
+	// PublicBaseURL is the public URL the blogs are served under
+	PublicBaseURL string `yaml:"publicBaseURL" toml:"publicBaseURL"`
+	// AllowedDomains replaces the scraper's built-in domain allowlist when not empty
+	AllowedDomains []string `yaml:"allowedDomains" toml:"allowedDomains"`
+	// PythonScript is the LlamaIndex script run by the python provider
+	PythonScript string `yaml:"pythonScript" toml:"pythonScript"`
+	// APIKeys are the keys allowed to call the protected endpoints, in addition to API_KEY
+	APIKeys []ConfigAPIKey `yaml:"apiKeys" toml:"apiKeys"`
+	// RateLimit limits the generation requests of each client
+	RateLimit RateLimitConfig `yaml:"rateLimit" toml:"rateLimit"`
+	// AuthRateLimit limits the login and registration requests of each client
+	AuthRateLimit AuthRateLimitConfig `yaml:"authRateLimit" toml:"authRateLimit"`
+}
+
+// RateLimitConfig sets the token buckets of the generation endpoints. Requests made with
+// an API key are limited per key, other requests per client IP.
+type RateLimitConfig struct {
+	PerMinute    int `yaml:"perMinute" toml:"perMinute"`
+	Burst        int `yaml:"burst" toml:"burst"`
+	KeyPerMinute int `yaml:"keyPerMinute" toml:"keyPerMinute"`
+	KeyBurst     int `yaml:"keyBurst" toml:"keyBurst"`
+}
+
+// AuthRateLimitConfig sets the token bucket of the login and registration endpoints, per
+// client IP
+type AuthRateLimitConfig struct {
+	PerMinute int `yaml:"perMinute" toml:"perMinute"`
+	Burst     int `yaml:"burst" toml:"burst"`
+}
+
+// defaultAuthRateLimitConfig returns the login and registration rate limit used unless
+// configured
+func defaultAuthRateLimitConfig() AuthRateLimitConfig {
+	return AuthRateLimitConfig{PerMinute: defaultAuthRateLimitPerMinute, Burst: defaultAuthRateLimitBurst}
+}
+
+// defaultRateLimitConfig returns the rate limits used unless configured
+func defaultRateLimitConfig() RateLimitConfig {
+	return RateLimitConfig{
+		PerMinute:    defaultRateLimitPerMinute,
+		Burst:        defaultRateLimitBurst,
+		KeyPerMinute: defaultKeyRateLimitPerMinute,
+		KeyBurst:     defaultKeyRateLimitBurst,
+	}
+}
+
+// appConfig is the configuration the server runs with. main replaces it with the loaded
+// configuration at startup.
+var appConfig = Config{
+	Port:          defaultPort,
+	DataDir:       defaultDataDir,
+	BaseURL:       fmt.Sprintf("http://localhost:%d", defaultPort),
+	PublicBaseURL: fmt.Sprintf("http://localhost:%d", defaultPort),
+	PythonScript:  defaultPythonScript,
+	RateLimit:     defaultRateLimitConfig(),
+	AuthRateLimit: defaultAuthRateLimitConfig(),
+}
+
+// loadConfig builds the configuration from the config file named by -config or CONFIG_FILE,
+// environment variables and the command-line args, and validates it
+func loadConfig(args []string) (Config, error) {
+	flags := flag.NewFlagSet("blog-generator", flag.ContinueOnError)
+	configFile := flags.String("config", getEnv("CONFIG_FILE", ""), "YAML (.yaml, .yml) or TOML (.toml) config file")
+	port := flags.Int("port", 0, "port to listen on")
+	dataDir := flags.String("data-dir", "", "directory for blogs, caches and saved jobs")
+	baseURL := flags.String("base-url", "", "URL clients reach the backend at")
+	publicBaseURL := flags.String("public-base-url", "", "public URL blogs are served under")
+	allowedDomains := flags.String("allowed-domains", "", "comma-separated domains the scraper may visit")
+	pythonScript := flags.String("python-script", "", "path of the LlamaIndex script")
+	rateLimit := flags.Int("rate-limit", 0, "generation requests per minute per client IP")
+	keyRateLimit := flags.Int("key-rate-limit", 0, "generation requests per minute per API key")
+	if err := flags.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	config := Config{
+		Port:          defaultPort,
+		DataDir:       defaultDataDir,
+		PythonScript:  defaultPythonScript,
+		RateLimit:     defaultRateLimitConfig(),
+		AuthRateLimit: defaultAuthRateLimitConfig(),
+	}
+	if *configFile != "" {
+		if err := readConfigFile(*configFile, &config); err != nil {
+			return Config{}, fmt.Errorf("failed to read config file %s: %w", *configFile, err)
+		}
+	}
+
+	for _, setting := range []struct {
+		name  string
+		value *int
+	}{
+		{"PORT", &config.Port},
+		{"RATE_LIMIT_PER_MINUTE", &config.RateLimit.PerMinute},
+		{"RATE_LIMIT_BURST", &config.RateLimit.Burst},
+		{"RATE_LIMIT_KEY_PER_MINUTE", &config.RateLimit.KeyPerMinute},
+		{"RATE_LIMIT_KEY_BURST", &config.RateLimit.KeyBurst},
+		{"AUTH_RATE_LIMIT_PER_MINUTE", &config.AuthRateLimit.PerMinute},
+		{"AUTH_RATE_LIMIT_BURST", &config.AuthRateLimit.Burst},
+	} {
+		if raw := getEnv(setting.name, ""); raw != "" {
+			value, err := strconv.Atoi(raw)
+			if err != nil {
+				return Config{}, fmt.Errorf("invalid %s=%q: %v", setting.name, raw, err)
+			}
+			*setting.value = value
+		}
+	}
+	config.DataDir = getEnv("DATA_DIR", config.DataDir)
+	config.BaseURL = getEnv("BASE_URL", config.BaseURL)
+	config.PublicBaseURL = getEnv("PUBLIC_BASE_URL", config.PublicBaseURL)
+	if raw := getEnv("SCRAPE_ALLOWED_DOMAINS", ""); raw != "" {
+		config.AllowedDomains = splitList(raw)
+	}
+	config.PythonScript = getEnv("PYTHON_SCRIPT", config.PythonScript)
+
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "port":
+			config.Port = *port
+		case "data-dir":
+			config.DataDir = *dataDir
+		case "base-url":
+			config.BaseURL = *baseURL
+		case "public-base-url":
+			config.PublicBaseURL = *publicBaseURL
+		case "allowed-domains":
+			config.AllowedDomains = splitList(*allowedDomains)
+		case "python-script":
+			config.PythonScript = *pythonScript
+		case "rate-limit":
+			config.RateLimit.PerMinute = *rateLimit
+		case "key-rate-limit":
+			config.RateLimit.KeyPerMinute = *keyRateLimit
+		}
+	})
+
+	if config.BaseURL == "" {
+		config.BaseURL = fmt.Sprintf("http://localhost:%d", config.Port)
+	}
+	if config.PublicBaseURL == "" {
+		config.PublicBaseURL = config.BaseURL
+	}
+	config.BaseURL = strings.TrimRight(config.BaseURL, "/")
+	config.PublicBaseURL = strings.TrimRight(config.PublicBaseURL, "/")
+	for i, domain := range config.AllowedDomains {
+		config.AllowedDomains[i] = strings.ToLower(strings.TrimSpace(domain))
+	}
+
+	return config, config.validate()
+}
+
+// readConfigFile decodes a YAML or TOML file, chosen by its extension, into config.
+// Unknown keys are rejected so that typos don't go unnoticed.
+func readConfigFile(path string, config *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err := decoder.Decode(config)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		return err
+	case ".toml":
+		meta, err := toml.Decode(string(data), config)
+		if err != nil {
+			return err
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("unknown keys %v", undecoded)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported format %q, use .yaml, .yml or .toml", filepath.Ext(path))
+	}
+}
+
+// validate reports every invalid setting
+func (c Config) validate() error {
+	var errs []error
+	if c.Port < 1 || c.Port > 65535 {
+		errs = append(errs, fmt.Errorf("port %d is outside 1-65535", c.Port))
+	}
+	if c.DataDir == "" {
+		errs = append(errs, errors.New("dataDir is empty"))
+	}
+	for _, setting := range []struct{ name, value string }{{"baseURL", c.BaseURL}, {"publicBaseURL", c.PublicBaseURL}} {
+		u, err := url.Parse(setting.value)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("%s %q is not an absolute http(s) URL", setting.name, setting.value))
+		}
+	}
+	for _, domain := range c.AllowedDomains {
+		if domain == "" || strings.ContainsAny(domain, "/: ") {
+			errs = append(errs, fmt.Errorf("allowedDomains entry %q is not a domain name", domain))
+		}
+	}
+	if c.PythonScript == "" {
+		errs = append(errs, errors.New("pythonScript is empty"))
+	}
+	for _, setting := range []struct {
+		name  string
+		value int
+	}{
+		{"rateLimit.perMinute", c.RateLimit.PerMinute},
+		{"rateLimit.burst", c.RateLimit.Burst},
+		{"rateLimit.keyPerMinute", c.RateLimit.KeyPerMinute},
+		{"rateLimit.keyBurst", c.RateLimit.KeyBurst},
+		{"authRateLimit.perMinute", c.AuthRateLimit.PerMinute},
+		{"authRateLimit.burst", c.AuthRateLimit.Burst},
+	} {
+		if setting.value < 1 {
+			errs = append(errs, fmt.Errorf("%s must be at least 1, got %d", setting.name, setting.value))
+		}
+	}
+	names := make(map[string]bool)
+	for i, key := range c.APIKeys {
+		switch {
+		case key.Name == "" || key.Key == "":
+			errs = append(errs, fmt.Errorf("apiKeys entry %d needs a name and a key", i))
+		case names[key.Name]:
+			errs = append(errs, fmt.Errorf("apiKeys name %q is used twice", key.Name))
+		}
+		names[key.Name] = true
+	}
+	return errors.Join(errs...)
+}
+
+// dataPath returns the path of name inside the data directory
+func dataPath(name string) string {
+	return filepath.Join(appConfig.DataDir, name)
+}
+
+// getEnv returns the value of the environment variable or the fallback if unset
+func getEnv(key, fallback string) string {
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// getEnvInt parses the environment variable as an int, returning the fallback if unset or invalid
+func getEnvInt(key string, fallback int) int {
+	raw := getEnv(key, "")
+	if raw == "" {
+		return fallback
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		log.Printf("Ignoring invalid %s=%q: %v", key, raw, err)
+		return fallback
+	}
+	return value
+}
+
+// getEnvBool parses the environment variable as a bool, returning the fallback if unset or invalid
+func getEnvBool(key string, fallback bool) bool {
+	raw := getEnv(key, "")
+	if raw == "" {
+		return fallback
+	}
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		log.Printf("Ignoring invalid %s=%q: %v", key, raw, err)
+		return fallback
+	}
+	return value
+}
+
+// getEnvDuration parses the environment variable as a duration like "90s" or "2h",
+// returning the fallback if unset or invalid
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	raw := getEnv(key, "")
+	if raw == "" {
+		return fallback
+	}
+	value, err := time.ParseDuration(raw)
+	if err != nil {
+		log.Printf("Ignoring invalid %s=%q: %v", key, raw, err)
+		return fallback
+	}
+	return value
+}
+
+// getEnvFloat parses the environment variable as a float, reporting whether it was set and valid
+func getEnvFloat(key string) (float64, bool) {
+	raw := getEnv(key, "")
+	if raw == "" {
+		return 0, false
+	}
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		log.Printf("Ignoring invalid %s=%q: %v", key, raw, err)
+		return 0, false
+	}
+	return value, true
+}
+
+// backendBaseURL returns the URL clients reach this backend at, without a trailing slash
+func backendBaseURL() string {
+	return appConfig.BaseURL
+}
+
+// publicBaseURL returns the public URL the blogs are served under, without a trailing slash.
+// It defaults to the backend's base URL.
+func publicBaseURL() string {
+	return appConfig.PublicBaseURL
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// defaultContentCacheTTL is how long a cached generation is reused for identical sources
+const defaultContentCacheTTL = 24 * time.Hour
+
+// ContentCacheEntry represents a generation cached under the hash of its source set
+type ContentCacheEntry struct {
+	Hash      string             `json:"hash"`
+	CreatedAt time.Time          `json:"createdAt"`
+	Response  LlamaIndexResponse `json:"response"`
+}
+
+// ContentCache reuses LlamaIndex responses for identical source sets
+type ContentCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]ContentCacheEntry
+	flight  singleflight.Group
+}
+
+var contentCache = &ContentCache{
+	entries: make(map[string]ContentCacheEntry),
+}
+
+// contentCacheDir is the directory cached generations are stored in
+func contentCacheDir() string {
+	return dataPath("content-cache")
+}
+
+// contentCacheEnabled reports whether CONTENT_CACHE=true
+func contentCacheEnabled() bool {
+	return getEnvBool("CONTENT_CACHE", false)
+}
+
+// hashSources returns a stable hash of the ordered source set passed to the LLM and the
+// options steering it. Requests without options hash the sources alone.
+func hashSources(contents []ScrapedContent, opts GenerationOptions) string {
+	h := sha256.New()
+	if options, _ := json.Marshal(opts); string(options) != "{}" {
+		h.Write(options)
+		h.Write([]byte{0})
+	}
+	for _, content := range contents {
+		h.Write([]byte(content.URL))
+		h.Write([]byte{0})
+		h.Write([]byte(content.Title))
+		h.Write([]byte{0})
+		h.Write([]byte(content.Text))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Get returns the cached response for hash if present and within the TTL
+func (c *ContentCache) Get(hash string) (LlamaIndexResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[hash]
+	if !ok {
+		data, err := os.ReadFile(filepath.Join(contentCacheDir(), hash+".json"))
+		if err != nil || json.Unmarshal(data, &entry) != nil {
+			return LlamaIndexResponse{}, false
+		}
+		c.entries[hash] = entry
+	}
+
+	if time.Since(entry.CreatedAt) > c.ttl {
+		delete(c.entries, hash)
+		os.Remove(filepath.Join(contentCacheDir(), hash+".json"))
+		return LlamaIndexResponse{}, false
+	}
+	return entry.Response, true
+}
+
+// Put stores the response under hash in memory and on disk
+func (c *ContentCache) Put(hash string, response LlamaIndexResponse) {
+	entry := ContentCacheEntry{Hash: hash, CreatedAt: time.Now(), Response: response}
+
+	c.mu.Lock()
+	c.entries[hash] = entry
+	c.mu.Unlock()
+
+	err := os.MkdirAll(contentCacheDir(), 0755)
+	if err == nil {
+		var data []byte
+		data, err = json.Marshal(entry)
+		if err == nil {
+			err = os.WriteFile(filepath.Join(contentCacheDir(), hash+".json"), data, 0644)
+		}
+	}
+	if err != nil {
+		log.Printf("Failed to persist content cache entry %s: %v", hash, err)
+	}
+}
+
+// generateWithContentCache returns a cached generation for an identical source set and
+// options, otherwise runs generate once per distinct request even when requested
+// concurrently. The shared generation runs on a context detached from the callers', bounded
+// by GENERATION_TIMEOUT, so one caller giving up doesn't fail the others; each caller
+// stops waiting when its own ctx is done, and the generation still finishes and is cached.
+func generateWithContentCache(ctx context.Context, request LlamaIndexRequest, generate func(ctx context.Context) (LlamaIndexResponse, error)) (LlamaIndexResponse, error) {
+	if !contentCacheEnabled() {
+		return generate(ctx)
+	}
+
+	contentCache.mu.Lock()
+	contentCache.ttl = getEnvDuration("CONTENT_CACHE_TTL", defaultContentCacheTTL)
+	contentCache.mu.Unlock()
+
+	hash := hashSources(request.Contents, request.GenerationOptions)
+	if response, ok := contentCache.Get(hash); ok {
+		log.Printf("Content cache hit for source set %s", hash[:12])
+		return response, nil
+	}
+
+	results := contentCache.flight.DoChan(hash, func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), getEnvDuration("GENERATION_TIMEOUT", defaultGenerationTimeout))
+		defer cancel()
+		response, err := generate(ctx)
+		if err != nil {
+			return response, err
+		}
+		contentCache.Put(hash, response)
+		return response, nil
+	})
+	select {
+	case result := <-results:
+		return result.Val.(LlamaIndexResponse), result.Err
+	case <-ctx.Done():
+		return LlamaIndexResponse{}, ctx.Err()
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGenerateWithContentCacheOutlivesFirstCaller(t *testing.T) {
+	t.Setenv("CONTENT_CACHE", "true")
+	previous := appConfig.DataDir
+	appConfig.DataDir = t.TempDir()
+	t.Cleanup(func() { appConfig.DataDir = previous })
+	contentCache.mu.Lock()
+	contentCache.entries = make(map[string]ContentCacheEntry)
+	contentCache.mu.Unlock()
+
+	request := LlamaIndexRequest{Topic: "solar power", Contents: []ScrapedContent{{URL: "https://news.example.com/solar", Title: "Solar", Text: "Panels are cheap."}}}
+	started, release := make(chan struct{}), make(chan struct{})
+	var calls atomic.Int32
+	generate := func(ctx context.Context) (LlamaIndexResponse, error) {
+		calls.Add(1)
+		close(started)
+		select {
+		case <-release:
+			return LlamaIndexResponse{Title: "Solar power"}, nil
+		case <-ctx.Done():
+			return LlamaIndexResponse{}, ctx.Err()
+		}
+	}
+
+	firstCtx, cancelFirst := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := generateWithContentCache(firstCtx, request, generate)
+		first <- err
+	}()
+	<-started
+
+	type result struct {
+		response LlamaIndexResponse
+		err      error
+	}
+	second := make(chan result, 1)
+	go func() {
+		response, err := generateWithContentCache(context.Background(), request, generate)
+		second <- result{response, err}
+	}()
+
+	cancelFirst()
+	select {
+	case err := <-first:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("cancelled caller got %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("cancelled caller kept waiting for the generation")
+	}
+
+	// Let the second caller join the flight before the generation finishes
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	got := <-second
+	if got.err != nil || got.response.Title != "Solar power" {
+		t.Fatalf("second caller got %+v, %v, want the shared generation", got.response, got.err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("generate ran %d times, want 1", calls.Load())
+	}
+	if response, err := generateWithContentCache(context.Background(), request, generate); err != nil || response.Title != "Solar power" {
+		t.Errorf("cached generation = %+v, %v", response, err)
+	}
+}
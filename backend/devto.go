@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Dev.to defaults and limits. Articles take at most four tags.
+const (
+	defaultDevToAPIURL = "https://dev.to/api"
+	devToMaxTags       = 4
+)
+
+// devToPublisher publishes blogs as Dev.to articles, written as Markdown with front matter
+type devToPublisher struct {
+	api    string
+	apiKey string
+}
+
+// devToArticle is the body of Dev.to create and update article requests
+type devToArticle struct {
+	Article struct {
+		BodyMarkdown string `json:"body_markdown"`
+	} `json:"article"`
+}
+
+// devToResponse is the part of a Dev.to article response the publisher uses
+type devToResponse struct {
+	ID  int    `json:"id"`
+	URL string `json:"url"`
+}
+
+// newDevToPublisher configures the Dev.to target from DEVTO_API_KEY and DEVTO_API_URL
+func newDevToPublisher() (Publisher, error) {
+	apiKey := getEnv("DEVTO_API_KEY", "")
+	if apiKey == "" {
+		return nil, fmt.Errorf("%w: set DEVTO_API_KEY", errPublisherNotConfigured)
+	}
+	return &devToPublisher{
+		api:    strings.TrimRight(getEnv("DEVTO_API_URL", defaultDevToAPIURL), "/"),
+		apiKey: apiKey,
+	}, nil
+}
+
+// Publish creates or updates the Dev.to article. Dev.to can't take image uploads through
+// its API, so images are linked, and the blog's own URL is set as the canonical URL.
+func (p *devToPublisher) Publish(ctx context.Context, blog BlogPost, previous *Publication, opts PublishOptions) (Publication, error) {
+	var article devToArticle
+	article.Article.BodyMarkdown = devToMarkdown(blog, opts.Status == StatusPublished)
+	headers := map[string]string{"api-key": p.apiKey}
+
+	var saved devToResponse
+	var err error
+	create := previous == nil
+	if previous != nil {
+		err = publishRequest(ctx, http.MethodPut, p.api+"/articles/"+url.PathEscape(previous.RemoteID), headers, article, &saved)
+		var remoteErr *publishError
+		// The article was deleted on Dev.to, so create it again
+		create = errors.As(err, &remoteErr) && remoteErr.StatusCode == http.StatusNotFound
+	}
+	if create {
+		err = publishRequest(ctx, http.MethodPost, p.api+"/articles", headers, article, &saved)
+	}
+	if err != nil {
+		return Publication{}, err
+	}
+	return Publication{RemoteID: strconv.Itoa(saved.ID), URL: saved.URL}, nil
+}
+
+// devToMarkdown renders the blog as Markdown with the front matter Dev.to reads the
+// article's settings from
+func devToMarkdown(blog BlogPost, published bool) string {
+	var b strings.Builder
+	b.WriteString("---\n")
+	fmt.Fprintf(&b, "title: %s\n", yamlString(blog.Title))
+	fmt.Fprintf(&b, "published: %t\n", published)
+	if blog.Summary != "" {
+		fmt.Fprintf(&b, "description: %s\n", yamlString(blog.Summary))
+	}
+	if tags := devToTags(blog.Tags); len(tags) > 0 {
+		fmt.Fprintf(&b, "tags: %s\n", strings.Join(tags, ", "))
+	}
+	if blog.FeaturedImage != "" {
+		fmt.Fprintf(&b, "cover_image: %s\n", yamlString(remoteImageURL(blog.FeaturedImage)))
+	}
+	fmt.Fprintf(&b, "canonical_url: %s\n", yamlString(blogLink(blog)))
+	b.WriteString("---\n\n")
+	b.WriteString(blogContentMarkdown(blog))
+	return b.String()
+}
+
+// devToTags converts tags to the lowercase alphanumeric form Dev.to accepts, keeping the
+// first four distinct ones
+func devToTags(tags []string) []string {
+	var converted []string
+	for _, tag := range tags {
+		tag = strings.Map(func(r rune) rune {
+			if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+				return unicode.ToLower(r)
+			}
+			return -1
+		}, tag)
+		if tag == "" || slices.Contains(converted, tag) {
+			continue
+		}
+		converted = append(converted, tag)
+		if len(converted) == devToMaxTags {
+			break
+		}
+	}
+	return converted
+}
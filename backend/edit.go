@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// errInvalidUpdate is returned when a BlogUpdate can't be applied to the stored blog
+var errInvalidUpdate = errors.New("invalid update")
+
+// BlogUpdate is a partial edit of a blog. Fields left out of the request are unchanged.
+// Content replaces every block, while Blocks edits individual blocks in place.
+type BlogUpdate struct {
+	Title   *string        `json:"title"`
+	Summary *string        `json:"summary"`
+	Tags    *[]string      `json:"tags"`
+	Content *[]BlogContent `json:"content"`
+	Blocks  []BlockEdit    `json:"blocks"`
+	// CanonicalURL overrides the blog's canonical URL; an empty one restores its URL on
+	// this backend
+	CanonicalURL *string `json:"canonicalUrl"`
+}
+
+// BlockEdit replaces the content block at Index
+type BlockEdit struct {
+	Index int         `json:"index"`
+	Block BlogContent `json:"block"`
+}
+
+// validate checks the update on its own, before it is applied to a blog
+func (u BlogUpdate) validate() error {
+	if u.Title != nil && strings.TrimSpace(*u.Title) == "" {
+		return fmt.Errorf("%w: title must not be empty", errInvalidUpdate)
+	}
+	if u.Content != nil {
+		for i, block := range *u.Content {
+			if err := validateEditedBlock(block); err != nil {
+				return fmt.Errorf("%w: content block %d: %v", errInvalidUpdate, i, err)
+			}
+		}
+	}
+	for _, edit := range u.Blocks {
+		if err := validateEditedBlock(edit.Block); err != nil {
+			return fmt.Errorf("%w: block %d: %v", errInvalidUpdate, edit.Index, err)
+		}
+	}
+	if u.CanonicalURL != nil && *u.CanonicalURL != "" {
+		parsed, err := url.Parse(*u.CanonicalURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("%w: canonicalUrl must be an absolute http(s) URL", errInvalidUpdate)
+		}
+	}
+	return nil
+}
+
+// apply merges the update into the blog, recomputing the fields derived from its content
+func (u BlogUpdate) apply(blog *BlogPost) error {
+	if u.Title != nil {
+		blog.Title = *u.Title
+	}
+	if u.Summary != nil {
+		// An edited summary has been reviewed by a person
+		blog.Summary = *u.Summary
+		blog.OriginalSummary = ""
+		blog.SummaryNeedsReview = false
+	}
+	if u.Tags != nil {
+		blog.Tags = *u.Tags
+	}
+	if u.CanonicalURL != nil {
+		blog.CanonicalURL = *u.CanonicalURL
+	}
+	if u.Content != nil {
+		blog.Content = *u.Content
+	}
+	for _, edit := range u.Blocks {
+		if edit.Index < 0 || edit.Index >= len(blog.Content) {
+			return fmt.Errorf("%w: block index %d is out of range, the blog has %d blocks", errInvalidUpdate, edit.Index, len(blog.Content))
+		}
+		blog.Content[edit.Index] = edit.Block
+	}
+	blog.ReadingTime = estimateReadingTime(blog.Content)
+	blog.LengthMismatch = checkLength(blog.Content, blog.Length) != nil
+	return nil
+}
+
+func updateBlogHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	var update BlogUpdate
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&update); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := update.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	blog, err := updateBlogPost(id, func(blog *BlogPost) error {
+		if !canManageBlog(r, *blog) {
+			return errNotBlogOwner
+		}
+		return update.apply(blog)
+	})
+	if errors.Is(err, errNotBlogOwner) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, errInvalidBlogID) {
+		http.Error(w, "Invalid blog ID", http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, errBlogNotFound) {
+		http.Error(w, "Blog not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, errInvalidUpdate) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to update blog: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(blog)
+}
+
+func regenerateBlogHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	existing, err := getBlogByID(id)
+	if errors.Is(err, errInvalidBlogID) {
+		http.Error(w, "Invalid blog ID", http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, errBlogNotFound) {
+		http.Error(w, "Blog not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to load blog: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !canManageBlog(r, existing) {
+		http.Error(w, errNotBlogOwner.Error(), http.StatusForbidden)
+		return
+	}
+	if existing.Topic == "" {
+		http.Error(w, "Blog has no topic to regenerate from", http.StatusUnprocessableEntity)
+		return
+	}
+
+	job, err := jobManager.SubmitRegeneration(existing)
+	if err != nil {
+		http.Error(w, "Failed to queue regeneration: "+err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/jobs/"+job.ID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// slugify turns a title into a lowercase, hyphen-separated ASCII slug, dropping accents
+func slugify(title string) string {
+	stripAccents := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	if stripped, _, err := transform.String(stripAccents, title); err == nil {
+		title = stripped
+	}
+
+	var b strings.Builder
+	pendingHyphen := false
+	for _, r := range strings.ToLower(title) {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			if pendingHyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			pendingHyphen = false
+			continue
+		}
+		pendingHyphen = true
+	}
+
+	slug := b.String()
+	if len(slug) > 80 {
+		slug = strings.TrimRight(slug[:80], "-")
+	}
+	if slug == "" {
+		return "blog"
+	}
+	return slug
+}
+
+// blogSlug returns the blog's slug, derived from its title for blogs stored before slugs
+// were kept
+func blogSlug(blog BlogPost) string {
+	if blog.Slug != "" {
+		return blog.Slug
+	}
+	return slugify(blog.Title)
+}
+
+// yamlString quotes s for use as a YAML scalar. JSON strings are valid YAML.
+func yamlString(s string) string {
+	quoted, _ := json.Marshal(s)
+	return string(quoted)
+}
+
+// renderMarkdown renders the blog as Markdown with YAML front matter
+func renderMarkdown(blog BlogPost) string {
+	var b strings.Builder
+
+	b.WriteString("---\n")
+	fmt.Fprintf(&b, "title: %s\n", yamlString(blog.Title))
+	fmt.Fprintf(&b, "author: %s\n", yamlString(blog.Author))
+	fmt.Fprintf(&b, "date: %s\n", yamlString(blog.Date))
+	if blog.Summary != "" {
+		fmt.Fprintf(&b, "summary: %s\n", yamlString(blog.Summary))
+	}
+	b.WriteString("tags:")
+	if len(blog.Tags) == 0 {
+		b.WriteString(" []")
+	}
+	b.WriteString("\n")
+	for _, tag := range blog.Tags {
+		fmt.Fprintf(&b, "  - %s\n", yamlString(tag))
+	}
+	b.WriteString("---\n")
+	b.WriteString(renderMarkdownBody(blog))
+	return b.String()
+}
+
+// renderMarkdownBody renders the blog's content blocks as Markdown
+func renderMarkdownBody(blog BlogPost) string {
+	var b strings.Builder
+	for _, block := range blog.Content {
+		switch block.Type {
+		case "heading":
+			level := min(max(block.Level, 1), 6)
+			fmt.Fprintf(&b, "\n%s %s\n", strings.Repeat("#", level), strings.TrimSpace(block.Text))
+		case "paragraph":
+			fmt.Fprintf(&b, "\n%s", strings.TrimSpace(block.Text))
+			for _, citation := range blockCitations(block, blog.Sources) {
+				fmt.Fprintf(&b, " [[%d]](%s)", citation.Number, citation.URL)
+			}
+			b.WriteString("\n")
+		case "image":
+			fmt.Fprintf(&b, "\n![%s](%s)\n", block.Alt, block.URL)
+			if block.Caption != "" {
+				fmt.Fprintf(&b, "*%s*\n", block.Caption)
+			}
+		default:
+			if block.Text != "" {
+				fmt.Fprintf(&b, "\n%s\n", strings.TrimSpace(block.Text))
+			}
+		}
+	}
+
+	return b.String()
+}
+
+// errInvalidExportOptions is returned by exporters for query parameters they don't accept
+var errInvalidExportOptions = errors.New("invalid export options")
+
+// blogExporter renders a blog into a downloadable file format, with options from the
+// request's query parameters
+type blogExporter struct {
+	contentType string
+	extension   string
+	render      func(blog BlogPost, query url.Values) ([]byte, error)
+}
+
+// blogExporters are the formats GET /api/blogs/{id}/export?format= accepts
+var blogExporters = map[string]blogExporter{
+	"markdown": {
+		contentType: "text/markdown; charset=utf-8",
+		extension:   "md",
+		render: func(blog BlogPost, _ url.Values) ([]byte, error) {
+			return []byte(renderMarkdown(blog)), nil
+		},
+	},
+	"html": {
+		contentType: "text/html; charset=utf-8",
+		extension:   "html",
+		render:      renderHTML,
+	},
+	"pdf": {
+		contentType: "application/pdf",
+		extension:   "pdf",
+		render:      renderPDF,
+	},
+	"epub": {
+		contentType: "application/epub+zip",
+		extension:   "epub",
+		render:      renderEPUB,
+	},
+}
+
+// exportFormats returns the names of the export formats, sorted
+func exportFormats() []string {
+	formats := make([]string, 0, len(blogExporters))
+	for format := range blogExporters {
+		formats = append(formats, format)
+	}
+	slices.Sort(formats)
+	return formats
+}
+
+// exportBlogHandler serves the blog as a file in the format given by ?format=
+func exportBlogHandler(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	exporter, ok := blogExporters[format]
+	if !ok {
+		http.Error(w, "format must be one of "+strings.Join(exportFormats(), ", "), http.StatusBadRequest)
+		return
+	}
+	exportBlog(w, r, exporter)
+}
+
+// markdownExportHandler serves the blog as Markdown, like ?format=markdown on the export endpoint
+func markdownExportHandler(w http.ResponseWriter, r *http.Request) {
+	exportBlog(w, r, blogExporters["markdown"])
+}
+
+func exportBlog(w http.ResponseWriter, r *http.Request, exporter blogExporter) {
+	blog, err := getBlogByID(mux.Vars(r)["id"])
+	if err == nil && !canReadBlog(r, blog) {
+		err = errBlogNotFound
+	}
+	if errors.Is(err, errBlogNotFound) || errors.Is(err, errInvalidBlogID) {
+		http.Error(w, "Blog not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to load blog: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data, err := exporter.render(blog, r.URL.Query())
+	if errors.Is(err, errInvalidExportOptions) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to export blog: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", exporter.contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, blogSlug(blog), exporter.extension))
+	w.Write(data)
+}
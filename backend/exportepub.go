@@ -0,0 +1,417 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// maxEPUBPosts bounds how many blogs one booklet may compile
+const maxEPUBPosts = 100
+
+// epubImageTypes are the image types EPUB readers must support
+var epubImageTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// epubStylesheet styles the chapters; readers apply their own fonts and colors on top
+const epubStylesheet = `body { font-family: serif; line-height: 1.5; }
+h1, h2, h3, h4, h5, h6 { font-family: sans-serif; line-height: 1.25; }
+img { max-width: 100%; }
+figure { margin: 1em 0; text-align: center; }
+figcaption, .meta { color: #666; font-size: .85em; }
+.summary { font-style: italic; }
+.cover { margin: 0; padding: 0; text-align: center; }
+.cover img { max-height: 95vh; }
+`
+
+var epubChapterTemplate = template.Must(template.New("chapter").Parse(`<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" lang="{{.Language}}" xml:lang="{{.Language}}">
+<head>
+<meta charset="utf-8" />
+<title>{{.Blog.Title}}</title>
+<link rel="stylesheet" type="text/css" href="style.css" />
+</head>
+<body>
+<section epub:type="chapter">
+{{- /* The blog's title is the chapter's h1, so its headings start at h2 */}}
+<h1>{{.Blog.Title}}</h1>
+<p class="meta">{{.Blog.Author}} · {{.Blog.Date}} · {{.Blog.ReadingTime}} min read</p>
+{{- with .FeaturedImage}}
+<figure><img src="{{.}}" alt="{{$.Blog.Title}}" /></figure>
+{{- end}}
+{{- with .Blog.Summary}}
+<p class="summary">{{.}}</p>
+{{- end}}
+{{- range .Blocks}}
+{{- if eq .Type "heading"}}
+{{- if le .Level 2}}
+<h2>{{.Text}}</h2>
+{{- else if eq .Level 3}}
+<h3>{{.Text}}</h3>
+{{- else if eq .Level 4}}
+<h4>{{.Text}}</h4>
+{{- else if eq .Level 5}}
+<h5>{{.Text}}</h5>
+{{- else}}
+<h6>{{.Text}}</h6>
+{{- end}}
+{{- else if eq .Type "image"}}
+{{- if .Src}}
+<figure><img src="{{.Src}}" alt="{{.Alt}}" />{{with .Caption}}<figcaption>{{.}}</figcaption>{{end}}</figure>
+{{- end}}
+{{- else if .Text}}
+<p>{{.Text}}{{range .Citations}} <sup><a href="{{.URL}}" title="{{or .Title .URL}}">[{{.Number}}]</a></sup>{{end}}</p>
+{{- end}}
+{{- end}}
+{{- with .Blog.Sources}}
+<h2>Sources</h2>
+<ol>
+{{- range .}}
+<li><a href="{{.URL}}">{{or .Title .URL}}</a></li>
+{{- end}}
+</ol>
+{{- end}}
+</section>
+</body>
+</html>
+`))
+
+var epubCoverTemplate = template.Must(template.New("cover").Parse(`<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" lang="{{index .Languages 0}}" xml:lang="{{index .Languages 0}}">
+<head>
+<meta charset="utf-8" />
+<title>{{.Title}}</title>
+<link rel="stylesheet" type="text/css" href="style.css" />
+</head>
+<body class="cover">
+<section epub:type="cover"><img src="{{.Cover.Name}}" alt="{{.Title}}" /></section>
+</body>
+</html>
+`))
+
+var epubNavTemplate = template.Must(template.New("nav").Parse(`<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" lang="{{index .Languages 0}}" xml:lang="{{index .Languages 0}}">
+<head>
+<meta charset="utf-8" />
+<title>{{.Title}}</title>
+<link rel="stylesheet" type="text/css" href="style.css" />
+</head>
+<body>
+<nav epub:type="toc" id="toc">
+<h1>Contents</h1>
+<ol>
+{{- range .Chapters}}
+<li><a href="{{.Name}}">{{.Blog.Title}}</a></li>
+{{- end}}
+</ol>
+</nav>
+</body>
+</html>
+`))
+
+var epubPackageTemplate = template.Must(template.New("package").Parse(`<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="book-id" xml:lang="{{index .Languages 0}}">
+<metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+<dc:identifier id="book-id">urn:uuid:{{.ID}}</dc:identifier>
+<dc:title>{{.Title}}</dc:title>
+{{- range .Authors}}
+<dc:creator>{{.}}</dc:creator>
+{{- end}}
+{{- range .Languages}}
+<dc:language>{{.}}</dc:language>
+{{- end}}
+<meta property="dcterms:modified">{{.Modified}}</meta>
+{{- with .Cover}}
+<meta name="cover" content="{{.ID}}" />
+{{- end}}
+</metadata>
+<manifest>
+<item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav" />
+<item id="style" href="style.css" media-type="text/css" />
+{{- if .Cover}}
+<item id="cover-page" href="cover.xhtml" media-type="application/xhtml+xml" />
+{{- end}}
+{{- range .Chapters}}
+<item id="{{.ID}}" href="{{.Name}}" media-type="application/xhtml+xml" />
+{{- end}}
+{{- range .Images}}
+<item id="{{.ID}}" href="{{.Name}}" media-type="{{.ContentType}}"{{if .IsCover}} properties="cover-image"{{end}} />
+{{- end}}
+</manifest>
+<spine>
+{{- if .Cover}}
+<itemref idref="cover-page" linear="no" />
+{{- end}}
+<itemref idref="nav" />
+{{- range .Chapters}}
+<itemref idref="{{.ID}}" />
+{{- end}}
+</spine>
+</package>
+`))
+
+const epubContainer = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+<rootfiles>
+<rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml" />
+</rootfiles>
+</container>
+`
+
+// epubImage is an image embedded in the book
+type epubImage struct {
+	ID          string
+	Name        string
+	ContentType string
+	IsCover     bool
+	data        []byte
+}
+
+// epubFile is a file in the EPUB archive, written by render
+type epubFile struct {
+	name   string
+	render func(io.Writer) error
+}
+
+// epubChapter is one blog in the book, in the blog's language
+type epubChapter struct {
+	ID            string
+	Name          string
+	Language      string
+	Blog          BlogPost
+	FeaturedImage string
+	Blocks        []exportBlock
+}
+
+// epubBook collects the chapters and images of a book before it is written
+type epubBook struct {
+	ID       string
+	Title    string
+	Authors  []string
+	Modified string
+	// Languages are the languages of the chapters, the first one's being the book's
+	Languages []string
+	Cover     *epubImage
+	Chapters  []epubChapter
+	Images    []*epubImage
+
+	// imagesByURL holds the images already added, nil for those that can't be embedded
+	imagesByURL map[string]*epubImage
+}
+
+// renderEPUB renders the blog as a single-chapter EPUB
+func renderEPUB(blog BlogPost, _ url.Values) ([]byte, error) {
+	return buildEPUB(blog.Title, []BlogPost{blog})
+}
+
+// buildEPUB compiles the blogs into an EPUB 3 book with a table of contents, one chapter
+// per blog in order. The first featured image that can be embedded becomes the cover.
+// Images served by this backend are embedded; others are left out, since readers work offline.
+func buildEPUB(title string, blogs []BlogPost) ([]byte, error) {
+	book := &epubBook{
+		ID:          uuid.NewString(),
+		Title:       title,
+		Modified:    time.Now().UTC().Format(time.RFC3339),
+		imagesByURL: make(map[string]*epubImage),
+	}
+
+	for i, blog := range blogs {
+		if blog.Author != "" && !slices.Contains(book.Authors, blog.Author) {
+			book.Authors = append(book.Authors, blog.Author)
+		}
+		chapter := epubChapter{
+			ID:       fmt.Sprintf("chapter%d", i+1),
+			Name:     fmt.Sprintf("chapter%d.xhtml", i+1),
+			Language: blogLanguage(blog),
+			Blog:     blog,
+		}
+		if !slices.Contains(book.Languages, chapter.Language) {
+			book.Languages = append(book.Languages, chapter.Language)
+		}
+		if image := book.addImage(blog.FeaturedImage); image != nil {
+			chapter.FeaturedImage = image.Name
+			if book.Cover == nil {
+				book.Cover = image
+				image.IsCover = true
+			}
+		}
+		for _, block := range blog.Content {
+			exported := exportBlock{BlogContent: block, Citations: blockCitations(block, blog.Sources)}
+			if block.Type == "image" {
+				if image := book.addImage(block.URL); image != nil {
+					exported.Src = image.Name
+				}
+			}
+			chapter.Blocks = append(chapter.Blocks, exported)
+		}
+		book.Chapters = append(book.Chapters, chapter)
+	}
+	if len(book.Languages) == 0 {
+		book.Languages = []string{defaultBlogLanguage}
+	}
+
+	var b bytes.Buffer
+	err := book.write(&b)
+	return b.Bytes(), err
+}
+
+// addImage embeds the image once, returning nil if it can't be embedded
+func (b *epubBook) addImage(raw string) *epubImage {
+	if raw == "" {
+		return nil
+	}
+	if image, ok := b.imagesByURL[raw]; ok {
+		return image
+	}
+	data, contentType, ok := readExportImage(raw)
+	if !ok || !epubImageTypes[contentType] {
+		b.imagesByURL[raw] = nil
+		return nil
+	}
+
+	image := &epubImage{
+		ID:          fmt.Sprintf("image%d", len(b.Images)+1),
+		ContentType: contentType,
+		data:        data,
+	}
+	image.Name = fmt.Sprintf("images/%s.%s", image.ID, imageExtensions[contentType])
+	b.Images = append(b.Images, image)
+	b.imagesByURL[raw] = image
+	return image
+}
+
+// write writes the book as an EPUB archive. The mimetype file must come first and be
+// stored uncompressed so readers can identify the archive.
+func (b *epubBook) write(w io.Writer) error {
+	archive := zip.NewWriter(w)
+
+	mimetype, err := archive.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(mimetype, "application/epub+zip"); err != nil {
+		return err
+	}
+
+	files := []epubFile{
+		{"META-INF/container.xml", writeString(epubContainer)},
+		{"OEBPS/content.opf", writeXHTML(epubPackageTemplate, b)},
+		{"OEBPS/nav.xhtml", writeXHTML(epubNavTemplate, b)},
+		{"OEBPS/style.css", writeString(epubStylesheet)},
+	}
+	if b.Cover != nil {
+		files = append(files, epubFile{"OEBPS/cover.xhtml", writeXHTML(epubCoverTemplate, b)})
+	}
+	for _, chapter := range b.Chapters {
+		files = append(files, epubFile{"OEBPS/" + chapter.Name, writeXHTML(epubChapterTemplate, chapter)})
+	}
+	for _, image := range b.Images {
+		files = append(files, epubFile{"OEBPS/" + image.Name, writeBytes(image.data)})
+	}
+
+	for _, file := range files {
+		f, err := archive.Create(file.name)
+		if err != nil {
+			return err
+		}
+		if err := file.render(f); err != nil {
+			return fmt.Errorf("failed to write %s: %w", file.name, err)
+		}
+	}
+	return archive.Close()
+}
+
+func writeString(s string) func(io.Writer) error {
+	return func(w io.Writer) error {
+		_, err := io.WriteString(w, s)
+		return err
+	}
+}
+
+func writeBytes(data []byte) func(io.Writer) error {
+	return func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	}
+}
+
+// writeXHTML executes the template after an XML declaration, which html/template would
+// otherwise mangle
+func writeXHTML(tmpl *template.Template, data interface{}) func(io.Writer) error {
+	return func(w io.Writer) error {
+		if _, err := io.WriteString(w, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n"); err != nil {
+			return err
+		}
+		return tmpl.Execute(w, data)
+	}
+}
+
+// EPUBExportRequest selects the blogs compiled into a booklet, in order
+type EPUBExportRequest struct {
+	IDs   []string `json:"ids"`
+	Title string   `json:"title"`
+}
+
+// epubExportHandler compiles the requested blogs into one EPUB booklet
+func epubExportHandler(w http.ResponseWriter, r *http.Request) {
+	var req EPUBExportRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.IDs) == 0 || len(req.IDs) > maxEPUBPosts {
+		http.Error(w, fmt.Sprintf("ids must list between 1 and %d blogs", maxEPUBPosts), http.StatusBadRequest)
+		return
+	}
+
+	blogs := make([]BlogPost, 0, len(req.IDs))
+	seen := make(map[string]bool)
+	for _, id := range req.IDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		blog, err := getBlogByID(id)
+		if err == nil && !canReadBlog(r, blog) {
+			err = errBlogNotFound
+		}
+		if errors.Is(err, errBlogNotFound) || errors.Is(err, errInvalidBlogID) {
+			http.Error(w, "Blog not found: "+id, http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to load blog: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		blogs = append(blogs, blog)
+	}
+
+	title := strings.TrimSpace(req.Title)
+	if title == "" {
+		title = blogs[0].Title
+		if len(blogs) > 1 {
+			title = fmt.Sprintf("%s and %d more", title, len(blogs)-1)
+		}
+	}
+
+	data, err := buildEPUB(title, blogs)
+	if err != nil {
+		http.Error(w, "Failed to export blogs: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/epub+zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.epub"`, slugify(title)))
+	w.Write(data)
+}
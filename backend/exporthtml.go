@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"log"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+)
+
+// defaultExportTheme is the theme of HTML exports unless ?theme= picks another
+const defaultExportTheme = "light"
+
+// exportThemeBase is the layout shared by every theme; the themes only set colors and fonts
+const exportThemeBase = `
+body { margin: 0; background: var(--bg); color: var(--fg); font: 18px/1.7 var(--font); }
+article { max-width: 720px; margin: 0 auto; padding: 48px 24px; }
+h1, h2, h3, h4, h5, h6 { font-family: var(--heading-font); line-height: 1.25; }
+h1 { font-size: 2.4em; margin: 0 0 .3em; }
+a { color: var(--link); }
+img { max-width: 100%; height: auto; border-radius: 8px; }
+figure { margin: 2em 0; }
+figcaption, .meta { color: var(--muted); font-size: .85em; }
+.featured { width: 100%; margin: 1em 0; }
+.summary { font-size: 1.1em; font-style: italic; }
+.tags span { display: inline-block; margin: 0 .4em .4em 0; padding: .1em .6em; border-radius: 1em; background: var(--tag-bg); font-size: .8em; }
+footer { margin-top: 3em; border-top: 1px solid var(--muted); }
+`
+
+// exportThemes are the built-in themes of HTML exports
+var exportThemes = map[string]string{
+	"light": `:root { --bg: #ffffff; --fg: #1f2937; --muted: #6b7280; --link: #2563eb; --tag-bg: #e5e7eb;
+	--font: system-ui, -apple-system, "Segoe UI", sans-serif; --heading-font: var(--font); }`,
+	"dark": `:root { --bg: #111827; --fg: #e5e7eb; --muted: #9ca3af; --link: #93c5fd; --tag-bg: #374151;
+	--font: system-ui, -apple-system, "Segoe UI", sans-serif; --heading-font: var(--font); }`,
+	"serif": `:root { --bg: #fbf8f1; --fg: #2d2a26; --muted: #7c746a; --link: #9a3412; --tag-bg: #ece4d4;
+	--font: Georgia, "Times New Roman", serif; --heading-font: "Palatino Linotype", Palatino, Georgia, serif; }`,
+}
+
+// exportBlocksTemplate renders a blog's content blocks and sources as HTML fragments,
+// shared by the HTML export and the publishers
+var exportBlocksTemplate = template.Must(template.New("blocks").Parse(`
+{{- range .}}
+{{- if eq .Type "heading"}}
+{{- if le .Level 1}}
+<h1>{{.Text}}</h1>
+{{- else if eq .Level 2}}
+<h2>{{.Text}}</h2>
+{{- else if eq .Level 3}}
+<h3>{{.Text}}</h3>
+{{- else if eq .Level 4}}
+<h4>{{.Text}}</h4>
+{{- else if eq .Level 5}}
+<h5>{{.Text}}</h5>
+{{- else}}
+<h6>{{.Text}}</h6>
+{{- end}}
+{{- else if eq .Type "image"}}
+<figure><img src="{{.Src}}" alt="{{.Alt}}">{{with .Caption}}<figcaption>{{.}}</figcaption>{{end}}</figure>
+{{- else if .Text}}
+<p>{{.Text}}{{range .Citations}} <sup><a href="{{.URL}}" title="{{or .Title .URL}}">[{{.Number}}]</a></sup>{{end}}</p>
+{{- end}}
+{{- end}}
+{{- define "sources"}}
+{{- with .}}
+<h2>Sources</h2>
+<ol>
+{{- range .}}
+<li><a href="{{.URL}}">{{or .Title .URL}}</a></li>
+{{- end}}
+</ol>
+{{- end}}
+{{- end}}`))
+
+var exportHTMLTemplate = template.Must(template.Must(exportBlocksTemplate.Clone()).New("export").Parse(`<!DOCTYPE html>
+<html lang="{{.Language}}">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Blog.Title}}</title>
+{{- with .Blog.Summary}}
+<meta name="description" content="{{.}}">
+{{- end}}
+<link rel="canonical" href="{{.CanonicalURL}}">
+<script type="application/ld+json">{{.JSONLD}}</script>
+<style>{{.CSS}}</style>
+</head>
+<body>
+<article>
+<header>
+<h1>{{.Blog.Title}}</h1>
+<p class="meta">{{.Blog.Author}} · <time datetime="{{.Blog.Date}}">{{.Blog.Date}}</time> · {{.Blog.ReadingTime}} min read</p>
+{{- with .FeaturedImage}}
+<img class="featured" src="{{.}}" alt="{{$.Blog.Title}}">
+{{- end}}
+{{- with .Blog.Summary}}
+<p class="summary">{{.}}</p>
+{{- end}}
+</header>
+{{- template "blocks" .Blocks}}
+<footer>
+{{- with .Blog.Tags}}
+<p class="tags">{{range .}}<span>{{.}}</span>{{end}}</p>
+{{- end}}
+{{- template "sources" .Blog.Sources}}
+</footer>
+</article>
+</body>
+</html>
+`))
+
+// exportBlock is a content block prepared for the HTML template. Src is a string for
+// linked images, which the template sanitizes, or a template.URL for inlined data URIs.
+// Citations number the paragraph's sources as they are listed under the blog.
+type exportBlock struct {
+	BlogContent
+	Src       interface{}
+	Citations []exportCitation
+}
+
+// blogPostingJSONLD is the schema.org BlogPosting describing an exported blog to search
+// engines, identified by its canonical URL
+type blogPostingJSONLD struct {
+	Context          string       `json:"@context"`
+	Type             string       `json:"@type"`
+	Headline         string       `json:"headline"`
+	Description      string       `json:"description,omitempty"`
+	URL              string       `json:"url"`
+	MainEntityOfPage string       `json:"mainEntityOfPage"`
+	DatePublished    string       `json:"datePublished,omitempty"`
+	DateModified     string       `json:"dateModified,omitempty"`
+	Author           *jsonLDThing `json:"author,omitempty"`
+	Image            string       `json:"image,omitempty"`
+	Keywords         string       `json:"keywords,omitempty"`
+	InLanguage       string       `json:"inLanguage"`
+}
+
+// jsonLDThing is a schema.org entity known by its name, such as a blog's author
+type jsonLDThing struct {
+	Type string `json:"@type"`
+	Name string `json:"name"`
+}
+
+// blogPosting returns the JSON-LD of the blog. It was published when it was last
+// published, or generated, and modified when it was last stored.
+func blogPosting(blog BlogPost) blogPostingJSONLD {
+	link := blogLink(blog)
+	posting := blogPostingJSONLD{
+		Context:          "https://schema.org",
+		Type:             "BlogPosting",
+		Headline:         blog.Title,
+		Description:      blog.Summary,
+		URL:              link,
+		MainEntityOfPage: link,
+		DatePublished:    cmp.Or(blog.PublishedAt, blog.Date),
+		Image:            blog.FeaturedImage,
+		Keywords:         strings.Join(blog.Tags, ", "),
+		InLanguage:       blogLanguage(blog),
+	}
+	posting.DateModified = cmp.Or(blog.UpdatedAt, posting.DatePublished)
+	if blog.Author != "" {
+		posting.Author = &jsonLDThing{Type: "Person", Name: blog.Author}
+	}
+	return posting
+}
+
+// renderHTML renders the blog as a standalone HTML page styled by the ?theme= query
+// parameter. With ?images=inline the images served by this backend are embedded as data
+// URIs so the page works offline; otherwise they are linked.
+func renderHTML(blog BlogPost, query url.Values) ([]byte, error) {
+	theme := query.Get("theme")
+	if theme == "" {
+		theme = defaultExportTheme
+	}
+	themeCSS, ok := exportThemes[theme]
+	if !ok {
+		return nil, fmt.Errorf("%w: theme must be one of %s", errInvalidExportOptions, strings.Join(exportThemeNames(), ", "))
+	}
+	inline := false
+	switch query.Get("images") {
+	case "", "link":
+	case "inline":
+		inline = true
+	default:
+		return nil, fmt.Errorf("%w: images must be link or inline", errInvalidExportOptions)
+	}
+
+	imageSrc := func(raw string) interface{} {
+		if inline {
+			if uri, ok := imageDataURI(raw); ok {
+				return uri
+			}
+		}
+		return raw
+	}
+
+	blocks := make([]exportBlock, 0, len(blog.Content))
+	for _, block := range blog.Content {
+		exported := exportBlock{BlogContent: block, Citations: blockCitations(block, blog.Sources)}
+		if block.Type == "image" {
+			exported.Src = imageSrc(block.URL)
+		}
+		blocks = append(blocks, exported)
+	}
+	var featured interface{}
+	if blog.FeaturedImage != "" {
+		featured = imageSrc(blog.FeaturedImage)
+	}
+
+	var b bytes.Buffer
+	err := exportHTMLTemplate.Execute(&b, struct {
+		Blog          BlogPost
+		Language      string
+		CanonicalURL  string
+		JSONLD        blogPostingJSONLD
+		CSS           template.CSS
+		FeaturedImage interface{}
+		Blocks        []exportBlock
+	}{
+		Blog:          blog,
+		Language:      blogLanguage(blog),
+		CanonicalURL:  blogLink(blog),
+		JSONLD:        blogPosting(blog),
+		CSS:           template.CSS(themeCSS + exportThemeBase),
+		FeaturedImage: featured,
+		Blocks:        blocks,
+	})
+	return b.Bytes(), err
+}
+
+// exportThemeNames returns the names of the HTML export themes, sorted
+func exportThemeNames() []string {
+	names := make([]string, 0, len(exportThemes))
+	for name := range exportThemes {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// imageDataURI returns an image served by this backend as a data URI, reporting false for
+// images it doesn't serve or can't read
+func imageDataURI(raw string) (template.URL, bool) {
+	data, contentType, ok := readExportImage(raw)
+	if !ok {
+		return "", false
+	}
+	// The content type was checked against the image bytes when it was downloaded
+	return template.URL("data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(data)), true
+}
+
+// readExportImage returns the bytes and content type of an image served by this backend,
+// reporting false for images it doesn't serve or can't read
+func readExportImage(raw string) ([]byte, string, bool) {
+	var path, contentType string
+	if id, ok := storedImageID(raw); ok {
+		image, err := getImageStore().Get(id)
+		if err != nil {
+			log.Printf("Leaving image %s out of the export: %v", raw, err)
+			return nil, "", false
+		}
+		path, contentType = getImageStore().dataPath(image.ID), image.ContentType
+	} else if isProxiedImageURL(raw) {
+		entry, err := getImageCache().Fetch(upstreamImageURL(raw))
+		if err != nil {
+			log.Printf("Leaving image %s out of the export: %v", raw, err)
+			return nil, "", false
+		}
+		path, contentType = entry.path, entry.ContentType
+	} else {
+		return nil, "", false
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("Leaving image %s out of the export: %v", raw, err)
+		return nil, "", false
+	}
+	return data, contentType, true
+}
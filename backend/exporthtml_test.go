@@ -0,0 +1,106 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRenderHTMLJSONLD(t *testing.T) {
+	previousPublicURL := appConfig.PublicBaseURL
+	t.Cleanup(func() { appConfig.PublicBaseURL = previousPublicURL })
+	appConfig.PublicBaseURL = "https://www.example.com"
+
+	blog := BlogPost{
+		ID:          revisionTestBlogID,
+		Title:       "Solar </script><script>alert(1)</script>",
+		Summary:     "Panels are cheap",
+		Author:      "AI Blog Generator",
+		Date:        "2024-05-01",
+		PublishedAt: "2024-05-02T09:00:00Z",
+		UpdatedAt:   "2024-05-03T10:00:00Z",
+		Tags:        []string{"energy", "solar"},
+	}
+	page, err := renderHTML(blog, url.Values{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	canonical := "https://www.example.com/blogs/" + revisionTestBlogID
+	if !regexp.MustCompile(`<link rel="canonical" href="` + regexp.QuoteMeta(canonical) + `">`).Match(page) {
+		t.Errorf("page has no canonical link to %s", canonical)
+	}
+	scripts := regexp.MustCompile(`(?s)<script type="application/ld\+json">(.*?)</script>`).FindAllSubmatch(page, -1)
+	if len(scripts) != 1 {
+		t.Fatalf("page has %d JSON-LD scripts, want 1:\n%s", len(scripts), page)
+	}
+	var posting map[string]interface{}
+	if err := json.Unmarshal(scripts[0][1], &posting); err != nil {
+		t.Fatalf("invalid JSON-LD %s: %v", scripts[0][1], err)
+	}
+	for field, want := range map[string]string{
+		"@context":         "https://schema.org",
+		"@type":            "BlogPosting",
+		"headline":         blog.Title,
+		"url":              canonical,
+		"mainEntityOfPage": canonical,
+		"datePublished":    blog.PublishedAt,
+		"dateModified":     blog.UpdatedAt,
+		"keywords":         "energy, solar",
+	} {
+		if posting[field] != want {
+			t.Errorf("%s = %v, want %q", field, posting[field], want)
+		}
+	}
+}
+
+func TestExportsUseBlogLanguage(t *testing.T) {
+	german := BlogPost{ID: revisionTestBlogID, Title: "Solarenergie", GenerationOptions: GenerationOptions{Language: "de-AT"}}
+	page, err := renderHTML(german, url.Values{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(page), `<html lang="de-AT">`) || !strings.Contains(string(page), `"inLanguage":"de-AT"`) {
+		t.Errorf("HTML export isn't marked as de-AT:\n%s", page)
+	}
+
+	book, err := buildEPUB("Energie", []BlogPost{german, {ID: "english", Title: "Solar power"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(book), int64(len(book)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{
+		"OEBPS/content.opf":    {`xml:lang="de-AT"`, "<dc:language>de-AT</dc:language>\n<dc:language>en</dc:language>"},
+		"OEBPS/nav.xhtml":      {`lang="de-AT" xml:lang="de-AT"`},
+		"OEBPS/chapter1.xhtml": {`lang="de-AT" xml:lang="de-AT"`},
+		"OEBPS/chapter2.xhtml": {`lang="en" xml:lang="en"`},
+	}
+	for _, file := range archive.File {
+		f, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, fragment := range want[file.Name] {
+			if !strings.Contains(string(data), fragment) {
+				t.Errorf("%s doesn't contain %q:\n%s", file.Name, fragment, data)
+			}
+		}
+		delete(want, file.Name)
+	}
+	if len(want) > 0 {
+		t.Errorf("EPUB is missing %v", want)
+	}
+}
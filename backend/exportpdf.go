@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// PDF layout, in millimeters and points
+const (
+	pdfMargin     = 20.0
+	pdfLineHeight = 6.0
+	pdfBodySize   = 11.0
+)
+
+// pdfHeadingSizes are the font sizes of heading levels 1 to 4; deeper levels use the last
+var pdfHeadingSizes = []float64{18, 16, 14, 12}
+
+// pdfFont returns the TrueType font set by PDF_FONT, used instead of the built-in
+// Helvetica, which only covers Western European text. Nil means no font is configured.
+var pdfFont = sync.OnceValue(func() []byte {
+	path := getEnv("PDF_FONT", "")
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("Using the built-in PDF font: %v", err)
+		return nil
+	}
+	return data
+})
+
+// pdfWriter lays out a blog on the pages of a PDF
+type pdfWriter struct {
+	pdf    *gofpdf.Fpdf
+	family string
+	// tr converts UTF-8 text to the encoding of the font
+	tr     func(string) string
+	images int
+}
+
+// renderPDF renders the blog as an A4 PDF with its headings, paragraphs, images and
+// captions. Images served by this backend are embedded; others are left out.
+func renderPDF(blog BlogPost, _ url.Values) ([]byte, error) {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(pdfMargin, pdfMargin, pdfMargin)
+	pdf.SetAutoPageBreak(true, pdfMargin)
+
+	w := &pdfWriter{pdf: pdf, family: "Helvetica", tr: pdf.UnicodeTranslatorFromDescriptor("")}
+	if font := pdfFont(); font != nil {
+		// The font has no bold or italic faces, so the same face stands in for them
+		for _, style := range []string{"", "B", "I"} {
+			pdf.AddUTF8FontFromBytes("body", style, font)
+		}
+		w.family, w.tr = "body", func(s string) string { return s }
+	}
+
+	pdf.SetTitle(blog.Title, true)
+	pdf.SetAuthor(blog.Author, true)
+	pdf.SetCreator("Blog Generator", true)
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-pdfMargin / 2)
+		w.font("", 8, 128)
+		pdf.CellFormat(0, 4, strconv.Itoa(pdf.PageNo()), "", 0, "C", false, 0, "")
+	})
+	pdf.AddPage()
+
+	w.font("B", 22, 0)
+	w.text(blog.Title, 9)
+	w.font("", 10, 110)
+	w.text(fmt.Sprintf("%s · %s · %d min read", blog.Author, blog.Date, blog.ReadingTime), pdfLineHeight)
+	pdf.Ln(4)
+	if blog.FeaturedImage != "" {
+		w.image(blog.FeaturedImage)
+	}
+	if blog.Summary != "" {
+		w.font("I", 12, 60)
+		w.text(blog.Summary, pdfLineHeight+1)
+		pdf.Ln(4)
+	}
+
+	for _, block := range blog.Content {
+		switch {
+		case block.Type == "heading":
+			level := min(max(block.Level, 1), len(pdfHeadingSizes))
+			pdf.Ln(3)
+			w.font("B", pdfHeadingSizes[level-1], 0)
+			w.text(block.Text, pdfHeadingSizes[level-1]*0.45)
+			pdf.Ln(1)
+		case block.Type == "image":
+			w.image(block.URL)
+			if block.Caption != "" {
+				w.font("I", 9, 110)
+				w.text(block.Caption, 5)
+			}
+			pdf.Ln(3)
+		case block.Text != "":
+			w.font("", pdfBodySize, 30)
+			w.text(block.Text, pdfLineHeight)
+			pdf.Ln(3)
+		}
+	}
+
+	if len(blog.Tags) > 0 {
+		pdf.Ln(4)
+		w.font("", 9, 110)
+		w.text("Tags: "+strings.Join(blog.Tags, ", "), 5)
+	}
+	if len(blog.Sources) > 0 {
+		pdf.Ln(4)
+		w.font("B", 12, 0)
+		w.text("Sources", 7)
+		w.font("", 9, 30)
+		for _, source := range blog.Sources {
+			title := source.Title
+			if title == "" {
+				title = source.URL
+			}
+			pdf.SetTextColor(37, 99, 235)
+			pdf.WriteLinkString(5, w.tr(title), source.URL)
+			pdf.Ln(5)
+		}
+	}
+
+	var b bytes.Buffer
+	err := pdf.Output(&b)
+	return b.Bytes(), err
+}
+
+// font sets the font style and size and a gray text color, 0 being black
+func (w *pdfWriter) font(style string, size float64, gray int) {
+	w.pdf.SetFont(w.family, style, size)
+	w.pdf.SetTextColor(gray, gray, gray)
+}
+
+// text writes a block of wrapped text spanning the page width
+func (w *pdfWriter) text(s string, lineHeight float64) {
+	w.pdf.MultiCell(0, lineHeight, w.tr(strings.TrimSpace(s)), "", "L", false)
+}
+
+// image embeds the image at its width, shrunk to fit the page, skipping images that
+// can't be read or decoded
+func (w *pdfWriter) image(raw string) {
+	data, contentType, ok := readExportImage(raw)
+	if !ok {
+		return
+	}
+	imageType, data, err := pdfImage(data, contentType)
+	if err != nil {
+		log.Printf("Leaving image %s out of the PDF: %v", raw, err)
+		return
+	}
+
+	w.images++
+	name := fmt.Sprintf("image%d", w.images)
+	options := gofpdf.ImageOptions{ImageType: imageType, ReadDpi: false}
+	info := w.pdf.RegisterImageOptionsReader(name, options, bytes.NewReader(data))
+	if info == nil || !w.pdf.Ok() {
+		return
+	}
+
+	pageWidth, pageHeight := w.pdf.GetPageSize()
+	maxWidth, maxHeight := pageWidth-2*pdfMargin, pageHeight-2*pdfMargin
+	// Images are laid out at 96 DPI, like a browser would show them
+	width := min(info.Width()*25.4/96, maxWidth)
+	height := width * info.Height() / info.Width()
+	if height > maxHeight {
+		width, height = width*maxHeight/height, maxHeight
+	}
+	if w.pdf.GetY()+height > pageHeight-pdfMargin {
+		w.pdf.AddPage()
+	}
+	x := (pageWidth - width) / 2
+	w.pdf.ImageOptions(name, x, w.pdf.GetY(), width, height, true, options, 0, "")
+	w.pdf.Ln(2)
+}
+
+// pdfImage returns the image in a format the PDF library embeds, JPEG or 8-bit PNG. JPEGs
+// are embedded as they are; other images are decoded and re-encoded as PNG, since the
+// library rejects WebP, interlaced PNGs and PNGs with 16-bit channels.
+func pdfImage(data []byte, contentType string) (string, []byte, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", nil, err
+	}
+	if config.Width*config.Height > maxImagePixels {
+		return "", nil, fmt.Errorf("image is too large (%dx%d)", config.Width, config.Height)
+	}
+	if contentType == "image/jpeg" {
+		return "JPG", data, nil
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", nil, err
+	}
+	dst := image.NewNRGBA(src.Bounds())
+	draw.Draw(dst, dst.Bounds(), src, src.Bounds().Min, draw.Src)
+	var b bytes.Buffer
+	if err := png.Encode(&b, dst); err != nil {
+		return "", nil, err
+	}
+	return "PNG", b.Bytes(), nil
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// siteLayout describes where a static site generator keeps posts and images, and the
+// front matter it reads
+type siteLayout struct {
+	// postPath returns the path of the blog's Markdown file in the site
+	postPath func(blog BlogPost, slug string) string
+	// imageDir is the directory images are copied to, served at imageURL
+	imageDir string
+	imageURL string
+	// frontMatter returns the blog's front matter fields, in order, with the URL of its
+	// featured image
+	frontMatter func(blog BlogPost, featuredImage string) [][2]string
+}
+
+// siteLayouts are the generators GET /api/export/site?generator= accepts
+var siteLayouts = map[string]siteLayout{
+	"hugo": {
+		postPath: func(_ BlogPost, slug string) string {
+			return "content/posts/" + slug + ".md"
+		},
+		imageDir: "static/images/posts",
+		imageURL: "/images/posts",
+		frontMatter: func(blog BlogPost, featuredImage string) [][2]string {
+			fields := [][2]string{
+				{"title", yamlString(blog.Title)},
+				{"date", yamlString(blog.Date)},
+				{"draft", fmt.Sprint(blogStatus(blog) != StatusPublished)},
+				{"author", yamlString(blog.Author)},
+				{"summary", yamlString(blog.Summary)},
+				{"tags", yamlList(blog.Tags)},
+			}
+			if blog.UpdatedAt != "" {
+				fields = append(fields, [2]string{"lastmod", yamlString(blog.UpdatedAt)})
+			}
+			if featuredImage != "" {
+				fields = append(fields, [2]string{"images", yamlList([]string{featuredImage})})
+			}
+			return fields
+		},
+	},
+	"jekyll": {
+		// Jekyll publishes posts named after their date and keeps drafts apart
+		postPath: func(blog BlogPost, slug string) string {
+			if blogStatus(blog) != StatusPublished {
+				return "_drafts/" + slug + ".md"
+			}
+			return fmt.Sprintf("_posts/%s-%s.md", siteDate(blog), slug)
+		},
+		imageDir: "assets/images/posts",
+		imageURL: "/assets/images/posts",
+		frontMatter: func(blog BlogPost, featuredImage string) [][2]string {
+			fields := [][2]string{
+				{"layout", "post"},
+				{"title", yamlString(blog.Title)},
+				{"date", yamlString(siteDate(blog))},
+				{"author", yamlString(blog.Author)},
+				{"excerpt", yamlString(blog.Summary)},
+				{"tags", yamlList(blog.Tags)},
+			}
+			if featuredImage != "" {
+				fields = append(fields, [2]string{"image", yamlString(featuredImage)})
+			}
+			return fields
+		},
+	},
+}
+
+// siteGenerators returns the names of the static site generators, sorted
+func siteGenerators() []string {
+	generators := make([]string, 0, len(siteLayouts))
+	for generator := range siteLayouts {
+		generators = append(generators, generator)
+	}
+	slices.Sort(generators)
+	return generators
+}
+
+// siteDate returns the blog's date, or today for blogs without a valid one, since Jekyll
+// requires a date in post file names
+func siteDate(blog BlogPost) string {
+	if _, ok := blogPublished(blog); ok {
+		return blog.Date
+	}
+	return time.Now().Format("2006-01-02")
+}
+
+// yamlList formats values as a YAML flow sequence
+func yamlList(values []string) string {
+	quoted := make([]string, 0, len(values))
+	for _, value := range values {
+		quoted = append(quoted, yamlString(value))
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+// siteExport writes a site's posts and images to a zip archive
+type siteExport struct {
+	layout  siteLayout
+	archive *zip.Writer
+	// images maps the blogs' image URLs to their URLs in the site, or to themselves for
+	// images that couldn't be copied
+	images map[string]string
+	slugs  map[string]bool
+}
+
+// image copies the image into the site once, returning its URL there. Images not served
+// by this backend are linked where they are.
+func (s *siteExport) image(raw string) (string, error) {
+	if raw == "" {
+		return "", nil
+	}
+	if local, ok := s.images[raw]; ok {
+		return local, nil
+	}
+
+	data, contentType, ok := readExportImage(raw)
+	if !ok {
+		s.images[raw] = remoteImageURL(raw)
+		return s.images[raw], nil
+	}
+	// Name images after their content, so each is copied once however many blogs use it
+	sum := sha256.Sum256(data)
+	name := hex.EncodeToString(sum[:8]) + "." + imageExtensions[contentType]
+	f, err := s.archive.Create(path.Join(s.layout.imageDir, name))
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Write(data); err != nil {
+		return "", err
+	}
+	s.images[raw] = path.Join(s.layout.imageURL, name)
+	return s.images[raw], nil
+}
+
+// post writes the blog as a Markdown file with front matter
+func (s *siteExport) post(blog BlogPost) error {
+	slug := blogSlug(blog)
+	if s.slugs[slug] {
+		slug += "-" + blog.ID[:min(8, len(blog.ID))]
+	}
+	s.slugs[slug] = true
+
+	featuredImage, err := s.image(blog.FeaturedImage)
+	if err != nil {
+		return err
+	}
+	blog.Content = slices.Clone(blog.Content)
+	for i, block := range blog.Content {
+		if block.Type == "image" {
+			blog.Content[i].URL, err = s.image(block.URL)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	f, err := s.archive.Create(s.layout.postPath(blog, slug))
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	b.WriteString("---\n")
+	for _, field := range s.layout.frontMatter(blog, featuredImage) {
+		fmt.Fprintf(&b, "%s: %s\n", field[0], field[1])
+	}
+	b.WriteString("---\n")
+	b.WriteString(renderMarkdownBody(blog))
+	_, err = io.WriteString(f, b.String())
+	return err
+}
+
+// siteExportHandler serves every blog as a zip archive laid out for the static site
+// generator given by ?generator=: Markdown posts with front matter, and the images served
+// by this backend copied next to them
+func siteExportHandler(w http.ResponseWriter, r *http.Request) {
+	generator := r.URL.Query().Get("generator")
+	layout, ok := siteLayouts[generator]
+	if !ok {
+		http.Error(w, "generator must be one of "+strings.Join(siteGenerators(), ", "), http.StatusBadRequest)
+		return
+	}
+
+	blogs, err := blogStore.List(ListOptions{Sort: SortDateAsc})
+	if err != nil {
+		http.Error(w, "Failed to load blogs: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="blog-%s.zip"`, generator))
+	export := &siteExport{
+		layout:  layout,
+		archive: zip.NewWriter(w),
+		images:  make(map[string]string),
+		slugs:   make(map[string]bool),
+	}
+	for _, blog := range blogs {
+		if err := export.post(blog); err != nil {
+			// The response has started, so the archive is left truncated
+			log.Printf("Failed to export blog %s for %s: %v", blog.ID, generator, err)
+			return
+		}
+	}
+	if err := export.archive.Close(); err != nil {
+		log.Printf("Failed to finish %s export: %v", generator, err)
+	}
+}
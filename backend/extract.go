@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gocolly/colly/v2"
+)
+
+const (
+	extractTestTimeout     = 15 * time.Second
+	extractTestMaxBodySize = 5 * 1024 * 1024
+	extractTestMaxMatches  = 20
+	extractTestMaxTextLen  = 2000
+)
+
+// ExtractTestRequest represents the selectors to try against a single URL. Without a
+// container selector, the selectors of the extractor the scraper uses for the URL's site
+// are tried.
+type ExtractTestRequest struct {
+	URL               string `json:"url"`
+	ContainerSelector string `json:"containerSelector"`
+	ParagraphSelector string `json:"paragraphSelector"`
+	TitleSelector     string `json:"titleSelector"`
+}
+
+// ExtractTestMatch represents what the selectors extracted from one container
+type ExtractTestMatch struct {
+	Title      string   `json:"title"`
+	Paragraphs []string `json:"paragraphs"`
+}
+
+// ExtractTestResponse represents the result of an extraction test
+type ExtractTestResponse struct {
+	URL string `json:"url"`
+	// Extractor is the domain of the site extractor whose selectors were tried, "generic"
+	// for the generic extractor and empty for the request's own selectors
+	Extractor string             `json:"extractor,omitempty"`
+	Matches   []ExtractTestMatch `json:"matches"`
+	Truncated bool               `json:"truncated"`
+}
+
+// truncateUTF8 cuts s to at most n bytes, backing off to the start of a character so
+// none is split in half
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// isAllowedDomain reports whether host is one of the scraper's allowed domains
+func isAllowedDomain(host string) bool {
+	host = strings.ToLower(host)
+	for _, domain := range scrapeAllowedDomains() {
+		if host == domain {
+			return true
+		}
+	}
+	return false
+}
+
+func extractTestHandler(w http.ResponseWriter, r *http.Request) {
+	var reqBody ExtractTestRequest
+	err := json.NewDecoder(r.Body).Decode(&reqBody)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if reqBody.URL == "" {
+		http.Error(w, "url is required", http.StatusBadRequest)
+		return
+	}
+
+	target, err := url.Parse(reqBody.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") {
+		http.Error(w, "Invalid URL", http.StatusBadRequest)
+		return
+	}
+	if !isAllowedDomain(target.Hostname()) {
+		http.Error(w, "Domain is not in the scraper allowlist", http.StatusForbidden)
+		return
+	}
+
+	result, err := runExtractTest(r.Context(), reqBody)
+	if err != nil {
+		http.Error(w, "Failed to fetch URL: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// runExtractTest fetches the URL and applies the given selectors the same way the scraper does.
+// The fetch is cancelled when ctx is done.
+func runExtractTest(ctx context.Context, req ExtractTestRequest) (ExtractTestResponse, error) {
+	result := ExtractTestResponse{URL: req.URL, Matches: []ExtractTestMatch{}}
+
+	var removeSelector string
+	if req.ContainerSelector == "" {
+		target, err := url.Parse(req.URL)
+		if err != nil {
+			return result, err
+		}
+		extractor, domain := extractorFor(target.Hostname())
+		result.Extractor = domain
+		if domain == "" {
+			result.Extractor = "generic"
+		}
+		req.ContainerSelector = extractor.Container
+		req.ParagraphSelector = extractor.Paragraphs
+		req.TitleSelector = extractor.Title
+		removeSelector = extractor.Remove
+	}
+
+	paragraphSelector := req.ParagraphSelector
+	if paragraphSelector == "" {
+		paragraphSelector = "p"
+	}
+	titleSelector := req.TitleSelector
+	if titleSelector == "" {
+		titleSelector = "h1, h2, .title, .headline"
+	}
+
+	c := colly.NewCollector(
+		colly.MaxDepth(1),
+		colly.MaxBodySize(extractTestMaxBodySize),
+		colly.StdlibContext(ctx),
+		colly.UserAgent("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36"),
+	)
+	c.AllowedDomains = scrapeAllowedDomains()
+	c.SetRequestTimeout(extractTestTimeout)
+
+	// Like the scraper, drop the removed elements first and fall back to the page's title
+	var pageTitle string
+	c.OnHTML("html", func(page *colly.HTMLElement) {
+		if removeSelector != "" {
+			page.DOM.Find(removeSelector).Remove()
+		}
+		pageTitle = strings.TrimSpace(page.DOM.Find(titleSelector).First().Text())
+	})
+
+	c.OnHTML(req.ContainerSelector, func(e *colly.HTMLElement) {
+		if len(result.Matches) >= extractTestMaxMatches {
+			result.Truncated = true
+			return
+		}
+
+		match := ExtractTestMatch{
+			Title:      e.ChildText(titleSelector),
+			Paragraphs: []string{},
+		}
+		if match.Title == "" {
+			match.Title = pageTitle
+		}
+		e.ForEach(paragraphSelector, func(_ int, el *colly.HTMLElement) {
+			text := strings.TrimSpace(el.Text)
+			if text == "" {
+				return
+			}
+			if len(text) > extractTestMaxTextLen {
+				text = truncateUTF8(text, extractTestMaxTextLen)
+				result.Truncated = true
+			}
+			match.Paragraphs = append(match.Paragraphs, text)
+		})
+		result.Matches = append(result.Matches, match)
+	})
+
+	var statusErr error
+	c.OnError(func(resp *colly.Response, err error) {
+		statusErr = fmt.Errorf("status %d: %v", resp.StatusCode, err)
+	})
+
+	err := c.Visit(req.URL)
+	if err != nil {
+		return result, err
+	}
+	c.Wait()
+
+	return result, statusErr
+}
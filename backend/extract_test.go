@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateUTF8(t *testing.T) {
+	tests := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{s: "short", n: 10, want: "short"},
+		{s: "abcdef", n: 3, want: "abc"},
+		{s: "café", n: 4, want: "caf"},
+		{s: "café", n: 5, want: "café"},
+		{s: "日本語", n: 5, want: "日"},
+		{s: "日本語", n: 2, want: ""},
+	}
+	for _, tt := range tests {
+		if got := truncateUTF8(tt.s, tt.n); got != tt.want {
+			t.Errorf("truncateUTF8(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestExtractTestTruncatesOnCharacters(t *testing.T) {
+	// An odd offset puts the byte limit in the middle of a two-byte character
+	paragraph := "a" + strings.Repeat("é", extractTestMaxTextLen)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "<html><body><article><h1>Accents</h1><p>%s</p></article></body></html>", paragraph)
+	}))
+	defer server.Close()
+	previous := appConfig.AllowedDomains
+	t.Cleanup(func() { appConfig.AllowedDomains = previous })
+	appConfig.AllowedDomains = []string{"127.0.0.1"}
+
+	result, err := runExtractTest(context.Background(), ExtractTestRequest{URL: server.URL, ContainerSelector: "article"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Matches) != 1 || len(result.Matches[0].Paragraphs) != 1 {
+		t.Fatalf("matches %+v, want one paragraph", result.Matches)
+	}
+	text := result.Matches[0].Paragraphs[0]
+	if !result.Truncated || len(text) != extractTestMaxTextLen-1 || !utf8.ValidString(text) {
+		t.Errorf("paragraph of %d bytes (valid UTF-8 %v, truncated %v), want %d bytes of whole characters", len(text), utf8.ValidString(text), result.Truncated, extractTestMaxTextLen-1)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// SiteExtractor holds the CSS selectors that find articles on the pages of one site
+type SiteExtractor struct {
+	// Container matches the elements holding an article's text
+	Container string `json:"container"`
+	// Title matches the article's headline, looked up in the container and then in the
+	// whole page, since many sites put the headline above the article body
+	Title string `json:"title"`
+	// Paragraphs matches the paragraphs within the container
+	Paragraphs string `json:"paragraphs"`
+	// Remove matches elements dropped before extraction, such as reference markers or
+	// related-article links inside the body
+	Remove string `json:"remove,omitempty"`
+}
+
+// genericExtractor is used for sites without an extractor of their own
+var genericExtractor = SiteExtractor{
+	Container:  "article, .article, .post, .entry, main, .content",
+	Title:      "h1, h2, .title, .headline",
+	Paragraphs: "p",
+}
+
+// siteExtractors are the built-in extractors, keyed by domain. A domain's extractor also
+// covers its subdomains, so bbc.com covers www.bbc.com.
+var siteExtractors = map[string]SiteExtractor{
+	"wikipedia.org": {
+		Container:  "#mw-content-text .mw-parser-output",
+		Title:      "#firstHeading",
+		Paragraphs: "p",
+		Remove:     "sup.reference, .mw-editsection, .noprint, style",
+	},
+	"bbc.com": {
+		Container:  "article",
+		Title:      "h1",
+		Paragraphs: "[data-component='text-block'] p",
+	},
+	"bbc.co.uk": {
+		Container:  "article",
+		Title:      "h1",
+		Paragraphs: "[data-component='text-block'] p",
+	},
+	"reuters.com": {
+		Container:  "article",
+		Title:      "h1",
+		Paragraphs: "[data-testid^='paragraph-']",
+	},
+	"theguardian.com": {
+		Container:  "article",
+		Title:      "h1",
+		Paragraphs: "#maincontent p, .article-body-commercial-selector p",
+	},
+	"cnn.com": {
+		Container:  ".article__content, .zn-body__read-all",
+		Title:      "h1",
+		Paragraphs: "p.paragraph, .zn-body__paragraph",
+	},
+	"nytimes.com": {
+		Container:  "article#story, article",
+		Title:      "h1[data-testid='headline'], h1",
+		Paragraphs: "section[name='articleBody'] p",
+	},
+	"forbes.com": {
+		Container:  ".article-body",
+		Title:      "h1",
+		Paragraphs: "p",
+		Remove:     ".article-body .embed-base, .article-body .recirc-module",
+	},
+	"techcrunch.com": {
+		Container:  ".wp-block-post-content, .article-content",
+		Title:      "h1",
+		Paragraphs: "p",
+	},
+	"wired.com": {
+		Container:  "article",
+		Title:      "h1",
+		Paragraphs: ".body__inner-container p",
+	},
+}
+
+// extractorFor returns the extractor for a host and the domain it is registered under:
+// the scrape config file's extractors take precedence over the built-in ones, and hosts
+// without either use the generic extractor, with an empty domain
+func extractorFor(host string) (SiteExtractor, string) {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	configured := loadScrapeConfig().Extractors
+	for domain := host; domain != ""; {
+		if extractor, ok := configured[domain]; ok {
+			return extractor.withDefaults(), domain
+		}
+		if extractor, ok := siteExtractors[domain]; ok {
+			return extractor.withDefaults(), domain
+		}
+		_, parent, found := strings.Cut(domain, ".")
+		if !found || !strings.Contains(parent, ".") {
+			break
+		}
+		domain = parent
+	}
+	return genericExtractor, ""
+}
+
+// withDefaults fills the selectors an extractor leaves out from the generic extractor
+func (x SiteExtractor) withDefaults() SiteExtractor {
+	if x.Container == "" {
+		x.Container = genericExtractor.Container
+	}
+	if x.Title == "" {
+		x.Title = genericExtractor.Title
+	}
+	if x.Paragraphs == "" {
+		x.Paragraphs = genericExtractor.Paragraphs
+	}
+	return x
+}
+
+// extract returns the article-like contents of a page: one for each container with a
+// title and enough cleaned paragraph text
+func (x SiteExtractor) extract(page *colly.HTMLElement) []ScrapedContent {
+	if x.Remove != "" {
+		page.DOM.Find(x.Remove).Remove()
+	}
+	pageTitle := strings.TrimSpace(page.DOM.Find(x.Title).First().Text())
+
+	var contents []ScrapedContent
+	page.ForEach(x.Container, func(_ int, e *colly.HTMLElement) {
+		content := ScrapedContent{
+			URL:   page.Request.URL.String(),
+			Title: e.ChildText(x.Title),
+		}
+		if content.Title == "" {
+			content.Title = pageTitle
+		}
+
+		e.ForEach(x.Paragraphs, func(_ int, el *colly.HTMLElement) {
+			paragraphText, ok := cleanParagraph(el.Text)
+			if ok && len(paragraphText) > 20 {
+				content.Text += paragraphText + "\n\n"
+			}
+		})
+
+		// Prefer the machine-readable datetime attribute over the displayed text
+		publishDate := e.ChildAttr("time[datetime]", "datetime")
+		if publishDate == "" {
+			publishDate = e.ChildText("time, .date, .published, .timestamp")
+		}
+		content.PublishedAt = normalizePublishedAt(publishDate)
+
+		if content.Title != "" && len(content.Text) > 100 {
+			contents = append(contents, content)
+		}
+	})
+	return contents
+}
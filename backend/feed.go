@@ -0,0 +1,275 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// defaultFeedLimit is how many posts the feed includes unless FEED_LIMIT or ?limit= says otherwise
+const defaultFeedLimit = 20
+
+// Title and description shared by the feeds
+const (
+	feedTitle       = "Blog Generator"
+	feedDescription = "Newly generated blog posts"
+)
+
+// RSS represents an RSS 2.0 document
+type RSS struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel RSSChannel `xml:"channel"`
+}
+
+// RSSChannel represents the channel of an RSS feed
+type RSSChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []RSSItem `xml:"item"`
+}
+
+// RSSItem represents a single post in an RSS feed
+type RSSItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	Description string  `xml:"description"`
+	GUID        RSSGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate,omitempty"`
+}
+
+// RSSGUID represents the unique ID of an RSS item
+type RSSGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+}
+
+// feedBlogs returns the most recent published blogs, newest first, leaving out those
+// generated from placeholder content
+func feedBlogs(limit int) ([]BlogPost, error) {
+	return blogStore.List(ListOptions{
+		Page:             1,
+		Limit:            limit,
+		Sort:             SortDateDesc,
+		Status:           StatusPublished,
+		ExcludeSimulated: true,
+	})
+}
+
+// feedLimit reads ?limit=, defaulting to FEED_LIMIT, responding with 400 and reporting
+// false if it is invalid
+func feedLimit(w http.ResponseWriter, r *http.Request) (int, bool) {
+	limit := min(max(getEnvInt("FEED_LIMIT", defaultFeedLimit), 1), maxPageLimit)
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return 0, false
+		}
+		limit = min(parsed, maxPageLimit)
+	}
+	return limit, true
+}
+
+// feedEntries returns the blogs the feeds list, responding with an error and reporting
+// false if they can't be loaded
+func feedEntries(w http.ResponseWriter, r *http.Request) ([]BlogPost, bool) {
+	limit, ok := feedLimit(w, r)
+	if !ok {
+		return nil, false
+	}
+	blogs, err := feedBlogs(limit)
+	if err != nil {
+		http.Error(w, "Failed to build feed: "+err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return blogs, true
+}
+
+// blogPublished returns when the blog was published, reporting false if its date is invalid
+func blogPublished(blog BlogPost) (time.Time, bool) {
+	date, err := time.Parse("2006-01-02", blog.Date)
+	return date, err == nil
+}
+
+func rssFeedHandler(w http.ResponseWriter, r *http.Request) {
+	blogs, ok := feedEntries(w, r)
+	if !ok {
+		return
+	}
+
+	feed := RSS{
+		Version: "2.0",
+		Channel: RSSChannel{
+			Title:         feedTitle,
+			Link:          publicBaseURL(),
+			Description:   feedDescription,
+			LastBuildDate: time.Now().Format(time.RFC1123Z),
+			Items:         []RSSItem{},
+		},
+	}
+	for _, blog := range blogs {
+		item := RSSItem{
+			Title:       blog.Title,
+			Link:        blogLink(blog),
+			Description: blog.Summary,
+			GUID:        RSSGUID{Value: blogLink(blog), IsPermaLink: true},
+		}
+		if date, ok := blogPublished(blog); ok {
+			item.PubDate = date.Format(time.RFC1123Z)
+		}
+		feed.Channel.Items = append(feed.Channel.Items, item)
+	}
+
+	writeXML(w, "application/rss+xml; charset=utf-8", feed)
+}
+
+// AtomFeed represents an Atom 1.0 feed
+type AtomFeed struct {
+	XMLName xml.Name    `xml:"feed"`
+	Xmlns   string      `xml:"xmlns,attr"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []AtomLink  `xml:"link"`
+	Entries []AtomEntry `xml:"entry"`
+}
+
+// AtomLink represents a link of an Atom feed or entry
+type AtomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+// AtomEntry represents a single post in an Atom feed
+type AtomEntry struct {
+	ID        string     `xml:"id"`
+	Title     string     `xml:"title"`
+	Updated   string     `xml:"updated"`
+	Published string     `xml:"published,omitempty"`
+	Author    AtomAuthor `xml:"author"`
+	Link      AtomLink   `xml:"link"`
+	Summary   string     `xml:"summary,omitempty"`
+}
+
+// AtomAuthor represents the author of an Atom entry
+type AtomAuthor struct {
+	Name string `xml:"name"`
+}
+
+func atomFeedHandler(w http.ResponseWriter, r *http.Request) {
+	blogs, ok := feedEntries(w, r)
+	if !ok {
+		return
+	}
+
+	// Atom requires an updated time; the newest blog's date is when the feed last changed
+	updated := time.Now()
+	if len(blogs) > 0 {
+		if date, ok := blogPublished(blogs[0]); ok {
+			updated = date
+		}
+	}
+	feed := AtomFeed{
+		Xmlns:   "http://www.w3.org/2005/Atom",
+		ID:      publicBaseURL() + "/",
+		Title:   feedTitle,
+		Updated: updated.Format(time.RFC3339),
+		Links: []AtomLink{
+			{Href: backendBaseURL() + "/feed.atom", Rel: "self"},
+			{Href: publicBaseURL(), Rel: "alternate"},
+		},
+		Entries: []AtomEntry{},
+	}
+	for _, blog := range blogs {
+		entry := AtomEntry{
+			// The blog's UUID stays the same if the public URL changes
+			ID:      "urn:uuid:" + blog.ID,
+			Title:   blog.Title,
+			Updated: updated.Format(time.RFC3339),
+			Author:  AtomAuthor{Name: blog.Author},
+			Link:    AtomLink{Href: blogLink(blog), Rel: "alternate"},
+			Summary: blog.Summary,
+		}
+		if date, ok := blogPublished(blog); ok {
+			entry.Updated = date.Format(time.RFC3339)
+			entry.Published = entry.Updated
+		}
+		if blog.UpdatedAt != "" {
+			entry.Updated = blog.UpdatedAt
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	writeXML(w, "application/atom+xml; charset=utf-8", feed)
+}
+
+// JSONFeed represents a JSON Feed 1.1 document
+type JSONFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	Description string         `json:"description"`
+	HomePageURL string         `json:"home_page_url"`
+	FeedURL     string         `json:"feed_url"`
+	Items       []JSONFeedItem `json:"items"`
+}
+
+// JSONFeedItem represents a single post in a JSON Feed
+type JSONFeedItem struct {
+	ID            string           `json:"id"`
+	URL           string           `json:"url"`
+	Title         string           `json:"title"`
+	Summary       string           `json:"summary,omitempty"`
+	ContentText   string           `json:"content_text"`
+	Image         string           `json:"image,omitempty"`
+	DatePublished string           `json:"date_published,omitempty"`
+	Authors       []JSONFeedAuthor `json:"authors,omitempty"`
+	Tags          []string         `json:"tags,omitempty"`
+}
+
+// JSONFeedAuthor represents the author of a JSON Feed item
+type JSONFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+func jsonFeedHandler(w http.ResponseWriter, r *http.Request) {
+	blogs, ok := feedEntries(w, r)
+	if !ok {
+		return
+	}
+
+	feed := JSONFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       feedTitle,
+		Description: feedDescription,
+		HomePageURL: publicBaseURL(),
+		FeedURL:     backendBaseURL() + "/feed.json",
+		Items:       []JSONFeedItem{},
+	}
+	for _, blog := range blogs {
+		item := JSONFeedItem{
+			ID:    blog.ID,
+			URL:   blogLink(blog),
+			Title: blog.Title,
+			// Items need content; the summary stands in for the full post
+			Summary:     blog.Summary,
+			ContentText: blog.Summary,
+			Image:       blog.FeaturedImage,
+			Tags:        blog.Tags,
+		}
+		if blog.Author != "" {
+			item.Authors = []JSONFeedAuthor{{Name: blog.Author}}
+		}
+		if date, ok := blogPublished(blog); ok {
+			item.DatePublished = date.Format(time.RFC3339)
+		}
+		feed.Items = append(feed.Items, item)
+	}
+
+	w.Header().Set("Content-Type", "application/feed+json; charset=utf-8")
+	json.NewEncoder(w).Encode(feed)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestFeedBlogs(t *testing.T) {
+	useImageURLStore(t, "https://blog.example.com")
+	save := func(day int, status string, simulated bool) string {
+		t.Helper()
+		blog := BlogPost{
+			ID:        fmt.Sprintf("4d6c1f5e-8f7a-4b1c-9d2e-3a5b6c7d8e%02d", day),
+			Title:     fmt.Sprintf("Day %d", day),
+			Date:      fmt.Sprintf("2024-05-%02d", day),
+			Status:    status,
+			Simulated: simulated,
+		}
+		if err := saveBlogPost(blog); err != nil {
+			t.Fatal(err)
+		}
+		return blog.ID
+	}
+	oldest := save(1, StatusPublished, false)
+	save(2, StatusDraft, false)
+	older := save(3, "", false)
+	save(4, StatusPublished, true)
+	newest := save(5, StatusPublished, false)
+	save(6, StatusInReview, false)
+
+	for _, tt := range []struct {
+		limit int
+		want  []string
+	}{
+		{2, []string{newest, older}},
+		{10, []string{newest, older, oldest}},
+	} {
+		blogs, err := feedBlogs(tt.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, blog := range blogs {
+			got = append(got, blog.ID)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("feedBlogs(%d) = %v, want %v", tt.limit, got, tt.want)
+		}
+	}
+}
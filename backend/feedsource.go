@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/html/charset"
+)
+
+// Feed source defaults, overridable with SCRAPE_FEED_MAX_ITEMS
+const (
+	defaultFeedMaxItems = 10
+	feedFetchTimeout    = 15 * time.Second
+	feedMaxBodySize     = 5 * 1024 * 1024
+)
+
+// feedSourceName is the name the feed source's articles are counted under
+const feedSourceName = "RSS feeds"
+
+// feedClient fetches the configured feeds
+var feedClient = &http.Client{Timeout: feedFetchTimeout}
+
+// feedItem is an item of an RSS feed or an entry of an Atom feed
+type feedItem struct {
+	Title       string
+	Link        string
+	Description string
+}
+
+// feedDocument decodes both RSS 2.0 and Atom feeds
+type feedDocument struct {
+	Items []struct {
+		Title       string `xml:"title"`
+		Link        string `xml:"link"`
+		Description string `xml:"description"`
+	} `xml:"channel>item"`
+	Entries []struct {
+		Title string `xml:"title"`
+		Links []struct {
+			Href string `xml:"href,attr"`
+			Rel  string `xml:"rel,attr"`
+		} `xml:"link"`
+		Summary string `xml:"summary"`
+		Content string `xml:"content"`
+	} `xml:"entry"`
+}
+
+// scrapeFeeds returns the feeds the scraper reads before crawling search pages: the
+// comma-separated SCRAPE_FEEDS, else feeds from the scrape config file
+func scrapeFeeds() []string {
+	feeds := splitTrimmedList(getEnv("SCRAPE_FEEDS", ""))
+	if len(feeds) == 0 {
+		feeds = loadScrapeConfig().Feeds
+	}
+	normalized := make([]string, 0, len(feeds))
+	for _, feed := range feeds {
+		normalized = append(normalized, normalizeFeedURL(feed))
+	}
+	return normalized
+}
+
+// normalizeFeedURL lowercases the host of a feed URL, leaving its path and query, which
+// may be case-sensitive, as they are
+func normalizeFeedURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return raw
+	}
+	u.Host = strings.ToLower(u.Host)
+	return u.String()
+}
+
+// fetchFeed downloads and parses an RSS or Atom feed, returning its items in feed order
+func fetchFeed(ctx context.Context, feedURL string) ([]feedItem, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feedURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/rss+xml, application/atom+xml, application/xml;q=0.9, */*;q=0.8")
+	resp, err := feedClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	var doc feedDocument
+	decoder := xml.NewDecoder(io.LimitReader(resp.Body, feedMaxBodySize))
+	decoder.Strict = false
+	decoder.CharsetReader = charset.NewReaderLabel
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid feed: %w", err)
+	}
+
+	items := make([]feedItem, 0, len(doc.Items)+len(doc.Entries))
+	for _, item := range doc.Items {
+		items = append(items, feedItem{Title: item.Title, Link: strings.TrimSpace(item.Link), Description: item.Description})
+	}
+	for _, entry := range doc.Entries {
+		item := feedItem{Title: entry.Title, Description: entry.Summary}
+		if item.Description == "" {
+			item.Description = entry.Content
+		}
+		for _, link := range entry.Links {
+			if link.Rel == "" || link.Rel == "alternate" {
+				item.Link = strings.TrimSpace(link.Href)
+				break
+			}
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// feedWords splits text into lowercase words
+func feedWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// topicKeywords returns the words of a topic an item must mention, leaving out words
+// shorter than three letters unless the topic has no others
+func topicKeywords(topic string) []string {
+	words := feedWords(topic)
+	var keywords []string
+	for _, word := range words {
+		if utf8.RuneCountInString(word) >= 3 {
+			keywords = append(keywords, word)
+		}
+	}
+	if len(keywords) == 0 {
+		return words
+	}
+	return keywords
+}
+
+// matchesTopic reports whether the item's title or description mentions at least half of
+// the keywords, a word starting with a keyword counting so that plurals match
+func (item feedItem) matchesTopic(keywords []string) bool {
+	if len(keywords) == 0 {
+		return false
+	}
+	words := feedWords(item.Title + " " + item.Description)
+	matched := 0
+	for _, keyword := range keywords {
+		for _, word := range words {
+			if strings.HasPrefix(word, keyword) {
+				matched++
+				break
+			}
+		}
+	}
+	return matched*2 >= len(keywords)
+}
+
+// queueFeedArticles fetches the configured feeds and queues the articles of their items
+// matching the topic, at most SCRAPE_FEED_MAX_ITEMS per feed, returning how many were
+// queued. Feeds that fail are skipped.
+func queueFeedArticles(ctx context.Context, articles articleCollectors, topic string) int {
+	maxItems := max(getEnvInt("SCRAPE_FEED_MAX_ITEMS", defaultFeedMaxItems), 1)
+	keywords := topicKeywords(topic)
+
+	queued := 0
+	for _, feedURL := range scrapeFeeds() {
+		if ctx.Err() != nil {
+			break
+		}
+		items, err := fetchFeed(ctx, feedURL)
+		if err != nil {
+			log.Printf("Skipping feed %s: %v", feedURL, err)
+			continue
+		}
+
+		var links []string
+		for _, item := range items {
+			if len(links) >= maxItems {
+				break
+			}
+			if item.Link != "" && item.matchesTopic(keywords) {
+				links = append(links, item.Link)
+			}
+		}
+		queued += articles.queue(links, feedSourceName)
+	}
+	return queued
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Gemini defaults, overridable with GEMINI_MODEL and GEMINI_BASE_URL
+const (
+	defaultGeminiModel   = "gemini-1.5-pro"
+	defaultGeminiBaseURL = "https://generativelanguage.googleapis.com/v1beta"
+)
+
+// geminiGenerator writes blogs with the Google Gemini generateContent API
+type geminiGenerator struct{}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiPart struct {
+	Text string `json:"text"`
+}
+
+// geminiRequest is the body of a generateContent request
+type geminiRequest struct {
+	SystemInstruction geminiContent   `json:"systemInstruction"`
+	Contents          []geminiContent `json:"contents"`
+	GenerationConfig  struct {
+		ResponseMimeType string `json:"responseMimeType"`
+	} `json:"generationConfig"`
+}
+
+// geminiResponse is the part of a generateContent response the generator uses
+type geminiResponse struct {
+	Candidates []struct {
+		Content      geminiContent `json:"content"`
+		FinishReason string        `json:"finishReason"`
+	} `json:"candidates"`
+	UsageMetadata struct {
+		PromptTokenCount     int `json:"promptTokenCount"`
+		CandidatesTokenCount int `json:"candidatesTokenCount"`
+	} `json:"usageMetadata"`
+}
+
+func (geminiGenerator) Ready(ctx context.Context) error {
+	_, err := requireEnv("GEMINI_API_KEY")
+	return err
+}
+
+// Generate writes the blog with the Gemini API and fills its images from Pexels
+func (g geminiGenerator) Generate(ctx context.Context, request LlamaIndexRequest) (LlamaIndexResponse, error) {
+	text, usage, err := g.Complete(ctx, blogSystemPrompt, blogUserPrompt(request))
+	if err != nil {
+		return LlamaIndexResponse{Usage: usage}, err
+	}
+	blog, err := completeBlog(ctx, request.Topic, text, len(request.Contents))
+	blog.Usage = usage
+	return blog, err
+}
+
+// Complete asks the Gemini API for a JSON answer to the prompt
+func (geminiGenerator) Complete(ctx context.Context, system, prompt string) (string, TokenUsage, error) {
+	apiKey, err := requireEnv("GEMINI_API_KEY")
+	if err != nil {
+		return "", TokenUsage{}, err
+	}
+
+	request := geminiRequest{
+		SystemInstruction: geminiContent{Parts: []geminiPart{{Text: system}}},
+		Contents:          []geminiContent{{Role: "user", Parts: []geminiPart{{Text: prompt}}}},
+	}
+	request.GenerationConfig.ResponseMimeType = "application/json"
+
+	model := getEnv("GEMINI_MODEL", defaultGeminiModel)
+	endpoint := strings.TrimRight(getEnv("GEMINI_BASE_URL", defaultGeminiBaseURL), "/") + "/models/" + url.PathEscape(model) + ":generateContent"
+	var generated geminiResponse
+	if err := postJSON(ctx, endpoint, map[string]string{"x-goog-api-key": apiKey}, request, &generated); err != nil {
+		return "", TokenUsage{}, fmt.Errorf("Gemini request failed: %w", err)
+	}
+	usage := TokenUsage{InputTokens: generated.UsageMetadata.PromptTokenCount, OutputTokens: generated.UsageMetadata.CandidatesTokenCount}
+	if len(generated.Candidates) == 0 {
+		return "", usage, fmt.Errorf("%w: Gemini returned no candidates", errInvalidLlamaResponse)
+	}
+	candidate := generated.Candidates[0]
+	if candidate.FinishReason == "MAX_TOKENS" {
+		return "", usage, &RetryableError{Err: fmt.Errorf("%w: Gemini stopped at the token limit", errTruncatedOutput)}
+	}
+
+	var text strings.Builder
+	for _, part := range candidate.Content.Parts {
+		text.WriteString(part.Text)
+	}
+	if text.Len() == 0 {
+		return "", usage, fmt.Errorf("%w: Gemini returned no text (finish reason %s)", errInvalidLlamaResponse, candidate.FinishReason)
+	}
+	return text.String(), usage, nil
+}
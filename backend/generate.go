@@ -0,0 +1,371 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// defaultGenerationTimeout bounds how long the generator may run for one blog
+const defaultGenerationTimeout = 120 * time.Second
+
+// Errors returned by generateBlog for outcomes that aren't internal failures
+var (
+	errNoContent     = errors.New("no content found for this topic")
+	errLowConfidence = errors.New("generated blog confidence is below the minimum")
+)
+
+// Pipeline stages reported to a ProgressFunc
+const (
+	StageScraping   = "scraping"
+	StageGenerating = "generating"
+	StageGenerated  = "generated"
+)
+
+// ProgressEvent reports the stage the pipeline is in and what it has produced so far
+type ProgressEvent struct {
+	Stage string `json:"stage"`
+	// Pages is the number of pages the scraper has fetched
+	Pages int `json:"pages"`
+	// Sources is the number of articles found while scraping, then the number selected
+	// for generation once scraping finishes
+	Sources int `json:"sources"`
+	// Sections is the number of sections in the generated blog
+	Sections int `json:"sections,omitempty"`
+}
+
+// ProgressFunc receives progress events from the pipeline as it runs
+type ProgressFunc func(event ProgressEvent)
+
+// generateBlog runs the full scrape, generate and save pipeline for a topic with the
+// options, reporting progress to progress if it isn't nil. The blog is owned by ownerID,
+// if not empty.
+func generateBlog(ctx context.Context, topic, ownerID string, opts GenerationOptions, progress ProgressFunc) (BlogPost, error) {
+	return runGenerationPipeline(ctx, BlogPost{
+		ID:                uuid.New().String(),
+		Date:              time.Now().Format("2006-01-02"),
+		Topic:             topic,
+		OwnerID:           ownerID,
+		GenerationOptions: opts,
+	}, progress)
+}
+
+// generateBlogFromSources runs the generate and save steps of generateBlog on sources
+// already scraped for the topic, logging the tokens of the outline proposed from them
+// along with the generation's
+func generateBlogFromSources(ctx context.Context, topic, ownerID string, opts GenerationOptions, scrapedContents []ScrapedContent, outlineUsage TokenUsage, progress ProgressFunc) (BlogPost, error) {
+	base := BlogPost{
+		ID:                uuid.New().String(),
+		Date:              time.Now().Format("2006-01-02"),
+		Topic:             topic,
+		OwnerID:           ownerID,
+		GenerationOptions: opts,
+	}
+	return trackGeneration(ctx, base, func(ctx context.Context) (BlogPost, error) {
+		recordUsage(ctx, 1, outlineUsage)
+		return generateFromSources(ctx, base, scrapedContents, 0, progress)
+	})
+}
+
+// regenerateBlog re-scrapes and regenerates the topic of the blog with the ID, storing the
+// new content as a revision of the blog. It keeps its ID, slug, date, owner, generation
+// options, workflow status and publications, along with changes made to the blog while it
+// was regenerating.
+func regenerateBlog(ctx context.Context, id string, progress ProgressFunc) (BlogPost, error) {
+	existing, err := getBlogByID(id)
+	if err != nil {
+		return BlogPost{}, err
+	}
+	return runGenerationPipeline(ctx, regenerationBase(existing), progress)
+}
+
+// refreshBlog generates the blog for base from sources already scraped for its topic,
+// overwriting the blog with base's ID if there is one. Existing blogs are refreshed with
+// their regenerationBase.
+func refreshBlog(ctx context.Context, base BlogPost, scrapedContents []ScrapedContent) (BlogPost, error) {
+	return trackGeneration(ctx, base, func(ctx context.Context) (BlogPost, error) {
+		return generateFromSources(ctx, base, scrapedContents, 0, func(ProgressEvent) {})
+	})
+}
+
+// regenerationBase is what a regenerated blog keeps of the existing one. Unlike the base
+// of a new blog, it has a slug, which has the generated blog merged onto the stored one.
+func regenerationBase(existing BlogPost) BlogPost {
+	return BlogPost{
+		ID:            existing.ID,
+		Slug:          blogSlug(existing),
+		Date:          existing.Date,
+		Topic:         existing.Topic,
+		OwnerID:       existing.OwnerID,
+		Status:        blogStatus(existing),
+		SubmittedAt:   existing.SubmittedAt,
+		PublishedAt:   existing.PublishedAt,
+		StatusChanges: existing.StatusChanges,
+		Publications:  existing.Publications,
+		TranslationOf: existing.TranslationOf,
+		Translations:  existing.Translations,
+
+		GenerationOptions: existing.GenerationOptions,
+	}
+}
+
+// runGenerationPipeline generates content for base.Topic and saves it under base.ID and
+// base.Date, notifying webhooks when the generation starts and when it completes or fails
+func runGenerationPipeline(ctx context.Context, base BlogPost, progress ProgressFunc) (BlogPost, error) {
+	return trackGeneration(ctx, base, func(ctx context.Context) (BlogPost, error) {
+		return generateAndSave(ctx, base, progress)
+	})
+}
+
+// trackGeneration runs generate once a generation slot is free, emitting the generation
+// events for base around it and recording it in the generation log. Waiting for the slot
+// ends with ctx's error if ctx is done first.
+func trackGeneration(ctx context.Context, base BlogPost, generate func(ctx context.Context) (BlogPost, error)) (BlogPost, error) {
+	release, err := jobManager.acquire(ctx)
+	if err != nil {
+		return BlogPost{}, err
+	}
+	defer release()
+
+	emitEvent(EventGenerationStarted, base.OwnerID, GenerationEventData{Topic: base.Topic, BlogID: base.ID})
+	blog, err := recordGeneration(ctx, base, generate)
+	if err != nil {
+		emitEvent(EventGenerationFailed, base.OwnerID, GenerationEventData{Topic: base.Topic, BlogID: base.ID, Error: err.Error()})
+		return BlogPost{}, err
+	}
+	emitEvent(EventGenerationCompleted, base.OwnerID, GenerationEventData{Topic: base.Topic, BlogID: base.ID, Blog: eventBlog(blog)})
+	return blog, nil
+}
+
+// generateAndSave runs the scrape, generate and save steps of runGenerationPipeline
+func generateAndSave(ctx context.Context, base BlogPost, progress ProgressFunc) (BlogPost, error) {
+	if progress == nil {
+		progress = func(ProgressEvent) {}
+	}
+
+	topic := base.Topic
+	progress(ProgressEvent{Stage: StageScraping})
+	scrapedContents, pages, err := scrapeContentForTopic(ctx, topic, progress)
+	if err != nil {
+		return BlogPost{}, fmt.Errorf("failed to scrape content: %w", err)
+	}
+
+	return generateFromSources(ctx, base, scrapedContents, pages, progress)
+}
+
+// generateFromSources runs the generate and save steps of runGenerationPipeline on the
+// scraped contents, which were found on the given number of pages
+func generateFromSources(ctx context.Context, base BlogPost, scrapedContents []ScrapedContent, pages int, progress ProgressFunc) (BlogPost, error) {
+	topic := base.Topic
+	recordSources(ctx, len(scrapedContents))
+	if len(scrapedContents) == 0 {
+		return BlogPost{}, errNoContent
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, getEnvDuration("GENERATION_TIMEOUT", defaultGenerationTimeout))
+	defer cancel()
+
+	progress(ProgressEvent{Stage: StageGenerating, Pages: pages, Sources: len(scrapedContents)})
+	llamaResponse, err := GenerateBlogWithLlamaIndex(ctx, LlamaIndexRequest{
+		Topic:             topic,
+		Contents:          scrapedContents,
+		GenerationOptions: base.GenerationOptions,
+	})
+	attempts, usage := llamaResponse.Attempts, llamaResponse.Usage
+	if generationAttempts(err) > 0 {
+		attempts, usage = generationAttempts(err), generationUsage(err)
+	}
+	recordUsage(ctx, attempts, usage)
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		log.Printf("Generation for topic %q did not finish: %v", topic, err)
+		return BlogPost{}, fmt.Errorf("blog generation timed out: %w", err)
+	}
+	if err != nil {
+		return BlogPost{}, fmt.Errorf("failed to generate blog: %w", err)
+	}
+
+	progress(ProgressEvent{
+		Stage:    StageGenerated,
+		Pages:    pages,
+		Sources:  len(scrapedContents),
+		Sections: countSections(llamaResponse.Content),
+	})
+
+	lowConfidence, err := checkConfidence(topic, llamaResponse.Confidence)
+	if err != nil {
+		return BlogPost{}, err
+	}
+
+	imageURLs := blogImageURLs(llamaResponse)
+
+	// Serve the images from local copies so they outlive the upstream hosts, and proxy
+	// the rest through the backend to handle CORS
+	local := make(map[string]string)
+	if getEnvBool("PERSIST_IMAGES", true) {
+		local = persistBlogImages(llamaResponse)
+	}
+	serveImage := func(raw string) string {
+		if u, ok := local[raw]; ok {
+			return u
+		}
+		return proxiedImageURL(raw)
+	}
+	for i, block := range llamaResponse.Content {
+		if block.Type == "image" {
+			llamaResponse.Content[i].URL = serveImage(block.URL)
+		}
+	}
+	llamaResponse.FeaturedImage = serveImage(llamaResponse.FeaturedImage)
+
+	summary, originalSummary, summaryNeedsReview := processSummary(llamaResponse.Summary)
+	if summaryNeedsReview {
+		log.Printf("Summary for topic %q is suspiciously short, flagging for review", topic)
+	}
+
+	blog := BlogPost{
+		ID:            base.ID,
+		Title:         llamaResponse.Title,
+		Author:        "AI Content Generator",
+		Date:          base.Date,
+		Summary:       summary,
+		Content:       llamaResponse.Content,
+		FeaturedImage: llamaResponse.FeaturedImage,
+		Tags:          llamaResponse.Tags,
+		ReadingTime:   estimateReadingTime(llamaResponse.Content),
+		Topic:         topic,
+		Status:        base.Status,
+		SubmittedAt:   base.SubmittedAt,
+		PublishedAt:   base.PublishedAt,
+		StatusChanges: base.StatusChanges,
+		Confidence:    llamaResponse.Confidence,
+		LowConfidence: lowConfidence,
+
+		GenerationAttempts: llamaResponse.Attempts,
+
+		OriginalSummary:    originalSummary,
+		SummaryNeedsReview: summaryNeedsReview,
+
+		Publications:  base.Publications,
+		Slug:          base.Slug,
+		TranslationOf: base.TranslationOf,
+		Translations:  base.Translations,
+
+		GenerationOptions: base.GenerationOptions,
+	}
+	if blog.Slug == "" {
+		blog.Slug = slugify(blog.Title)
+	}
+	if err := checkLength(blog.Content, blog.Length); err != nil {
+		log.Printf("Blog for topic %q doesn't match the requested length: %v", topic, err)
+		blog.LengthMismatch = true
+	}
+	blog.Sources, blog.Simulated = blogSources(scrapedContents)
+	attributeSources(blog.Content, blog.Sources)
+	switch {
+	case blog.Status == "":
+		// New blogs are drafts unless AUTO_PUBLISH publishes those confident enough
+		blog.Status = StatusDraft
+		if getEnvBool("AUTO_PUBLISH", false) && !lowConfidence {
+			blog.Status = StatusPublished
+			blog.PublishedAt = time.Now().UTC().Format(time.RFC3339)
+		}
+	case lowConfidence && blog.Status != StatusDraft:
+		changeBlogStatus(&blog, StatusDraft, "")
+	}
+
+	blog, err = saveGeneratedBlog(blog, base.Slug != "")
+	if err != nil {
+		return BlogPost{}, fmt.Errorf("failed to save blog: %w", err)
+	}
+	storeGenerationSources(blog.ID, scrapedContents)
+
+	if getEnvBool("PREFETCH_IMAGES", false) {
+		go prefetchImages(imageURLs)
+	}
+
+	return blog, nil
+}
+
+// checkConfidence reports whether generated content for the topic falls below
+// MIN_CONFIDENCE, and should be saved as a draft, or returns errLowConfidence if
+// MIN_CONFIDENCE_ACTION=reject discards such content
+func checkConfidence(topic string, confidence float64) (bool, error) {
+	minConfidence, ok := getEnvFloat("MIN_CONFIDENCE")
+	if !ok || confidence >= minConfidence {
+		return false, nil
+	}
+	if getEnv("MIN_CONFIDENCE_ACTION", "draft") == "reject" {
+		return false, fmt.Errorf("%w: %.2f < %.2f", errLowConfidence, confidence, minConfidence)
+	}
+	log.Printf("Content for topic %q has low confidence %.2f, saving as draft", topic, confidence)
+	return true, nil
+}
+
+// saveGeneratedBlog stores a new blog, or merges a regenerated one onto the stored blog,
+// replacing only what the generator writes so that edits to other fields, status changes
+// and publications made while it was regenerating are kept. A regenerated blog that was
+// deleted in the meantime isn't stored again.
+func saveGeneratedBlog(blog BlogPost, regenerated bool) (BlogPost, error) {
+	if !regenerated {
+		return blog, saveBlogPost(blog)
+	}
+	return updateBlogPost(blog.ID, func(stored *BlogPost) error {
+		// Blogs saved before slugs were stored keep the slug of their old title
+		if stored.Slug == "" {
+			stored.Slug = blog.Slug
+		}
+		stored.Title = blog.Title
+		stored.Author = blog.Author
+		stored.Summary = blog.Summary
+		stored.OriginalSummary = blog.OriginalSummary
+		stored.SummaryNeedsReview = blog.SummaryNeedsReview
+		stored.Content = blog.Content
+		stored.FeaturedImage = blog.FeaturedImage
+		stored.Tags = blog.Tags
+		stored.ReadingTime = blog.ReadingTime
+		stored.Confidence = blog.Confidence
+		stored.LowConfidence = blog.LowConfidence
+		stored.GenerationAttempts = blog.GenerationAttempts
+		stored.LengthMismatch = blog.LengthMismatch
+		stored.Sources = blog.Sources
+		stored.Simulated = blog.Simulated
+		if stored.LowConfidence && blogStatus(*stored) != StatusDraft {
+			changeBlogStatus(stored, StatusDraft, "")
+		}
+		return nil
+	})
+}
+
+// countSections returns the number of sections in the content: one per heading, or a
+// single section for content without headings
+func countSections(content []BlogContent) int {
+	sections := 0
+	for _, block := range content {
+		if block.Type == "heading" {
+			sections++
+		}
+	}
+	if sections == 0 && len(content) > 0 {
+		return 1
+	}
+	return sections
+}
+
+// generationErrorStatus maps a pipeline error to the HTTP status reported to the client
+func generationErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errNoContent), errors.Is(err, errLowConfidence):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, errInvalidLlamaResponse):
+		return http.StatusBadGateway
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
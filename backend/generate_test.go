@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSaveGeneratedBlogMergesRegeneration(t *testing.T) {
+	useImageURLStore(t, "https://blog.example.com")
+	existing := revisionTestBlog()
+	existing.Slug = "solar-power"
+	existing.Topic = "solar power"
+	if err := saveBlogPost(existing); err != nil {
+		t.Fatal(err)
+	}
+	snapshot := regenerationBase(existing)
+
+	// The blog is published while it is regenerating
+	published, err := updateBlogPost(existing.ID, func(blog *BlogPost) error {
+		blog.Status = StatusPublished
+		blog.PublishedAt = "2024-05-02T09:00:00Z"
+		blog.Publications = map[string]Publication{"devto": {URL: "https://dev.to/solar-power"}}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	generated := BlogPost{
+		ID:      snapshot.ID,
+		Title:   "Solar power in 2024",
+		Summary: "Panels got cheaper.",
+		Content: []BlogContent{{Type: "paragraph", Text: "Panels are cheaper than ever."}},
+		Tags:    []string{"energy"},
+		Sources: []BlogSource{{URL: "https://news.example.com/solar", Title: "Solar"}},
+		Slug:    snapshot.Slug,
+		Status:  snapshot.Status,
+	}
+	blog, err := saveGeneratedBlog(generated, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := blogStore.GetByID(existing.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, got := range []BlogPost{blog, stored} {
+		if got.Title != generated.Title || !reflect.DeepEqual(got.Content, generated.Content) || !reflect.DeepEqual(got.Sources, generated.Sources) {
+			t.Errorf("merged blog has title %q, content %v and sources %v, want the generated ones", got.Title, got.Content, got.Sources)
+		}
+		if got.Status != StatusPublished || got.PublishedAt != published.PublishedAt || !reflect.DeepEqual(got.Publications, published.Publications) {
+			t.Errorf("merged blog has status %q, publishedAt %q and publications %v, want the ones set while regenerating", got.Status, got.PublishedAt, got.Publications)
+		}
+		if got.Slug != "solar-power" || got.Date != existing.Date || got.Topic != existing.Topic {
+			t.Errorf("merged blog has slug %q, date %q and topic %q, want the stored ones", got.Slug, got.Date, got.Topic)
+		}
+		if got.Revision != published.Revision+1 {
+			t.Errorf("merged blog is revision %d, want %d", got.Revision, published.Revision+1)
+		}
+	}
+}
+
+func TestSaveGeneratedBlogDemotesLowConfidence(t *testing.T) {
+	useImageURLStore(t, "https://blog.example.com")
+	existing := revisionTestBlog()
+	existing.Slug = "solar-power"
+	existing.Status = StatusPublished
+	if err := saveBlogPost(existing); err != nil {
+		t.Fatal(err)
+	}
+
+	blog, err := saveGeneratedBlog(BlogPost{ID: existing.ID, Title: "Solar", Slug: existing.Slug, LowConfidence: true}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blog.Status != StatusDraft {
+		t.Errorf("low-confidence regeneration left the blog %q, want %q", blog.Status, StatusDraft)
+	}
+}
+
+func TestSaveGeneratedBlogDeletedWhileRegenerating(t *testing.T) {
+	useImageURLStore(t, "https://blog.example.com")
+	_, err := saveGeneratedBlog(BlogPost{ID: revisionTestBlogID, Title: "Solar", Slug: "solar"}, true)
+	if !errors.Is(err, errBlogNotFound) {
+		t.Fatalf("saveGeneratedBlog = %v, want errBlogNotFound", err)
+	}
+	if _, err := blogStore.GetByID(revisionTestBlogID); !errors.Is(err, errBlogNotFound) {
+		t.Errorf("the deleted blog was stored again: %v", err)
+	}
+}
+
+func TestGenerateBlogFromSourcesLogsOutlineUsage(t *testing.T) {
+	useImageURLStore(t, "https://blog.example.com")
+	previousLog, previousJobs := generationLog, jobManager
+	t.Cleanup(func() { generationLog, jobManager = previousLog, previousJobs })
+	generationLog = &GenerationLog{size: defaultGenerationLogSize}
+	jobManager = &JobManager{slots: make(chan struct{}, 1)}
+	useGenerator(t, &fakeGenerator{results: []fakeResult{{response: LlamaIndexResponse{
+		Title:   "Solar power",
+		Summary: "About solar power.",
+		Content: []BlogContent{{Type: "paragraph", Text: "Panels turn sunlight into electricity."}},
+		Usage:   TokenUsage{InputTokens: 100, OutputTokens: 50},
+	}}}})
+
+	sources := []ScrapedContent{{URL: "https://news.example.com/solar", Title: "Solar news", Text: "Panel prices fell."}}
+	outlineUsage := TokenUsage{InputTokens: 30, OutputTokens: 10}
+	if _, err := generateBlogFromSources(context.Background(), "Solar power", "", GenerationOptions{}, sources, outlineUsage, func(ProgressEvent) {}); err != nil {
+		t.Fatal(err)
+	}
+
+	records := generationLog.Query(GenerationQuery{Page: 1, Limit: 10}).Generations
+	want := TokenUsage{InputTokens: 130, OutputTokens: 60}
+	if len(records) != 1 || records[0].Usage != want || records[0].Attempts != 2 {
+		t.Errorf("generation log %+v, want one generation with usage %+v over 2 attempts", records, want)
+	}
+}
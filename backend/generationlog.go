@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// defaultGenerationLogSize is how many generations the log keeps, overridable with
+// GENERATION_LOG_SIZE
+const defaultGenerationLogSize = 10000
+
+// Generation outcomes
+const (
+	OutcomeSucceeded = "succeeded"
+	OutcomeFailed    = "failed"
+	OutcomeCancelled = "cancelled"
+)
+
+// GenerationRecord describes one generation attempt: what was generated, for whom, from how
+// many sources, with how many tokens, and how it ended
+type GenerationRecord struct {
+	ID     string `json:"id"`
+	Topic  string `json:"topic"`
+	BlogID string `json:"blogId"`
+	// UserID is who the blog is generated for, empty for generations requested with an
+	// API key or without authentication
+	UserID string `json:"userId,omitempty"`
+	// Sources is the number of scraped articles the blog was generated from
+	Sources    int        `json:"sources"`
+	Attempts   int        `json:"attempts,omitempty"`
+	Usage      TokenUsage `json:"usage"`
+	Outcome    string     `json:"outcome"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt time.Time  `json:"finishedAt"`
+	// DurationMs is how long the generation ran, in milliseconds
+	DurationMs int64 `json:"durationMs"`
+}
+
+// GenerationLog keeps the latest generations in memory and appends each one to a file as
+// a line of JSON, so the log survives restarts
+type GenerationLog struct {
+	mu      sync.Mutex
+	path    string
+	size    int
+	records []GenerationRecord
+}
+
+var generationLog = &GenerationLog{size: defaultGenerationLogSize}
+
+// generationLogFile is where generations are logged, GENERATION_LOG_FILE or
+// generations.jsonl in the data directory
+func generationLogFile() string {
+	return getEnv("GENERATION_LOG_FILE", dataPath("generations.jsonl"))
+}
+
+// Load reads the latest generations logged at path, which may not exist yet. A file that
+// grew past twice the log's size is rewritten with only the generations kept.
+func (l *GenerationLog) Load(path string) error {
+	size := max(getEnvInt("GENERATION_LOG_SIZE", defaultGenerationLogSize), 1)
+
+	var records []GenerationRecord
+	lines := 0
+	file, err := os.Open(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			lines++
+			var record GenerationRecord
+			if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+				log.Printf("Skipping unreadable line %d of %s: %v", lines, path, err)
+				continue
+			}
+			records = append(records, record)
+			if len(records) > size {
+				records = records[1:]
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("failed to read %s: %v", path, err)
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.path = path
+	l.size = size
+	l.records = records
+	if lines > 2*size {
+		return l.rewrite()
+	}
+	return nil
+}
+
+// Add logs the generation
+func (l *GenerationLog) Add(record GenerationRecord) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.records = append(l.records, record)
+	if len(l.records) > l.size {
+		l.records = l.records[len(l.records)-l.size:]
+	}
+	if err := l.append(record); err != nil {
+		log.Printf("Failed to log generation %s: %v", record.ID, err)
+	}
+}
+
+// append writes the record to the end of the log's file. The caller must hold l.mu.
+func (l *GenerationLog) append(record GenerationRecord) error {
+	if l.path == "" {
+		return nil
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(line, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// rewrite replaces the log's file with the records kept in memory. The caller must hold
+// l.mu.
+func (l *GenerationLog) rewrite() error {
+	var data []byte
+	for _, record := range l.records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		data = append(append(data, line...), '\n')
+	}
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, l.path)
+}
+
+// GenerationQuery selects logged generations. Empty fields match every generation.
+type GenerationQuery struct {
+	// Topic matches topics containing it, ignoring case
+	Topic   string
+	UserID  string
+	Outcome string
+	From    time.Time
+	To      time.Time
+	Page    int
+	Limit   int
+}
+
+// GenerationLogResponse is a page of logged generations, newest first, with the totals of
+// every generation the query matched
+type GenerationLogResponse struct {
+	Generations []GenerationRecord `json:"generations"`
+	Total       int                `json:"total"`
+	Page        int                `json:"page"`
+	Limit       int                `json:"limit"`
+	// Outcomes counts the matched generations by outcome
+	Outcomes map[string]int `json:"outcomes"`
+	// Usage sums the tokens of the matched generations
+	Usage TokenUsage `json:"usage"`
+}
+
+// Query returns the page of generations matching q, newest first
+func (l *GenerationLog) Query(q GenerationQuery) GenerationLogResponse {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	response := GenerationLogResponse{
+		Generations: []GenerationRecord{},
+		Page:        q.Page,
+		Limit:       q.Limit,
+		Outcomes:    make(map[string]int),
+	}
+	start := (q.Page - 1) * q.Limit
+	for i := len(l.records) - 1; i >= 0; i-- {
+		record := l.records[i]
+		if !q.matches(record) {
+			continue
+		}
+		if response.Total >= start && len(response.Generations) < q.Limit {
+			response.Generations = append(response.Generations, record)
+		}
+		response.Total++
+		response.Outcomes[record.Outcome]++
+		response.Usage = response.Usage.Add(record.Usage)
+	}
+	return response
+}
+
+// matches reports whether the record is selected by the query
+func (q GenerationQuery) matches(record GenerationRecord) bool {
+	if q.Topic != "" && !strings.Contains(strings.ToLower(record.Topic), strings.ToLower(q.Topic)) {
+		return false
+	}
+	if q.UserID != "" && record.UserID != q.UserID {
+		return false
+	}
+	if q.Outcome != "" && record.Outcome != q.Outcome {
+		return false
+	}
+	if !q.From.IsZero() && record.StartedAt.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && record.StartedAt.After(q.To) {
+		return false
+	}
+	return true
+}
+
+type generationRecordKey struct{}
+
+// recordGeneration runs generate with a record of the generation in its context, for the
+// pipeline to fill in with recordSources and recordUsage, and logs the record once
+// generate returns
+func recordGeneration(ctx context.Context, base BlogPost, generate func(ctx context.Context) (BlogPost, error)) (BlogPost, error) {
+	record := &GenerationRecord{
+		ID:        uuid.New().String(),
+		Topic:     base.Topic,
+		BlogID:    base.ID,
+		UserID:    base.OwnerID,
+		StartedAt: time.Now().UTC(),
+	}
+	blog, err := generate(context.WithValue(ctx, generationRecordKey{}, record))
+
+	record.FinishedAt = time.Now().UTC()
+	record.DurationMs = record.FinishedAt.Sub(record.StartedAt).Milliseconds()
+	switch {
+	case err == nil:
+		record.Outcome = OutcomeSucceeded
+	case errors.Is(err, context.Canceled) || errors.Is(ctx.Err(), context.Canceled):
+		record.Outcome = OutcomeCancelled
+		record.Error = err.Error()
+	default:
+		record.Outcome = OutcomeFailed
+		record.Error = err.Error()
+	}
+	generationLog.Add(*record)
+	return blog, err
+}
+
+// recordSources notes the number of sources in the context's generation record, if any
+func recordSources(ctx context.Context, sources int) {
+	if record, ok := ctx.Value(generationRecordKey{}).(*GenerationRecord); ok {
+		record.Sources = sources
+	}
+}
+
+// recordUsage adds the generator's attempts and token usage to the context's generation
+// record, if any
+func recordUsage(ctx context.Context, attempts int, usage TokenUsage) {
+	if record, ok := ctx.Value(generationRecordKey{}).(*GenerationRecord); ok {
+		record.Attempts += attempts
+		record.Usage = record.Usage.Add(usage)
+	}
+}
+
+// parseGenerationQuery reads the generation log filters and pagination from the query string
+func parseGenerationQuery(r *http.Request) (GenerationQuery, error) {
+	query := r.URL.Query()
+	q := GenerationQuery{
+		Topic:   strings.TrimSpace(query.Get("topic")),
+		UserID:  strings.TrimSpace(query.Get("userId")),
+		Outcome: strings.TrimSpace(query.Get("outcome")),
+		Page:    1,
+		Limit:   defaultPageLimit,
+	}
+
+	switch q.Outcome {
+	case "", OutcomeSucceeded, OutcomeFailed, OutcomeCancelled:
+	default:
+		return q, fmt.Errorf("outcome must be one of %s, %s, %s", OutcomeSucceeded, OutcomeFailed, OutcomeCancelled)
+	}
+
+	if raw := query.Get("page"); raw != "" {
+		page, err := parsePage(raw)
+		if err != nil {
+			return q, err
+		}
+		q.Page = page
+	}
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 {
+			return q, fmt.Errorf("limit must be a positive integer")
+		}
+		q.Limit = min(limit, maxPageLimit)
+	}
+
+	for _, bound := range []struct {
+		name  string
+		value *time.Time
+	}{{"from", &q.From}, {"to", &q.To}} {
+		raw := query.Get(bound.name)
+		if raw == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			// A date covers the whole day
+			t, err = time.Parse("2006-01-02", raw)
+			if err != nil {
+				return q, fmt.Errorf("%s must be an RFC 3339 time or a date formatted as YYYY-MM-DD", bound.name)
+			}
+			if bound.name == "to" {
+				t = t.Add(24*time.Hour - time.Nanosecond)
+			}
+		}
+		*bound.value = t
+	}
+	return q, nil
+}
+
+// listGenerationsHandler returns the logged generations matching ?topic=, ?userId=,
+// ?outcome=, ?from= and ?to=, newest first
+func listGenerationsHandler(w http.ResponseWriter, r *http.Request) {
+	q, err := parseGenerationQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(generationLog.Query(q))
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGenerationQueryPage(t *testing.T) {
+	for _, tc := range []struct {
+		page    string
+		wantErr bool
+	}{
+		{"1", false},
+		{fmt.Sprint(maxPage), false},
+		{"0", true},
+		{fmt.Sprint(maxPage + 1), true},
+		{"922337203685477582", true},
+	} {
+		_, err := parseGenerationQuery(httptest.NewRequest("GET", "/api/generations?limit=100&page="+tc.page, nil))
+		if (err != nil) != tc.wantErr {
+			t.Errorf("page=%s: err %v, want error %v", tc.page, err, tc.wantErr)
+		}
+	}
+}
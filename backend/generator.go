@@ -0,0 +1,447 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// defaultLLMProvider is the generator used when LLM_PROVIDER is unset
+const defaultLLMProvider = "openai"
+
+// Limits on the free-text generation options
+const (
+	maxInstructionsLength = 2000
+	maxAudienceLength     = 200
+)
+
+// blogTones describes each tone a blog may be written in to the model. Blogs without a
+// tone are conversational.
+var blogTones = map[string]string{
+	"formal":         "formal and authoritative, without slang or contractions",
+	"conversational": "conversational and friendly, as if talking to the reader",
+	"persuasive":     "persuasive, building a case for its point of view and ending with a clear call to action",
+	"technical":      "technical and precise, using the field's terminology and concrete details",
+}
+
+// BlogLength is a requested blog length: the word count the model is asked for and the
+// range of word counts accepted
+type BlogLength struct {
+	Words    int
+	MinWords int
+	MaxWords int
+}
+
+// blogLengths are the lengths a blog may be requested at. Blogs without a length follow
+// the structure in blogSystemPrompt.
+var blogLengths = map[string]BlogLength{
+	"short":  {Words: 500, MinWords: 300, MaxWords: 800},
+	"medium": {Words: 1200, MinWords: 800, MaxWords: 1800},
+	"long":   {Words: 2500, MinWords: 1800, MaxWords: 3500},
+}
+
+// errLengthMismatch is returned when a generated blog's word count is outside the range
+// of the requested length
+var errLengthMismatch = errors.New("blog length doesn't match the requested length")
+
+// countWords counts the words of the content's headings and paragraphs
+func countWords(content []BlogContent) int {
+	words := 0
+	for _, block := range content {
+		if block.Type == "heading" || block.Type == "paragraph" {
+			words += len(strings.Fields(block.Text))
+		}
+	}
+	return words
+}
+
+// checkLength reports whether the content has about as many words as the length asks for.
+// Every content fits an empty length.
+func checkLength(content []BlogContent, length string) error {
+	target, ok := blogLengths[length]
+	if !ok {
+		return nil
+	}
+	if words := countWords(content); words < target.MinWords || words > target.MaxWords {
+		return fmt.Errorf("%w: %d words, expected %d-%d for a %s blog", errLengthMismatch, words, target.MinWords, target.MaxWords, length)
+	}
+	return nil
+}
+
+// GenerationOptions steer how a blog is written
+type GenerationOptions struct {
+	// Instructions are the requester's directions on structure and emphasis, such as
+	// "focus on financial impact, include a pros/cons section"
+	Instructions string `json:"instructions,omitempty"`
+	// Tone is one of blogTones
+	Tone string `json:"tone,omitempty"`
+	// Audience describes who the blog is written for, such as "small business owners"
+	Audience string `json:"audience,omitempty"`
+	// Length is one of blogLengths
+	Length string `json:"length,omitempty"`
+	// Language is the BCP 47 tag of the language the blog is written in, English if empty
+	Language string `json:"language,omitempty"`
+	// Outline is the approved outline the blog follows, if any
+	Outline []OutlineSection `json:"outline,omitempty"`
+}
+
+// validate checks the options given with a generation request, normalizing the language
+func (o *GenerationOptions) validate() error {
+	if len(o.Instructions) > maxInstructionsLength {
+		return fmt.Errorf("instructions can have at most %d characters", maxInstructionsLength)
+	}
+	if _, ok := blogTones[o.Tone]; o.Tone != "" && !ok {
+		return fmt.Errorf("tone must be one of %s", strings.Join(slices.Sorted(maps.Keys(blogTones)), ", "))
+	}
+	if len(o.Audience) > maxAudienceLength {
+		return fmt.Errorf("audience can have at most %d characters", maxAudienceLength)
+	}
+	if _, ok := blogLengths[o.Length]; o.Length != "" && !ok {
+		return fmt.Errorf("length must be one of %s", strings.Join(slices.Sorted(maps.Keys(blogLengths)), ", "))
+	}
+	if o.Language != "" {
+		language, err := parseLanguage(o.Language)
+		if err != nil {
+			return err
+		}
+		o.Language = language
+	}
+	return validateOutline(o.Outline)
+}
+
+// stylePrompt describes the language, tone, audience and length the options ask for,
+// empty for the defaults
+func (o GenerationOptions) stylePrompt() string {
+	var prompt strings.Builder
+	if o.Language != "" {
+		fmt.Fprintf(&prompt, "Write everything in %s (%s): the title, summary, tags, headings, paragraphs and image captions.\n", languageName(o.Language), o.Language)
+	}
+	if description, ok := blogTones[o.Tone]; ok {
+		fmt.Fprintf(&prompt, "Write in a %s tone: %s.\n", o.Tone, description)
+	}
+	if audience := strings.TrimSpace(o.Audience); audience != "" {
+		fmt.Fprintf(&prompt, "Write for this audience: %s. Pitch the explanations and examples at their level.\n", audience)
+	}
+	if length, ok := blogLengths[o.Length]; ok {
+		fmt.Fprintf(&prompt, "Write about %d words of headings and paragraphs in total, and no fewer than %d or more than %d, adjusting the number of sections and paragraphs to fit.\n", length.Words, length.MinWords, length.MaxWords)
+	}
+	return prompt.String()
+}
+
+// Generator writes a blog about a topic from scraped source articles
+type Generator interface {
+	Generate(ctx context.Context, request LlamaIndexRequest) (LlamaIndexResponse, error)
+	// Ready reports why the generator can't be used, such as a missing API key
+	Ready(ctx context.Context) error
+}
+
+// Completer is implemented by generators that can answer any prompt, not just write a
+// blog from sources. It's used to rewrite parts of existing blogs.
+type Completer interface {
+	// Complete returns the model's answer to the prompt with the system instructions, and
+	// the tokens it used
+	Complete(ctx context.Context, system, prompt string) (string, TokenUsage, error)
+}
+
+// errCompletionUnsupported is returned when the selected generator isn't a Completer
+var errCompletionUnsupported = errors.New("the selected LLM_PROVIDER can only generate whole blogs")
+
+// selectedCompleter returns the generator named by LLM_PROVIDER as a Completer
+func selectedCompleter() (Completer, error) {
+	generator, err := selectedGenerator()
+	if err != nil {
+		return nil, err
+	}
+	completer, ok := generator.(Completer)
+	if !ok {
+		return nil, errCompletionUnsupported
+	}
+	return completer, nil
+}
+
+// generators are the providers LLM_PROVIDER may select
+var generators = map[string]Generator{
+	"openai":    openAIGenerator{},
+	"anthropic": anthropicGenerator{},
+	"gemini":    geminiGenerator{},
+	"python":    pythonGenerator{},
+}
+
+// errUnknownProvider is returned when LLM_PROVIDER names no generator
+var errUnknownProvider = errors.New("unknown LLM_PROVIDER")
+
+// selectedGenerator returns the generator named by LLM_PROVIDER
+func selectedGenerator() (Generator, error) {
+	provider := getEnv("LLM_PROVIDER", defaultLLMProvider)
+	generator, ok := generators[provider]
+	if !ok {
+		names := make([]string, 0, len(generators))
+		for name := range generators {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("%w %q, expected one of %s", errUnknownProvider, provider, strings.Join(names, ", "))
+	}
+	return generator, nil
+}
+
+// TokenUsage counts the tokens a language model read and wrote
+type TokenUsage struct {
+	InputTokens  int `json:"inputTokens"`
+	OutputTokens int `json:"outputTokens"`
+}
+
+// Add returns the sum of both usages
+func (u TokenUsage) Add(other TokenUsage) TokenUsage {
+	return TokenUsage{
+		InputTokens:  u.InputTokens + other.InputTokens,
+		OutputTokens: u.OutputTokens + other.OutputTokens,
+	}
+}
+
+// chatMessage is one message of a chat-style model request
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// requireEnv returns the environment variable, or errMissingAPIKey if it is unset
+func requireEnv(key string) (string, error) {
+	value := getEnv(key, "")
+	if value == "" {
+		return "", fmt.Errorf("%w: %s is not set", errMissingAPIKey, key)
+	}
+	return value, nil
+}
+
+// maxPromptSourceChars bounds how much of each scraped article is sent to the model
+const maxPromptSourceChars = 4000
+
+// maxPromptSources bounds how many scraped articles are sent to the model
+const maxPromptSources = 15
+
+// errMissingAPIKey is returned when the selected provider has no API key configured
+var errMissingAPIKey = errors.New("missing API key")
+
+// Placeholder images used when Pexels has nothing for the topic
+const (
+	placeholderFeaturedImage = "https://via.placeholder.com/1200x600?text=Featured+Image+Not+Available"
+	placeholderContentImage  = "https://via.placeholder.com/900x500?text=Content+Image+Not+Available"
+)
+
+// llmClient is used for requests to the language model APIs, which are bounded by the
+// generation context rather than a client timeout
+var llmClient = &http.Client{}
+
+// blogSystemPrompt describes the blog structure and JSON format the model must produce
+const blogSystemPrompt = `You are a writer producing comprehensive, engaging blog posts that read like professional articles.
+Use only the facts in the provided source articles.
+Structure the blog as an introduction of 3-5 paragraphs with a hook, 3-5 main sections with descriptive headings and 4-6 paragraphs each, including examples from the sources and questions that engage the reader, and a conclusion of 2-3 paragraphs ending with a thought-provoking statement or call to action.
+Include exactly 2 image blocks: one before the introduction and one after it. Leave their "url" empty; images are filled in later.
+Respond with a JSON object with "title", "summary", "tags" (a list of strings) and "content", a list of blocks.
+Each block has a "type" of "heading" (with "text" and a "level" of 1 or 2), "paragraph" (with "text") or "image" (with "alt" and "caption").
+Give each paragraph "sources", a list of {"url"} objects naming the source articles its facts come from by the URLs given with them, or an empty list for paragraphs that state no facts from the sources.
+Keep the tone conversational unless asked for another, and the content well organized.`
+
+// blogUserPrompt lists the topic, the requested style, instructions and outline, and the
+// scraped articles the blog is written from
+func blogUserPrompt(request LlamaIndexRequest) string {
+	var prompt strings.Builder
+	fmt.Fprintf(&prompt, "Write a blog post about %q based on these source articles.\n", request.Topic)
+	prompt.WriteString(request.stylePrompt())
+	if instructions := strings.TrimSpace(request.Instructions); instructions != "" {
+		fmt.Fprintf(&prompt, "Follow these instructions on the post's structure and emphasis, as long as they don't contradict the format above:\n%s\n", instructions)
+	}
+	prompt.WriteString(request.outlinePrompt())
+	writePromptSources(&prompt, request.Contents)
+	return prompt.String()
+}
+
+// writePromptSources adds the scraped articles to a prompt, up to maxPromptSources of
+// them cut to maxPromptSourceChars each
+func writePromptSources(prompt *strings.Builder, contents []ScrapedContent) {
+	for i, content := range contents[:min(len(contents), maxPromptSources)] {
+		text := truncateUTF8(content.Text, maxPromptSourceChars)
+		fmt.Fprintf(prompt, "\nSource %d: %s\nURL: %s\nPublished: %s\n%s\n", i+1, content.Title, content.URL, content.PublishedAt, text)
+	}
+}
+
+// postJSON sends body as JSON to endpoint with the given headers and decodes the response into out
+func postJSON(ctx context.Context, endpoint string, headers map[string]string, body, out interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	return doJSONRequest(req, out)
+}
+
+// doJSONRequest sends the request and decodes a 200 JSON response into out. Rate limiting,
+// server errors and network failures are retryable.
+func doJSONRequest(req *http.Request, out interface{}) error {
+	resp, err := llmClient.Do(req)
+	if err != nil {
+		if req.Context().Err() != nil {
+			return req.Context().Err()
+		}
+		return &RetryableError{Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, stderrTailSize))
+		err := fmt.Errorf("status code %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+			return &RetryableError{Err: err}
+		}
+		return err
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return &RetryableError{Err: fmt.Errorf("failed to decode response: %v", err)}
+	}
+	return nil
+}
+
+// decodeModelJSON decodes the JSON written by a model into out, ignoring a Markdown code
+// fence around it
+func decodeModelJSON(text string, out interface{}) error {
+	text = strings.TrimSpace(text)
+	text = strings.TrimPrefix(text, "```json")
+	text = strings.TrimSuffix(strings.TrimPrefix(text, "```"), "```")
+	return json.Unmarshal([]byte(text), out)
+}
+
+// completeBlog parses the blog JSON written by a model and fills in its images and
+// confidence score the way the Python script does
+func completeBlog(ctx context.Context, topic, text string, sourceCount int) (LlamaIndexResponse, error) {
+	var response LlamaIndexResponse
+
+	if err := decodeModelJSON(text, &response); err != nil {
+		return response, fmt.Errorf("%w: blog is not valid JSON: %v", errInvalidLlamaResponse, err)
+	}
+
+	images := fetchPexelsImages(ctx, topic, 2)
+	featured, inline := placeholderFeaturedImage, placeholderContentImage
+	if len(images) > 0 {
+		featured = images[0]
+	}
+	if len(images) > 1 {
+		inline = images[1]
+	}
+	response.FeaturedImage = featured
+
+	// Keep at most two images, the first as the featured image and the second in the body
+	var content []BlogContent
+	imageCount := 0
+	for _, block := range response.Content {
+		if block.Type == "image" {
+			if imageCount == 2 {
+				continue
+			}
+			block.URL = []string{featured, inline}[imageCount]
+			block.Alt = strings.TrimSpace(block.Alt)
+			if block.Alt == "" {
+				block.Alt = fmt.Sprintf("Image for %s", topic)
+			}
+			imageCount++
+		}
+		if block.Type == "heading" && block.Level == 0 {
+			block.Level = 1
+		}
+		content = append(content, block)
+	}
+	if imageCount == 0 {
+		content = append([]BlogContent{{
+			Type:    "image",
+			URL:     featured,
+			Alt:     fmt.Sprintf("Featured image for %s", topic),
+			Caption: fmt.Sprintf("%s Overview", topic),
+		}}, content...)
+	}
+	response.Content = content
+
+	if len(response.Tags) == 0 {
+		response.Tags = []string{topic, "Insights", "Overview"}
+	}
+	response.Confidence = estimateConfidence(response, sourceCount)
+	return response, nil
+}
+
+// estimateConfidence is a 0-1 quality score based on source coverage and the structure
+// of the generated blog, matching the Python script's heuristic
+func estimateConfidence(blog LlamaIndexResponse, sourceCount int) float64 {
+	words, headings := 0, 0
+	for _, block := range blog.Content {
+		switch block.Type {
+		case "paragraph":
+			words += len(strings.Fields(block.Text))
+		case "heading":
+			headings++
+		}
+	}
+
+	score := float64(min(sourceCount, 5)) / 5
+	score *= float64(min(words, 800)) / 800
+	if headings < 3 {
+		score *= 0.8
+	}
+	return float64(int(score*100+0.5)) / 100
+}
+
+// fetchPexelsImages searches Pexels for up to count landscape photos of the topic,
+// returning none if PEXELS_API_KEY is unset or the search fails
+func fetchPexelsImages(ctx context.Context, topic string, count int) []string {
+	apiKey := getEnv("PEXELS_API_KEY", "")
+	if apiKey == "" {
+		return nil
+	}
+
+	query := url.Values{
+		"query":       {topic},
+		"per_page":    {fmt.Sprint(count)},
+		"orientation": {"landscape"},
+		"size":        {"large"},
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", "https://api.pexels.com/v1/search?"+query.Encode(), nil)
+	if err != nil {
+		return nil
+	}
+	req.Header.Set("Authorization", apiKey)
+
+	var result struct {
+		Photos []struct {
+			Src struct {
+				Large string `json:"large"`
+			} `json:"src"`
+		} `json:"photos"`
+	}
+	if err := doJSONRequest(req, &result); err != nil {
+		log.Printf("Failed to fetch Pexels images for topic %q: %v", topic, err)
+		return nil
+	}
+
+	var images []string
+	for _, photo := range result.Photos {
+		images = append(images, photo.Src.Large)
+	}
+	return images
+}
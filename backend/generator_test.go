@@ -0,0 +1,21 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestWritePromptSourcesCutsOnCharacters(t *testing.T) {
+	// An odd offset puts the cut in the middle of a two-byte character
+	text := "a" + strings.Repeat("é", maxPromptSourceChars)
+	var prompt strings.Builder
+	writePromptSources(&prompt, []ScrapedContent{{URL: "https://news.example.com/accents", Title: "Accents", Text: text}})
+
+	if !utf8.ValidString(prompt.String()) {
+		t.Fatal("the prompt isn't valid UTF-8")
+	}
+	if want := text[:maxPromptSourceChars-1] + "\n"; !strings.HasSuffix(prompt.String(), want) {
+		t.Errorf("the prompt doesn't end with the source cut to %d bytes", maxPromptSourceChars-1)
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Ghost Admin API settings. Tokens are short-lived, as Ghost requires, and excerpts are
+// cut to the length Ghost accepts.
+const (
+	ghostAPIVersion     = "v5.0"
+	ghostTokenLifetime  = 5 * time.Minute
+	ghostMaxExcerptSize = 300
+)
+
+// ghostPublisher publishes blogs through the Ghost Admin API, signing each request with a
+// JWT made from an Admin API key
+type ghostPublisher struct {
+	api    string
+	keyID  string
+	secret []byte
+}
+
+// ghostPost is a post in Ghost Admin API requests and responses
+type ghostPost struct {
+	ID            string     `json:"id,omitempty"`
+	URL           string     `json:"url,omitempty"`
+	Title         string     `json:"title,omitempty"`
+	HTML          string     `json:"html,omitempty"`
+	Status        string     `json:"status,omitempty"`
+	CustomExcerpt string     `json:"custom_excerpt,omitempty"`
+	FeatureImage  string     `json:"feature_image,omitempty"`
+	Tags          []ghostTag `json:"tags,omitempty"`
+	// UpdatedAt must be sent back unchanged when updating, so Ghost can detect conflicts
+	UpdatedAt string `json:"updated_at,omitempty"`
+}
+
+type ghostTag struct {
+	Name string `json:"name"`
+}
+
+// ghostPosts is the envelope of Ghost post requests and responses
+type ghostPosts struct {
+	Posts []ghostPost `json:"posts"`
+}
+
+// newGhostPublisher configures the Ghost target from GHOST_URL and GHOST_ADMIN_API_KEY,
+// the "id:secret" key of a Ghost custom integration
+func newGhostPublisher() (Publisher, error) {
+	site := strings.TrimRight(getEnv("GHOST_URL", ""), "/")
+	key := getEnv("GHOST_ADMIN_API_KEY", "")
+	if site == "" || key == "" {
+		return nil, fmt.Errorf("%w: set GHOST_URL and GHOST_ADMIN_API_KEY", errPublisherNotConfigured)
+	}
+	keyID, rawSecret, ok := strings.Cut(key, ":")
+	secret, err := hex.DecodeString(rawSecret)
+	if !ok || keyID == "" || err != nil || len(secret) == 0 {
+		return nil, fmt.Errorf("%w: GHOST_ADMIN_API_KEY must be an Admin API key in the id:secret form", errPublisherNotConfigured)
+	}
+	return &ghostPublisher{api: site + "/ghost/api/admin", keyID: keyID, secret: secret}, nil
+}
+
+// headers returns the headers of an Admin API request, with a freshly signed token
+func (p *ghostPublisher) headers() (map[string]string, error) {
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(ghostTokenLifetime)),
+		Audience:  jwt.ClaimStrings{"/admin/"},
+	})
+	token.Header["kid"] = p.keyID
+	signed, err := token.SignedString(p.secret)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{
+		"Authorization":  "Ghost " + signed,
+		"Accept-Version": ghostAPIVersion,
+	}, nil
+}
+
+// Publish creates or updates the Ghost post from the blog's HTML. Images served by this
+// backend are uploaded to Ghost once per image.
+func (p *ghostPublisher) Publish(ctx context.Context, blog BlogPost, previous *Publication, opts PublishOptions) (Publication, error) {
+	publication := Publication{Assets: make(map[string]RemoteAsset)}
+	if previous != nil {
+		for key, asset := range previous.Assets {
+			publication.Assets[key] = asset
+		}
+	}
+	imageURL := func(raw string) string {
+		key := assetKey(raw)
+		if asset, ok := publication.Assets[key]; ok {
+			return asset.URL
+		}
+		data, contentType, ok := readExportImage(raw)
+		if !ok {
+			return remoteImageURL(raw)
+		}
+		uploaded, err := p.uploadImage(ctx, data, contentType)
+		if err != nil {
+			log.Printf("Linking image %s instead of uploading it to Ghost: %v", raw, err)
+			return remoteImageURL(raw)
+		}
+		publication.Assets[key] = RemoteAsset{URL: uploaded}
+		return uploaded
+	}
+
+	content, err := blogContentHTML(blog, imageURL)
+	if err != nil {
+		return Publication{}, err
+	}
+	post := ghostPost{
+		Title:         blog.Title,
+		HTML:          content,
+		Status:        opts.Status,
+		CustomExcerpt: truncateAtWord(blog.Summary, ghostMaxExcerptSize),
+	}
+	if blog.FeaturedImage != "" {
+		post.FeatureImage = imageURL(blog.FeaturedImage)
+	}
+	for _, tag := range blog.Tags {
+		post.Tags = append(post.Tags, ghostTag{Name: tag})
+	}
+
+	var saved ghostPosts
+	create := previous == nil
+	if previous != nil {
+		err = p.update(ctx, previous.RemoteID, post, &saved)
+		// The post was deleted on Ghost, so create it again
+		create = errors.Is(err, errRemotePostNotFound)
+	}
+	if create {
+		err = p.send(ctx, http.MethodPost, p.api+"/posts/?source=html", ghostPosts{Posts: []ghostPost{post}}, &saved)
+	}
+	if err != nil {
+		return Publication{}, err
+	}
+	if len(saved.Posts) == 0 {
+		return Publication{}, fmt.Errorf("Ghost returned no post")
+	}
+
+	publication.RemoteID = saved.Posts[0].ID
+	publication.URL = saved.Posts[0].URL
+	return publication, nil
+}
+
+// update replaces the remote post, returning errRemotePostNotFound if it no longer exists
+func (p *ghostPublisher) update(ctx context.Context, id string, post ghostPost, saved *ghostPosts) error {
+	endpoint := p.api + "/posts/" + url.PathEscape(id) + "/"
+	var current ghostPosts
+	err := p.send(ctx, http.MethodGet, endpoint, nil, &current)
+	var remoteErr *publishError
+	if errors.As(err, &remoteErr) && remoteErr.StatusCode == http.StatusNotFound {
+		return errRemotePostNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if len(current.Posts) == 0 {
+		return errRemotePostNotFound
+	}
+
+	post.UpdatedAt = current.Posts[0].UpdatedAt
+	return p.send(ctx, http.MethodPut, endpoint+"?source=html", ghostPosts{Posts: []ghostPost{post}}, saved)
+}
+
+// send makes an Admin API request with a signed token
+func (p *ghostPublisher) send(ctx context.Context, method, endpoint string, body, out interface{}) error {
+	headers, err := p.headers()
+	if err != nil {
+		return err
+	}
+	return publishRequest(ctx, method, endpoint, headers, body, out)
+}
+
+// uploadImage uploads the image to Ghost, returning the URL Ghost serves it at
+func (p *ghostPublisher) uploadImage(ctx context.Context, data []byte, contentType string) (string, error) {
+	var form bytes.Buffer
+	writer := multipart.NewWriter(&form)
+	part, err := writer.CreatePart(map[string][]string{
+		"Content-Disposition": {fmt.Sprintf(`form-data; name="file"; filename="image.%s"`, imageExtensions[contentType])},
+		"Content-Type":        {contentType},
+	})
+	if err != nil {
+		return "", err
+	}
+	part.Write(data)
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+
+	headers, err := p.headers()
+	if err != nil {
+		return "", err
+	}
+	headers["Content-Type"] = writer.FormDataContentType()
+	var uploaded struct {
+		Images []struct {
+			URL string `json:"url"`
+		} `json:"images"`
+	}
+	err = publishRequest(ctx, http.MethodPost, p.api+"/images/upload/", headers, &form, &uploaded)
+	if err != nil {
+		return "", err
+	}
+	if len(uploaded.Images) == 0 {
+		return "", fmt.Errorf("Ghost returned no image")
+	}
+	return uploaded.Images[0].URL, nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Hashnode defaults and limits
+const (
+	defaultHashnodeAPIURL = "https://gql.hashnode.com"
+	hashnodeMaxSubtitle   = 150
+)
+
+// Hashnode GraphQL mutations creating and updating a post
+const (
+	hashnodePublishMutation = `mutation PublishPost($input: PublishPostInput!) {
+  publishPost(input: $input) { post { id url } }
+}`
+	hashnodeUpdateMutation = `mutation UpdatePost($input: UpdatePostInput!) {
+  updatePost(input: $input) { post { id url } }
+}`
+)
+
+// hashnodePublisher publishes blogs to a Hashnode publication through its GraphQL API
+type hashnodePublisher struct {
+	api           string
+	token         string
+	publicationID string
+}
+
+// hashnodePostInput is the input of the publishPost and updatePost mutations
+type hashnodePostInput struct {
+	ID                 string              `json:"id,omitempty"`
+	PublicationID      string              `json:"publicationId,omitempty"`
+	Title              string              `json:"title"`
+	Subtitle           string              `json:"subtitle,omitempty"`
+	ContentMarkdown    string              `json:"contentMarkdown"`
+	Tags               []hashnodeTag       `json:"tags"`
+	CoverImageOptions  *hashnodeCoverImage `json:"coverImageOptions,omitempty"`
+	OriginalArticleURL string              `json:"originalArticleURL,omitempty"`
+}
+
+type hashnodeTag struct {
+	Slug string `json:"slug"`
+	Name string `json:"name"`
+}
+
+type hashnodeCoverImage struct {
+	CoverImageURL string `json:"coverImageURL"`
+}
+
+// hashnodePostResponse is the response of the publishPost and updatePost mutations
+type hashnodePostResponse struct {
+	Data map[string]struct {
+		Post struct {
+			ID  string `json:"id"`
+			URL string `json:"url"`
+		} `json:"post"`
+	} `json:"data"`
+	Errors []struct {
+		Message    string `json:"message"`
+		Extensions struct {
+			Code string `json:"code"`
+		} `json:"extensions"`
+	} `json:"errors"`
+}
+
+// newHashnodePublisher configures the Hashnode target from HASHNODE_TOKEN,
+// HASHNODE_PUBLICATION_ID and HASHNODE_API_URL
+func newHashnodePublisher() (Publisher, error) {
+	token := getEnv("HASHNODE_TOKEN", "")
+	publicationID := getEnv("HASHNODE_PUBLICATION_ID", "")
+	if token == "" || publicationID == "" {
+		return nil, fmt.Errorf("%w: set HASHNODE_TOKEN and HASHNODE_PUBLICATION_ID", errPublisherNotConfigured)
+	}
+	return &hashnodePublisher{
+		api:           getEnv("HASHNODE_API_URL", defaultHashnodeAPIURL),
+		token:         token,
+		publicationID: publicationID,
+	}, nil
+}
+
+// Publish publishes the blog's Markdown as a Hashnode post, or updates the post it was
+// published as. Images are linked, and the blog's own URL is set as the original article.
+func (p *hashnodePublisher) Publish(ctx context.Context, blog BlogPost, previous *Publication, opts PublishOptions) (Publication, error) {
+	if opts.Status == StatusDraft {
+		return Publication{}, fmt.Errorf("%w: Hashnode posts can only be published, use status=published", errInvalidPublishOptions)
+	}
+
+	input := hashnodePostInput{
+		Title:              blog.Title,
+		Subtitle:           truncateAtWord(blog.Summary, hashnodeMaxSubtitle),
+		ContentMarkdown:    blogContentMarkdown(blog),
+		Tags:               []hashnodeTag{},
+		OriginalArticleURL: blogLink(blog),
+	}
+	for _, tag := range blog.Tags {
+		slug := slugify(tag)
+		if !slices.ContainsFunc(input.Tags, func(t hashnodeTag) bool { return t.Slug == slug }) {
+			input.Tags = append(input.Tags, hashnodeTag{Slug: slug, Name: tag})
+		}
+	}
+	if blog.FeaturedImage != "" {
+		input.CoverImageOptions = &hashnodeCoverImage{CoverImageURL: remoteImageURL(blog.FeaturedImage)}
+	}
+
+	var post Publication
+	var err error
+	create := previous == nil
+	if previous != nil {
+		update := input
+		update.ID = previous.RemoteID
+		post, err = p.mutate(ctx, "updatePost", hashnodeUpdateMutation, update)
+		// The post was deleted on Hashnode, so publish it again
+		create = errors.Is(err, errRemotePostNotFound)
+	}
+	if create {
+		input.PublicationID = p.publicationID
+		post, err = p.mutate(ctx, "publishPost", hashnodePublishMutation, input)
+	}
+	return post, err
+}
+
+// mutate runs a post mutation, returning the post's ID and URL
+func (p *hashnodePublisher) mutate(ctx context.Context, name, query string, input hashnodePostInput) (Publication, error) {
+	body := map[string]interface{}{
+		"query":     query,
+		"variables": map[string]interface{}{"input": input},
+	}
+	var response hashnodePostResponse
+	err := publishRequest(ctx, http.MethodPost, p.api, map[string]string{"Authorization": p.token}, body, &response)
+	if err != nil {
+		return Publication{}, err
+	}
+
+	if len(response.Errors) > 0 {
+		messages := make([]string, 0, len(response.Errors))
+		for _, e := range response.Errors {
+			if e.Extensions.Code == "NOT_FOUND" {
+				return Publication{}, fmt.Errorf("%w: %s", errRemotePostNotFound, e.Message)
+			}
+			messages = append(messages, e.Message)
+		}
+		return Publication{}, fmt.Errorf("Hashnode %s failed: %s", name, strings.Join(messages, "; "))
+	}
+	post := response.Data[name].Post
+	if post.ID == "" {
+		return Publication{}, fmt.Errorf("Hashnode %s returned no post", name)
+	}
+	return Publication{RemoteID: post.ID, URL: post.URL}, nil
+}
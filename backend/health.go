@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"time"
+)
+
+// readinessCheckTimeout bounds how long the Python interpreter check may take
+const readinessCheckTimeout = 5 * time.Second
+
+// ReadinessResponse reports the result of each readiness check
+type ReadinessResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+	Failed []string          `json:"failed,omitempty"`
+}
+
+// checkPython verifies that python3 is on PATH and can start
+func checkPython(ctx context.Context) error {
+	path, err := exec.LookPath("python3")
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, readinessCheckTimeout)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, path, "-c", "import sys").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, tail(string(output), 500))
+	}
+	return nil
+}
+
+// checkScript verifies that the LlamaIndex script exists and is a regular file
+func checkScript() error {
+	info, err := os.Stat(appConfig.PythonScript)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", appConfig.PythonScript)
+	}
+	return nil
+}
+
+// checkGenerator verifies that the generator selected by LLM_PROVIDER can be used
+func checkGenerator(ctx context.Context) error {
+	generator, err := selectedGenerator()
+	if err != nil {
+		return err
+	}
+	return generator.Ready(ctx)
+}
+
+// checkWritable verifies that files can be created in dir
+func checkWritable(dir string) error {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(dir, ".readyz-*")
+	if err != nil {
+		return err
+	}
+	file.Close()
+	return os.Remove(file.Name())
+}
+
+func readyzHandler(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]error{
+		"generator": checkGenerator(r.Context()),
+		"dataDir":   checkWritable(blogDataDir()),
+		"search":    checkSearchProvider(),
+	}
+
+	response := ReadinessResponse{Status: "ready", Checks: make(map[string]string)}
+	for name, err := range checks {
+		if err != nil {
+			response.Checks[name] = err.Error()
+			response.Failed = append(response.Failed, name)
+			continue
+		}
+		response.Checks[name] = "ok"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if len(response.Failed) > 0 {
+		sort.Strings(response.Failed)
+		response.Status = "not ready"
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(response)
+}
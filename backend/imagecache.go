@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Image cache defaults, overridable with IMAGE_CACHE_TTL and IMAGE_CACHE_MAX_BYTES
+const (
+	defaultImageCacheTTL      = 7 * 24 * time.Hour
+	defaultImageCacheMaxBytes = 500 * 1024 * 1024
+)
+
+// maxImageSize is the largest upstream image the proxy will cache
+const maxImageSize = 20 * 1024 * 1024
+
+// errImageTooLarge is returned when an upstream image exceeds maxImageSize
+var errImageTooLarge = errors.New("image is too large")
+
+// ImageCacheEntry describes an image stored in the cache. The bytes live next to the
+// metadata in a file named after the hash of the upstream URL.
+type ImageCacheEntry struct {
+	URL         string    `json:"url"`
+	ContentType string    `json:"contentType"`
+	ETag        string    `json:"etag"`
+	Size        int64     `json:"size"`
+	FetchedAt   time.Time `json:"fetchedAt"`
+
+	path string
+}
+
+// ImageCache is an on-disk cache of proxied images with TTL expiry and LRU eviction
+type ImageCache struct {
+	dir      string
+	ttl      time.Duration
+	maxBytes int64
+
+	// evictMu serializes eviction so concurrent stores don't race deleting files
+	evictMu sync.Mutex
+	flight  singleflight.Group
+}
+
+// getImageCache returns the image cache, configuring it on first use
+var getImageCache = sync.OnceValue(func() *ImageCache {
+	return &ImageCache{
+		dir:      getEnv("IMAGE_CACHE_DIR", dataPath("image-cache")),
+		ttl:      getEnvDuration("IMAGE_CACHE_TTL", defaultImageCacheTTL),
+		maxBytes: int64(getEnvInt("IMAGE_CACHE_MAX_BYTES", defaultImageCacheMaxBytes)),
+	}
+})
+
+func imageCacheKey(imageURL string) string {
+	sum := sha256.Sum256([]byte(imageURL))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *ImageCache) dataPath(key string) string {
+	return filepath.Join(c.dir, key)
+}
+
+func (c *ImageCache) metaPath(key string) string {
+	return filepath.Join(c.dir, key+".json")
+}
+
+// lookup returns the cached entry if present and fresh, marking it as recently used
+func (c *ImageCache) lookup(key string) (ImageCacheEntry, bool) {
+	data, err := os.ReadFile(c.metaPath(key))
+	if err != nil {
+		return ImageCacheEntry{}, false
+	}
+
+	var entry ImageCacheEntry
+	if json.Unmarshal(data, &entry) != nil || time.Since(entry.FetchedAt) > c.ttl {
+		return ImageCacheEntry{}, false
+	}
+
+	entry.path = c.dataPath(key)
+	now := time.Now()
+	if os.Chtimes(entry.path, now, now) != nil {
+		return ImageCacheEntry{}, false
+	}
+	return entry, true
+}
+
+// Fetch returns the cached image for the URL, fetching and storing it first if it is
+// missing or stale. Concurrent fetches of the same URL share a single upstream request.
+func (c *ImageCache) Fetch(imageURL string) (ImageCacheEntry, error) {
+	key := imageCacheKey(imageURL)
+	if entry, ok := c.lookup(key); ok {
+		return entry, nil
+	}
+
+	result, err, _ := c.flight.Do(key, func() (interface{}, error) {
+		if entry, ok := c.lookup(key); ok {
+			return entry, nil
+		}
+		return c.store(key, imageURL)
+	})
+	if err != nil {
+		return ImageCacheEntry{}, err
+	}
+	return result.(ImageCacheEntry), nil
+}
+
+// Remove deletes the cached image for the URL, if any
+func (c *ImageCache) Remove(imageURL string) {
+	c.evictMu.Lock()
+	defer c.evictMu.Unlock()
+
+	key := imageCacheKey(imageURL)
+	os.Remove(c.metaPath(key))
+	os.Remove(c.dataPath(key))
+}
+
+// store downloads the image and writes its bytes and metadata to the cache. The image's
+// type is taken from its leading bytes, which must be an allowed image type.
+func (c *ImageCache) store(key, imageURL string) (ImageCacheEntry, error) {
+	resp, err := fetchImage(imageURL)
+	if err != nil {
+		return ImageCacheEntry{}, err
+	}
+	defer resp.Body.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(resp.Body, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return ImageCacheEntry{}, err
+	}
+	head = head[:n]
+	contentType := sniffImageType(head)
+	if contentType == "" {
+		return ImageCacheEntry{}, fmt.Errorf("%w: content doesn't match %q", errUnsupportedMediaType, resp.Header.Get("Content-Type"))
+	}
+	body := io.MultiReader(bytes.NewReader(head), resp.Body)
+
+	err = os.MkdirAll(c.dir, 0755)
+	if err != nil {
+		return ImageCacheEntry{}, err
+	}
+
+	tmp, err := os.CreateTemp(c.dir, key+".*.tmp")
+	if err != nil {
+		return ImageCacheEntry{}, err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), io.LimitReader(body, maxImageSize+1))
+	closeErr := tmp.Close()
+	if err != nil {
+		return ImageCacheEntry{}, err
+	}
+	if closeErr != nil {
+		return ImageCacheEntry{}, closeErr
+	}
+	if size > maxImageSize {
+		return ImageCacheEntry{}, errImageTooLarge
+	}
+
+	entry := ImageCacheEntry{
+		URL:         imageURL,
+		ContentType: contentType,
+		ETag:        fmt.Sprintf(`"%s"`, hex.EncodeToString(hash.Sum(nil))[:32]),
+		Size:        size,
+		FetchedAt:   time.Now(),
+		path:        c.dataPath(key),
+	}
+
+	err = os.Rename(tmp.Name(), entry.path)
+	if err != nil {
+		return ImageCacheEntry{}, err
+	}
+
+	meta, err := json.Marshal(entry)
+	if err != nil {
+		return ImageCacheEntry{}, err
+	}
+	err = os.WriteFile(c.metaPath(key), meta, 0644)
+	if err != nil {
+		return ImageCacheEntry{}, err
+	}
+
+	c.evict()
+	return entry, nil
+}
+
+// evict removes expired images, then the least recently used ones until the cache fits in
+// maxBytes
+func (c *ImageCache) evict() {
+	c.evictMu.Lock()
+	defer c.evictMu.Unlock()
+
+	files, err := os.ReadDir(c.dir)
+	if err != nil {
+		log.Printf("Failed to read image cache: %v", err)
+		return
+	}
+
+	type cachedFile struct {
+		key    string
+		size   int64
+		usedAt time.Time
+	}
+	// The metadata file is written once per fetch, so its modification time is when the
+	// image was fetched; lookups only touch the image file
+	fetchedAt := make(map[string]time.Time)
+	for _, file := range files {
+		if key, ok := strings.CutSuffix(file.Name(), ".json"); ok {
+			if info, err := file.Info(); err == nil {
+				fetchedAt[key] = info.ModTime()
+			}
+		}
+	}
+
+	var cached []cachedFile
+	var total int64
+	for _, file := range files {
+		name := file.Name()
+		if strings.Contains(name, ".") {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+		// Images without metadata are still being stored
+		if fetched, ok := fetchedAt[name]; ok && time.Since(fetched) > c.ttl {
+			os.Remove(c.metaPath(name))
+			os.Remove(c.dataPath(name))
+			continue
+		}
+		cached = append(cached, cachedFile{key: name, size: info.Size(), usedAt: info.ModTime()})
+		total += info.Size()
+	}
+
+	if total <= c.maxBytes {
+		return
+	}
+
+	sort.Slice(cached, func(i, j int) bool {
+		return cached[i].usedAt.Before(cached[j].usedAt)
+	})
+	for _, file := range cached {
+		if total <= c.maxBytes {
+			break
+		}
+		os.Remove(c.metaPath(file.key))
+		os.Remove(c.dataPath(file.key))
+		total -= file.size
+	}
+}
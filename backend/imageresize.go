@@ -0,0 +1,226 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Image variant defaults. Requested sizes are rounded up to one of the variant sizes, so
+// each image has a handful of variants on disk; IMAGE_VARIANT_SIZES replaces them.
+const (
+	defaultImageQuality = 80
+	// maxImagePixels bounds the images decoded for resizing, against decompression bombs
+	maxImagePixels = 50_000_000
+)
+
+var defaultImageVariantSizes = []int{320, 768, 1280}
+
+// errInvalidImageVariant is returned for width, height or quality parameters out of range
+var errInvalidImageVariant = errors.New("invalid image size or quality")
+
+// resizableImageTypes are the stored image types that can be decoded for resizing. GIFs
+// are left alone to keep their animation, and AVIF has no Go decoder.
+var resizableImageTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/webp": true,
+}
+
+// ImageVariant is a resized copy of a stored image, fitting within Width x Height. A zero
+// Width or Height leaves that side unconstrained.
+type ImageVariant struct {
+	Width   int
+	Height  int
+	Quality int
+}
+
+// imageVariantSizes returns the sizes images are resized to, from the comma-separated
+// IMAGE_VARIANT_SIZES
+func imageVariantSizes() []int {
+	var sizes []int
+	for _, raw := range splitList(getEnv("IMAGE_VARIANT_SIZES", "")) {
+		size, err := strconv.Atoi(raw)
+		if err != nil || size < 1 {
+			continue
+		}
+		sizes = append(sizes, size)
+	}
+	if len(sizes) == 0 {
+		return defaultImageVariantSizes
+	}
+	slices.Sort(sizes)
+	return sizes
+}
+
+// snapImageSize rounds size up to the nearest variant size, or down to the largest
+func snapImageSize(size int, sizes []int) int {
+	for _, variant := range sizes {
+		if size <= variant {
+			return variant
+		}
+	}
+	return sizes[len(sizes)-1]
+}
+
+// parseImageVariant reads the w, h and q query parameters, reporting whether the image
+// should be resized. Without w and h the original image is served; without q the default
+// quality is used.
+func parseImageVariant(query url.Values) (ImageVariant, bool, error) {
+	parse := func(name string, maximum int) (int, error) {
+		raw := query.Get(name)
+		if raw == "" {
+			return 0, nil
+		}
+		value, err := strconv.Atoi(raw)
+		if err != nil || value < 1 || value > maximum {
+			return 0, fmt.Errorf("%w: %s=%q", errInvalidImageVariant, name, raw)
+		}
+		return value, nil
+	}
+
+	width, err := parse("w", 10000)
+	if err != nil {
+		return ImageVariant{}, false, err
+	}
+	height, err := parse("h", 10000)
+	if err != nil {
+		return ImageVariant{}, false, err
+	}
+	quality, err := parse("q", 100)
+	if err != nil {
+		return ImageVariant{}, false, err
+	}
+
+	variant := ImageVariant{Quality: defaultImageQuality}
+	if quality > 0 {
+		variant.Quality = quality
+	}
+	if width == 0 && height == 0 {
+		return variant, false, nil
+	}
+
+	sizes := imageVariantSizes()
+	if width > 0 {
+		variant.Width = snapImageSize(width, sizes)
+	}
+	if height > 0 {
+		variant.Height = snapImageSize(height, sizes)
+	}
+	return variant, true, nil
+}
+
+// fit returns the size of a width x height image scaled down to fit the variant, keeping
+// its aspect ratio
+func (v ImageVariant) fit(width, height int) (int, int) {
+	scale := 1.0
+	if v.Width > 0 && width > v.Width {
+		scale = float64(v.Width) / float64(width)
+	}
+	if v.Height > 0 && float64(height)*scale > float64(v.Height) {
+		scale = float64(v.Height) / float64(height)
+	}
+	return max(int(float64(width)*scale+0.5), 1), max(int(float64(height)*scale+0.5), 1)
+}
+
+func (s *ImageStore) variantPath(id string, v ImageVariant) string {
+	return filepath.Join(s.dir, "variants", fmt.Sprintf("%s_%dx%d_q%d", id, v.Width, v.Height, v.Quality))
+}
+
+// Variant returns the path of the image resized to fit the variant, creating it on first
+// request. Images that can't be resized, or are already small enough, are returned as is.
+func (s *ImageStore) Variant(image StoredImage, v ImageVariant) (string, error) {
+	if !resizableImageTypes[image.ContentType] {
+		return s.dataPath(image.ID), nil
+	}
+
+	path := s.variantPath(image.ID, v)
+	result, err, _ := s.flight.Do(path, func() (interface{}, error) {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+		return s.resize(image, v, path)
+	})
+	if err != nil {
+		return "", err
+	}
+	return result.(string), nil
+}
+
+// resize writes the variant of the image to path. Opaque images are encoded as JPEG at
+// the variant's quality, PNGs and images with transparency as PNG.
+func (s *ImageStore) resize(stored StoredImage, v ImageVariant, path string) (string, error) {
+	original := s.dataPath(stored.ID)
+	file, err := os.Open(original)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read image %s: %v", stored.ID, err)
+	}
+	if config.Width*config.Height > maxImagePixels {
+		return "", fmt.Errorf("image %s is too large to resize (%dx%d)", stored.ID, config.Width, config.Height)
+	}
+	width, height := v.fit(config.Width, config.Height)
+	if width == config.Width && height == config.Height {
+		return original, nil
+	}
+
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", err
+	}
+	src, _, err := image.Decode(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode image %s: %v", stored.ID, err)
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Src, nil)
+
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "variant.*.tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	if stored.ContentType == "image/png" || !dst.Opaque() {
+		err = png.Encode(tmp, dst)
+	} else {
+		err = jpeg.Encode(tmp, dst, &jpeg.Options{Quality: v.Quality})
+	}
+	closeErr := tmp.Close()
+	if err != nil {
+		return "", err
+	}
+	if closeErr != nil {
+		return "", closeErr
+	}
+	return path, os.Rename(tmp.Name(), path)
+}
+
+// removeVariants deletes the resized and converted copies of the stored image
+func (s *ImageStore) removeVariants(id string) {
+	variants, _ := filepath.Glob(filepath.Join(s.dir, "variants", id+"_*"))
+	for _, variant := range variants {
+		os.Remove(variant)
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultPrefetchConcurrency bounds how many images are prefetched at once
+const defaultPrefetchConcurrency = 4
+
+// maxImageRedirects bounds how many redirects the image proxy follows
+const maxImageRedirects = 5
+
+// errUnsupportedMediaType is returned when the upstream response isn't an image
+var errUnsupportedMediaType = errors.New("upstream response is not an image")
+
+// allowedImageTypes are the image types the proxy serves. SVG is left out since it can
+// carry scripts.
+var allowedImageTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+	"image/avif": true,
+}
+
+// imageExtensions are the file extensions of the allowed image types
+var imageExtensions = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+	"image/webp": "webp",
+	"image/avif": "avif",
+}
+
+// sniffImageType returns the allowed image type the leading bytes of a file are in, or ""
+// if they aren't one. Upstream Content-Type headers aren't trusted.
+func sniffImageType(head []byte) string {
+	// http.DetectContentType doesn't know AVIF, an ISO media file with an avif brand
+	if len(head) >= 12 && string(head[4:8]) == "ftyp" &&
+		(string(head[8:12]) == "avif" || string(head[8:12]) == "avis") {
+		return "image/avif"
+	}
+	detected := http.DetectContentType(head)
+	if allowedImageTypes[detected] {
+		return detected
+	}
+	return ""
+}
+
+var imageClient = &http.Client{
+	Timeout: 15 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: publicOnlyControl,
+		}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxImageRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxImageRedirects)
+		}
+		_, err := validateImageURL(req.URL.String())
+		return err
+	},
+}
+
+// UpstreamStatusError is returned when the upstream image host responds with a non-200 status
+type UpstreamStatusError struct {
+	StatusCode int
+}
+
+func (e *UpstreamStatusError) Error() string {
+	return fmt.Sprintf("status code %d", e.StatusCode)
+}
+
+// fetchImage requests the upstream image, returning the response only for a 200 status
+// with an allowed image content type and a size within maxImageSize, if declared. The
+// caller must close the response body.
+func fetchImage(imageURL string) (*http.Response, error) {
+	target, err := validateImageURL(imageURL)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", target.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36")
+
+	resp, err := imageClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, &UpstreamStatusError{StatusCode: resp.StatusCode}
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if !allowedImageTypes[mediaType] {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: content type %q", errUnsupportedMediaType, resp.Header.Get("Content-Type"))
+	}
+	if resp.ContentLength > maxImageSize {
+		resp.Body.Close()
+		return nil, errImageTooLarge
+	}
+	return resp, nil
+}
+
+// proxiedImageURL returns the signed URL that serves the upstream image through this
+// backend's proxy
+func proxiedImageURL(raw string) string {
+	return fmt.Sprintf("%s/api/proxy-image?%s", backendBaseURL(), signImageURL(raw).Encode())
+}
+
+// proxyImageHandler serves upstream images for URLs signed by proxiedImageURL, so the proxy
+// only fetches images the backend put in a blog
+func proxyImageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("url") == "" {
+		http.Error(w, "Image URL is required", http.StatusBadRequest)
+		return
+	}
+	imageURL, err := verifyImageURL(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	entry, err := getImageCache().Fetch(imageURL)
+	if err != nil {
+		log.Printf("Failed to fetch image from %s: %v", imageURL, err)
+		status := http.StatusInternalServerError
+		var upstreamErr *UpstreamStatusError
+		switch {
+		case errors.Is(err, errForbiddenURL):
+			status = http.StatusForbidden
+		case errors.Is(err, errUnsupportedMediaType):
+			status = http.StatusUnsupportedMediaType
+		case errors.Is(err, errImageTooLarge):
+			status = http.StatusRequestEntityTooLarge
+		case errors.As(err, &upstreamErr):
+			status = upstreamErr.StatusCode
+		}
+		http.Error(w, "Failed to fetch image: "+err.Error(), status)
+		return
+	}
+
+	file, err := os.Open(entry.path)
+	if err != nil {
+		http.Error(w, "Failed to read cached image: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	// ServeContent answers If-None-Match with 304 using the ETag set here
+	w.Header().Set("Content-Type", entry.ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	w.Header().Set("ETag", entry.ETag)
+	// Browsers may keep the image for as long as the cache still considers it fresh
+	maxAge := max(getImageCache().ttl-time.Since(entry.FetchedAt), 0)
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds())))
+	http.ServeContent(w, r, "", entry.FetchedAt, file)
+}
+
+// blogImageURLs returns the upstream URLs of every image in the generated blog
+func blogImageURLs(response LlamaIndexResponse) []string {
+	var urls []string
+	seen := make(map[string]bool)
+	add := func(u string) {
+		if u != "" && !seen[u] {
+			seen[u] = true
+			urls = append(urls, u)
+		}
+	}
+
+	add(response.FeaturedImage)
+	for _, block := range response.Content {
+		if block.Type == "image" {
+			add(block.URL)
+		}
+	}
+	return urls
+}
+
+// upstreamImageURL returns the URL a proxied image URL points at, or the URL itself if it
+// isn't proxied
+func upstreamImageURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || !strings.HasSuffix(u.Path, "/api/proxy-image") {
+		return raw
+	}
+	return u.Query().Get("url")
+}
+
+// storedImageURLs returns the upstream URLs of the images in a saved blog
+func storedImageURLs(blog BlogPost) []string {
+	var urls []string
+	add := func(raw string) {
+		if u := upstreamImageURL(raw); u != "" {
+			urls = append(urls, u)
+		}
+	}
+
+	add(blog.FeaturedImage)
+	for _, block := range blog.Content {
+		if block.Type == "image" {
+			add(block.URL)
+		}
+	}
+	return urls
+}
+
+// removeCachedImages drops the deleted blog's images from the image cache and the image
+// store unless another stored blog still uses them
+func removeCachedImages(deleted BlogPost) {
+	urls := storedImageURLs(deleted)
+	if len(urls) == 0 {
+		return
+	}
+
+	blogs, err := getAllBlogs()
+	if err != nil {
+		log.Printf("Not removing cached images of blog %s: %v", deleted.ID, err)
+		return
+	}
+	inUse := make(map[string]bool)
+	for _, blog := range blogs {
+		for _, u := range storedImageURLs(blog) {
+			inUse[u] = true
+		}
+	}
+
+	cache := getImageCache()
+	for _, u := range urls {
+		if inUse[u] {
+			continue
+		}
+		if id, ok := storedImageID(u); ok {
+			getImageStore().Remove(id)
+		} else {
+			cache.Remove(u)
+		}
+	}
+}
+
+// prefetchImages loads the images into the proxy's cache with bounded concurrency so they
+// are warm before the blog is first viewed. Failures are only logged.
+func prefetchImages(urls []string) {
+	concurrency := max(getEnvInt("PREFETCH_CONCURRENCY", defaultPrefetchConcurrency), 1)
+	sem := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+	for _, imageURL := range urls {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(imageURL string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			_, err := getImageCache().Fetch(imageURL)
+			if err != nil {
+				log.Printf("Failed to prefetch image %s: %v", imageURL, err)
+			}
+		}(imageURL)
+	}
+	wg.Wait()
+	log.Printf("Prefetched %d images", len(urls))
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultImageURLTTL is how long a signed image URL is valid, overridable with IMAGE_URL_TTL
+const defaultImageURLTTL = 24 * time.Hour
+
+// errInvalidImageSignature is returned for proxy requests whose signature is missing,
+// wrong or expired
+var errInvalidImageSignature = errors.New("image URL signature is invalid or expired")
+
+// imageSigningKey signs the proxied image URLs. Without IMAGE_URL_SECRET a random key is
+// used; stored blogs are re-signed when read, so only URLs handed out before a restart
+// stop working.
+var imageSigningKey = sync.OnceValue(func() []byte {
+	if secret := getEnv("IMAGE_URL_SECRET", ""); secret != "" {
+		return []byte(secret)
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return key
+})
+
+// imageSignature returns the HMAC of the upstream URL and expiry time
+func imageSignature(imageURL string, expires int64) string {
+	mac := hmac.New(sha256.New, imageSigningKey())
+	mac.Write([]byte(imageURL + "\n" + strconv.FormatInt(expires, 10)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// signImageURL returns the query of a proxy URL for the upstream image, valid for IMAGE_URL_TTL
+func signImageURL(imageURL string) url.Values {
+	expires := time.Now().Add(getEnvDuration("IMAGE_URL_TTL", defaultImageURLTTL)).Unix()
+	return url.Values{
+		"url":     {imageURL},
+		"expires": {strconv.FormatInt(expires, 10)},
+		"sig":     {imageSignature(imageURL, expires)},
+	}
+}
+
+// verifyImageURL checks the signature and expiry of a proxy request's query, returning
+// the upstream URL it was signed for
+func verifyImageURL(query url.Values) (string, error) {
+	imageURL := query.Get("url")
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return "", errInvalidImageSignature
+	}
+	if !hmac.Equal([]byte(query.Get("sig")), []byte(imageSignature(imageURL, expires))) {
+		return "", errInvalidImageSignature
+	}
+	return imageURL, nil
+}
+
+// isProxiedImageURL reports whether raw points at this backend's image proxy
+func isProxiedImageURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && strings.HasSuffix(u.Path, "/api/proxy-image")
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerifyImageURL(t *testing.T) {
+	const imageURL = "https://images.example.com/panel.jpg"
+	signed := signImageURL(imageURL)
+	expired := time.Now().Add(-time.Minute).Unix()
+
+	tests := []struct {
+		name  string
+		query func(url.Values)
+		valid bool
+	}{
+		{"signed", func(url.Values) {}, true},
+		{"other image", func(q url.Values) { q.Set("url", "https://images.example.com/other.jpg") }, false},
+		{"tampered signature", func(q url.Values) { q.Set("sig", q.Get("sig")[1:]+"A") }, false},
+		{"missing signature", func(q url.Values) { q.Del("sig") }, false},
+		{"extended expiry", func(q url.Values) { q.Set("expires", strconv.FormatInt(time.Now().Add(48*time.Hour).Unix(), 10)) }, false},
+		{"expired", func(q url.Values) {
+			q.Set("expires", strconv.FormatInt(expired, 10))
+			q.Set("sig", imageSignature(imageURL, expired))
+		}, false},
+		{"malformed expiry", func(q url.Values) { q.Set("expires", "soon") }, false},
+	}
+	for _, tt := range tests {
+		query := url.Values{}
+		for key, values := range signed {
+			query[key] = append([]string(nil), values...)
+		}
+		tt.query(query)
+
+		got, err := verifyImageURL(query)
+		if tt.valid && (err != nil || got != imageURL) {
+			t.Errorf("%s: verifyImageURL = %q, %v, want %q", tt.name, got, err, imageURL)
+		}
+		if !tt.valid && !errors.Is(err, errInvalidImageSignature) {
+			t.Errorf("%s: verifyImageURL error %v, want %v", tt.name, err, errInvalidImageSignature)
+		}
+	}
+}
+
+func TestProxyImageHandlerRejectsUnsignedURLs(t *testing.T) {
+	rec := httptest.NewRecorder()
+	proxyImageHandler(rec, httptest.NewRequest("GET", "/api/proxy-image?url="+url.QueryEscape("http://169.254.169.254/latest/meta-data"), nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("unsigned proxy request: status %d, want %d", rec.Code, http.StatusForbidden)
+	}
+}
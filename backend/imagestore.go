@@ -0,0 +1,261 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/sync/singleflight"
+)
+
+// errImageNotFound is returned when no stored image has the requested ID
+var errImageNotFound = errors.New("image not found")
+
+// imageIDPattern matches stored image IDs, the hex SHA-256 of the image bytes
+var imageIDPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// StoredImage describes an image downloaded at generation time. The bytes live next to
+// the metadata in a file named after the ID.
+type StoredImage struct {
+	ID          string    `json:"id"`
+	ContentType string    `json:"contentType"`
+	Size        int64     `json:"size"`
+	SourceURL   string    `json:"sourceUrl"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// ImageStore keeps the images of generated blogs on disk, so blogs keep their images
+// after the upstream copies disappear. Images are stored once per distinct content, with
+// their resized variants in a subdirectory.
+type ImageStore struct {
+	dir string
+
+	flight singleflight.Group
+}
+
+// getImageStore returns the image store, configuring it on first use
+var getImageStore = sync.OnceValue(func() *ImageStore {
+	return &ImageStore{dir: getEnv("IMAGE_STORE_DIR", dataPath("images"))}
+})
+
+func (s *ImageStore) dataPath(id string) string {
+	return filepath.Join(s.dir, id)
+}
+
+func (s *ImageStore) metaPath(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+// Save downloads the image through the image cache, which checks the URL and the image
+// type, and stores a copy
+func (s *ImageStore) Save(sourceURL string) (StoredImage, error) {
+	entry, err := getImageCache().Fetch(sourceURL)
+	if err != nil {
+		return StoredImage{}, err
+	}
+	cached, err := os.Open(entry.path)
+	if err != nil {
+		return StoredImage{}, err
+	}
+	defer cached.Close()
+
+	err = os.MkdirAll(s.dir, 0755)
+	if err != nil {
+		return StoredImage{}, err
+	}
+	tmp, err := os.CreateTemp(s.dir, "image.*.tmp")
+	if err != nil {
+		return StoredImage{}, err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), cached)
+	closeErr := tmp.Close()
+	if err != nil {
+		return StoredImage{}, err
+	}
+	if closeErr != nil {
+		return StoredImage{}, closeErr
+	}
+
+	image := StoredImage{
+		ID:          hex.EncodeToString(hash.Sum(nil)),
+		ContentType: entry.ContentType,
+		Size:        size,
+		SourceURL:   sourceURL,
+		CreatedAt:   time.Now(),
+	}
+	if existing, err := s.Get(image.ID); err == nil {
+		return existing, nil
+	}
+
+	err = os.Rename(tmp.Name(), s.dataPath(image.ID))
+	if err != nil {
+		return StoredImage{}, err
+	}
+	meta, err := json.Marshal(image)
+	if err != nil {
+		return StoredImage{}, err
+	}
+	return image, os.WriteFile(s.metaPath(image.ID), meta, 0644)
+}
+
+// Get returns the stored image's metadata
+func (s *ImageStore) Get(id string) (StoredImage, error) {
+	if !imageIDPattern.MatchString(id) {
+		return StoredImage{}, errImageNotFound
+	}
+	data, err := os.ReadFile(s.metaPath(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return StoredImage{}, errImageNotFound
+	}
+	if err != nil {
+		return StoredImage{}, err
+	}
+
+	var image StoredImage
+	if err := json.Unmarshal(data, &image); err != nil {
+		return StoredImage{}, fmt.Errorf("failed to parse image %s: %v", id, err)
+	}
+	return image, nil
+}
+
+// Remove deletes the stored image and its variants, if any
+func (s *ImageStore) Remove(id string) {
+	if !imageIDPattern.MatchString(id) {
+		return
+	}
+	os.Remove(s.metaPath(id))
+	os.Remove(s.dataPath(id))
+	s.removeVariants(id)
+}
+
+// storedImagePath returns the path the backend serves a stored image at
+func storedImagePath(id string) string {
+	return "/api/images/" + id
+}
+
+// storedImageURL returns the URL the backend serves a stored image at
+func storedImageURL(id string) string {
+	return backendBaseURL() + storedImagePath(id)
+}
+
+// storedImageID returns the ID of the stored image a URL points at, if it points at one
+func storedImageID(raw string) (string, bool) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", false
+	}
+	_, id, ok := strings.Cut(u.Path, "/api/images/")
+	if !ok || !imageIDPattern.MatchString(id) {
+		return "", false
+	}
+	return id, true
+}
+
+// persistBlogImages downloads the response's images into the image store with bounded
+// concurrency, returning the local URL of each image that was saved. Images that can't be
+// saved are left out and keep being proxied.
+func persistBlogImages(response LlamaIndexResponse) map[string]string {
+	concurrency := max(getEnvInt("PREFETCH_CONCURRENCY", defaultPrefetchConcurrency), 1)
+	sem := make(chan struct{}, concurrency)
+
+	var mu sync.Mutex
+	local := make(map[string]string)
+	var wg sync.WaitGroup
+	for _, imageURL := range blogImageURLs(response) {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(imageURL string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			image, err := getImageStore().Save(imageURL)
+			if err != nil {
+				log.Printf("Failed to save image %s, proxying it instead: %v", imageURL, err)
+				return
+			}
+			mu.Lock()
+			local[imageURL] = storedImageURL(image.ID)
+			mu.Unlock()
+		}(imageURL)
+	}
+	wg.Wait()
+	return local
+}
+
+// getImageHandler serves a stored image, or a resized variant of it when the w (width),
+// h (height) or q (quality) query parameters are given. JPEG and PNG images are converted
+// to AVIF or WebP for clients that accept them.
+func getImageHandler(w http.ResponseWriter, r *http.Request) {
+	variant, resized, err := parseImageVariant(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	store := getImageStore()
+	image, err := store.Get(mux.Vars(r)["id"])
+	if errors.Is(err, errImageNotFound) {
+		http.Error(w, "Image not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to read image: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	original := store.dataPath(image.ID)
+	path := original
+	if resized {
+		path, err = store.Variant(image, variant)
+		if err != nil {
+			http.Error(w, "Failed to resize image: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	path = store.Transcode(image, path, variant.Quality, r.Header.Get("Accept"))
+
+	file, err := os.Open(path)
+	if err != nil {
+		http.Error(w, "Failed to read image: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	contentType, etag := image.ContentType, image.ID[:32]
+	if path != original {
+		// Variants may be encoded differently from the original
+		head := make([]byte, 512)
+		n, _ := io.ReadFull(file, head)
+		contentType = sniffImageType(head[:n])
+		etag = image.ID[:32] + strings.TrimPrefix(filepath.Base(path), image.ID)
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			http.Error(w, "Failed to read image: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// The ID is the hash of the bytes, so the image at a URL never changes
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("ETag", fmt.Sprintf(`"%s"`, etag))
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("Vary", "Accept")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	http.ServeContent(w, r, "", image.CreatedAt, file)
+}
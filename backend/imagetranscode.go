@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"mime"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// imageTranscodeTimeout bounds how long an encoder may run for one image
+const imageTranscodeTimeout = 30 * time.Second
+
+// imageEncoder converts JPEG and PNG images to a modern format with an external command,
+// since Go has no WebP or AVIF encoder
+type imageEncoder struct {
+	contentType string
+	ext         string
+	// env names the variable overriding the command
+	env     string
+	command string
+	// args returns the command's arguments for the input and output files
+	args func(quality int, in, out string) []string
+
+	available func() bool
+}
+
+// imageEncoders are tried in order of preference, smallest output first
+var imageEncoders = []*imageEncoder{
+	{
+		contentType: "image/avif",
+		ext:         "avif",
+		env:         "AVIF_ENCODER",
+		command:     "avifenc",
+		args: func(quality int, in, out string) []string {
+			return []string{"-q", strconv.Itoa(quality), in, out}
+		},
+	},
+	{
+		contentType: "image/webp",
+		ext:         "webp",
+		env:         "WEBP_ENCODER",
+		command:     "cwebp",
+		args: func(quality int, in, out string) []string {
+			return []string{"-quiet", "-q", strconv.Itoa(quality), in, "-o", out}
+		},
+	},
+}
+
+func init() {
+	for _, encoder := range imageEncoders {
+		encoder.available = sync.OnceValue(func() bool {
+			if !getEnvBool("IMAGE_TRANSCODE", true) {
+				return false
+			}
+			_, err := exec.LookPath(encoder.path())
+			if err != nil {
+				log.Printf("Not serving %s images: %v", encoder.ext, err)
+			}
+			return err == nil
+		})
+	}
+}
+
+// path returns the encoder's command, overridable with its environment variable
+func (e *imageEncoder) path() string {
+	return getEnv(e.env, e.command)
+}
+
+// acceptsImageType reports whether the Accept header lists the content type with a
+// non-zero quality. Wildcards aren't enough, since browsers send image/* without
+// supporting every format.
+func acceptsImageType(accept, contentType string) bool {
+	for _, entry := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(entry))
+		if err != nil || mediaType != contentType {
+			continue
+		}
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q == 0 {
+			return false
+		}
+		return true
+	}
+	return false
+}
+
+// Transcode returns the path of the image at path, a stored image or one of its
+// variants, converted to the preferred format the client accepts, converting it on first
+// request. If no accepted format has an encoder, or converting fails, path is returned.
+func (s *ImageStore) Transcode(image StoredImage, path string, quality int, accept string) string {
+	// Resized variants are always JPEG or PNG
+	original := path == s.dataPath(image.ID)
+	if original && image.ContentType != "image/jpeg" && image.ContentType != "image/png" {
+		return path
+	}
+
+	for _, encoder := range imageEncoders {
+		if !acceptsImageType(accept, encoder.contentType) || !encoder.available() {
+			continue
+		}
+
+		name := filepath.Base(path)
+		if original {
+			name = fmt.Sprintf("%s_original_q%d", image.ID, quality)
+		}
+		out := filepath.Join(s.dir, "variants", name+"."+encoder.ext)
+		_, err, _ := s.flight.Do(out, func() (interface{}, error) {
+			if _, err := os.Stat(out); err == nil {
+				return nil, nil
+			}
+			return nil, encoder.encode(quality, path, out)
+		})
+		if err != nil {
+			log.Printf("Failed to convert image %s to %s: %v", image.ID, encoder.ext, err)
+			continue
+		}
+		return out
+	}
+	return path
+}
+
+// encode converts the image at in to out, writing it to a temporary file first so
+// readers never see a partial image
+func (e *imageEncoder) encode(quality int, in, out string) error {
+	err := os.MkdirAll(filepath.Dir(out), 0755)
+	if err != nil {
+		return err
+	}
+	tmp := out + ".tmp"
+	defer os.Remove(tmp)
+
+	ctx, cancel := context.WithTimeout(context.Background(), imageTranscodeTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, e.path(), e.args(quality, in, tmp)...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s failed: %v: %s", e.path(), err, strings.TrimSpace(string(output)))
+	}
+	return os.Rename(tmp, out)
+}
@@ -0,0 +1,111 @@
+package main
+
+import "net/url"
+
+// proxiedImagePath returns the unsigned path of the proxy URL for the upstream image, as
+// saved in stored blogs
+func proxiedImagePath(raw string) string {
+	return "/api/proxy-image?url=" + url.QueryEscape(raw)
+}
+
+// mapBlogImages replaces the URLs of the blog's featured and inline images with convert's
+func mapBlogImages(blog *BlogPost, convert func(string) string) {
+	blog.FeaturedImage = convert(blog.FeaturedImage)
+	for i, block := range blog.Content {
+		if block.Type == "image" {
+			blog.Content[i].URL = convert(block.URL)
+		}
+	}
+}
+
+// withRelativeURLs returns a copy of the blog as it is saved, leaving the blog's content
+// untouched: with the images served by this backend as paths, and without a canonical URL
+// unless one was set in place of the blog's URL on this backend
+func withRelativeURLs(blog BlogPost) BlogPost {
+	blog.Content = append([]BlogContent(nil), blog.Content...)
+	mapBlogImages(&blog, relativeImageURL)
+	if isDerivedCanonicalURL(blog) {
+		blog.CanonicalURL = ""
+	}
+	return blog
+}
+
+// resolveBlogURLs resolves the URLs of a saved blog against the current base URLs
+func resolveBlogURLs(blog *BlogPost) {
+	mapBlogImages(blog, absoluteImageURL)
+	blog.CanonicalURL = blogLink(*blog)
+}
+
+// relativeImageURL returns the path saved for an image served by this backend, without
+// the base URL or the proxy signature, which depend on the deployment and the time
+func relativeImageURL(raw string) string {
+	if id, ok := storedImageID(raw); ok {
+		return storedImagePath(id)
+	}
+	if isProxiedImageURL(raw) {
+		return proxiedImagePath(upstreamImageURL(raw))
+	}
+	return raw
+}
+
+// absoluteImageURL returns the URL clients load an image served by this backend from:
+// the current base URL, and a fresh signature for proxied images. Blogs saved with
+// absolute URLs, before paths were saved instead, are resolved the same way.
+func absoluteImageURL(raw string) string {
+	if id, ok := storedImageID(raw); ok {
+		return storedImageURL(id)
+	}
+	if isProxiedImageURL(raw) {
+		return proxiedImageURL(upstreamImageURL(raw))
+	}
+	return raw
+}
+
+// imageURLStore saves the images served by this backend of blogs and their revisions as
+// paths, and resolves them against BASE_URL when they are read, so stored blogs survive the
+// backend moving to another host and keep showing proxied images after their signatures
+// expire. Canonical URLs are likewise built from PUBLIC_BASE_URL when blogs are read.
+type imageURLStore struct {
+	BlogStore
+}
+
+func (s imageURLStore) Save(blog BlogPost) error {
+	return s.BlogStore.Save(withRelativeURLs(blog))
+}
+
+func (s imageURLStore) GetByID(id string) (BlogPost, error) {
+	blog, err := s.BlogStore.GetByID(id)
+	if err == nil {
+		resolveBlogURLs(&blog)
+	}
+	return blog, err
+}
+
+func (s imageURLStore) List(opts ListOptions) ([]BlogPost, error) {
+	blogs, err := s.BlogStore.List(opts)
+	for i := range blogs {
+		resolveBlogURLs(&blogs[i])
+	}
+	return blogs, err
+}
+
+func (s imageURLStore) SaveRevision(revision BlogRevision, keep int) error {
+	revision.Blog = withRelativeURLs(revision.Blog)
+	return s.BlogStore.SaveRevision(revision, keep)
+}
+
+func (s imageURLStore) GetRevision(blogID string, number int) (BlogRevision, error) {
+	revision, err := s.BlogStore.GetRevision(blogID, number)
+	if err == nil {
+		resolveBlogURLs(&revision.Blog)
+	}
+	return revision, err
+}
+
+func (s imageURLStore) Revisions(blogID string) ([]BlogRevision, error) {
+	revisions, err := s.BlogStore.Revisions(blogID)
+	for i := range revisions {
+		resolveBlogURLs(&revisions[i].Blog)
+	}
+	return revisions, err
+}
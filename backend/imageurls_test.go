@@ -0,0 +1,167 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const revisionTestBlogID = "4d6c1f5e-8f7a-4b1c-9d2e-3a5b6c7d8e9f"
+
+// useImageURLStore stores blogs in a temporary directory through an imageURLStore, with
+// images served from baseURL
+func useImageURLStore(t *testing.T, baseURL string) *FileStore {
+	t.Helper()
+	files := NewFileStore(t.TempDir())
+	previousStore, previousBaseURL := blogStore, appConfig.BaseURL
+	blogStore, appConfig.BaseURL = imageURLStore{files}, baseURL
+	t.Cleanup(func() { blogStore, appConfig.BaseURL = previousStore, previousBaseURL })
+	return files
+}
+
+// revisionTestBlog returns a blog with a proxied featured image and a proxied inline image
+func revisionTestBlog() BlogPost {
+	return BlogPost{
+		ID:            revisionTestBlogID,
+		Title:         "Solar power",
+		Date:          "2024-05-01T10:00:00Z",
+		UpdatedAt:     "2024-05-01T10:00:00Z",
+		FeaturedImage: proxiedImageURL("https://images.example.com/panel.jpg"),
+		Content: []BlogContent{
+			{Type: "paragraph", Text: "Panels are cheap."},
+			{Type: "image", URL: proxiedImageURL("https://images.example.com/roof.jpg")},
+		},
+	}
+}
+
+func TestImageURLStoreRevisions(t *testing.T) {
+	files := useImageURLStore(t, "https://old.example.com")
+	blog := revisionTestBlog()
+	if err := blogStore.SaveRevision(BlogRevision{Number: 1, CreatedAt: blog.UpdatedAt, Blog: blog}, 10); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := files.GetRevision(revisionTestBlogID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, imageURL := range []string{saved.Blog.FeaturedImage, saved.Blog.Content[1].URL} {
+		if !strings.HasPrefix(imageURL, "/api/proxy-image?url=") || strings.Contains(imageURL, "sig=") {
+			t.Errorf("revision saved with image URL %q, want an unsigned path", imageURL)
+		}
+	}
+	if !strings.HasPrefix(blog.Content[1].URL, "https://old.example.com/") {
+		t.Errorf("saving the revision changed the blog's image URL to %q", blog.Content[1].URL)
+	}
+
+	appConfig.BaseURL = "https://new.example.com"
+	revision, err := blogStore.GetRevision(revisionTestBlogID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revisions, err := blogStore.Revisions(revisionTestBlogID)
+	if err != nil || len(revisions) != 1 {
+		t.Fatalf("Revisions = %d revisions, %v, want 1", len(revisions), err)
+	}
+	for _, read := range []BlogPost{revision.Blog, revisions[0].Blog} {
+		for _, imageURL := range []string{read.FeaturedImage, read.Content[1].URL} {
+			if !strings.HasPrefix(imageURL, "https://new.example.com/api/proxy-image?") || !strings.Contains(imageURL, "sig=") {
+				t.Errorf("revision read with image URL %q, want one signed under the current base URL", imageURL)
+			}
+		}
+	}
+}
+
+func TestRecordRevisionIgnoresImageSignatures(t *testing.T) {
+	useImageURLStore(t, "https://blog.example.com")
+	blog := revisionTestBlog()
+	blogStorageMu.Lock()
+	defer blogStorageMu.Unlock()
+	if err := recordRevision(&blog); err != nil {
+		t.Fatal(err)
+	}
+	if err := blogStore.Save(blog); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reading the blog back signs its images with a different expiry
+	t.Setenv("IMAGE_URL_TTL", "1h")
+	stored, err := blogStore.GetByID(revisionTestBlogID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.FeaturedImage == blog.FeaturedImage {
+		t.Fatal("the stored blog's image wasn't signed again")
+	}
+	if err := recordRevision(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored.Revision != blog.Revision {
+		t.Errorf("unchanged blog recorded as revision %d, want %d", stored.Revision, blog.Revision)
+	}
+
+	stored.Title = "Solar power in 2024"
+	if err := recordRevision(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored.Revision != blog.Revision+1 {
+		t.Errorf("edited blog recorded as revision %d, want %d", stored.Revision, blog.Revision+1)
+	}
+}
+
+func TestCanonicalURLResolvedWhenRead(t *testing.T) {
+	files := useImageURLStore(t, "https://blog.example.com")
+	previousPublicURL := appConfig.PublicBaseURL
+	t.Cleanup(func() { appConfig.PublicBaseURL = previousPublicURL })
+	appConfig.PublicBaseURL = "http://localhost:8080"
+
+	blog := revisionTestBlog()
+	if err := saveBlogPost(blog); err != nil {
+		t.Fatal(err)
+	}
+	if saved, err := files.GetByID(revisionTestBlogID); err != nil || saved.CanonicalURL != "" {
+		t.Fatalf("blog saved with canonical URL %q (%v), want none", saved.CanonicalURL, err)
+	}
+
+	appConfig.PublicBaseURL = "https://www.example.com"
+	read, err := getBlogByID(revisionTestBlogID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "https://www.example.com/blogs/" + revisionTestBlogID; read.CanonicalURL != want || blogLink(read) != want {
+		t.Errorf("canonical URL %q, link %q, want %q", read.CanonicalURL, blogLink(read), want)
+	}
+
+	// Blogs saved with the URL under an earlier base URL are resolved the same way
+	legacy := revisionTestBlog()
+	legacy.CanonicalURL = "http://localhost:8080/blogs/" + revisionTestBlogID
+	if err := files.Save(legacy); err != nil {
+		t.Fatal(err)
+	}
+	if read, err := getBlogByID(revisionTestBlogID); err != nil || !strings.HasPrefix(read.CanonicalURL, "https://www.example.com/") {
+		t.Errorf("legacy blog read with canonical URL %q (%v)", read.CanonicalURL, err)
+	}
+
+	// A canonical URL set by a user is kept, until it is cleared
+	for _, override := range []string{"https://elsewhere.example.org/solar", ""} {
+		update := BlogUpdate{CanonicalURL: &override}
+		if err := update.validate(); err != nil {
+			t.Fatal(err)
+		}
+		updated, err := updateBlogPost(revisionTestBlogID, update.apply)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := override
+		if want == "" {
+			want = "https://www.example.com/blogs/" + revisionTestBlogID
+		}
+		if read, err := getBlogByID(revisionTestBlogID); err != nil || read.CanonicalURL != want || updated.CanonicalURL != want {
+			t.Errorf("override %q: read %q, updated %q, want %q", override, read.CanonicalURL, updated.CanonicalURL, want)
+		}
+	}
+
+	invalid := "ftp://elsewhere.example.org/solar"
+	if err := (BlogUpdate{CanonicalURL: &invalid}).validate(); err == nil {
+		t.Errorf("validate accepted canonical URL %q", invalid)
+	}
+}
@@ -0,0 +1,763 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Job statuses. A running job is scraping or generating, following the pipeline's progress.
+// Outline-first jobs are outlining after scraping, then awaiting approval of their outline
+// until they are queued again to generate the blog.
+const (
+	JobQueued           = "queued"
+	JobScraping         = StageScraping
+	JobOutlining        = "outlining"
+	JobAwaitingApproval = "awaiting_approval"
+	JobGenerating       = StageGenerating
+	JobDone             = "done"
+	JobFailed           = "failed"
+	JobCancelled        = "cancelled"
+)
+
+// Job defaults, overridable with GENERATION_WORKERS, JOB_QUEUE_SIZE and JOB_TTL
+const (
+	defaultGenerationWorkers = 2
+	defaultJobQueueSize      = 100
+	defaultJobTTL            = time.Hour
+)
+
+// jobCancelGracePeriod bounds how long shutdown waits for cancelled jobs to stop
+const jobCancelGracePeriod = 5 * time.Second
+
+// Errors returned by Submit when a job can't be queued
+var (
+	errQueueFull    = errors.New("generation queue is full")
+	errShuttingDown = errors.New("server is shutting down")
+)
+
+// Errors from cancelling a job
+var (
+	errJobNotFound = errors.New("job not found")
+	errJobFinished = errors.New("the job has already finished")
+	errNotJobOwner = errors.New("only the job's owner can cancel or approve it")
+
+	errNotAwaitingApproval = errors.New("the job has no outline awaiting approval")
+)
+
+// Job represents a background blog generation
+type Job struct {
+	ID     string `json:"jobId"`
+	Topic  string `json:"topic"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	BlogID string `json:"blogId,omitempty"`
+	// OwnerID is the user the generated blog will belong to
+	OwnerID string `json:"ownerId,omitempty"`
+	// Pages, Sources and Sections report the pipeline's progress, as in ProgressEvent
+	Pages    int `json:"pages,omitempty"`
+	Sources  int `json:"sources,omitempty"`
+	Sections int `json:"sections,omitempty"`
+	// Attempts is how many times the generator ran for this job
+	Attempts  int       `json:"attempts,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	// Regenerate is set for jobs regenerating the blog with BlogID rather than generating
+	// a new one
+	Regenerate bool `json:"regenerate,omitempty"`
+	// OutlineFirst is set for jobs that propose an outline before generating the blog, and
+	// OutlineApproved once the outline in GenerationOptions has been approved
+	OutlineFirst    bool `json:"outlineFirst,omitempty"`
+	OutlineApproved bool `json:"outlineApproved,omitempty"`
+	// GenerationOptions are passed on to the generator
+	GenerationOptions
+
+	// sources are the contents scraped for an outline-first job's outline, kept in memory
+	// for writing the blog once the outline is approved, and outlineUsage the tokens the
+	// outline took, which are logged with the blog's generation
+	sources      []ScrapedContent
+	outlineUsage TokenUsage
+}
+
+// finished reports whether the job is done, failed or cancelled
+func (job Job) finished() bool {
+	return job.Status == JobDone || job.Status == JobFailed || job.Status == JobCancelled
+}
+
+// JobManager queues generation jobs and runs them on a fixed number of workers
+type JobManager struct {
+	mu    sync.Mutex
+	jobs  map[string]*Job
+	queue chan string
+	once  sync.Once
+	// slots bounds how many generations run at once, counting the streamed and refreshed
+	// blogs that don't go through the queue along with the jobs
+	slots chan struct{}
+	// waiting counts the generations waiting for a slot
+	waiting atomic.Int64
+	// subscribers receive a copy of a job every time it changes
+	subscribers map[string]map[chan Job]bool
+	// cancels stop the running jobs, by ID
+	cancels map[string]context.CancelFunc
+	// ctx is cancelled to stop running jobs when shutdown runs out of time
+	ctx    context.Context
+	cancel context.CancelFunc
+	// stopping is closed when shutdown begins, so workers take no more jobs
+	stopping chan struct{}
+	running  sync.WaitGroup
+}
+
+var jobManager = &JobManager{
+	jobs:        make(map[string]*Job),
+	subscribers: make(map[string]map[chan Job]bool),
+	cancels:     make(map[string]context.CancelFunc),
+	stopping:    make(chan struct{}),
+}
+
+// Start requeues the jobs left unfinished by the last shutdown, then launches the workers
+// and the cleanup of expired jobs
+func (m *JobManager) Start() {
+	m.once.Do(func() {
+		m.ctx, m.cancel = context.WithCancel(context.Background())
+		m.queue = make(chan string, max(getEnvInt("JOB_QUEUE_SIZE", defaultJobQueueSize), 1))
+		m.restore(jobStateFile())
+
+		workers := max(getEnvInt("GENERATION_WORKERS", defaultGenerationWorkers), 1)
+		m.slots = make(chan struct{}, workers)
+		for i := 0; i < workers; i++ {
+			go m.worker()
+		}
+		go m.cleanup(getEnvDuration("JOB_TTL", defaultJobTTL), getEnvDuration("OUTLINE_APPROVAL_TTL", defaultOutlineApprovalTTL))
+	})
+}
+
+// Submit queues a generation for the topic with the options, owned by ownerID if not
+// empty, and returns the pending job
+func (m *JobManager) Submit(topic, ownerID string, opts GenerationOptions) (Job, error) {
+	return m.submit(newJob(topic, ownerID, opts))
+}
+
+// SubmitOutlineFirst queues a job like Submit that stops at awaiting approval once it
+// has proposed an outline, generating the blog after ApproveOutline
+func (m *JobManager) SubmitOutlineFirst(topic, ownerID string, opts GenerationOptions) (Job, error) {
+	job := newJob(topic, ownerID, opts)
+	job.OutlineFirst = true
+	return m.submit(job)
+}
+
+// SubmitRegeneration queues the regeneration of an existing blog with its topic and
+// generation options, owned like the blog
+func (m *JobManager) SubmitRegeneration(blog BlogPost) (Job, error) {
+	job := newJob(blog.Topic, blog.OwnerID, blog.GenerationOptions)
+	job.BlogID = blog.ID
+	job.Regenerate = true
+	return m.submit(job)
+}
+
+// newJob returns a queued job for the topic
+func newJob(topic, ownerID string, opts GenerationOptions) *Job {
+	now := time.Now()
+	return &Job{
+		ID:                uuid.New().String(),
+		Topic:             topic,
+		OwnerID:           ownerID,
+		Status:            JobQueued,
+		CreatedAt:         now,
+		UpdatedAt:         now,
+		GenerationOptions: opts,
+	}
+}
+
+// submit adds the job to the queue
+func (m *JobManager) submit(job *Job) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	select {
+	case <-m.stopping:
+		return Job{}, errShuttingDown
+	default:
+	}
+	select {
+	case m.queue <- job.ID:
+	default:
+		return Job{}, errQueueFull
+	}
+	m.jobs[job.ID] = job
+	return *job, nil
+}
+
+// acquire waits for a generation slot and returns the function releasing it, or ctx's
+// error if ctx is done first. Start must have been called.
+func (m *JobManager) acquire(ctx context.Context) (release func(), err error) {
+	m.waiting.Add(1)
+	defer m.waiting.Add(-1)
+
+	select {
+	case m.slots <- struct{}{}:
+		return func() { <-m.slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// JobStats reports the load on the generation workers
+type JobStats struct {
+	Workers int
+	// Running is the number of generations holding a slot and Waiting the number waiting
+	// for one, jobs taken off the queue included
+	Running int
+	Waiting int
+	// QueueDepth is the number of jobs waiting in the queue for a worker
+	QueueDepth    int
+	QueueCapacity int
+	// Jobs counts the jobs still kept, by status
+	Jobs map[string]int
+}
+
+// Stats reports the current load on the workers and queue
+func (m *JobManager) Stats() JobStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := JobStats{
+		Workers:       cap(m.slots),
+		Running:       len(m.slots),
+		Waiting:       int(m.waiting.Load()),
+		QueueDepth:    len(m.queue),
+		QueueCapacity: cap(m.queue),
+		Jobs:          make(map[string]int),
+	}
+	for _, job := range m.jobs {
+		stats.Jobs[job.Status]++
+	}
+	return stats
+}
+
+// Get returns a copy of the job
+func (m *JobManager) Get(id string) (Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// Subscribe returns a copy of the job and a channel that receives the job after each change,
+// until unsubscribe is called. Subscribers that fall behind lose intermediate updates but
+// always receive the latest state.
+func (m *JobManager) Subscribe(id string) (job Job, updates <-chan Job, unsubscribe func(), ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current, ok := m.jobs[id]
+	if !ok {
+		return Job{}, nil, nil, false
+	}
+
+	ch := make(chan Job, 16)
+	if m.subscribers[id] == nil {
+		m.subscribers[id] = make(map[chan Job]bool)
+	}
+	m.subscribers[id][ch] = true
+
+	unsubscribe = func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		delete(m.subscribers[id], ch)
+		if len(m.subscribers[id]) == 0 {
+			delete(m.subscribers, id)
+		}
+	}
+	return *current, ch, unsubscribe, true
+}
+
+// Cancel marks a queued or running job as cancelled and returns it. A queued job is
+// skipped when a worker takes it off the queue; a running one has its context cancelled,
+// which stops the scrape and kills the generator's Python process.
+func (m *JobManager) Cancel(id string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return Job{}, errJobNotFound
+	}
+	if job.finished() {
+		return *job, errJobFinished
+	}
+	if cancel, ok := m.cancels[id]; ok {
+		cancel()
+	}
+	job.Status = JobCancelled
+	job.sources = nil
+	job.UpdatedAt = time.Now()
+	m.notify(job)
+	return *job, nil
+}
+
+// ApproveOutline queues the generation of the blog for a job awaiting approval of its
+// outline, replacing the proposed outline with outline unless it's empty
+func (m *JobManager) ApproveOutline(id string, outline []OutlineSection) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return Job{}, errJobNotFound
+	}
+	if job.Status != JobAwaitingApproval {
+		return *job, errNotAwaitingApproval
+	}
+	select {
+	case <-m.stopping:
+		return Job{}, errShuttingDown
+	default:
+	}
+	select {
+	case m.queue <- job.ID:
+	default:
+		return Job{}, errQueueFull
+	}
+
+	if len(outline) > 0 {
+		job.Outline = outline
+	}
+	job.OutlineApproved = true
+	job.Status = JobQueued
+	job.UpdatedAt = time.Now()
+	m.notify(job)
+	return *job, nil
+}
+
+// update applies fn to the job under the lock and notifies its subscribers. Finished jobs
+// are left as they are, so a job cancelled while running keeps its status.
+func (m *JobManager) update(id string, fn func(job *Job)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok || job.finished() {
+		return
+	}
+	fn(job)
+	job.UpdatedAt = time.Now()
+	m.notify(job)
+}
+
+// notify sends a copy of the job to its subscribers. The caller must hold m.mu.
+func (m *JobManager) notify(job *Job) {
+	for ch := range m.subscribers[job.ID] {
+		select {
+		case ch <- *job:
+		default:
+			// Make room by dropping the oldest update so the latest state always arrives
+			select {
+			case <-ch:
+			default:
+			}
+			ch <- *job
+		}
+	}
+}
+
+func (m *JobManager) worker() {
+	for {
+		// Leave queued jobs in place once shutdown begins so they are saved for the next start
+		select {
+		case <-m.stopping:
+			return
+		default:
+		}
+
+		select {
+		case <-m.stopping:
+			return
+		case id := <-m.queue:
+			m.running.Add(1)
+			m.run(id)
+			m.running.Done()
+		}
+	}
+}
+
+// run generates or regenerates the blog for a queued job, recording its progress and
+// outcome. Outline-first jobs propose their outline instead until it is approved, then
+// generate the blog from the sources scraped for it. A job cancelled by shutdown goes back to queued so that it is
+// saved and rerun on the next start.
+func (m *JobManager) run(id string) {
+	ctx, cancel := context.WithCancel(m.ctx)
+	defer cancel()
+	job, ok := m.start(id, cancel)
+	if !ok {
+		return
+	}
+	defer func() {
+		m.mu.Lock()
+		delete(m.cancels, id)
+		m.mu.Unlock()
+	}()
+
+	progress := func(event ProgressEvent) {
+		m.update(id, func(job *Job) {
+			if event.Stage == StageScraping || event.Stage == StageGenerating {
+				job.Status = event.Stage
+			}
+			job.Pages = event.Pages
+			job.Sources = event.Sources
+			job.Sections = event.Sections
+		})
+	}
+	var blog BlogPost
+	var err error
+	outlining := job.OutlineFirst && !job.OutlineApproved
+	switch {
+	case outlining:
+		err = m.outline(ctx, id, job, progress)
+	case job.Regenerate:
+		blog, err = regenerateBlog(ctx, job.BlogID, progress)
+	case job.sources != nil:
+		blog, err = generateBlogFromSources(ctx, job.Topic, job.OwnerID, job.GenerationOptions, job.sources, job.outlineUsage, progress)
+	default:
+		// Outline-first jobs restored after a restart have lost their sources and scrape again
+		blog, err = generateBlog(ctx, job.Topic, job.OwnerID, job.GenerationOptions, progress)
+	}
+	if err != nil && m.ctx.Err() != nil {
+		log.Printf("Generation job %s for topic %q was interrupted by shutdown: %v", id, job.Topic, err)
+		m.update(id, func(job *Job) {
+			job.Status = JobQueued
+		})
+		return
+	}
+	if err != nil && ctx.Err() != nil {
+		log.Printf("Generation job %s for topic %q was cancelled: %v", id, job.Topic, err)
+		return
+	}
+	if err != nil {
+		log.Printf("Generation job %s for topic %q failed: %v", id, job.Topic, err)
+		m.update(id, func(job *Job) {
+			job.Status = JobFailed
+			job.Error = err.Error()
+			job.Attempts = generationAttempts(err)
+			job.sources = nil
+		})
+		return
+	}
+	if outlining {
+		return
+	}
+
+	m.update(id, func(job *Job) {
+		job.Status = JobDone
+		job.BlogID = blog.ID
+		job.Attempts = blog.GenerationAttempts
+		job.sources = nil
+	})
+}
+
+// outline scrapes the sources for an outline-first job and has the model propose an
+// outline from them, leaving the job awaiting approval of the outline
+func (m *JobManager) outline(ctx context.Context, id string, job Job, progress ProgressFunc) error {
+	completer, err := selectedCompleter()
+	if err != nil {
+		return err
+	}
+
+	progress(ProgressEvent{Stage: StageScraping})
+	sources, pages, err := scrapeContentForTopic(ctx, job.Topic, progress)
+	if err != nil {
+		return fmt.Errorf("failed to scrape content: %w", err)
+	}
+	if len(sources) == 0 {
+		return errNoContent
+	}
+	m.update(id, func(job *Job) {
+		job.Status = JobOutlining
+		job.Pages = pages
+		job.Sources = len(sources)
+	})
+
+	release, err := m.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	outline, usage, err := proposeOutline(ctx, completer, job.Topic, job.GenerationOptions, sources)
+	if err != nil {
+		return err
+	}
+
+	m.update(id, func(job *Job) {
+		job.Status = JobAwaitingApproval
+		job.Outline = outline
+		job.Sections = len(outline)
+		job.sources = sources
+		job.outlineUsage = usage
+	})
+	return nil
+}
+
+// start returns a copy of the queued job and records cancel as the way to stop it. Jobs
+// cancelled while they were queued are skipped.
+func (m *JobManager) start(id string, cancel context.CancelFunc) (Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok || job.Status != JobQueued {
+		return Job{}, false
+	}
+	m.cancels[id] = cancel
+	return *job, true
+}
+
+// Shutdown stops taking jobs and waits for the running ones to finish. If ctx is done
+// first, the running jobs are cancelled. Jobs that didn't finish, including those still
+// queued, are written to JOB_STATE_FILE with their progress so the next start reruns them.
+func (m *JobManager) Shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	select {
+	case <-m.stopping:
+	default:
+		close(m.stopping)
+	}
+	m.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		m.running.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		log.Printf("Cancelling running generation jobs: %v", ctx.Err())
+		if m.cancel != nil {
+			m.cancel()
+		}
+		select {
+		case <-drained:
+		case <-time.After(jobCancelGracePeriod):
+			log.Printf("Running generation jobs did not stop within %s", jobCancelGracePeriod)
+		}
+	}
+
+	return m.save(jobStateFile())
+}
+
+// jobStateFile is where unfinished jobs are saved at shutdown, JOB_STATE_FILE or jobs.json
+// in the data directory
+func jobStateFile() string {
+	return getEnv("JOB_STATE_FILE", dataPath("jobs.json"))
+}
+
+// unfinished returns copies of the jobs that are queued or still running, oldest first
+func (m *JobManager) unfinished() []Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var jobs []Job
+	for _, job := range m.jobs {
+		if !job.finished() {
+			jobs = append(jobs, *job)
+		}
+	}
+	slices.SortFunc(jobs, func(a, b Job) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return jobs
+}
+
+// save writes the unfinished jobs to path, or removes it if there are none
+func (m *JobManager) save(path string) error {
+	jobs := m.unfinished()
+	if len(jobs) == 0 {
+		err := os.Remove(path)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	data, err := json.MarshalIndent(jobs, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(path, data, 0644)
+	if err != nil {
+		return err
+	}
+	log.Printf("Saved %d unfinished generation jobs to %s", len(jobs), path)
+	return nil
+}
+
+// restore queues the jobs saved by the last shutdown, keeping their IDs and progress, and
+// removes the file so they run only once
+func (m *JobManager) restore(path string) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to read saved generation jobs from %s: %v", path, err)
+		return
+	}
+
+	var jobs []Job
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		log.Printf("Failed to parse saved generation jobs in %s: %v", path, err)
+		return
+	}
+
+	m.mu.Lock()
+	requeued := 0
+	for _, saved := range jobs {
+		job := saved
+		job.UpdatedAt = time.Now()
+		if job.Status == JobAwaitingApproval {
+			// The outline is still waiting for approval; the sources are scraped again once
+			// it is approved
+			m.jobs[job.ID] = &job
+			continue
+		}
+		job.Status = JobQueued
+		select {
+		case m.queue <- job.ID:
+			requeued++
+		default:
+			job.Status = JobFailed
+			job.Error = errQueueFull.Error()
+		}
+		m.jobs[job.ID] = &job
+	}
+	m.mu.Unlock()
+
+	log.Printf("Requeued %d of %d generation jobs saved at the last shutdown", requeued, len(jobs))
+	if err := os.Remove(path); err != nil {
+		log.Printf("Failed to remove %s: %v", path, err)
+	}
+}
+
+// cleanup periodically drops finished jobs older than ttl, and fails jobs whose outline
+// has waited longer than approvalTTL for approval
+func (m *JobManager) cleanup(ttl, approvalTTL time.Duration) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		m.mu.Lock()
+		for id, job := range m.jobs {
+			if job.finished() && time.Since(job.UpdatedAt) > ttl {
+				delete(m.jobs, id)
+			}
+			if job.Status == JobAwaitingApproval && time.Since(job.UpdatedAt) > approvalTTL {
+				job.Status = JobFailed
+				job.Error = fmt.Sprintf("the outline wasn't approved within %s", approvalTTL)
+				job.sources = nil
+				job.UpdatedAt = time.Now()
+				m.notify(job)
+			}
+		}
+		m.mu.Unlock()
+	}
+}
+
+func getJobHandler(w http.ResponseWriter, r *http.Request) {
+	job, ok := jobManager.Get(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// cancelJobHandler cancels a queued or running job, returning the cancelled job. Finished
+// jobs can't be cancelled and get 409.
+func cancelJobHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	job, ok := jobManager.Get(id)
+	var err error
+	if !ok {
+		err = errJobNotFound
+	} else if !canManageOwnedBy(r, job.OwnerID) {
+		err = errNotJobOwner
+	} else {
+		job, err = jobManager.Cancel(id)
+	}
+
+	switch {
+	case errors.Is(err, errJobNotFound):
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	case errors.Is(err, errNotJobOwner):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case errors.Is(err, errJobFinished):
+		http.Error(w, fmt.Sprintf("The job has already finished with status %s", job.Status), http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// jobEventsHandler streams a job's status as Server-Sent Events, named after the job's
+// status and carrying the Job, until the job is done or has failed
+func jobEventsHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	job, updates, unsubscribe, ok := jobManager.Subscribe(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	for {
+		if err := writeSSE(w, job.Status, job); err != nil {
+			return
+		}
+		flusher.Flush()
+		if job.finished() {
+			return
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case job = <-updates:
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/language/display"
+)
+
+// defaultBlogLanguage is the language of blogs generated without one
+const defaultBlogLanguage = "en"
+
+// errInvalidLanguage is returned for languages that aren't BCP 47 language tags
+var errInvalidLanguage = errors.New("language must be a language tag such as en, de or pt-BR")
+
+// parseLanguage returns the canonical form of a BCP 47 language tag, such as pt-BR for
+// pt_br
+func parseLanguage(raw string) (string, error) {
+	tag, err := language.Parse(strings.ReplaceAll(strings.TrimSpace(raw), "_", "-"))
+	if err != nil || tag == language.Und {
+		return "", errInvalidLanguage
+	}
+	return tag.String(), nil
+}
+
+// blogLanguage returns the language the blog is written in. Blogs generated without one
+// are in English.
+func blogLanguage(blog BlogPost) string {
+	if blog.Language == "" {
+		return defaultBlogLanguage
+	}
+	return blog.Language
+}
+
+// languageName returns the English name of a language tag, such as "Brazilian Portuguese"
+// for pt-BR, falling back to the tag itself
+func languageName(tag string) string {
+	parsed, err := language.Parse(tag)
+	if err != nil {
+		return tag
+	}
+	if name := display.English.Tags().Name(parsed); name != "" {
+		return name
+	}
+	return tag
+}
+
+// matchesLanguage reports whether tag is the language or one of its regional variants, so
+// pt matches pt-BR but pt-BR doesn't match pt-PT
+func matchesLanguage(tag, language string) bool {
+	return strings.EqualFold(tag, language) || strings.HasPrefix(strings.ToLower(tag), strings.ToLower(language)+"-")
+}
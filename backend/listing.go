@@ -0,0 +1,263 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Pagination defaults for list endpoints. maxPage keeps the offset of a page of up to
+// maxPageLimit items from overflowing.
+const (
+	defaultPageLimit = 10
+	maxPageLimit     = 100
+	maxPage          = math.MaxInt / maxPageLimit
+)
+
+// errUnpublishedListing is returned by parseListOptions when a caller without the editor
+// role asks for blogs that aren't published
+var errUnpublishedListing = errors.New("listing unpublished blogs requires the editor role")
+
+// Sort orders supported by list endpoints
+const (
+	SortDateDesc        = "date_desc"
+	SortDateAsc         = "date_asc"
+	SortReadingTimeAsc  = "reading_time_asc"
+	SortReadingTimeDesc = "reading_time_desc"
+)
+
+// ListOptions controls which window of blogs a list returns and in what order
+type ListOptions struct {
+	Page  int
+	Limit int
+	Sort  string
+
+	ExcludeSimulated bool
+	// Tag matches blogs with this tag, ignoring case
+	Tag string
+	// Topic matches blogs whose topic contains this text, ignoring case
+	Topic string
+	// From and To bound the blog date, inclusive, as YYYY-MM-DD
+	From string
+	To   string
+	// OwnerID matches blogs generated by this user
+	OwnerID string
+	// Status matches blogs in this workflow status, counting blogs without one as published
+	Status string
+	// Language matches blogs in this language or one of its regional variants, counting
+	// blogs without one as English
+	Language string
+}
+
+// BlogListResponse represents a page of blogs
+type BlogListResponse struct {
+	// Blogs holds []BlogSummary, or []BlogPost when requested with ?full=true
+	Blogs interface{} `json:"blogs"`
+	Total int         `json:"total"`
+	Page  int         `json:"page"`
+	Limit int         `json:"limit"`
+	// Errors lists stored blogs that couldn't be read, when requested with ?includeErrors=true
+	Errors []BlogReadError `json:"errors,omitempty"`
+}
+
+// BlogSummary is the lightweight form of a blog returned by list endpoints, without its
+// content blocks and sources
+type BlogSummary struct {
+	ID            string   `json:"id"`
+	Title         string   `json:"title"`
+	Author        string   `json:"author"`
+	Date          string   `json:"date"`
+	Summary       string   `json:"summary"`
+	FeaturedImage string   `json:"featuredImage"`
+	Tags          []string `json:"tags"`
+	ReadingTime   int      `json:"readingTime"`
+	Topic         string   `json:"topic"`
+	CanonicalURL  string   `json:"canonicalUrl,omitempty"`
+	Status        string   `json:"status,omitempty"`
+	Language      string   `json:"language,omitempty"`
+	Simulated     bool     `json:"simulated,omitempty"`
+}
+
+// summarizeBlogs returns the lightweight form of each blog
+func summarizeBlogs(blogs []BlogPost) []BlogSummary {
+	summaries := make([]BlogSummary, 0, len(blogs))
+	for _, blog := range blogs {
+		summaries = append(summaries, BlogSummary{
+			ID:            blog.ID,
+			Title:         blog.Title,
+			Author:        blog.Author,
+			Date:          blog.Date,
+			Summary:       blog.Summary,
+			FeaturedImage: blog.FeaturedImage,
+			Tags:          blog.Tags,
+			ReadingTime:   blog.ReadingTime,
+			Topic:         blog.Topic,
+			CanonicalURL:  blog.CanonicalURL,
+			Status:        blog.Status,
+			Language:      blog.Language,
+			Simulated:     blog.Simulated,
+		})
+	}
+	return summaries
+}
+
+// parsePage parses a page number, which must be between 1 and maxPage
+func parsePage(raw string) (int, error) {
+	page, err := strconv.Atoi(raw)
+	if err != nil || page < 1 || page > maxPage {
+		return 0, fmt.Errorf("page must be a positive integer no greater than %d", maxPage)
+	}
+	return page, nil
+}
+
+// parseListOptions reads page, limit and sort from the query string. Only published blogs
+// are listed unless ?status= asks for another status, or all of them, which takes the editor
+// role and lists an editor's own blogs only. ?mine=true lists the caller's own blogs.
+func parseListOptions(r *http.Request) (ListOptions, error) {
+	opts := ListOptions{Page: 1, Limit: defaultPageLimit, Sort: SortDateDesc, Status: StatusPublished}
+	query := r.URL.Query()
+
+	if raw := query.Get("page"); raw != "" {
+		page, err := parsePage(raw)
+		if err != nil {
+			return opts, err
+		}
+		opts.Page = page
+	}
+
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 {
+			return opts, fmt.Errorf("limit must be a positive integer")
+		}
+		opts.Limit = min(limit, maxPageLimit)
+	}
+
+	if raw := query.Get("sort"); raw != "" {
+		switch raw {
+		case SortDateDesc, SortDateAsc, SortReadingTimeAsc, SortReadingTimeDesc:
+			opts.Sort = raw
+		default:
+			return opts, fmt.Errorf("sort must be one of %s, %s, %s, %s", SortDateDesc, SortDateAsc, SortReadingTimeAsc, SortReadingTimeDesc)
+		}
+	}
+
+	if raw := query.Get("status"); raw != "" {
+		switch raw {
+		case StatusDraft, StatusInReview, StatusPublished:
+			opts.Status = raw
+		case "all":
+			opts.Status = ""
+		default:
+			return opts, fmt.Errorf("status must be one of %s, %s, %s, all", StatusDraft, StatusInReview, StatusPublished)
+		}
+		if opts.Status != StatusPublished && !canListUnpublished(r) {
+			return opts, errUnpublishedListing
+		}
+	}
+
+	opts.ExcludeSimulated = query.Get("excludeSimulated") == "true"
+	opts.Tag = strings.TrimSpace(query.Get("tag"))
+	opts.Topic = strings.TrimSpace(query.Get("topic"))
+	if raw := query.Get("language"); raw != "" {
+		language, err := parseLanguage(raw)
+		if err != nil {
+			return opts, err
+		}
+		opts.Language = language
+	}
+	if user, ok := requestUser(r); ok {
+		mine := query.Get("mine") == "true"
+		if mine || (opts.Status != StatusPublished && user.Role == RoleEditor) {
+			opts.OwnerID = user.ID
+		}
+	}
+
+	for _, bound := range []struct {
+		name  string
+		value *string
+	}{{"from", &opts.From}, {"to", &opts.To}} {
+		raw := query.Get(bound.name)
+		if raw == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", raw); err != nil {
+			return opts, fmt.Errorf("%s must be a date formatted as YYYY-MM-DD", bound.name)
+		}
+		*bound.value = raw
+	}
+
+	return opts, nil
+}
+
+// filterBlogs returns the blogs matching the filters in opts
+func filterBlogs(blogs []BlogPost, opts ListOptions) []BlogPost {
+	filtered := make([]BlogPost, 0, len(blogs))
+	for _, blog := range blogs {
+		if opts.ExcludeSimulated && blog.Simulated {
+			continue
+		}
+		if opts.Tag != "" && !hasTag(blog, opts.Tag) {
+			continue
+		}
+		if opts.Topic != "" && !strings.Contains(strings.ToLower(blog.Topic), strings.ToLower(opts.Topic)) {
+			continue
+		}
+		if (opts.From != "" && blog.Date < opts.From) || (opts.To != "" && blog.Date > opts.To) {
+			continue
+		}
+		if opts.OwnerID != "" && blog.OwnerID != opts.OwnerID {
+			continue
+		}
+		if opts.Status != "" && blogStatus(blog) != opts.Status {
+			continue
+		}
+		if opts.Language != "" && !matchesLanguage(blogLanguage(blog), opts.Language) {
+			continue
+		}
+		filtered = append(filtered, blog)
+	}
+	return filtered
+}
+
+// sortBlogs orders the blogs in place. Dates are stored as YYYY-MM-DD so they
+// compare correctly as strings; ties fall back to the ID for a stable order.
+func sortBlogs(blogs []BlogPost, order string) {
+	sort.SliceStable(blogs, func(i, j int) bool {
+		a, b := blogs[i], blogs[j]
+		switch order {
+		case SortDateAsc:
+			if a.Date != b.Date {
+				return a.Date < b.Date
+			}
+		case SortReadingTimeAsc:
+			if a.ReadingTime != b.ReadingTime {
+				return a.ReadingTime < b.ReadingTime
+			}
+		case SortReadingTimeDesc:
+			if a.ReadingTime != b.ReadingTime {
+				return a.ReadingTime > b.ReadingTime
+			}
+		default:
+			if a.Date != b.Date {
+				return a.Date > b.Date
+			}
+		}
+		return a.ID < b.ID
+	})
+}
+
+// paginate returns the page of blogs selected by opts, or an empty slice if the page is out of range
+func paginate(blogs []BlogPost, opts ListOptions) []BlogPost {
+	start := (opts.Page - 1) * opts.Limit
+	if start >= len(blogs) {
+		return []BlogPost{}
+	}
+	end := min(start+opts.Limit, len(blogs))
+	return blogs[start:end]
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestListOptionsOwnerScope(t *testing.T) {
+	useAuthStores(t, ConfigAPIKey{Name: "ci", Key: "editor-key"})
+	editor := User{ID: "editor-1", Role: RoleEditor}
+
+	for _, tc := range []struct {
+		query string
+		owner string
+	}{
+		{"/api/blogs", ""},
+		{"/api/blogs?status=published", ""},
+		{"/api/blogs?status=draft", editor.ID},
+		{"/api/blogs?status=all", editor.ID},
+		{"/api/blogs?mine=true", editor.ID},
+	} {
+		opts, err := parseListOptions(withUser(httptest.NewRequest("GET", tc.query, nil), editor))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.query, err)
+		}
+		if opts.OwnerID != tc.owner {
+			t.Errorf("%s: owner %q, want %q", tc.query, opts.OwnerID, tc.owner)
+		}
+	}
+
+	viewer := User{ID: "viewer-1", Role: RoleViewer}
+	opts, err := parseListOptions(withUser(httptest.NewRequest("GET", "/api/blogs?mine=true", nil), viewer))
+	if err != nil || opts.OwnerID != viewer.ID {
+		t.Errorf("viewer ?mine=true: owner %q, err %v", opts.OwnerID, err)
+	}
+}
+
+func TestListOptionsPage(t *testing.T) {
+	for _, tc := range []struct {
+		page    string
+		wantErr bool
+	}{
+		{"1", false},
+		{fmt.Sprint(maxPage), false},
+		{"0", true},
+		{"-1", true},
+		{"abc", true},
+		{fmt.Sprint(maxPage + 1), true},
+		{"922337203685477582", true},
+	} {
+		_, err := parseListOptions(httptest.NewRequest("GET", "/api/blogs?limit=100&page="+tc.page, nil))
+		if (err != nil) != tc.wantErr {
+			t.Errorf("page=%s: err %v, want error %v", tc.page, err, tc.wantErr)
+		}
+	}
+}
+
+func TestPaginateLastPage(t *testing.T) {
+	blogs := []BlogPost{{ID: "a"}, {ID: "b"}}
+	if page := paginate(blogs, ListOptions{Page: maxPage, Limit: maxPageLimit}); len(page) != 0 {
+		t.Errorf("page %d returned %d blogs", maxPage, len(page))
+	}
+}
@@ -2,20 +2,220 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"math/rand"
 	"os/exec"
+	"strings"
+	"time"
 )
 
-// GenerateBlogWithLlamaIndex calls the Python script that implements LlamaIndex to generate a blog
-func GenerateBlogWithLlamaIndex(topic string, contents []ScrapedContent) (LlamaIndexResponse, error) {
+// stderrTailSize is how much of the Python script's stderr is included in errors
+const stderrTailSize = 2000
+
+// errTruncatedOutput is returned when the Python script's stdout ends before a complete JSON document
+var errTruncatedOutput = errors.New("truncated output from Python script")
+
+// errInvalidLlamaResponse is returned when the generator's output does not describe a usable blog
+var errInvalidLlamaResponse = errors.New("invalid response from generator")
+
+// Retry defaults, overridable with GENERATION_MAX_ATTEMPTS, GENERATION_RETRY_DELAY,
+// GENERATION_RETRY_MAX_DELAY and GENERATION_RETRY_JITTER
+const (
+	defaultGenerationMaxAttempts   = 2
+	defaultGenerationRetryDelay    = time.Second
+	defaultGenerationRetryMaxDelay = 30 * time.Second
+	defaultGenerationRetryJitter   = 0.5
+)
+
+// AttemptsError reports how many times generation was attempted before it failed, and the
+// tokens those attempts used
+type AttemptsError struct {
+	Attempts int
+	Usage    TokenUsage
+	Err      error
+}
+
+func (e *AttemptsError) Error() string {
+	if e.Attempts == 1 {
+		return fmt.Sprintf("%v (after 1 attempt)", e.Err)
+	}
+	return fmt.Sprintf("%v (after %d attempts)", e.Err, e.Attempts)
+}
+
+func (e *AttemptsError) Unwrap() error {
+	return e.Err
+}
+
+// generationAttempts returns the number of attempts recorded in err, or 0 if there is none
+func generationAttempts(err error) int {
+	var attemptsErr *AttemptsError
+	if errors.As(err, &attemptsErr) {
+		return attemptsErr.Attempts
+	}
+	return 0
+}
+
+// generationUsage returns the token usage recorded in err
+func generationUsage(err error) TokenUsage {
+	var attemptsErr *AttemptsError
+	if errors.As(err, &attemptsErr) {
+		return attemptsErr.Usage
+	}
+	return TokenUsage{}
+}
+
+// RetryableError marks a generation failure that may succeed if attempted again
+type RetryableError struct {
+	Err error
+}
+
+func (e *RetryableError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RetryableError) Unwrap() error {
+	return e.Err
+}
+
+// isRetryable reports whether err is worth retrying
+func isRetryable(err error) bool {
+	var retryable *RetryableError
+	return errors.As(err, &retryable)
+}
+
+// GenerateBlogWithLlamaIndex generates a blog with the provider selected by LLM_PROVIDER, reusing
+// cached generations for identical source sets when CONTENT_CACHE is enabled
+func GenerateBlogWithLlamaIndex(ctx context.Context, request LlamaIndexRequest) (LlamaIndexResponse, error) {
+	return generateWithContentCache(ctx, request, func(ctx context.Context) (LlamaIndexResponse, error) {
+		response, err := generateWithRetries(ctx, request)
+		if err != nil {
+			return response, err
+		}
+		return response, validateLlamaResponse(response)
+	})
+}
+
+// validateLlamaResponse checks that a generated blog has the fields and block structure
+// the rest of the pipeline relies on
+func validateLlamaResponse(response LlamaIndexResponse) error {
+	if strings.TrimSpace(response.Title) == "" {
+		return fmt.Errorf("%w: title is empty", errInvalidLlamaResponse)
+	}
+	if strings.TrimSpace(response.Summary) == "" {
+		return fmt.Errorf("%w: summary is empty", errInvalidLlamaResponse)
+	}
+	if len(response.Content) == 0 {
+		return fmt.Errorf("%w: no content blocks", errInvalidLlamaResponse)
+	}
+
+	for i, block := range response.Content {
+		if err := validateBlock(block); err != nil {
+			return fmt.Errorf("%w: block %d: %v", errInvalidLlamaResponse, i, err)
+		}
+	}
+	return nil
+}
+
+// generateWithRetries runs the generator selected by LLM_PROVIDER, retrying retryable
+// failures and blogs of the wrong length with exponential backoff until the attempts run
+// out or ctx is done. The response records how many attempts it took and the tokens they
+// used; errors are wrapped in an AttemptsError.
+func generateWithRetries(ctx context.Context, request LlamaIndexRequest) (LlamaIndexResponse, error) {
+	maxAttempts := max(getEnvInt("GENERATION_MAX_ATTEMPTS", defaultGenerationMaxAttempts), 1)
+
 	var response LlamaIndexResponse
+	generator, err := selectedGenerator()
+	if err != nil {
+		return response, err
+	}
+
+	var usage TokenUsage
+	attempt := 1
+	for ; ; attempt++ {
+		response, err = generator.Generate(ctx, request)
+		usage = usage.Add(response.Usage)
+		if err == nil && attempt < maxAttempts {
+			// A blog of the wrong length is worth another attempt, but the last one is kept
+			if lengthErr := checkLength(response.Content, request.Length); lengthErr != nil {
+				err = &RetryableError{Err: lengthErr}
+			}
+		}
+		if err == nil {
+			response.Attempts = attempt
+			response.Usage = usage
+			return response, nil
+		}
+		if !isRetryable(err) || ctx.Err() != nil || attempt == maxAttempts {
+			break
+		}
+
+		delay := retryDelay(attempt)
+		log.Printf("Generation attempt %d/%d for topic %q failed, retrying in %v: %v", attempt, maxAttempts, request.Topic, delay.Round(time.Millisecond), err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return response, &AttemptsError{Attempts: attempt, Usage: usage, Err: fmt.Errorf("%w (last error: %v)", ctx.Err(), err)}
+		case <-timer.C:
+		}
+	}
+	return response, &AttemptsError{Attempts: attempt, Usage: usage, Err: err}
+}
+
+// retryDelay returns how long to wait after the given failed attempt: GENERATION_RETRY_DELAY
+// doubled for each earlier attempt, capped at GENERATION_RETRY_MAX_DELAY, and shortened by
+// a random fraction of up to GENERATION_RETRY_JITTER so concurrent retries spread out
+func retryDelay(attempt int) time.Duration {
+	base := getEnvDuration("GENERATION_RETRY_DELAY", defaultGenerationRetryDelay)
+	maxDelay := getEnvDuration("GENERATION_RETRY_MAX_DELAY", defaultGenerationRetryMaxDelay)
+	jitter, ok := getEnvFloat("GENERATION_RETRY_JITTER")
+	if !ok {
+		jitter = defaultGenerationRetryJitter
+	}
+	jitter = min(max(jitter, 0), 1)
+
+	delay := base
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, maxDelay)
+	return delay - time.Duration(rand.Float64()*jitter*float64(delay))
+}
+
+// pythonGenerator writes blogs with the LlamaIndex script, run per request, as a long-lived
+// worker when LLAMA_WORKER is enabled, or as an HTTP sidecar when LLAMA_SIDECAR or
+// LLAMA_SIDECAR_URL is set
+type pythonGenerator struct{}
+
+func (pythonGenerator) Ready(ctx context.Context) error {
+	if sidecar := pythonSidecar(); sidecar.enabled() && !sidecar.managed {
+		return sidecar.healthy(ctx)
+	}
+	if err := checkPython(ctx); err != nil {
+		return err
+	}
+	return checkScript()
+}
 
-	// Create the request
-	request := LlamaIndexRequest{
-		Topic:    topic,
-		Contents: contents,
+func (pythonGenerator) Generate(ctx context.Context, request LlamaIndexRequest) (LlamaIndexResponse, error) {
+	if sidecar := pythonSidecar(); sidecar.enabled() {
+		return sidecar.Generate(ctx, request)
+	}
+	if llamaWorkerEnabled() {
+		return pythonWorker.Generate(ctx, request)
 	}
+	return runLlamaIndexScript(ctx, request)
+}
+
+// runLlamaIndexScript runs the Python script once and parses its output. The script is
+// killed if ctx is cancelled or its deadline passes.
+func runLlamaIndexScript(ctx context.Context, request LlamaIndexRequest) (LlamaIndexResponse, error) {
+	var response LlamaIndexResponse
 
 	// Convert request to JSON
 	requestJSON, err := json.Marshal(request)
@@ -24,7 +224,8 @@ func GenerateBlogWithLlamaIndex(topic string, contents []ScrapedContent) (LlamaI
 	}
 
 	// Prepare the Python script command
-	cmd := exec.Command("python3", "llamaindex_service.py")
+	cmd := exec.CommandContext(ctx, "python3", appConfig.PythonScript)
+	cmd.WaitDelay = 5 * time.Second
 
 	// Set up stdin/stdout pipes
 	cmd.Stdin = bytes.NewBuffer(requestJSON)
@@ -35,15 +236,52 @@ func GenerateBlogWithLlamaIndex(topic string, contents []ScrapedContent) (LlamaI
 
 	// Run the command
 	err = cmd.Run()
+	if ctx.Err() != nil {
+		return response, fmt.Errorf("stopped Python script: %w", ctx.Err())
+	}
 	if err != nil {
-		return response, fmt.Errorf("failed to run Python script: %v\nStderr: %s", err, errOut.String())
+		// A crash part way through writing leaves a truncated document on stdout
+		if len(bytes.TrimSpace(out.Bytes())) > 0 {
+			if _, parseErr := parseLlamaOutput(out.Bytes(), errOut.String()); errors.Is(parseErr, errTruncatedOutput) {
+				return response, parseErr
+			}
+		}
+		return response, fmt.Errorf("failed to run Python script: %v\nStderr: %s", err, tail(errOut.String(), stderrTailSize))
 	}
 
-	// Parse the response
-	err = json.Unmarshal(out.Bytes(), &response)
+	return parseLlamaOutput(out.Bytes(), errOut.String())
+}
+
+// parseLlamaOutput decodes the Python script's stdout, distinguishing truncated output
+// (retryable) from output that is complete but malformed
+func parseLlamaOutput(stdout []byte, stderr string) (LlamaIndexResponse, error) {
+	var response LlamaIndexResponse
+
+	if len(bytes.TrimSpace(stdout)) == 0 {
+		return response, &RetryableError{Err: fmt.Errorf("%w: stdout was empty\nStderr tail: %s", errTruncatedOutput, tail(stderr, stderrTailSize))}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(stdout))
+	err := decoder.Decode(&response)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return response, &RetryableError{Err: fmt.Errorf("%w: stdout ended after %d bytes\nStderr tail: %s", errTruncatedOutput, len(stdout), tail(stderr, stderrTailSize))}
+	}
+	if err == nil {
+		if _, tokenErr := decoder.Token(); tokenErr != io.EOF {
+			err = fmt.Errorf("unexpected data after JSON document")
+		}
+	}
 	if err != nil {
-		return response, fmt.Errorf("failed to unmarshal response: %v", err)
+		return response, fmt.Errorf("failed to unmarshal response (%d bytes of stdout): %v\nStderr tail: %s", len(stdout), err, tail(stderr, stderrTailSize))
 	}
 
 	return response, nil
 }
+
+// tail returns at most the last n bytes of s
+func tail(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return "..." + s[len(s)-n:]
+}
@@ -1,6 +1,8 @@
 import sys
 import json
 import os
+import argparse
+from http.server import BaseHTTPRequestHandler, HTTPServer
 import requests
 from typing import List, Dict, Any, Optional
 from datetime import datetime
@@ -63,7 +65,21 @@ class LlamaIndexService:
         
         return [photo["src"]["large"] for photo in photos[:count]] + [f"https://via.placeholder.com/900x500?text={topic}+Image+Not+Available"] * (count - len(photos))
 
-    def generate_blog_from_query(self, topic: str, index: VectorStoreIndex) -> Dict:
+    def estimate_confidence(self, blog: Dict, source_count: int, parsed_json: bool) -> float:
+        """Heuristic 0-1 quality score based on source coverage and structure of the generated blog."""
+        paragraphs = [b for b in blog.get("content", []) if b.get("type") == "paragraph" and b.get("text")]
+        headings = [b for b in blog.get("content", []) if b.get("type") == "heading"]
+        words = sum(len(b["text"].split()) for b in paragraphs)
+
+        score = 1.0 if parsed_json else 0.6
+        score *= min(source_count, 5) / 5
+        score *= min(words, 800) / 800
+        if len(headings) < 3:
+            score *= 0.8
+        return round(max(0.0, min(score, 1.0)), 2)
+
+    def generate_blog_from_query(self, topic: str, index: VectorStoreIndex, source_count: int = 0, options: Dict = None) -> Dict:
+        options = options or {}
         query_engine = index.as_query_engine(
             llm=self.llm,
             similarity_top_k=20,
@@ -80,8 +96,10 @@ class LlamaIndexService:
         Include exactly 2 image placeholders: one as the featured image and one in the body after the introduction. Use placeholders like 'FEATURED_IMAGE_URL' and 'CONTENT_IMAGE_URL'; actual URLs will be filled in later.
         Format the response as a JSON object with 'title', 'content' (list of content blocks), 'featuredImage', 'tags', and 'summary'.
         Each content block should have 'type' (e.g., 'heading', 'paragraph', 'image') and appropriate fields (e.g., 'text' for paragraphs, 'url', 'alt', 'caption' for images).
-        Ensure the tone is conversational, the content is well-organized, and the output feels like a blog post, not a list of facts or images.
+        Give each paragraph 'sources', a list of objects with the 'url' of the documents (their 'source' metadata) its facts come from, or an empty list for paragraphs that state no facts from them.
+        Unless another tone or length is requested below, ensure the tone is conversational, the content is well-organized, and the output feels like a blog post, not a list of facts or images.
         """
+        prompt += style_prompt(options)
 
         response = query_engine.query(prompt)
         response_text = str(response).strip()
@@ -114,7 +132,7 @@ class LlamaIndexService:
                             block.setdefault("level", 1)
                             block.setdefault("text", block.get("content", ""))
                         elif block["type"] == "text":
-                            block = {"type": "paragraph", "text": block.get("content", "")}
+                            block = {"type": "paragraph", "text": block.get("content", ""), "sources": block.get("sources", [])}
                         content_blocks.append(block)
 
                 # Ensure exactly 2 images: featured at start, content after intro
@@ -148,6 +166,7 @@ class LlamaIndexService:
                     "tags": blog_data.get("tags", [topic, "Insights", "Overview"]),
                     "summary": blog_data.get("summary", f"A comprehensive blog post exploring {topic}, its developments, impacts, and future possibilities.")
                 }
+                blog["confidence"] = self.estimate_confidence(blog, source_count, parsed_json=True)
                 return blog
         except json.JSONDecodeError:
             content_blocks = []
@@ -223,17 +242,132 @@ class LlamaIndexService:
                 "tags": [topic, "Insights", "Overview"],
                 "summary": f"A comprehensive blog post exploring {topic}, its developments, impacts, and future possibilities."
             }
+            blog["confidence"] = self.estimate_confidence(blog, source_count, parsed_json=False)
             return blog
 
-def main():
-    input_data = json.loads(sys.stdin.read())
+# Tones the backend may ask for, described as in generator.go
+TONES = {
+    "formal": "formal and authoritative, without slang or contractions",
+    "conversational": "conversational and friendly, as if talking to the reader",
+    "persuasive": "persuasive, building a case for its point of view and ending with a clear call to action",
+    "technical": "technical and precise, using the field's terminology and concrete details",
+}
+
+# Word counts of the lengths the backend may ask for (target, minimum, maximum), as in generator.go
+LENGTHS = {
+    "short": (500, 300, 800),
+    "medium": (1200, 800, 1800),
+    "long": (2500, 1800, 3500),
+}
+
+def style_prompt(options: Dict) -> str:
+    # Describe the requested language, tone, audience, length, instructions and outline, overriding the default tone and structure
+    prompt = ""
+    language = options.get("language", "")
+    if language:
+        prompt += f"\nWrite everything in the language with the BCP 47 tag {language}: the title, summary, tags, headings, paragraphs and image captions.\n"
+    tone = options.get("tone", "")
+    if tone in TONES:
+        prompt += f"\nWrite in a {tone} tone: {TONES[tone]}.\n"
+    audience = options.get("audience", "").strip()
+    if audience:
+        prompt += f"\nWrite for this audience: {audience}. Pitch the explanations and examples at their level.\n"
+    length = LENGTHS.get(options.get("length", ""))
+    if length:
+        words, min_words, max_words = length
+        prompt += f"\nWrite about {words} words of headings and paragraphs in total, and no fewer than {min_words} or more than {max_words}, adjusting the number of sections and paragraphs to fit.\n"
+    instructions = options.get("instructions", "").strip()
+    if instructions:
+        prompt += f"\nFollow these instructions on the post's structure and emphasis, as long as they don't contradict the format above:\n{instructions}\n"
+    outline = options.get("outline") or []
+    if outline:
+        prompt += "\nFollow this approved outline, using its headings as the section headings in this order and covering each of its points:\n"
+        for section in outline:
+            prompt += f"- {section.get('heading', '')}\n"
+            for point in section.get("points") or []:
+                prompt += f"  - {point}\n"
+    return prompt
+
+def generate(service: LlamaIndexService, input_data: Dict) -> Dict:
     topic = input_data.get("topic", "")
     contents = input_data.get("contents", [])
 
-    service = LlamaIndexService()
     documents = service.create_documents_from_scraped_content(contents)
     index = service.create_index(documents)
-    blog = service.generate_blog_from_query(topic, index)
+    return service.generate_blog_from_query(topic, index, len(documents), input_data)
+
+def run_worker():
+    # Serve newline-delimited JSON requests until stdin closes, answering each with one line.
+    # Anything the libraries print goes to stderr so it can't corrupt the protocol.
+    out = sys.stdout
+    sys.stdout = sys.stderr
+
+    service = LlamaIndexService()
+    for line in sys.stdin:
+        if not line.strip():
+            continue
+        try:
+            blog = generate(service, json.loads(line))
+        except Exception as e:
+            blog = {"error": str(e)}
+        out.write(json.dumps(blog) + "\n")
+        out.flush()
+
+def run_server(host: str, port: int):
+    # Serve GET /health and POST /generate until killed. Requests are handled one at a time,
+    # since generations share the on-disk index.
+    service = LlamaIndexService()
+
+    class Handler(BaseHTTPRequestHandler):
+        def reply(self, status: int, body: Dict):
+            payload = json.dumps(body).encode()
+            self.send_response(status)
+            self.send_header("Content-Type", "application/json")
+            self.send_header("Content-Length", str(len(payload)))
+            self.end_headers()
+            self.wfile.write(payload)
+
+        def do_GET(self):
+            if self.path == "/health":
+                self.reply(200, {"status": "ok"})
+            else:
+                self.reply(404, {"error": "not found"})
+
+        def do_POST(self):
+            if self.path != "/generate":
+                self.reply(404, {"error": "not found"})
+                return
+            try:
+                length = int(self.headers.get("Content-Length", 0))
+                blog = generate(service, json.loads(self.rfile.read(length)))
+            except Exception as e:
+                self.reply(500, {"error": str(e)})
+                return
+            self.reply(200, blog)
+
+        def log_message(self, format, *args):
+            sys.stderr.write("%s - %s\n" % (self.address_string(), format % args))
+
+    print(f"LlamaIndex sidecar listening on {host}:{port}", file=sys.stderr)
+    HTTPServer((host, port), Handler).serve_forever()
+
+def main():
+    parser = argparse.ArgumentParser()
+    parser.add_argument("--worker", action="store_true", help="serve newline-delimited JSON requests on stdin")
+    parser.add_argument("--serve", action="store_true", help="serve requests over HTTP")
+    parser.add_argument("--host", default="127.0.0.1")
+    parser.add_argument("--port", type=int, default=8765)
+    args = parser.parse_args()
+
+    if args.serve:
+        run_server(args.host, args.port)
+        return
+    if args.worker:
+        run_worker()
+        return
+
+    input_data = json.loads(sys.stdin.read())
+    blog = generate(LlamaIndexService(), input_data)
 
     print(json.dumps(blog))
 
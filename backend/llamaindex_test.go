@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseLlamaOutput(t *testing.T) {
+	complete := `{"title": "Go", "summary": "About Go", "content": [{"type": "paragraph", "text": "Go is a language."}]}`
+
+	tests := []struct {
+		name          string
+		stdout        string
+		wantTitle     string
+		wantTruncated bool
+		wantErr       bool
+	}{
+		{name: "complete document", stdout: complete, wantTitle: "Go"},
+		{name: "trailing newline", stdout: complete + "\n", wantTitle: "Go"},
+		{name: "empty", stdout: "", wantTruncated: true, wantErr: true},
+		{name: "only whitespace", stdout: " \n\t", wantTruncated: true, wantErr: true},
+		{name: "cut inside a string", stdout: complete[:20], wantTruncated: true, wantErr: true},
+		{name: "cut inside the content list", stdout: complete[:len(complete)-3], wantTruncated: true, wantErr: true},
+		{name: "missing closing brace", stdout: complete[:len(complete)-1], wantTruncated: true, wantErr: true},
+		{name: "malformed", stdout: `{"title": Go}`, wantErr: true},
+		{name: "not JSON", stdout: "Traceback (most recent call last):", wantErr: true},
+		{name: "data after the document", stdout: complete + `{"title": "again"}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := parseLlamaOutput([]byte(tt.stdout), "stderr output")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if truncated := errors.Is(err, errTruncatedOutput); truncated != tt.wantTruncated {
+				t.Errorf("truncated = %v, want %v (err %v)", truncated, tt.wantTruncated, err)
+			}
+			if isRetryable(err) != tt.wantTruncated {
+				t.Errorf("retryable = %v, want %v", isRetryable(err), tt.wantTruncated)
+			}
+			if err != nil && !strings.Contains(err.Error(), "stderr output") {
+				t.Errorf("error %q doesn't include the stderr tail", err)
+			}
+			if response.Title != tt.wantTitle && err == nil {
+				t.Errorf("title = %q, want %q", response.Title, tt.wantTitle)
+			}
+		})
+	}
+}
+
+// fakeGenerator returns its results in order, one per call
+type fakeGenerator struct {
+	results []fakeResult
+	calls   int
+}
+
+type fakeResult struct {
+	response LlamaIndexResponse
+	err      error
+}
+
+func (g *fakeGenerator) Ready(context.Context) error { return nil }
+
+func (g *fakeGenerator) Generate(context.Context, LlamaIndexRequest) (LlamaIndexResponse, error) {
+	result := g.results[min(g.calls, len(g.results)-1)]
+	g.calls++
+	return result.response, result.err
+}
+
+// useGenerator selects the generator for the test, with retries that don't wait
+func useGenerator(t *testing.T, generator Generator) {
+	t.Helper()
+	generators["fake"] = generator
+	t.Cleanup(func() { delete(generators, "fake") })
+	t.Setenv("LLM_PROVIDER", "fake")
+	t.Setenv("GENERATION_RETRY_DELAY", "1ms")
+	t.Setenv("GENERATION_RETRY_JITTER", "0")
+}
+
+func TestGenerateWithRetries(t *testing.T) {
+	blog := LlamaIndexResponse{Title: "Go", Summary: "About Go", Content: []BlogContent{{Type: "paragraph", Text: "Go is a language."}}, Usage: TokenUsage{InputTokens: 10, OutputTokens: 5}}
+	truncated := &RetryableError{Err: errTruncatedOutput}
+	malformed := errors.New("failed to unmarshal response")
+
+	tests := []struct {
+		name         string
+		maxAttempts  string
+		results      []fakeResult
+		wantCalls    int
+		wantErr      error
+		wantAttempts int
+	}{
+		{name: "first attempt succeeds", maxAttempts: "3", results: []fakeResult{{response: blog}}, wantCalls: 1, wantAttempts: 1},
+		{name: "truncated output is retried", maxAttempts: "3", results: []fakeResult{{err: truncated}, {response: blog}}, wantCalls: 2, wantAttempts: 2},
+		{name: "attempts run out", maxAttempts: "2", results: []fakeResult{{err: truncated}}, wantCalls: 2, wantErr: errTruncatedOutput, wantAttempts: 2},
+		{name: "malformed output isn't retried", maxAttempts: "3", results: []fakeResult{{err: malformed}}, wantCalls: 1, wantErr: malformed, wantAttempts: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			generator := &fakeGenerator{results: tt.results}
+			useGenerator(t, generator)
+			t.Setenv("GENERATION_MAX_ATTEMPTS", tt.maxAttempts)
+
+			response, err := generateWithRetries(context.Background(), LlamaIndexRequest{Topic: "Go"})
+			if generator.calls != tt.wantCalls {
+				t.Errorf("generator called %d times, want %d", generator.calls, tt.wantCalls)
+			}
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if response.Attempts != tt.wantAttempts {
+					t.Errorf("attempts = %d, want %d", response.Attempts, tt.wantAttempts)
+				}
+				if response.Usage != blog.Usage {
+					t.Errorf("usage = %+v, want %+v", response.Usage, blog.Usage)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if attempts := generationAttempts(err); attempts != tt.wantAttempts {
+				t.Errorf("attempts recorded in the error = %d, want %d", attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestGenerateWithRetriesStopsWhenCancelled(t *testing.T) {
+	generator := &fakeGenerator{results: []fakeResult{{err: &RetryableError{Err: errTruncatedOutput}}}}
+	useGenerator(t, generator)
+	t.Setenv("GENERATION_MAX_ATTEMPTS", "5")
+	t.Setenv("GENERATION_RETRY_DELAY", "1h")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := generateWithRetries(ctx, LlamaIndexRequest{Topic: "Go"})
+	if !errors.Is(err, errTruncatedOutput) {
+		t.Fatalf("err = %v, want the last attempt's error", err)
+	}
+	if generator.calls != 1 {
+		t.Errorf("generator called %d times, want 1", generator.calls)
+	}
+}
+
+func TestValidateLlamaResponse(t *testing.T) {
+	valid := func() LlamaIndexResponse {
+		return LlamaIndexResponse{
+			Title:   "Go",
+			Summary: "About Go",
+			Content: []BlogContent{
+				{Type: "heading", Text: "Why Go", Level: 2},
+				{Type: "paragraph", Text: "Go is a language."},
+				{Type: "image", URL: "https://images.example.com/go.png"},
+			},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		change  func(*LlamaIndexResponse)
+		wantErr bool
+	}{
+		{"valid", func(*LlamaIndexResponse) {}, false},
+		{"empty title", func(r *LlamaIndexResponse) { r.Title = "" }, true},
+		{"blank title", func(r *LlamaIndexResponse) { r.Title = " \n" }, true},
+		{"empty summary", func(r *LlamaIndexResponse) { r.Summary = "" }, true},
+		{"no content", func(r *LlamaIndexResponse) { r.Content = nil }, true},
+		{"unknown block type", func(r *LlamaIndexResponse) { r.Content[1].Type = "quote" }, true},
+		{"heading without level", func(r *LlamaIndexResponse) { r.Content[0].Level = 0 }, true},
+		{"image without URL", func(r *LlamaIndexResponse) { r.Content[2].URL = "" }, true},
+		// Stray citations are stripped by attributeSources rather than failing the generation
+		{"heading citing a source", func(r *LlamaIndexResponse) {
+			r.Content[0].Sources = []BlogSource{{URL: "https://news.example.com/go"}}
+		}, false},
+		{"citation without URL", func(r *LlamaIndexResponse) { r.Content[1].Sources = []BlogSource{{Title: "Go"}} }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := valid()
+			tt.change(&response)
+			err := validateLlamaResponse(response)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateLlamaResponse = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, errInvalidLlamaResponse) {
+				t.Errorf("error %v doesn't wrap errInvalidLlamaResponse", err)
+			}
+		})
+	}
+}
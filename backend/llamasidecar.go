@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sidecar defaults, overridable with LLAMA_SIDECAR_PORT, LLAMA_SIDECAR_START_TIMEOUT and
+// LLAMA_SIDECAR_HEALTH_INTERVAL
+const (
+	defaultSidecarPort           = 8765
+	defaultSidecarStartTimeout   = 60 * time.Second
+	defaultSidecarHealthInterval = 10 * time.Second
+	sidecarHealthTimeout         = 2 * time.Second
+)
+
+// errSidecarUnavailable is returned when the sidecar doesn't pass its health check
+var errSidecarUnavailable = errors.New("LlamaIndex sidecar is unavailable")
+
+// llamaSidecar talks to llamaindex_service.py running as an HTTP server, either one it
+// starts itself (LLAMA_SIDECAR) or one run separately at LLAMA_SIDECAR_URL. A managed
+// process that fails its health check is restarted.
+type llamaSidecar struct {
+	mu      sync.Mutex
+	url     string
+	managed bool
+	cmd     *exec.Cmd
+	exited  chan struct{}
+	stderr  *tailBuffer
+	once    sync.Once
+	done    chan struct{}
+}
+
+// pythonSidecar is shared by all generations when the sidecar is enabled. It is configured
+// at first use, after .env has been loaded.
+var pythonSidecar = sync.OnceValue(newLlamaSidecar)
+
+func newLlamaSidecar() *llamaSidecar {
+	sidecar := &llamaSidecar{done: make(chan struct{})}
+	if external := getEnv("LLAMA_SIDECAR_URL", ""); external != "" {
+		sidecar.url = strings.TrimRight(external, "/")
+	} else if getEnvBool("LLAMA_SIDECAR", false) {
+		sidecar.url = fmt.Sprintf("http://127.0.0.1:%d", getEnvInt("LLAMA_SIDECAR_PORT", defaultSidecarPort))
+		sidecar.managed = true
+	}
+	return sidecar
+}
+
+// enabled reports whether generations go through the sidecar
+func (s *llamaSidecar) enabled() bool {
+	return s.url != ""
+}
+
+// healthy reports whether the sidecar answers its health check
+func (s *llamaSidecar) healthy(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, sidecarHealthTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", s.url+"/health", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := llmClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errSidecarUnavailable, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: health check returned status code %d", errSidecarUnavailable, resp.StatusCode)
+	}
+	return nil
+}
+
+// start launches the managed Python server. The caller must hold s.mu.
+func (s *llamaSidecar) start() error {
+	port := getEnvInt("LLAMA_SIDECAR_PORT", defaultSidecarPort)
+	cmd := exec.Command("python3", appConfig.PythonScript, "--serve", "--port", fmt.Sprint(port))
+	stderr := &tailBuffer{max: stderrTailSize}
+	cmd.Stdout = stderr
+	cmd.Stderr = stderr
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start LlamaIndex sidecar: %v", err)
+	}
+	log.Printf("Started LlamaIndex sidecar on port %d (pid %d)", port, cmd.Process.Pid)
+
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+
+	s.cmd = cmd
+	s.exited = exited
+	s.stderr = stderr
+	return nil
+}
+
+// stop kills the managed Python server. The caller must hold s.mu.
+func (s *llamaSidecar) stop() {
+	if s.cmd == nil {
+		return
+	}
+	s.cmd.Process.Kill()
+	<-s.exited
+	s.cmd = nil
+}
+
+// ensure makes sure the sidecar is healthy, (re)starting the managed process and waiting
+// for it to come up if needed
+func (s *llamaSidecar) ensure(ctx context.Context) error {
+	s.once.Do(func() {
+		if s.managed {
+			go s.monitor(getEnvDuration("LLAMA_SIDECAR_HEALTH_INTERVAL", defaultSidecarHealthInterval))
+		}
+	})
+
+	if err := s.healthy(ctx); err == nil || !s.managed {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	select {
+	case <-s.done:
+		return fmt.Errorf("%w: shutting down", errSidecarUnavailable)
+	default:
+	}
+	// Another request may have restarted it while this one waited for the lock
+	if s.healthy(ctx) == nil {
+		return nil
+	}
+	s.stop()
+	if err := s.start(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, getEnvDuration("LLAMA_SIDECAR_START_TIMEOUT", defaultSidecarStartTimeout))
+	defer cancel()
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.exited:
+			s.cmd = nil
+			return &RetryableError{Err: fmt.Errorf("%w: process exited during startup\nStderr tail: %s", errSidecarUnavailable, s.stderr.String())}
+		case <-ctx.Done():
+			return &RetryableError{Err: fmt.Errorf("%w: not healthy after startup: %v\nStderr tail: %s", errSidecarUnavailable, ctx.Err(), s.stderr.String())}
+		case <-ticker.C:
+			if s.healthy(ctx) == nil {
+				return nil
+			}
+		}
+	}
+}
+
+// monitor restarts the managed process whenever it fails its health check, so a crashed
+// sidecar is back up before the next generation needs it
+func (s *llamaSidecar) monitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			err := s.healthy(context.Background())
+			if err == nil {
+				continue
+			}
+			log.Printf("LlamaIndex sidecar failed its health check, restarting: %v", err)
+			if err := s.ensure(context.Background()); err != nil {
+				log.Printf("Failed to restart LlamaIndex sidecar: %v", err)
+			}
+		}
+	}
+}
+
+// Close stops health monitoring and the managed process
+func (s *llamaSidecar) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	select {
+	case <-s.done:
+	default:
+		close(s.done)
+	}
+	s.stop()
+}
+
+// Generate sends one request to the sidecar and waits for its reply. Connection failures
+// are retryable; the next attempt restarts a managed sidecar that has died.
+func (s *llamaSidecar) Generate(ctx context.Context, request LlamaIndexRequest) (LlamaIndexResponse, error) {
+	var response LlamaIndexResponse
+	if err := s.ensure(ctx); err != nil {
+		return response, err
+	}
+
+	requestJSON, err := json.Marshal(request)
+	if err != nil {
+		return response, fmt.Errorf("failed to marshal request: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", s.url+"/generate", bytes.NewReader(requestJSON))
+	if err != nil {
+		return response, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := llmClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return response, fmt.Errorf("stopped waiting for LlamaIndex sidecar: %w", ctx.Err())
+		}
+		return response, &RetryableError{Err: fmt.Errorf("LlamaIndex sidecar request failed: %v", err)}
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return response, &RetryableError{Err: fmt.Errorf("failed to read LlamaIndex sidecar reply: %v", err)}
+	}
+	if resp.StatusCode != http.StatusOK {
+		var workerErr workerError
+		if json.Unmarshal(body, &workerErr) == nil && workerErr.Error != "" {
+			return response, fmt.Errorf("LlamaIndex sidecar failed: %s", workerErr.Error)
+		}
+		return response, fmt.Errorf("LlamaIndex sidecar returned status code %d: %s", resp.StatusCode, tail(string(body), stderrTailSize))
+	}
+
+	return parseLlamaOutput(body, "")
+}
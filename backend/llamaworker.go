@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"sync"
+)
+
+// llamaWorker keeps one Python process running in --worker mode and exchanges
+// newline-delimited JSON with it, so the interpreter and model imports are paid once.
+// Only one request is in flight at a time; the process is respawned after it dies.
+type llamaWorker struct {
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	stderr *tailBuffer
+}
+
+// workerError is the reply the worker sends when generation raised an exception
+type workerError struct {
+	Error string `json:"error"`
+}
+
+// pythonWorker is shared by all generations when LLAMA_WORKER is enabled
+var pythonWorker = &llamaWorker{}
+
+// llamaWorkerEnabled reports whether generations go through the long-lived worker
+// instead of starting the Python script for every request
+func llamaWorkerEnabled() bool {
+	return getEnvBool("LLAMA_WORKER", false)
+}
+
+// start launches the Python process. The caller must hold w.mu.
+func (w *llamaWorker) start() error {
+	cmd := exec.Command("python3", appConfig.PythonScript, "--worker")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("failed to open worker stdin: %v", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to open worker stdout: %v", err)
+	}
+	stderr := &tailBuffer{max: stderrTailSize}
+	cmd.Stderr = stderr
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start Python worker: %v", err)
+	}
+	log.Printf("Started Python worker (pid %d)", cmd.Process.Pid)
+
+	w.cmd = cmd
+	w.stdin = stdin
+	w.stdout = bufio.NewReader(stdout)
+	w.stderr = stderr
+	return nil
+}
+
+// stop kills the Python process so the next request starts a fresh one. The caller must hold w.mu.
+func (w *llamaWorker) stop() {
+	if w.cmd == nil {
+		return
+	}
+	w.stdin.Close()
+	w.cmd.Process.Kill()
+	w.cmd.Wait()
+	w.cmd = nil
+}
+
+// Close stops the Python process, waiting for any in-flight request to finish first
+func (w *llamaWorker) Close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stop()
+}
+
+// Generate sends one request to the worker and waits for its reply. If ctx ends first or the
+// process dies mid-request, the worker is killed and respawned on the next call.
+func (w *llamaWorker) Generate(ctx context.Context, request LlamaIndexRequest) (LlamaIndexResponse, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var response LlamaIndexResponse
+	if w.cmd == nil {
+		if err := w.start(); err != nil {
+			return response, err
+		}
+	}
+
+	requestJSON, err := json.Marshal(request)
+	if err != nil {
+		return response, fmt.Errorf("failed to marshal request: %v", err)
+	}
+
+	if _, err := w.stdin.Write(append(requestJSON, '\n')); err != nil {
+		stderr := w.stderr.String()
+		w.stop()
+		return response, &RetryableError{Err: fmt.Errorf("failed to write to Python worker: %v\nStderr tail: %s", err, stderr)}
+	}
+
+	type reply struct {
+		line []byte
+		err  error
+	}
+	replies := make(chan reply, 1)
+	go func() {
+		line, err := w.stdout.ReadBytes('\n')
+		replies <- reply{line, err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		w.stop()
+		<-replies
+		return response, fmt.Errorf("stopped Python worker: %w", ctx.Err())
+	case r := <-replies:
+		if r.err != nil {
+			// The process exited before finishing its reply
+			w.stop()
+			return response, &RetryableError{Err: fmt.Errorf("Python worker died mid-request: %v\nStderr tail: %s", r.err, w.stderr.String())}
+		}
+
+		var workerErr workerError
+		if json.Unmarshal(r.line, &workerErr) == nil && workerErr.Error != "" {
+			return response, fmt.Errorf("Python worker failed: %s", workerErr.Error)
+		}
+		return parseLlamaOutput(r.line, w.stderr.String())
+	}
+}
+
+// tailBuffer is an io.Writer that keeps only the last max bytes written to it
+type tailBuffer struct {
+	mu  sync.Mutex
+	max int
+	buf bytes.Buffer
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.buf.Write(p)
+	if extra := b.buf.Len() - b.max; extra > 0 {
+		b.buf.Next(extra)
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
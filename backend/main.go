@@ -1,19 +1,22 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"io"
 	"log"
+	"math"
 	"net/http"
-	"net/url"
 	"os"
-	"path/filepath"
+	"os/signal"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
-	"github.com/gocolly/colly/v2"
-	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
 	"github.com/rs/cors"
@@ -27,6 +30,8 @@ type BlogContent struct {
 	URL     string `json:"url,omitempty"`
 	Alt     string `json:"alt,omitempty"`
 	Caption string `json:"caption,omitempty"`
+	// Sources are the scraped articles a paragraph's facts come from, as URL and title
+	Sources []BlogSource `json:"sources,omitempty"`
 }
 
 // BlogPost represents the full blog structure
@@ -41,11 +46,114 @@ type BlogPost struct {
 	Tags          []string      `json:"tags"`
 	ReadingTime   int           `json:"readingTime"`
 	Topic         string        `json:"topic"`
+	// UpdatedAt is when the blog was last stored (RFC 3339), used as its last modification time
+	UpdatedAt string `json:"updatedAt,omitempty"`
+	// OwnerID is the user who generated the blog, empty for blogs generated with an API key
+	OwnerID string `json:"ownerId,omitempty"`
+	// CanonicalURL is the blog's URL under PUBLIC_BASE_URL, resolved when the blog is read,
+	// unless a user set another one
+	CanonicalURL  string  `json:"canonicalUrl,omitempty"`
+	Status        string  `json:"status,omitempty"`
+	Confidence    float64 `json:"confidence"`
+	LowConfidence bool    `json:"lowConfidence,omitempty"`
+	// SubmittedAt and PublishedAt are when the blog was last sent for review and when it
+	// was published (RFC 3339); PublishedAt is cleared when the blog is unpublished
+	SubmittedAt string `json:"submittedAt,omitempty"`
+	PublishedAt string `json:"publishedAt,omitempty"`
+	// StatusChanges records the blog's latest status changes, oldest first
+	StatusChanges []StatusChange `json:"statusChanges,omitempty"`
+	// GenerationAttempts is how many times the generator ran before it succeeded
+	GenerationAttempts int `json:"generationAttempts,omitempty"`
+	// LengthMismatch is set when the blog's word count is outside the range of the length
+	// it was requested at, even after retrying
+	LengthMismatch bool `json:"lengthMismatch,omitempty"`
+
+	OriginalSummary    string `json:"originalSummary,omitempty"`
+	SummaryNeedsReview bool   `json:"summaryNeedsReview,omitempty"`
+
+	// Simulated is set when the blog was generated with placeholder content instead of real sources
+	Simulated bool         `json:"simulated,omitempty"`
+	Sources   []BlogSource `json:"sources,omitempty"`
+
+	// Publications records the remote posts the blog was published as, by target
+	Publications map[string]Publication `json:"publications,omitempty"`
+
+	// Slug names the blog in exported sites. It is taken from the title the blog was first
+	// generated with and kept through regenerations and edits, so links to it stay valid.
+	Slug string `json:"slug,omitempty"`
+	// GenerationOptions are the options the blog was generated with, reused when it is
+	// regenerated
+	GenerationOptions
+	// Revision is the number of the blog's latest revision; each change to its content is
+	// stored as a new one
+	Revision int `json:"revision,omitempty"`
+	// TranslationOf is the ID of the blog this one was translated from, and Translations
+	// maps the language tags the blog was translated into to the translations' IDs
+	TranslationOf string            `json:"translationOf,omitempty"`
+	Translations  map[string]string `json:"translations,omitempty"`
 }
 
+// BlogSource represents a scraped article referenced by the blog
+type BlogSource struct {
+	URL         string `json:"url"`
+	Title       string `json:"title"`
+	PublishedAt string `json:"publishedAt,omitempty"`
+}
+
+// blockTypes are the content block types a blog may contain
+var blockTypes = map[string]bool{
+	"paragraph": true,
+	"heading":   true,
+	"image":     true,
+}
+
+// validateBlock checks that a content block has a known type and the fields that type needs.
+// Citations aren't checked, as generated content's are resolved by attributeSources.
+func validateBlock(block BlogContent) error {
+	if !blockTypes[block.Type] {
+		return fmt.Errorf("unknown block type %q", block.Type)
+	}
+	if block.Type == "heading" && (block.Level < 1 || block.Level > 6) {
+		return fmt.Errorf("heading has level %d, want 1-6", block.Level)
+	}
+	if block.Type == "image" && strings.TrimSpace(block.URL) == "" {
+		return fmt.Errorf("image has no URL")
+	}
+	return nil
+}
+
+// validateEditedBlock checks a content block written by a user, who must cite sources
+// only on paragraphs and by URL
+func validateEditedBlock(block BlogContent) error {
+	if err := validateBlock(block); err != nil {
+		return err
+	}
+	if len(block.Sources) > 0 && block.Type != "paragraph" {
+		return fmt.Errorf("only paragraphs can cite sources")
+	}
+	for _, source := range block.Sources {
+		if strings.TrimSpace(source.URL) == "" {
+			return fmt.Errorf("cited source has no URL")
+		}
+	}
+	return nil
+}
+
+// Blog statuses. Generated blogs start as drafts, which may be sent for review before they
+// are published.
+const (
+	StatusDraft     = "draft"
+	StatusInReview  = "in_review"
+	StatusPublished = "published"
+)
+
 // RequestBody represents the incoming request payload
 type RequestBody struct {
 	Topic string `json:"topic"`
+	// OutlineFirst has the job propose an outline and wait for it to be approved before
+	// writing the blog
+	OutlineFirst bool `json:"outlineFirst,omitempty"`
+	GenerationOptions
 }
 
 // ScrapedContent represents content scraped from the web
@@ -54,12 +162,14 @@ type ScrapedContent struct {
 	Title       string `json:"title"`
 	Text        string `json:"text"`
 	PublishedAt string `json:"publishedAt"`
+	Simulated   bool   `json:"simulated,omitempty"`
 }
 
 // LlamaIndexRequest represents the input to the LlamaIndex Python script
 type LlamaIndexRequest struct {
 	Topic    string           `json:"topic"`
 	Contents []ScrapedContent `json:"contents"`
+	GenerationOptions
 }
 
 // LlamaIndexResponse represents the output from the LlamaIndex Python script
@@ -69,6 +179,13 @@ type LlamaIndexResponse struct {
 	FeaturedImage string        `json:"featuredImage"`
 	Tags          []string      `json:"tags"`
 	Summary       string        `json:"summary"`
+	Confidence    float64       `json:"confidence"`
+	// Attempts is how many times the generator ran to produce this response; cached
+	// responses leave it zero
+	Attempts int `json:"-"`
+	// Usage is the tokens the generator used over all its attempts. The Python generator
+	// doesn't report it and cached responses leave it zero.
+	Usage TokenUsage `json:"-"`
 }
 
 func main() {
@@ -77,14 +194,170 @@ func main() {
 		log.Println("No .env file found, relying on system environment variables")
 	}
 
+	appConfig, err = loadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	generationLimiters = newGenerationLimiters(appConfig.RateLimit)
+	authLimiters = newAuthLimiters(appConfig.AuthRateLimit)
+
+	if err := apiKeys.Load(appConfig.APIKeys, apiKeysFile()); err != nil {
+		log.Fatalf("Failed to load API keys: %v", err)
+	}
+	if err := users.Load(usersFile()); err != nil {
+		log.Fatalf("Failed to load user accounts: %v", err)
+	}
+	if err := webhooks.Load(webhooksFile()); err != nil {
+		log.Fatalf("Failed to load webhooks: %v", err)
+	}
+	if err := schedules.Load(schedulesFile()); err != nil {
+		log.Fatalf("Failed to load schedules: %v", err)
+	}
+	if err := subscriptions.Load(subscriptionsFile()); err != nil {
+		log.Fatalf("Failed to load subscriptions: %v", err)
+	}
+	if err := generationLog.Load(generationLogFile()); err != nil {
+		log.Fatalf("Failed to load the generation log: %v", err)
+	}
+
+	blogStore, err = newBlogStore()
+	if err != nil {
+		log.Fatalf("Failed to open blog store: %v", err)
+	}
+	blogStore = imageURLStore{blogStore}
+	initSearchIndex()
+	jobManager.Start()
+	schedules.Start()
+	subscriptions.Start()
+
 	r := mux.NewRouter()
-	r.HandleFunc("/api/generate-blog", generateBlogHandler).Methods("POST")
+	r.HandleFunc("/api/auth/register", authRateLimit(registerHandler)).Methods("POST")
+	r.HandleFunc("/api/auth/login", authRateLimit(loginHandler)).Methods("POST")
+	r.HandleFunc("/api/auth/me", currentUserHandler).Methods("GET")
+	r.HandleFunc("/api/generate-blog", requireRole(RoleEditor, rateLimit(generateBlogHandler))).Methods("POST")
+	r.HandleFunc("/api/generate-blog/stream", requireRole(RoleEditor, rateLimit(streamGenerateBlogHandler))).Methods("GET")
+	r.HandleFunc("/api/generate-blogs", requireRole(RoleEditor, generateBlogsHandler)).Methods("POST")
+	r.HandleFunc("/api/batches/{id}", getBatchHandler).Methods("GET")
+	r.HandleFunc("/api/jobs/{id}", getJobHandler).Methods("GET")
+	r.HandleFunc("/api/jobs/{id}", requireRole(RoleEditor, cancelJobHandler)).Methods("DELETE")
+	r.HandleFunc("/api/schedules", requireRole(RoleEditor, listSchedulesHandler)).Methods("GET")
+	r.HandleFunc("/api/schedules", requireRole(RoleEditor, createScheduleHandler)).Methods("POST")
+	r.HandleFunc("/api/schedules/{id}", requireRole(RoleEditor, getScheduleHandler)).Methods("GET")
+	r.HandleFunc("/api/schedules/{id}", requireRole(RoleEditor, updateScheduleHandler)).Methods("PUT")
+	r.HandleFunc("/api/schedules/{id}", requireRole(RoleEditor, deleteScheduleHandler)).Methods("DELETE")
+	r.HandleFunc("/api/jobs/{id}/events", jobEventsHandler).Methods("GET")
+	r.HandleFunc("/api/jobs/{id}/approve", requireRole(RoleEditor, approveOutlineHandler)).Methods("POST")
+	r.HandleFunc("/api/subscriptions", requireRole(RoleEditor, listSubscriptionsHandler)).Methods("GET")
+	r.HandleFunc("/api/subscriptions", requireRole(RoleEditor, createSubscriptionHandler)).Methods("POST")
+	r.HandleFunc("/api/subscriptions/{id}", requireRole(RoleEditor, getSubscriptionHandler)).Methods("GET")
+	r.HandleFunc("/api/subscriptions/{id}", requireRole(RoleEditor, updateSubscriptionHandler)).Methods("PUT")
+	r.HandleFunc("/api/subscriptions/{id}", requireRole(RoleEditor, deleteSubscriptionHandler)).Methods("DELETE")
+	r.HandleFunc("/api/subscriptions/{id}/refresh", requireRole(RoleEditor, rateLimit(refreshSubscriptionHandler))).Methods("POST")
 	r.HandleFunc("/api/blogs", getBlogsHandler).Methods("GET")
+	r.HandleFunc("/api/blogs/search", searchBlogsHandler).Methods("GET")
+	r.HandleFunc("/api/search", searchBlogsHandler).Methods("GET")
+	r.HandleFunc("/api/blogs/bulk-delete", requireRole(RoleEditor, bulkDeleteHandler)).Methods("POST")
 	r.HandleFunc("/api/blogs/{id}", getBlogByIDHandler).Methods("GET")
+	r.HandleFunc("/api/blogs/{id}", requireRole(RoleEditor, updateBlogHandler)).Methods("PUT")
+	r.HandleFunc("/api/blogs/{id}", requireRole(RoleEditor, deleteBlogHandler)).Methods("DELETE")
+	r.HandleFunc("/api/blogs/{id}/status", requireRole(RoleEditor, updateBlogStatusHandler)).Methods("PUT")
+	r.HandleFunc("/api/blogs/{id}/sources", blogSourcesHandler).Methods("GET")
+	r.HandleFunc("/api/blogs/{id}/revisions", listRevisionsHandler).Methods("GET")
+	r.HandleFunc("/api/blogs/{id}/revisions/{rev}", getRevisionHandler).Methods("GET")
+	r.HandleFunc("/api/blogs/{id}/rollback/{rev}", requireRole(RoleEditor, rollbackBlogHandler)).Methods("POST")
+	r.HandleFunc("/api/blogs/{id}/regenerate", requireRole(RoleEditor, rateLimit(regenerateBlogHandler))).Methods("POST")
+	r.HandleFunc("/api/blogs/{id}/regenerate-section", requireRole(RoleEditor, rateLimit(regenerateSectionHandler))).Methods("POST")
+	r.HandleFunc("/api/blogs/{id}/translate", requireRole(RoleEditor, rateLimit(translateBlogHandler))).Methods("POST")
+	r.HandleFunc("/api/blogs/{id}/publish", requireRole(RoleEditor, publishBlogHandler)).Methods("POST")
+	r.HandleFunc("/api/blogs/{id}/export", exportBlogHandler).Methods("GET")
+	r.HandleFunc("/api/blogs/{id}/markdown", markdownExportHandler).Methods("GET")
+	r.HandleFunc("/api/export/epub", epubExportHandler).Methods("POST")
+	r.HandleFunc("/api/export/site", requireRole(RoleEditor, siteExportHandler)).Methods("GET")
+	r.HandleFunc("/api/webhooks", requireRole(RoleEditor, listWebhooksHandler)).Methods("GET")
+	r.HandleFunc("/api/webhooks", requireRole(RoleEditor, createWebhookHandler)).Methods("POST")
+	r.HandleFunc("/api/webhooks/{id}", requireRole(RoleEditor, deleteWebhookHandler)).Methods("DELETE")
+	r.HandleFunc("/api/webhooks/{id}/deliveries", requireRole(RoleEditor, webhookDeliveriesHandler)).Methods("GET")
 	r.HandleFunc("/api/proxy-image", proxyImageHandler).Methods("GET")
+	r.HandleFunc("/api/images/{id}", getImageHandler).Methods("GET")
+	r.HandleFunc("/api/admin/extract-test", requireRole(RoleAdmin, extractTestHandler)).Methods("POST")
+	r.HandleFunc("/api/admin/reindex", requireRole(RoleAdmin, reindexHandler)).Methods("POST")
+	r.HandleFunc("/api/admin/generations", requireRole(RoleAdmin, listGenerationsHandler)).Methods("GET")
+	r.HandleFunc("/api/admin/keys", requireRole(RoleAdmin, listAPIKeysHandler)).Methods("GET")
+	r.HandleFunc("/api/admin/keys", requireRole(RoleAdmin, createAPIKeyHandler)).Methods("POST")
+	r.HandleFunc("/api/admin/keys/{id}", requireRole(RoleAdmin, deleteAPIKeyHandler)).Methods("DELETE")
+	r.HandleFunc("/api/admin/users", requireRole(RoleAdmin, listUsersHandler)).Methods("GET")
+	r.HandleFunc("/api/admin/users/{id}/role", requireRole(RoleAdmin, updateUserRoleHandler)).Methods("PUT")
+	r.HandleFunc("/api/feed.xml", rssFeedHandler).Methods("GET")
+	r.HandleFunc("/feed.xml", rssFeedHandler).Methods("GET")
+	r.HandleFunc("/feed.atom", atomFeedHandler).Methods("GET")
+	r.HandleFunc("/feed.json", jsonFeedHandler).Methods("GET")
+	r.HandleFunc("/api/version", versionHandler).Methods("GET")
+	r.HandleFunc("/healthz", healthzHandler).Methods("GET")
+	r.HandleFunc("/api/healthz", healthzHandler).Methods("GET")
+	r.HandleFunc("/api/readyz", readyzHandler).Methods("GET")
+	r.HandleFunc("/metrics", metricsHandler).Methods("GET")
+	r.HandleFunc("/sitemap.xml", sitemapHandler).Methods("GET")
+	r.HandleFunc("/sitemap-{page:[0-9]+}.xml", sitemapPageHandler).Methods("GET")
+
+	r.Use(authMiddleware)
+	if !authEnabled() {
+		log.Println("Warning: no API keys or user accounts exist, generation and other mutating endpoints are unauthenticated")
+	}
+
+	handler := cors.New(cors.Options{
+		AllowedMethods: []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete},
+		AllowedHeaders: []string{"Content-Type", "Authorization", "X-API-Key"},
+		ExposedHeaders: []string{"X-Total-Count"},
+	}).Handler(r)
+	server := &http.Server{
+		Addr:    fmt.Sprintf(":%d", appConfig.Port),
+		Handler: trackInFlight(handler),
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	handler := cors.Default().Handler(r)
-	log.Fatal(http.ListenAndServe(":8080", handler))
+	serverErr := make(chan error, 1)
+	go func() {
+		info := currentBuildInfo()
+		log.Printf("Starting blog-generator %s (commit %s, built %s, %s) on %s", info.Version, info.Commit, info.BuildTime, info.GoVersion, server.Addr)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		log.Fatal(err)
+	case <-ctx.Done():
+	}
+	stop()
+
+	gracePeriod := getEnvDuration("SHUTDOWN_GRACE_PERIOD", defaultShutdownGracePeriod)
+	inFlight := inFlightRequests.Load()
+	log.Printf("Shutting down, waiting up to %s for %d in-flight requests and running generation jobs", gracePeriod, inFlight)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), gracePeriod)
+	defer cancel()
+	err = server.Shutdown(shutdownCtx)
+
+	remaining := inFlightRequests.Load()
+	log.Printf("Drained %d of %d in-flight requests", inFlight-remaining, inFlight)
+	if err != nil {
+		log.Printf("Shutdown did not finish cleanly: %v", err)
+	}
+	schedules.Stop(shutdownCtx)
+	subscriptions.Stop(shutdownCtx)
+	if err := jobManager.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Failed to save unfinished generation jobs: %v", err)
+	}
+	if err := apiKeys.Save(); err != nil {
+		log.Printf("Failed to save API key usage: %v", err)
+	}
+	pythonWorker.Close()
+	pythonSidecar().Close()
 }
 
 func generateBlogHandler(w http.ResponseWriter, r *http.Request) {
@@ -99,274 +372,286 @@ func generateBlogHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Topic is required", http.StatusBadRequest)
 		return
 	}
-
-	scrapedContents, err := scrapeContentForTopic(reqBody.Topic)
-	if err != nil {
-		http.Error(w, "Failed to scrape content: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	if len(scrapedContents) == 0 {
-		http.Error(w, "No content found for this topic", http.StatusNotFound)
+	if err := reqBody.GenerationOptions.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	llamaResponse, err := GenerateBlogWithLlamaIndex(reqBody.Topic, scrapedContents)
-	if err != nil {
-		http.Error(w, "Failed to generate blog: "+err.Error(), http.StatusInternalServerError)
+	if reqBody.OutlineFirst && len(reqBody.Outline) > 0 {
+		http.Error(w, "Give either an outline or outlineFirst, not both", http.StatusBadRequest)
 		return
 	}
-
-	// Proxy image URLs through the backend to handle CORS
-	for i, block := range llamaResponse.Content {
-		if block.Type == "image" {
-			proxyURL := fmt.Sprintf("http://localhost:8080/api/proxy-image?url=%s", url.QueryEscape(block.URL))
-			llamaResponse.Content[i].URL = proxyURL
+	if reqBody.OutlineFirst {
+		if _, err := selectedCompleter(); errors.Is(err, errCompletionUnsupported) {
+			http.Error(w, err.Error(), http.StatusNotImplemented)
+			return
 		}
 	}
-	llamaResponse.FeaturedImage = fmt.Sprintf("http://localhost:8080/api/proxy-image?url=%s", url.QueryEscape(llamaResponse.FeaturedImage))
 
-	blog := BlogPost{
-		ID:            uuid.New().String(),
-		Title:         llamaResponse.Title,
-		Author:        "AI Content Generator",
-		Date:          time.Now().Format("2006-01-02"),
-		Summary:       llamaResponse.Summary,
-		Content:       llamaResponse.Content,
-		FeaturedImage: llamaResponse.FeaturedImage,
-		Tags:          llamaResponse.Tags,
-		ReadingTime:   estimateReadingTime(llamaResponse.Content),
-		Topic:         reqBody.Topic,
+	user, _ := requestUser(r)
+	submit := jobManager.Submit
+	if reqBody.OutlineFirst {
+		submit = jobManager.SubmitOutlineFirst
 	}
-
-	err = saveBlogPost(blog)
+	job, err := submit(reqBody.Topic, user.ID, reqBody.GenerationOptions)
 	if err != nil {
-		http.Error(w, "Failed to save blog: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, "Failed to queue generation: "+err.Error(), http.StatusServiceUnavailable)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(blog)
+	w.Header().Set("Location", "/api/jobs/"+job.ID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
 }
 
 func getBlogsHandler(w http.ResponseWriter, r *http.Request) {
-	blogs, err := getAllBlogs()
+	opts, err := parseListOptions(r)
+	if errors.Is(err, errUnpublishedListing) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
 	if err != nil {
-		http.Error(w, "Failed to retrieve blogs: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(blogs)
-}
-
-func getBlogByIDHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
+	blogs, err := blogStore.List(opts)
+	if err != nil {
+		http.Error(w, "Failed to retrieve blogs: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-	blog, err := getBlogByID(id)
+	total, err := blogStore.Count(opts)
 	if err != nil {
-		http.Error(w, "Blog not found: "+err.Error(), http.StatusNotFound)
+		http.Error(w, "Failed to count blogs: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	response := BlogListResponse{
+		Blogs: summarizeBlogs(blogs),
+		Total: total,
+		Page:  opts.Page,
+		Limit: opts.Limit,
+	}
+	if r.URL.Query().Get("full") == "true" {
+		response.Blogs = blogs
+	}
+	if r.URL.Query().Get("includeErrors") == "true" {
+		response.Errors, err = blogStore.Unreadable()
+		if err != nil {
+			http.Error(w, "Failed to check blogs: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(blog)
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	json.NewEncoder(w).Encode(response)
 }
 
-func proxyImageHandler(w http.ResponseWriter, r *http.Request) {
-	imageURL := r.URL.Query().Get("url")
-	if imageURL == "" {
-		http.Error(w, "Image URL is required", http.StatusBadRequest)
-		return
-	}
+func deleteBlogHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
 
-	client := &http.Client{
-		Timeout: 15 * time.Second,
+	blogStorageMu.Lock()
+	blog, err := blogStore.GetByID(id)
+	if err == nil && !canManageBlog(r, blog) {
+		err = errNotBlogOwner
 	}
-
-	req, err := http.NewRequest("GET", imageURL, nil)
-	if err != nil {
-		log.Printf("Failed to create request for %s: %v", imageURL, err)
-		http.Error(w, "Failed to create request: "+err.Error(), http.StatusInternalServerError)
-		return
+	if err == nil {
+		err = deleteBlogPost(id)
 	}
+	blogStorageMu.Unlock()
 
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36")
-
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Printf("Failed to fetch image from %s: %v", imageURL, err)
-		http.Error(w, "Failed to fetch image: "+err.Error(), http.StatusInternalServerError)
+	if errors.Is(err, errNotBlogOwner) {
+		http.Error(w, err.Error(), http.StatusForbidden)
 		return
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("Image fetch returned status %d for %s", resp.StatusCode, imageURL)
-		http.Error(w, fmt.Sprintf("Failed to fetch image: status code %d", resp.StatusCode), resp.StatusCode)
+	if errors.Is(err, errInvalidBlogID) {
+		http.Error(w, "Invalid blog ID", http.StatusBadRequest)
 		return
 	}
-
-	for k, v := range resp.Header {
-		w.Header()[k] = v
+	if errors.Is(err, errBlogNotFound) {
+		http.Error(w, "Blog not found", http.StatusNotFound)
+		return
 	}
-
-	w.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
-	w.WriteHeader(resp.StatusCode)
-	_, err = io.Copy(w, resp.Body)
 	if err != nil {
-		log.Printf("Failed to copy image response for %s: %v", imageURL, err)
+		http.Error(w, "Failed to delete blog: "+err.Error(), http.StatusInternalServerError)
+		return
 	}
-}
 
-func scrapeContentForTopic(topic string) ([]ScrapedContent, error) {
-	var contents []ScrapedContent
+	w.WriteHeader(http.StatusNoContent)
+}
 
-	c := colly.NewCollector(
-		colly.MaxDepth(2),
-		colly.UserAgent("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36"),
-	)
+func getBlogByIDHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
 
-	c.AllowedDomains = []string{
-		"en.wikipedia.org",
-		"www.bbc.com",
-		"www.cnn.com",
-		"www.reuters.com",
-		"www.theguardian.com",
-		"news.google.com",
-		"www.nytimes.com",
-		"www.forbes.com",
-		"techcrunch.com",
-		"www.wired.com",
+	blog, err := getBlogByID(id)
+	if err == nil && !canReadBlog(r, blog) {
+		err = errBlogNotFound
 	}
-
-	count := 0
-	maxCount := 50
-
-	searchQuery := strings.ReplaceAll(topic, " ", "+")
-	searchURL := fmt.Sprintf("https://news.google.com/search?q=%s", searchQuery)
-
-	c.OnHTML("article, .article, .post, .entry, main, .content", func(e *colly.HTMLElement) {
-		if count >= maxCount {
+	if err != nil {
+		http.Error(w, "Blog not found: "+err.Error(), http.StatusNotFound)
+		return
+	}
+	if lang := r.URL.Query().Get("lang"); lang != "" {
+		blog, err = blogTranslation(blog, lang)
+		if errors.Is(err, errInvalidLanguage) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-
-		content := ScrapedContent{
-			URL:   e.Request.URL.String(),
-			Title: e.ChildText("h1, h2, .title, .headline"),
-			Text:  "",
-		}
-
-		e.ForEach("p", func(_ int, el *colly.HTMLElement) {
-			paragraphText := strings.TrimSpace(el.Text)
-			if len(paragraphText) > 20 {
-				content.Text += paragraphText + "\n\n"
-			}
-		})
-
-		publishDate := e.ChildText("time, .date, .published, .timestamp")
-		if publishDate != "" {
-			content.PublishedAt = publishDate
-		}
-
-		if content.Title != "" && len(content.Text) > 100 {
-			contents = append(contents, content)
-			count++
+		if errors.Is(err, errTranslationNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
 		}
-	})
-
-	err := c.Visit(searchURL)
-	if err != nil {
-		wikiURL := fmt.Sprintf("https://en.wikipedia.org/wiki/%s", strings.ReplaceAll(topic, " ", "_"))
-		err = c.Visit(wikiURL)
 		if err != nil {
-			log.Printf("Failed to visit Wikipedia: %v", err)
+			http.Error(w, "Failed to load translation: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// A translation may still be a draft after its original was published
+		if !canReadBlog(r, blog) {
+			http.Error(w, "Blog not found", http.StatusNotFound)
+			return
 		}
 	}
 
-	c.Wait()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(blog)
+}
 
-	if len(contents) < 5 {
-		contents = append(contents, []ScrapedContent{
-			{
-				URL:         "https://example.com/article1",
-				Title:       fmt.Sprintf("Latest developments on %s", topic),
-				Text:        fmt.Sprintf("This is a simulated article about %s. It contains information about the topic that would have been scraped from actual news sources.\n\nExperts have been discussing %s extensively.\n\nFurther research on %s is ongoing.", topic, topic, topic),
-				PublishedAt: time.Now().Format("2006-01-02"),
-			},
-			{
-				URL:         "https://example.com/article2",
-				Title:       fmt.Sprintf("Historical context of %s", topic),
-				Text:        fmt.Sprintf("Here's some historical background on %s. This topic has evolved over time.\n\nMany factors have shaped %s today.\n\nCommunities have experienced %s differently.", topic, topic, topic),
-				PublishedAt: time.Now().AddDate(0, 0, -2).Format("2006-01-02"),
-			},
-		}...)
+// blogSources converts the scraped contents into the blog's references, reporting whether any
+// of them were simulated. Simulated sources are left out unless SHOW_SIMULATED_SOURCES=true.
+func blogSources(contents []ScrapedContent) ([]BlogSource, bool) {
+	showSimulated := getEnvBool("SHOW_SIMULATED_SOURCES", false)
+
+	var sources []BlogSource
+	simulated := false
+	for _, content := range contents {
+		if content.Simulated {
+			simulated = true
+			if !showSimulated {
+				continue
+			}
+		}
+		sources = append(sources, BlogSource{
+			URL:         content.URL,
+			Title:       content.Title,
+			PublishedAt: content.PublishedAt,
+		})
 	}
-
-	return contents, nil
+	return sources, simulated
 }
 
+// Reading time assumptions: words read per minute and seconds spent looking at each image
+const (
+	wordsPerMinute  = 200
+	secondsPerImage = 12
+)
+
+// estimateReadingTime returns the minutes needed to read the blog, rounded to the nearest
+// minute with a minimum of 1. Words are counted from every visible text field regardless of
+// block type; alt text is skipped since it isn't displayed.
 func estimateReadingTime(content []BlogContent) int {
-	totalWords := 0
+	totalWords, images := 0, 0
 	for _, block := range content {
-		if block.Type == "paragraph" || block.Type == "heading" {
-			totalWords += len(strings.Fields(block.Text))
+		totalWords += len(strings.Fields(block.Text)) + len(strings.Fields(block.Caption))
+		if block.URL != "" {
+			images++
 		}
 	}
-	return (totalWords / 200) + 1 // Assuming 200 words per minute
+
+	seconds := float64(totalWords)*60/wordsPerMinute + float64(images*secondsPerImage)
+	return max(int(math.Round(seconds/60)), 1)
 }
 
+// blogStorageMu serializes writes to the blog store
+var blogStorageMu sync.Mutex
+
+// saveBlogPost stores the blog and adds it to the search index
 func saveBlogPost(blog BlogPost) error {
-	dataDir := "./data/blogs"
-	err := os.MkdirAll(dataDir, 0755)
+	blogStorageMu.Lock()
+	defer blogStorageMu.Unlock()
+	return storeBlogPost(&blog)
+}
+
+// updateBlogPost applies update to the stored blog and saves the result, holding the
+// storage lock so concurrent updates can't overwrite each other. Nothing is saved if
+// update returns an error.
+func updateBlogPost(id string, update func(blog *BlogPost) error) (BlogPost, error) {
+	blogStorageMu.Lock()
+	defer blogStorageMu.Unlock()
+
+	blog, err := blogStore.GetByID(id)
 	if err != nil {
-		return err
+		return BlogPost{}, err
+	}
+	err = update(&blog)
+	if err != nil {
+		return BlogPost{}, err
 	}
+	return blog, storeBlogPost(&blog)
+}
 
-	filePath := filepath.Join(dataDir, blog.ID+".json")
-	file, err := os.Create(filePath)
+// storeBlogPost stamps the blog's modification time, records a revision if its content
+// changed, stores it and adds it to the search index. The caller must hold blogStorageMu.
+func storeBlogPost(blog *BlogPost) error {
+	blog.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	err := recordRevision(blog)
+	if err != nil {
+		return err
+	}
+	err = blogStore.Save(*blog)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 
-	encoder := json.NewEncoder(file)
-	encoder.SetIndent("", "  ")
-	return encoder.Encode(blog)
+	// Canonical URLs aren't saved unless set by a user, but are resolved for the caller
+	// as they are when blogs are read
+	blog.CanonicalURL = blogLink(*blog)
+	searchIndex.Add(*blog)
+	invalidateSitemap()
+	return nil
 }
 
-func getAllBlogs() ([]BlogPost, error) {
-	dataDir := "./data/blogs"
-	files, err := os.ReadDir(dataDir)
+// deleteBlogPost removes the blog from the store and the search index, along with cached
+// images no other blog uses. Its translations are deleted with it, and a deleted
+// translation is unlinked from its original. The caller must hold blogStorageMu.
+func deleteBlogPost(id string) error {
+	blog, err := blogStore.GetByID(id)
+	if err != nil && !errors.Is(err, errBlogNotFound) && !errors.Is(err, errInvalidBlogID) {
+		// An unreadable blog can still be deleted, it just has no images to clean up
+		log.Printf("Deleting unreadable blog %s: %v", id, err)
+	}
+
+	err = blogStore.Delete(id)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return []BlogPost{}, nil
-		}
-		return nil, err
+		return err
 	}
+	searchIndex.Remove(id)
+	invalidateSitemap()
 
-	var blogs []BlogPost
-	for _, file := range files {
-		if filepath.Ext(file.Name()) == ".json" {
-			blog, err := getBlogByID(strings.TrimSuffix(file.Name(), ".json"))
-			if err == nil {
-				blogs = append(blogs, blog)
-			}
+	removeCachedImages(blog)
+	for _, translationID := range blog.Translations {
+		if err := deleteBlogPost(translationID); err != nil && !errors.Is(err, errBlogNotFound) {
+			log.Printf("Failed to delete translation %s of blog %s: %v", translationID, id, err)
 		}
 	}
-	return blogs, nil
+	if blog.TranslationOf != "" {
+		unlinkTranslation(blog)
+	}
+	data := BlogDeletedEventData{BlogID: id}
+	if blog.ID != "" {
+		data.Blog = eventBlog(blog)
+	}
+	emitEvent(EventBlogDeleted, blog.OwnerID, data)
+	return nil
 }
 
-func getBlogByID(id string) (BlogPost, error) {
-	filePath := filepath.Join("./data/blogs", id+".json")
-	file, err := os.Open(filePath)
-	if err != nil {
-		return BlogPost{}, err
-	}
-	defer file.Close()
+// getAllBlogs returns every stored blog
+func getAllBlogs() ([]BlogPost, error) {
+	return blogStore.List(ListOptions{})
+}
 
-	var blog BlogPost
-	err = json.NewDecoder(file).Decode(&blog)
-	return blog, err
+func getBlogByID(id string) (BlogPost, error) {
+	return blogStore.GetByID(id)
 }
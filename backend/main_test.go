@@ -0,0 +1,116 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateBlock(t *testing.T) {
+	tests := []struct {
+		name    string
+		block   BlogContent
+		wantErr bool
+	}{
+		{"paragraph", BlogContent{Type: "paragraph", Text: "Go is a language."}, false},
+		{"heading", BlogContent{Type: "heading", Text: "Why Go", Level: 2}, false},
+		{"image", BlogContent{Type: "image", URL: "https://images.example.com/go.png"}, false},
+		{"unknown type", BlogContent{Type: "table", Text: "a | b"}, true},
+		{"missing type", BlogContent{Text: "Go is a language."}, true},
+		{"heading without level", BlogContent{Type: "heading", Text: "Why Go"}, true},
+		{"heading below level 1", BlogContent{Type: "heading", Text: "Why Go", Level: -1}, true},
+		{"heading above level 6", BlogContent{Type: "heading", Text: "Why Go", Level: 7}, true},
+		{"image without URL", BlogContent{Type: "image", Alt: "The Go gopher"}, true},
+		{"image with blank URL", BlogContent{Type: "image", URL: "  "}, true},
+		{"heading citing a source", BlogContent{Type: "heading", Text: "Why Go", Level: 2, Sources: []BlogSource{{URL: "https://news.example.com/go"}}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateBlock(tt.block)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateBlock(%+v) = %v, want error %v", tt.block, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateEditedBlock(t *testing.T) {
+	source := []BlogSource{{URL: "https://news.example.com/go", Title: "Go 1.23"}}
+
+	tests := []struct {
+		name    string
+		block   BlogContent
+		wantErr bool
+	}{
+		{"paragraph citing a source", BlogContent{Type: "paragraph", Text: "Go is a language.", Sources: source}, false},
+		{"invalid block", BlogContent{Type: "heading", Text: "Why Go"}, true},
+		{"heading citing a source", BlogContent{Type: "heading", Text: "Why Go", Level: 2, Sources: source}, true},
+		{"image citing a source", BlogContent{Type: "image", URL: "https://images.example.com/go.png", Sources: source}, true},
+		{"citation without URL", BlogContent{Type: "paragraph", Text: "Go is a language.", Sources: []BlogSource{{Title: "Go 1.23"}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateEditedBlock(tt.block)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateEditedBlock(%+v) = %v, want error %v", tt.block, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAttributeSourcesStripsStrayCitations(t *testing.T) {
+	sources := []BlogSource{{URL: "https://news.example.com/go", Title: "Go 1.23", PublishedAt: "2024-08-13"}}
+	content := []BlogContent{
+		{Type: "heading", Text: "Why Go", Level: 2, Sources: []BlogSource{{URL: "https://news.example.com/go"}}},
+		{Type: "paragraph", Text: "Go is a language.", Sources: []BlogSource{
+			{URL: " https://news.example.com/go/ "},
+			{URL: "https://made-up.example.com/"},
+			{Title: "No URL"},
+		}},
+	}
+
+	attributeSources(content, sources)
+	if content[0].Sources != nil {
+		t.Errorf("heading kept citations %v", content[0].Sources)
+	}
+	want := []BlogSource{{URL: "https://news.example.com/go", Title: "Go 1.23"}}
+	if !reflect.DeepEqual(content[1].Sources, want) {
+		t.Errorf("paragraph cites %v, want %v", content[1].Sources, want)
+	}
+}
+
+// words returns text of n words
+func words(n int) string {
+	return strings.TrimSpace(strings.Repeat("word ", n))
+}
+
+func TestEstimateReadingTime(t *testing.T) {
+	image := BlogContent{Type: "image", URL: "https://images.example.com/a.png"}
+
+	tests := []struct {
+		name    string
+		content []BlogContent
+		want    int
+	}{
+		{"empty post", nil, 1},
+		{"empty blocks", []BlogContent{{Type: "paragraph"}, {Type: "heading", Level: 2}}, 1},
+		{"exactly one minute of words", []BlogContent{{Type: "paragraph", Text: words(wordsPerMinute)}}, 1},
+		{"just under one and a half minutes", []BlogContent{{Type: "paragraph", Text: words(wordsPerMinute*3/2 - 1)}}, 1},
+		{"one and a half minutes rounds up", []BlogContent{{Type: "paragraph", Text: words(wordsPerMinute * 3 / 2)}}, 2},
+		{"exactly two minutes", []BlogContent{{Type: "paragraph", Text: words(wordsPerMinute)}, {Type: "heading", Level: 2, Text: words(wordsPerMinute)}}, 2},
+		{"one image", []BlogContent{image}, 1},
+		{"images only", []BlogContent{image, image, image, image, image, image, image, image}, 2},
+		{"alt text isn't read", []BlogContent{{Type: "image", URL: "https://images.example.com/a.png", Alt: words(1000)}}, 1},
+		{"captions are read", []BlogContent{{Type: "image", URL: "https://images.example.com/a.png", Caption: words(wordsPerMinute * 3)}}, 3},
+		{"list block text counts", []BlogContent{{Type: "list", Text: words(wordsPerMinute * 2)}}, 2},
+		{"quote block text counts", []BlogContent{{Type: "quote", Text: words(wordsPerMinute * 4)}}, 4},
+		{"words and images add up", []BlogContent{{Type: "paragraph", Text: words(wordsPerMinute)}, image, image, image, image, image}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := estimateReadingTime(tt.content); got != tt.want {
+				t.Errorf("estimateReadingTime = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+)
+
+// metricsHandler reports the generation workers and queue in the Prometheus text format
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	stats := jobManager.Stats()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	writeGauge(w, "blog_generator_generation_workers", "How many generations may run at once", stats.Workers)
+	writeGauge(w, "blog_generator_generations_running", "Generations currently running", stats.Running)
+	writeGauge(w, "blog_generator_generations_waiting", "Generations waiting for a free worker", stats.Waiting)
+	writeGauge(w, "blog_generator_job_queue_depth", "Generation jobs waiting in the queue", stats.QueueDepth)
+	writeGauge(w, "blog_generator_job_queue_capacity", "How many generation jobs the queue holds", stats.QueueCapacity)
+
+	statuses := []string{JobQueued, JobScraping, JobGenerating, JobDone, JobFailed, JobCancelled}
+	for status := range stats.Jobs {
+		if !slices.Contains(statuses, status) {
+			statuses = append(statuses, status)
+		}
+	}
+	slices.Sort(statuses)
+	fmt.Fprintln(w, "# HELP blog_generator_jobs Generation jobs kept in memory, by status")
+	fmt.Fprintln(w, "# TYPE blog_generator_jobs gauge")
+	for _, status := range statuses {
+		fmt.Fprintf(w, "blog_generator_jobs{status=%q} %d\n", status, stats.Jobs[status])
+	}
+}
+
+// writeGauge writes a gauge with its help text
+func writeGauge(w io.Writer, name, help string, value int) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s gauge\n", name)
+	fmt.Fprintf(w, "%s %d\n", name, value)
+}
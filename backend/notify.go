@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Message limits of the chat services. Slack sections take 3000 characters, which leaves
+// room for the title and escaping beside the summary.
+const (
+	slackMaxSummary       = 2000
+	discordMaxTitle       = 256
+	discordMaxDescription = 4096
+)
+
+// notifyClient posts to the chat services' incoming webhooks
+var notifyClient = &http.Client{Timeout: 10 * time.Second}
+
+// chatNotifier posts a message about each newly generated blog to a chat service's
+// incoming webhook, configured by an environment variable
+type chatNotifier struct {
+	name   string
+	envVar string
+	// message builds the JSON message announcing the blog
+	message func(blog EventBlog) interface{}
+}
+
+// chatNotifiers are the built-in notifiers, enabled by setting their webhook URL
+var chatNotifiers = []chatNotifier{
+	{name: "Slack", envVar: "SLACK_WEBHOOK_URL", message: slackMessage},
+	{name: "Discord", envVar: "DISCORD_WEBHOOK_URL", message: discordMessage},
+}
+
+// notifyChats announces a completed generation on the configured chat services, in the
+// background
+func notifyChats(event WebhookEvent) {
+	data, ok := event.Data.(GenerationEventData)
+	if event.Type != EventGenerationCompleted || !ok || data.Blog == nil {
+		return
+	}
+	for _, notifier := range chatNotifiers {
+		target := getEnv(notifier.envVar, "")
+		if target == "" {
+			continue
+		}
+		go func(notifier chatNotifier) {
+			if err := postChatMessage(target, notifier.message(*data.Blog)); err != nil {
+				log.Printf("Failed to notify %s about blog %s: %v", notifier.name, data.Blog.ID, err)
+			}
+		}(notifier)
+	}
+}
+
+// postChatMessage posts the message to an incoming webhook
+func postChatMessage(target string, message interface{}) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	resp, err := notifyClient.Post(target, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// announcement is the headline of a blog's notification
+func announcement(blog EventBlog) string {
+	if blog.Status != StatusPublished {
+		return "New draft blog generated"
+	}
+	return "New blog published"
+}
+
+// slackMessage announces the blog in Slack Block Kit, with the featured image beside the
+// linked title and summary
+func slackMessage(blog EventBlog) interface{} {
+	text := fmt.Sprintf("*<%s|%s>*", blog.URL, slackEscape(blog.Title))
+	if blog.Summary != "" {
+		text += "\n" + slackEscape(truncateAtWord(blog.Summary, slackMaxSummary))
+	}
+	section := map[string]interface{}{
+		"type": "section",
+		"text": map[string]string{"type": "mrkdwn", "text": text},
+	}
+	if blog.FeaturedImage != "" {
+		section["accessory"] = map[string]string{
+			"type":      "image",
+			"image_url": blog.FeaturedImage,
+			"alt_text":  blog.Title,
+		}
+	}
+	return map[string]interface{}{
+		// text is shown in notifications and clients that can't render blocks
+		"text": fmt.Sprintf("%s: %s", announcement(blog), slackEscape(blog.Title)),
+		"blocks": []interface{}{
+			map[string]interface{}{
+				"type": "context",
+				"elements": []map[string]string{
+					{"type": "mrkdwn", "text": announcement(blog)},
+				},
+			},
+			section,
+		},
+	}
+}
+
+// slackEscape escapes the characters Slack reads as markup in mrkdwn text
+func slackEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+// discordMessage announces the blog as a Discord embed linking to it, with the featured
+// image below the summary
+func discordMessage(blog EventBlog) interface{} {
+	embed := map[string]interface{}{
+		"title":       truncateAtWord(blog.Title, discordMaxTitle),
+		"description": truncateAtWord(blog.Summary, discordMaxDescription),
+		"url":         blog.URL,
+	}
+	if blog.FeaturedImage != "" {
+		embed["image"] = map[string]string{"url": blog.FeaturedImage}
+	}
+	return map[string]interface{}{
+		"content": announcement(blog),
+		"embeds":  []interface{}{embed},
+		// Titles and summaries come from scraped content, so they must not ping anyone
+		"allowed_mentions": map[string][]string{"parse": {}},
+	}
+}
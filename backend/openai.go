@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// OpenAI defaults, overridable with OPENAI_MODEL and OPENAI_BASE_URL
+const (
+	defaultOpenAIModel   = "gpt-4o"
+	defaultOpenAIBaseURL = "https://api.openai.com/v1"
+)
+
+// openAIGenerator writes blogs with the OpenAI chat completions API
+type openAIGenerator struct{}
+
+// openAIChatRequest is the body of a chat completions request
+type openAIChatRequest struct {
+	Model          string        `json:"model"`
+	Messages       []chatMessage `json:"messages"`
+	ResponseFormat struct {
+		Type string `json:"type"`
+	} `json:"response_format"`
+}
+
+// openAIChatResponse is the part of a chat completions response the generator uses
+type openAIChatResponse struct {
+	Choices []struct {
+		Message      chatMessage `json:"message"`
+		FinishReason string      `json:"finish_reason"`
+	} `json:"choices"`
+	Usage struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+func (openAIGenerator) Ready(ctx context.Context) error {
+	_, err := requireEnv("OPENAI_API_KEY")
+	return err
+}
+
+// Generate writes the blog with the OpenAI chat completions API and fills its images from Pexels
+func (g openAIGenerator) Generate(ctx context.Context, request LlamaIndexRequest) (LlamaIndexResponse, error) {
+	text, usage, err := g.Complete(ctx, blogSystemPrompt, blogUserPrompt(request))
+	if err != nil {
+		return LlamaIndexResponse{Usage: usage}, err
+	}
+	blog, err := completeBlog(ctx, request.Topic, text, len(request.Contents))
+	blog.Usage = usage
+	return blog, err
+}
+
+// Complete asks the OpenAI chat completions API for a JSON answer to the prompt
+func (openAIGenerator) Complete(ctx context.Context, system, prompt string) (string, TokenUsage, error) {
+	apiKey, err := requireEnv("OPENAI_API_KEY")
+	if err != nil {
+		return "", TokenUsage{}, err
+	}
+
+	chat := openAIChatRequest{
+		Model: getEnv("OPENAI_MODEL", defaultOpenAIModel),
+		Messages: []chatMessage{
+			{Role: "system", Content: system},
+			{Role: "user", Content: prompt},
+		},
+	}
+	chat.ResponseFormat.Type = "json_object"
+
+	endpoint := strings.TrimRight(getEnv("OPENAI_BASE_URL", defaultOpenAIBaseURL), "/") + "/chat/completions"
+	var completion openAIChatResponse
+	err = postJSON(ctx, endpoint, map[string]string{"Authorization": "Bearer " + apiKey}, chat, &completion)
+	if err != nil {
+		return "", TokenUsage{}, fmt.Errorf("OpenAI request failed: %w", err)
+	}
+	usage := TokenUsage{InputTokens: completion.Usage.PromptTokens, OutputTokens: completion.Usage.CompletionTokens}
+	if len(completion.Choices) == 0 {
+		return "", usage, fmt.Errorf("%w: OpenAI returned no choices", errInvalidLlamaResponse)
+	}
+	choice := completion.Choices[0]
+	if choice.FinishReason == "length" {
+		return "", usage, &RetryableError{Err: fmt.Errorf("%w: OpenAI stopped at the token limit", errTruncatedOutput)}
+	}
+	return choice.Message.Content, usage, nil
+}
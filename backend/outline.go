@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Limits on an outline given with a generation request or approved for a job
+const (
+	maxOutlineSections   = 12
+	maxOutlinePoints     = 10
+	maxOutlineTextLength = 300
+)
+
+// defaultOutlineApprovalTTL is how long a proposed outline waits for approval before its
+// job fails, overridable with OUTLINE_APPROVAL_TTL
+const defaultOutlineApprovalTTL = 24 * time.Hour
+
+// OutlineSection is a section of a blog's outline: its heading and the points it covers
+type OutlineSection struct {
+	Heading string   `json:"heading"`
+	Points  []string `json:"points,omitempty"`
+}
+
+// validateOutline checks the size of an outline and that each section has a heading
+func validateOutline(outline []OutlineSection) error {
+	if len(outline) > maxOutlineSections {
+		return fmt.Errorf("an outline can have at most %d sections", maxOutlineSections)
+	}
+	for i, section := range outline {
+		if strings.TrimSpace(section.Heading) == "" {
+			return fmt.Errorf("outline section %d has no heading", i)
+		}
+		if len(section.Points) > maxOutlinePoints {
+			return fmt.Errorf("outline section %d can have at most %d points", i, maxOutlinePoints)
+		}
+		for _, text := range append([]string{section.Heading}, section.Points...) {
+			if len(text) > maxOutlineTextLength {
+				return fmt.Errorf("outline section %d has a heading or point longer than %d characters", i, maxOutlineTextLength)
+			}
+		}
+	}
+	return nil
+}
+
+// outlinePrompt asks the model to follow the outline, empty if there is none
+func (o GenerationOptions) outlinePrompt() string {
+	if len(o.Outline) == 0 {
+		return ""
+	}
+	var prompt strings.Builder
+	prompt.WriteString("Follow this approved outline, using its headings as the section headings in this order and covering each of its points:\n")
+	for _, section := range o.Outline {
+		fmt.Fprintf(&prompt, "- %s\n", section.Heading)
+		for _, point := range section.Points {
+			fmt.Fprintf(&prompt, "  - %s\n", point)
+		}
+	}
+	return prompt.String()
+}
+
+// outlineSystemPrompt describes the JSON format a proposed outline must have
+const outlineSystemPrompt = `You are an editor planning a blog post before it is written.
+Use only the facts in the provided source articles.
+Propose the post's sections in order, from the introduction to the conclusion, each with a descriptive heading and 2-5 short points on what it covers.
+Respond with a JSON object with "outline", a list of sections, each with "heading" and "points" (a list of strings).`
+
+// proposeOutline asks the model for an outline of a blog about the topic written from the
+// sources with the options, returning it with the tokens the model used
+func proposeOutline(ctx context.Context, completer Completer, topic string, opts GenerationOptions, sources []ScrapedContent) ([]OutlineSection, TokenUsage, error) {
+	var prompt strings.Builder
+	fmt.Fprintf(&prompt, "Propose an outline for a blog post about %q based on these source articles.\n", topic)
+	prompt.WriteString(opts.stylePrompt())
+	if instructions := strings.TrimSpace(opts.Instructions); instructions != "" {
+		fmt.Fprintf(&prompt, "Follow these instructions on the post's structure and emphasis:\n%s\n", instructions)
+	}
+	writePromptSources(&prompt, sources)
+
+	ctx, cancel := context.WithTimeout(ctx, getEnvDuration("GENERATION_TIMEOUT", defaultGenerationTimeout))
+	defer cancel()
+	text, usage, err := completer.Complete(ctx, outlineSystemPrompt, prompt.String())
+	if err != nil {
+		return nil, usage, fmt.Errorf("failed to propose outline: %w", err)
+	}
+
+	var response struct {
+		Outline []OutlineSection `json:"outline"`
+	}
+	if err := decodeModelJSON(text, &response); err != nil {
+		return nil, usage, fmt.Errorf("%w: outline is not valid JSON: %v", errInvalidLlamaResponse, err)
+	}
+	if len(response.Outline) == 0 {
+		return nil, usage, fmt.Errorf("%w: the outline has no sections", errInvalidLlamaResponse)
+	}
+	if err := validateOutline(response.Outline); err != nil {
+		return nil, usage, fmt.Errorf("%w: %v", errInvalidLlamaResponse, err)
+	}
+	return response.Outline, usage, nil
+}
+
+// approveOutlineHandler approves the outline proposed for an outline-first job, queueing
+// the generation of the full blog. An edited {"outline": [...]} replaces the proposal.
+func approveOutlineHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	var reqBody struct {
+		Outline []OutlineSection `json:"outline"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	if err := validateOutline(reqBody.Outline); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	job, ok := jobManager.Get(id)
+	var err error
+	if !ok {
+		err = errJobNotFound
+	} else if !canManageOwnedBy(r, job.OwnerID) {
+		err = errNotJobOwner
+	} else {
+		job, err = jobManager.ApproveOutline(id, reqBody.Outline)
+	}
+
+	switch {
+	case errors.Is(err, errJobNotFound):
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	case errors.Is(err, errNotJobOwner):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case errors.Is(err, errNotAwaitingApproval):
+		http.Error(w, fmt.Sprintf("The job has no outline awaiting approval, its status is %s", job.Status), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, "Failed to queue generation: "+err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
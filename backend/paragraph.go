@@ -0,0 +1,106 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxBoilerplateLength is the longest paragraph dropped for containing a boilerplate phrase;
+// longer paragraphs are probably real content that happens to mention one
+const maxBoilerplateLength = 200
+
+// defaultBoilerplatePhrases mark cookie notices, newsletter prompts, share buttons and legal
+// footers. More can be added with the comma-separated SCRAPE_BOILERPLATE_PHRASES.
+var defaultBoilerplatePhrases = []string{
+	"accept cookies",
+	"we use cookies",
+	"cookie policy",
+	"cookie settings",
+	"sign up for our newsletter",
+	"subscribe to our newsletter",
+	"sign up to receive",
+	"get our newsletter",
+	"share this article",
+	"share on facebook",
+	"share on twitter",
+	"follow us on",
+	"click here to",
+	"all rights reserved",
+	"terms of service",
+	"terms of use",
+	"privacy policy",
+	"skip to content",
+	"skip to main content",
+	"this article is more than",
+	"log in to continue",
+	"subscribe to continue reading",
+}
+
+// boilerplatePrefixes are labels stripped from the start of otherwise useful paragraphs
+var boilerplatePrefixes = []string{
+	"advertisement",
+	"read more:",
+	"related:",
+	"story continues below",
+}
+
+// navigationSeparators appear between links in breadcrumbs and menus
+var navigationSeparators = []string{"|", "›", "»", "•", " / "}
+
+// boilerplatePhrases returns the default phrases plus any configured ones, lowercased
+func boilerplatePhrases() []string {
+	return append(append([]string{}, defaultBoilerplatePhrases...), splitList(getEnv("SCRAPE_BOILERPLATE_PHRASES", ""))...)
+}
+
+// cleanParagraph collapses whitespace in a scraped paragraph and strips boilerplate labels,
+// returning false when the paragraph is boilerplate, navigation or a legal notice to skip
+func cleanParagraph(text string) (string, bool) {
+	text = strings.Join(strings.Fields(text), " ")
+
+	for stripped := true; stripped; {
+		stripped = false
+		for _, prefix := range boilerplatePrefixes {
+			if hasLabelPrefix(text, prefix) {
+				text = strings.TrimSpace(text[len(prefix):])
+				stripped = true
+				break
+			}
+		}
+	}
+	if text == "" {
+		return "", false
+	}
+
+	lower := strings.ToLower(text)
+	if strings.HasPrefix(lower, "©") || strings.HasPrefix(lower, "copyright") {
+		return "", false
+	}
+
+	if len(text) <= maxBoilerplateLength {
+		for _, phrase := range boilerplatePhrases() {
+			if strings.Contains(lower, phrase) {
+				return "", false
+			}
+		}
+	}
+
+	separators := 0
+	for _, separator := range navigationSeparators {
+		separators += strings.Count(text, separator)
+	}
+	if separators >= 3 && separators*15 > len(strings.Fields(text)) {
+		return "", false
+	}
+
+	return text, true
+}
+
+// hasLabelPrefix reports whether text starts with prefix, ignoring case, as a whole word
+func hasLabelPrefix(text, prefix string) bool {
+	if len(text) < len(prefix) || !strings.EqualFold(text[:len(prefix)], prefix) {
+		return false
+	}
+	next, _ := utf8.DecodeRuneInString(text[len(prefix):])
+	return !unicode.IsLetter(next)
+}
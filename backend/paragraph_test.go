@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCleanParagraph(t *testing.T) {
+	article := "Solar panels now supply a fifth of the country's electricity, according to the grid operator."
+
+	tests := []struct {
+		name   string
+		before string
+		after  string
+		keep   bool
+	}{
+		{"plain paragraph", article, article, true},
+		{"collapses whitespace", "  Solar panels\n\n now   supply\ta fifth. ", "Solar panels now supply a fifth.", true},
+		{"strips advertisement label", "Advertisement " + article, article, true},
+		{"strips read more label", "Read more: " + article, article, true},
+		{"strips stacked labels", "ADVERTISEMENT Related: " + article, article, true},
+		{"keeps words that start like a label", "Advertisements for solar panels are everywhere this summer.", "Advertisements for solar panels are everywhere this summer.", true},
+		{"label only", "  Advertisement  ", "", false},
+		{"empty", " \n ", "", false},
+		{"cookie notice", "We use cookies to improve your experience. Accept cookies to continue.", "", false},
+		{"newsletter prompt", "Sign up for our newsletter to get the latest news.", "", false},
+		{"copyright line", "© 2024 Example News Ltd.", "", false},
+		{"copyright word", "Copyright 2024 Example News. All rights reserved.", "", false},
+		{"breadcrumb", "Home | News | World | Europe", "", false},
+		{"long paragraph mentioning a phrase", article + " " + strings.Repeat("The operator's privacy policy was not part of the report. ", 3), article + " " + strings.TrimSpace(strings.Repeat("The operator's privacy policy was not part of the report. ", 3)), true},
+		{"single separator", "Prices fell | analysts expect a further drop next year as more panels are installed.", "Prices fell | analysts expect a further drop next year as more panels are installed.", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			after, keep := cleanParagraph(tt.before)
+			if keep != tt.keep {
+				t.Fatalf("cleanParagraph(%q) kept = %v, want %v", tt.before, keep, tt.keep)
+			}
+			if keep && after != tt.after {
+				t.Errorf("cleanParagraph(%q) = %q, want %q", tt.before, after, tt.after)
+			}
+		})
+	}
+}
+
+func TestCleanParagraphConfiguredPhrases(t *testing.T) {
+	t.Setenv("SCRAPE_BOILERPLATE_PHRASES", "Download Our App, ")
+	if _, keep := cleanParagraph("Download our app for breaking news alerts."); keep {
+		t.Error("a paragraph with a configured phrase was kept")
+	}
+}
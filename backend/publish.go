@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// publishTimeout bounds a whole publish request, including image uploads
+const publishTimeout = 2 * time.Minute
+
+// publishClient is used for requests to the publishing targets
+var publishClient = &http.Client{Timeout: 30 * time.Second}
+
+// errPublisherNotConfigured is returned when a publishing target's settings are missing
+var errPublisherNotConfigured = errors.New("publishing target is not configured")
+
+// errRemotePostNotFound is returned by publishers when the post they are updating was
+// deleted on the target
+var errRemotePostNotFound = errors.New("remote post not found")
+
+// errInvalidPublishOptions is returned by publishers for options the target doesn't support
+var errInvalidPublishOptions = errors.New("invalid publish options")
+
+// Publication records where a blog was published on a target, so publishing it again
+// updates the remote post instead of creating another
+type Publication struct {
+	RemoteID    string `json:"remoteId"`
+	URL         string `json:"url,omitempty"`
+	Status      string `json:"status"`
+	PublishedAt string `json:"publishedAt"`
+	// Assets maps the blog's images to the copies uploaded to the target, so they are
+	// only uploaded once
+	Assets map[string]RemoteAsset `json:"assets,omitempty"`
+}
+
+// RemoteAsset is an image uploaded to a publishing target
+type RemoteAsset struct {
+	ID  string `json:"id,omitempty"`
+	URL string `json:"url"`
+}
+
+// PublishOptions are the per-request settings of a publish
+type PublishOptions struct {
+	// Status is StatusDraft or StatusPublished
+	Status string
+}
+
+// Publisher pushes blogs to an external site
+type Publisher interface {
+	// Publish creates the blog's remote post, or updates it when previous is set,
+	// returning where it was published
+	Publish(ctx context.Context, blog BlogPost, previous *Publication, opts PublishOptions) (Publication, error)
+}
+
+// publisherFactories create the publishing targets POST /api/blogs/{id}/publish?target=
+// accepts from their configuration, returning errPublisherNotConfigured when it is missing
+var publisherFactories = map[string]func() (Publisher, error){
+	"wordpress": newWordPressPublisher,
+	"ghost":     newGhostPublisher,
+	"devto":     newDevToPublisher,
+	"hashnode":  newHashnodePublisher,
+}
+
+// publishTargets returns the names of the publishing targets, sorted
+func publishTargets() []string {
+	targets := make([]string, 0, len(publisherFactories))
+	for target := range publisherFactories {
+		targets = append(targets, target)
+	}
+	slices.Sort(targets)
+	return targets
+}
+
+// blogContentHTML renders the blog's content blocks and sources as an HTML fragment for
+// publishing, with image URLs mapped by imageURL
+func blogContentHTML(blog BlogPost, imageURL func(string) string) (string, error) {
+	blocks := make([]exportBlock, 0, len(blog.Content))
+	for _, block := range blog.Content {
+		exported := exportBlock{BlogContent: block, Citations: blockCitations(block, blog.Sources)}
+		if block.Type == "image" {
+			exported.Src = imageURL(block.URL)
+		}
+		blocks = append(blocks, exported)
+	}
+
+	var b strings.Builder
+	err := exportBlocksTemplate.Execute(&b, blocks)
+	if err != nil {
+		return "", err
+	}
+	err = exportBlocksTemplate.ExecuteTemplate(&b, "sources", blog.Sources)
+	return strings.TrimSpace(b.String()), err
+}
+
+// blogContentMarkdown renders the blog's content blocks and sources as Markdown for
+// targets that take Markdown, with the images linked where the target can fetch them
+func blogContentMarkdown(blog BlogPost) string {
+	blog.Content = slices.Clone(blog.Content)
+	mapBlogImages(&blog, remoteImageURL)
+
+	var b strings.Builder
+	b.WriteString(strings.TrimSpace(renderMarkdownBody(blog)))
+	if len(blog.Sources) > 0 {
+		b.WriteString("\n\n## Sources\n\n")
+		for i, source := range blog.Sources {
+			title := source.Title
+			if title == "" {
+				title = source.URL
+			}
+			fmt.Fprintf(&b, "%d. [%s](%s)\n", i+1, title, source.URL)
+		}
+	}
+	return b.String()
+}
+
+// assetKey identifies an image across reads of a blog, whose image URLs are re-signed and
+// resolved against the current base URL each time
+func assetKey(raw string) string {
+	return relativeImageURL(raw)
+}
+
+// remoteImageURL returns the URL an image can be fetched from by a publishing target that
+// doesn't host images: stored images are served by the backend, and proxied ones are
+// linked at their source since the proxy's signed URLs expire
+func remoteImageURL(raw string) string {
+	return upstreamImageURL(raw)
+}
+
+// publishRequest sends a JSON request to a publishing target and decodes a successful
+// JSON response into out, if set. The body may be nil or an io.Reader sent as is.
+func publishRequest(ctx context.Context, method, endpoint string, headers map[string]string, body, out interface{}) error {
+	var reader io.Reader
+	contentType := ""
+	switch body := body.(type) {
+	case nil:
+	case io.Reader:
+		reader = body
+	default:
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %v", err)
+		}
+		reader, contentType = bytes.NewReader(payload), "application/json"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := publishClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, stderrTailSize))
+		return &publishError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(detail))}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %v", err)
+	}
+	return nil
+}
+
+// publishError is a publishing target's response with an unsuccessful status code
+type publishError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *publishError) Error() string {
+	return fmt.Sprintf("status code %d: %s", e.StatusCode, e.Body)
+}
+
+// publishBlogHandler pushes a blog to the target given by ?target=, as a draft or
+// published post depending on ?status= or the blog's own status, and records the remote
+// post on the blog
+func publishBlogHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	query := r.URL.Query()
+
+	target := query.Get("target")
+	factory, ok := publisherFactories[target]
+	if !ok {
+		http.Error(w, "target must be one of "+strings.Join(publishTargets(), ", "), http.StatusBadRequest)
+		return
+	}
+	status := query.Get("status")
+	if status != "" && status != StatusDraft && status != StatusPublished {
+		http.Error(w, "status must be draft or published", http.StatusBadRequest)
+		return
+	}
+
+	blog, err := getBlogByID(id)
+	if errors.Is(err, errInvalidBlogID) {
+		http.Error(w, "Invalid blog ID", http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, errBlogNotFound) {
+		http.Error(w, "Blog not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to load blog: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !canManageBlog(r, blog) {
+		http.Error(w, errNotBlogOwner.Error(), http.StatusForbidden)
+		return
+	}
+	if status == "" {
+		status = StatusPublished
+		if blogStatus(blog) != StatusPublished {
+			status = StatusDraft
+		}
+	}
+
+	publisher, err := factory()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var previous *Publication
+	if publication, ok := blog.Publications[target]; ok {
+		previous = &publication
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), publishTimeout)
+	defer cancel()
+	publication, err := publisher.Publish(ctx, blog, previous, PublishOptions{Status: status})
+	if errors.Is(err, errInvalidPublishOptions) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to publish to %s: %v", target, err), http.StatusBadGateway)
+		return
+	}
+	publication.Status = status
+	publication.PublishedAt = time.Now().UTC().Format(time.RFC3339)
+
+	_, err = updateBlogPost(id, func(blog *BlogPost) error {
+		if blog.Publications == nil {
+			blog.Publications = make(map[string]Publication)
+		}
+		blog.Publications[target] = publication
+		return nil
+	})
+	if err != nil {
+		http.Error(w, "Published, but failed to record the publication: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(publication)
+}
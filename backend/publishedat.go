@@ -0,0 +1,111 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// publishedAtLayouts are the absolute date formats commonly found on news sites
+var publishedAtLayouts = []string{
+	time.RFC3339,
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC822Z,
+	time.RFC822,
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"January 2, 2006 3:04 PM",
+	"January 2, 2006",
+	"Jan 2, 2006 3:04 PM",
+	"Jan 2, 2006",
+	"Jan. 2, 2006",
+	"2 January 2006",
+	"2 Jan 2006",
+	"Monday, January 2, 2006",
+	"Mon, January 2, 2006",
+	"01/02/2006",
+	"2006/01/02",
+}
+
+// relativeDatePattern matches phrases like "5 minutes ago" or "an hour ago"
+var relativeDatePattern = regexp.MustCompile(`^(\d+|an?|one)\s+(second|sec|minute|min|hour|hr|day|week|month|year)s?\s+ago$`)
+
+// parsePublishedAt parses a scraped publish date, accepting common absolute layouts and
+// relative phrases such as "2 hours ago". It reports false when the date can't be parsed
+// so callers don't fabricate one.
+func parsePublishedAt(raw string) (time.Time, bool) {
+	return parsePublishedAtFrom(raw, time.Now())
+}
+
+// parsePublishedAtFrom is parsePublishedAt with relative dates resolved against now
+func parsePublishedAtFrom(raw string, now time.Time) (time.Time, bool) {
+	text := strings.Join(strings.Fields(raw), " ")
+	text = strings.TrimPrefix(text, "Published ")
+	text = strings.TrimPrefix(text, "Updated ")
+	if text == "" {
+		return time.Time{}, false
+	}
+
+	for _, layout := range publishedAtLayouts {
+		if t, err := time.Parse(layout, text); err == nil {
+			return t, true
+		}
+	}
+
+	lower := strings.ToLower(text)
+	switch lower {
+	case "just now", "now":
+		return now, true
+	case "today":
+		return startOfDay(now), true
+	case "yesterday":
+		return startOfDay(now.AddDate(0, 0, -1)), true
+	}
+
+	match := relativeDatePattern.FindStringSubmatch(lower)
+	if match == nil {
+		return time.Time{}, false
+	}
+
+	amount := 1
+	if n, err := strconv.Atoi(match[1]); err == nil {
+		amount = n
+	}
+
+	switch match[2] {
+	case "second", "sec":
+		return now.Add(-time.Duration(amount) * time.Second), true
+	case "minute", "min":
+		return now.Add(-time.Duration(amount) * time.Minute), true
+	case "hour", "hr":
+		return now.Add(-time.Duration(amount) * time.Hour), true
+	case "day":
+		return now.AddDate(0, 0, -amount), true
+	case "week":
+		return now.AddDate(0, 0, -7*amount), true
+	case "month":
+		return now.AddDate(0, -amount, 0), true
+	default:
+		return now.AddDate(-amount, 0, 0), true
+	}
+}
+
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+// normalizePublishedAt returns the scraped date as RFC3339, or an empty string if it can't be parsed
+func normalizePublishedAt(raw string) string {
+	t, ok := parsePublishedAt(raw)
+	if !ok {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParsePublishedAtFrom(t *testing.T) {
+	now := time.Date(2024, time.March, 15, 14, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		raw    string
+		want   time.Time
+		wantOK bool
+	}{
+		{"RFC 3339", "2024-03-10T08:15:00Z", time.Date(2024, time.March, 10, 8, 15, 0, 0, time.UTC), true},
+		{"RFC 3339 with offset", "2024-03-10T08:15:00+02:00", time.Date(2024, time.March, 10, 6, 15, 0, 0, time.UTC), true},
+		{"RFC 1123", "Sun, 10 Mar 2024 08:15:00 GMT", time.Date(2024, time.March, 10, 8, 15, 0, 0, time.UTC), true},
+		{"RFC 1123 with numeric zone", "Sun, 10 Mar 2024 08:15:00 +0000", time.Date(2024, time.March, 10, 8, 15, 0, 0, time.UTC), true},
+		{"date only", "2024-03-10", time.Date(2024, time.March, 10, 0, 0, 0, 0, time.UTC), true},
+		{"long month", "March 10, 2024", time.Date(2024, time.March, 10, 0, 0, 0, 0, time.UTC), true},
+		{"day first", "10 March 2024", time.Date(2024, time.March, 10, 0, 0, 0, 0, time.UTC), true},
+		{"published prefix and extra spaces", "  Published   Mar 10,  2024 ", time.Date(2024, time.March, 10, 0, 0, 0, 0, time.UTC), true},
+		{"hours ago", "3 hours ago", now.Add(-3 * time.Hour), true},
+		{"an hour ago", "an hour ago", now.Add(-time.Hour), true},
+		{"minutes ago abbreviated", "5 mins ago", now.Add(-5 * time.Minute), true},
+		{"days ago", "2 days ago", time.Date(2024, time.March, 13, 14, 30, 0, 0, time.UTC), true},
+		{"a week ago", "a week ago", time.Date(2024, time.March, 8, 14, 30, 0, 0, time.UTC), true},
+		{"months ago", "2 months ago", time.Date(2024, time.January, 15, 14, 30, 0, 0, time.UTC), true},
+		{"yesterday", "Yesterday", time.Date(2024, time.March, 14, 0, 0, 0, 0, time.UTC), true},
+		{"today", "today", time.Date(2024, time.March, 15, 0, 0, 0, 0, time.UTC), true},
+		{"just now", "just now", now, true},
+		{"empty", "", time.Time{}, false},
+		{"only spaces", "   ", time.Time{}, false},
+		{"unparseable", "sometime last spring", time.Time{}, false},
+		{"relative without ago", "3 hours", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parsePublishedAtFrom(tt.raw, now)
+			if ok != tt.wantOK {
+				t.Fatalf("parsePublishedAtFrom(%q) ok = %v, want %v", tt.raw, ok, tt.wantOK)
+			}
+			if ok && !got.Equal(tt.want) {
+				t.Errorf("parsePublishedAtFrom(%q) = %v, want %v", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizePublishedAt(t *testing.T) {
+	if got := normalizePublishedAt("Sun, 10 Mar 2024 08:15:00 +0000"); got != "2024-03-10T08:15:00Z" {
+		t.Errorf("normalizePublishedAt = %q, want RFC 3339", got)
+	}
+	if got := normalizePublishedAt("not a date"); got != "" {
+		t.Errorf("normalizePublishedAt of an unparseable date = %q, want empty", got)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// rateLimiterIdleTTL is how long a client's bucket is kept after its last request
+const rateLimiterIdleTTL = 10 * time.Minute
+
+// clientLimiter tracks a client's token bucket and when it was last used
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// RateLimiter hands out a token bucket per client key
+type RateLimiter struct {
+	mu        sync.Mutex
+	limit     rate.Limit
+	burst     int
+	clients   map[string]*clientLimiter
+	lastSwept time.Time
+}
+
+// NewRateLimiter creates a limiter allowing perMinute requests per client with the given burst
+func NewRateLimiter(perMinute, burst int) *RateLimiter {
+	return &RateLimiter{
+		limit:   rate.Limit(float64(perMinute) / 60),
+		burst:   burst,
+		clients: make(map[string]*clientLimiter),
+	}
+}
+
+// Reserve takes n tokens for the client, returning how long to wait if they aren't
+// available. A wait of 0 with false means n is more than the burst, so the tokens will never
+// be available at once.
+func (l *RateLimiter) Reserve(key string, n int) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.sweep(now)
+
+	client, ok := l.clients[key]
+	if !ok {
+		client = &clientLimiter{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.clients[key] = client
+	}
+	client.lastSeen = now
+
+	reservation := client.limiter.ReserveN(now, n)
+	if !reservation.OK() {
+		return 0, false
+	}
+	delay := reservation.DelayFrom(now)
+	if delay > 0 {
+		reservation.CancelAt(now)
+		return delay, false
+	}
+	return 0, true
+}
+
+// sweep drops clients that haven't been seen recently. The caller must hold l.mu.
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSwept) < time.Minute {
+		return
+	}
+	l.lastSwept = now
+	for key, client := range l.clients {
+		if now.Sub(client.lastSeen) > rateLimiterIdleTTL {
+			delete(l.clients, key)
+		}
+	}
+}
+
+// clientIP returns the client's address, taken from X-Forwarded-For when the server sits
+// behind TRUSTED_PROXY_HOPS proxies and from the connection otherwise
+func clientIP(r *http.Request) string {
+	if hops := getEnvInt("TRUSTED_PROXY_HOPS", 0); hops > 0 {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			parts := strings.Split(forwarded, ",")
+			// Each trusted proxy appends the address it received the request from,
+			// so the client is the entry added by the outermost trusted proxy
+			index := max(len(parts)-hops, 0)
+			if ip := strings.TrimSpace(parts[index]); ip != "" {
+				return ip
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ClientLimiters hand out tokens per API key, or per client IP for requests made without a
+// key. Without a key limiter every request is limited per IP.
+type ClientLimiters struct {
+	IP  *RateLimiter
+	Key *RateLimiter
+}
+
+// generationLimiters are shared by every endpoint starting a generation, so that a client
+// has one budget across them, and authLimiters by login and registration. main sizes them
+// from the loaded configuration.
+var (
+	generationLimiters = newGenerationLimiters(defaultRateLimitConfig())
+	authLimiters       = newAuthLimiters(defaultAuthRateLimitConfig())
+)
+
+// newGenerationLimiters creates the generation limiters sized by the config
+func newGenerationLimiters(config RateLimitConfig) *ClientLimiters {
+	return &ClientLimiters{
+		IP:  NewRateLimiter(config.PerMinute, config.Burst),
+		Key: NewRateLimiter(config.KeyPerMinute, config.KeyBurst),
+	}
+}
+
+// newAuthLimiters creates the login and registration limiters sized by the config
+func newAuthLimiters(config AuthRateLimitConfig) *ClientLimiters {
+	return &ClientLimiters{IP: NewRateLimiter(config.PerMinute, config.Burst)}
+}
+
+// Allow takes n tokens for the request's client, responding 429 and returning false if
+// they aren't available, with a Retry-After header when waiting would help
+func (l *ClientLimiters) Allow(w http.ResponseWriter, r *http.Request, n int) bool {
+	var wait time.Duration
+	var ok bool
+	if key := requestPrincipal(r).APIKey; key != nil && l.Key != nil {
+		wait, ok = l.Key.Reserve(key.ID, n)
+	} else {
+		wait, ok = l.IP.Reserve(clientIP(r), n)
+	}
+	if ok {
+		return true
+	}
+	if wait == 0 {
+		writeJSONError(w, http.StatusTooManyRequests, fmt.Sprintf("rate limit exceeded: %d requests at once are more than the limit allows", n))
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	writeJSONError(w, http.StatusTooManyRequests, "rate limit exceeded")
+	return false
+}
+
+// rateLimit wraps a generation handler with generationLimiters, charging one token per
+// request and responding 429 with a Retry-After header once the budget is spent
+func rateLimit(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if generationLimiters.Allow(w, r, 1) {
+			next(w, r)
+		}
+	}
+}
+
+// authRateLimit wraps a login or registration handler with authLimiters
+func authRateLimit(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if authLimiters.Allow(w, r, 1) {
+			next(w, r)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useRateLimits replaces the generation and auth limiters with fresh ones for the test
+func useRateLimits(t *testing.T, generation RateLimitConfig, auth AuthRateLimitConfig) {
+	t.Helper()
+	previousGeneration, previousAuth := generationLimiters, authLimiters
+	t.Cleanup(func() { generationLimiters, authLimiters = previousGeneration, previousAuth })
+	generationLimiters, authLimiters = newGenerationLimiters(generation), newAuthLimiters(auth)
+}
+
+// limitedStatus serves a request from the address through the handler, returning the
+// response
+func limitedStatus(handler http.HandlerFunc, target, remoteAddr, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	req.RemoteAddr = remoteAddr
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+func TestRateLimitSharedAcrossGenerationRoutes(t *testing.T) {
+	useRateLimits(t, RateLimitConfig{PerMinute: 1, Burst: 2, KeyPerMinute: 1, KeyBurst: 2}, defaultAuthRateLimitConfig())
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	generate, regenerate, translate := rateLimit(ok), rateLimit(ok), rateLimit(ok)
+
+	for i, handler := range []http.HandlerFunc{generate, regenerate} {
+		if rec := limitedStatus(handler, "/", "192.0.2.1:1234", ""); rec.Code != http.StatusOK {
+			t.Fatalf("request %d: status %d, want %d", i, rec.Code, http.StatusOK)
+		}
+	}
+	rec := limitedStatus(translate, "/", "192.0.2.1:1234", "")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("third route: status %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	if retry, err := strconv.Atoi(rec.Header().Get("Retry-After")); err != nil || retry < 1 || retry > 60 {
+		t.Errorf("Retry-After = %q, want 1-60 seconds", rec.Header().Get("Retry-After"))
+	}
+
+	// Another client has its own budget, and login its own limiter
+	if rec := limitedStatus(generate, "/", "192.0.2.2:1234", ""); rec.Code != http.StatusOK {
+		t.Errorf("other client: status %d, want %d", rec.Code, http.StatusOK)
+	}
+	if rec := limitedStatus(authRateLimit(ok), "/", "192.0.2.1:1234", ""); rec.Code != http.StatusOK {
+		t.Errorf("login after the generation budget is spent: status %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestRateLimitAuth(t *testing.T) {
+	useRateLimits(t, defaultRateLimitConfig(), AuthRateLimitConfig{PerMinute: 1, Burst: 1})
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+
+	if rec := limitedStatus(authRateLimit(ok), "/", "192.0.2.1:1234", ""); rec.Code != http.StatusOK {
+		t.Fatalf("first login: status %d", rec.Code)
+	}
+	rec := limitedStatus(authRateLimit(ok), "/", "192.0.2.1:1234", "")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("second login: status %d, Retry-After %q, want 429 with Retry-After", rec.Code, rec.Header().Get("Retry-After"))
+	}
+}
+
+func TestRateLimitChargesBatchesPerTopic(t *testing.T) {
+	useAuthStores(t)
+	useRateLimits(t, RateLimitConfig{PerMinute: 1, Burst: 3, KeyPerMinute: 1, KeyBurst: 3}, defaultAuthRateLimitConfig())
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		retryAfter bool
+	}{
+		// More topics than the burst can never be served at once
+		{"over the burst", `{"topics": ["a", "b", "c", "d"]}`, http.StatusTooManyRequests, false},
+		// Two topics leave one token, too few for the next two
+		{"within the burst", `{"topics": ["a", "b"]}`, http.StatusAccepted, false},
+		{"budget spent", `{"topics": ["c", "d"]}`, http.StatusTooManyRequests, true},
+	}
+	previousBatches := batches
+	t.Cleanup(func() { batches = previousBatches })
+	batches = &BatchStore{batches: make(map[string]*Batch)}
+	for _, tt := range tests {
+		rec := limitedStatus(generateBlogsHandler, "/api/generate-blogs", "192.0.2.1:1234", tt.body)
+		if tt.wantStatus == http.StatusAccepted {
+			// The queue isn't running, so the accepted batch's topics may all fail to queue
+			if rec.Code == http.StatusTooManyRequests {
+				t.Errorf("%s: status %d, want it to pass the rate limit", tt.name, rec.Code)
+			}
+			continue
+		}
+		if rec.Code != tt.wantStatus || (rec.Header().Get("Retry-After") != "") != tt.retryAfter {
+			t.Errorf("%s: status %d, Retry-After %q, want %d with Retry-After %v", tt.name, rec.Code, rec.Header().Get("Retry-After"), tt.wantStatus, tt.retryAfter)
+		}
+	}
+}
+
+func TestRateLimiterReserve(t *testing.T) {
+	limiter := NewRateLimiter(60, 2)
+	for i := 0; i < 2; i++ {
+		if _, ok := limiter.Reserve("192.0.2.1", 1); !ok {
+			t.Fatalf("request %d within the burst was limited", i)
+		}
+	}
+	wait, ok := limiter.Reserve("192.0.2.1", 1)
+	if ok || wait <= 0 || wait > time.Second {
+		t.Errorf("request over the burst: wait %v, ok %v, want a wait of up to a second", wait, ok)
+	}
+	if _, ok := limiter.Reserve("192.0.2.2", 1); !ok {
+		t.Error("another client was limited")
+	}
+	if wait, ok := limiter.Reserve("192.0.2.3", 3); ok || wait != 0 {
+		t.Errorf("more tokens than the burst: wait %v, ok %v, want no wait and false", wait, ok)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name      string
+		hops      string
+		forwarded string
+		want      string
+	}{
+		{"connection", "", "", "192.0.2.1"},
+		{"untrusted forwarded header", "", "198.51.100.7", "192.0.2.1"},
+		{"one trusted proxy", "1", "203.0.113.9, 198.51.100.7", "198.51.100.7"},
+		{"two trusted proxies", "2", "203.0.113.9, 198.51.100.7", "203.0.113.9"},
+		{"more hops than entries", "5", "198.51.100.7", "198.51.100.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TRUSTED_PROXY_HOPS", tt.hops)
+			req := httptest.NewRequest(http.MethodPost, "/api/generate-blog", nil)
+			req.RemoteAddr = "192.0.2.1:4321"
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if got := clientIP(req); got != tt.want {
+				t.Errorf("clientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
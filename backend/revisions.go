@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// defaultMaxRevisions is how many revisions are kept per blog, overridable with
+// MAX_REVISIONS
+const defaultMaxRevisions = 50
+
+// errRevisionNotFound is returned by stores when the blog has no revision with the
+// requested number
+var errRevisionNotFound = errors.New("revision not found")
+
+// BlogRevision is a version of a blog's content, numbered from 1 in the order the versions
+// were stored
+type BlogRevision struct {
+	Number int `json:"revision"`
+	// CreatedAt is when the version was stored (RFC 3339)
+	CreatedAt string   `json:"createdAt"`
+	Blog      BlogPost `json:"blog"`
+}
+
+// RevisionSummary describes a revision without its content
+type RevisionSummary struct {
+	Number      int    `json:"revision"`
+	CreatedAt   string `json:"createdAt"`
+	Title       string `json:"title"`
+	ReadingTime int    `json:"readingTime"`
+}
+
+// withBookkeeping returns blog with the fields that aren't part of its content taken from
+// current: its identity and slug, workflow status, publications, revision number and
+// translations.
+// Restoring a revision brings back what the blog said, not where it stood in the workflow.
+func withBookkeeping(blog, current BlogPost) BlogPost {
+	blog.ID = current.ID
+	blog.Slug = current.Slug
+	blog.Date = current.Date
+	blog.UpdatedAt = current.UpdatedAt
+	blog.OwnerID = current.OwnerID
+	blog.CanonicalURL = current.CanonicalURL
+	blog.Status = current.Status
+	blog.SubmittedAt = current.SubmittedAt
+	blog.PublishedAt = current.PublishedAt
+	blog.StatusChanges = current.StatusChanges
+	blog.Publications = current.Publications
+	blog.Revision = current.Revision
+	blog.TranslationOf = current.TranslationOf
+	blog.Translations = current.Translations
+	return blog
+}
+
+// recordRevision numbers the blog's content, storing it as a new revision when it differs
+// from the stored version's. Blogs stored before revisions existed have their stored
+// version kept as revision 1 first. The caller must hold blogStorageMu.
+func recordRevision(blog *BlogPost) error {
+	previous, err := blogStore.GetByID(blog.ID)
+	if errors.Is(err, errBlogNotFound) {
+		previous, err = BlogPost{}, nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load the stored blog: %w", err)
+	}
+	// Compare the saved forms, as the stored version's proxied images are read with fresh
+	// signatures
+	current := withRelativeURLs(*blog)
+	if previous.ID != "" && reflect.DeepEqual(withBookkeeping(withRelativeURLs(previous), current), current) {
+		blog.Revision = previous.Revision
+		return nil
+	}
+
+	keep := max(getEnvInt("MAX_REVISIONS", defaultMaxRevisions), 1)
+	if previous.ID != "" && previous.Revision == 0 {
+		previous.Revision = 1
+		createdAt := previous.UpdatedAt
+		if createdAt == "" {
+			createdAt = previous.Date
+		}
+		err = blogStore.SaveRevision(BlogRevision{Number: 1, CreatedAt: createdAt, Blog: previous}, keep)
+		if err != nil {
+			return err
+		}
+	}
+	blog.Revision = previous.Revision + 1
+	return blogStore.SaveRevision(BlogRevision{Number: blog.Revision, CreatedAt: blog.UpdatedAt, Blog: *blog}, keep)
+}
+
+// revisionNumber reads the {rev} path parameter
+func revisionNumber(r *http.Request) (int, error) {
+	number, err := strconv.Atoi(mux.Vars(r)["rev"])
+	if err != nil || number < 1 {
+		return 0, errors.New("revision must be a positive integer")
+	}
+	return number, nil
+}
+
+// writeRevisionError writes the response for an error loading a blog or its revisions
+func writeRevisionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errInvalidBlogID):
+		http.Error(w, "Invalid blog ID", http.StatusBadRequest)
+	case errors.Is(err, errBlogNotFound):
+		http.Error(w, "Blog not found", http.StatusNotFound)
+	case errors.Is(err, errRevisionNotFound):
+		http.Error(w, "Revision not found", http.StatusNotFound)
+	default:
+		http.Error(w, "Failed to load revisions: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// listRevisionsHandler returns the blog's revisions, oldest first, without their content
+func listRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	blog, err := getBlogByID(id)
+	if err == nil && !canReadBlog(r, blog) {
+		err = errBlogNotFound
+	}
+	if err != nil {
+		writeRevisionError(w, err)
+		return
+	}
+	revisions, err := blogStore.Revisions(id)
+	if err != nil {
+		writeRevisionError(w, err)
+		return
+	}
+
+	summaries := make([]RevisionSummary, 0, len(revisions))
+	for _, revision := range revisions {
+		summaries = append(summaries, RevisionSummary{
+			Number:      revision.Number,
+			CreatedAt:   revision.CreatedAt,
+			Title:       revision.Blog.Title,
+			ReadingTime: revision.Blog.ReadingTime,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Current   int               `json:"current"`
+		Revisions []RevisionSummary `json:"revisions"`
+	}{blog.Revision, summaries})
+}
+
+// getRevisionHandler returns one of the blog's revisions with the blog as it was stored
+func getRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	number, err := revisionNumber(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	blog, err := getBlogByID(id)
+	if err == nil && !canReadBlog(r, blog) {
+		err = errBlogNotFound
+	}
+	if err != nil {
+		writeRevisionError(w, err)
+		return
+	}
+	revision, err := blogStore.GetRevision(id, number)
+	if err != nil {
+		writeRevisionError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revision)
+}
+
+// rollbackBlogHandler restores the content of one of the blog's revisions, which is stored
+// as a new revision so the rollback can itself be undone. The blog keeps its workflow
+// status and publications.
+func rollbackBlogHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	number, err := revisionNumber(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	blog, err := updateBlogPost(id, func(blog *BlogPost) error {
+		if !canManageBlog(r, *blog) {
+			return errNotBlogOwner
+		}
+		revision, err := blogStore.GetRevision(id, number)
+		if err != nil {
+			return err
+		}
+		*blog = withBookkeeping(revision.Blog, *blog)
+		return nil
+	})
+	if errors.Is(err, errNotBlogOwner) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, errInvalidBlogID) || errors.Is(err, errBlogNotFound) || errors.Is(err, errRevisionNotFound) {
+		writeRevisionError(w, err)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to roll back blog: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(blog)
+}
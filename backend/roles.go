@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Roles, each allowed everything the roles before it are. Viewers can read, editors can
+// also generate blogs and manage their own, and admins can manage every blog, the API
+// keys and the user accounts.
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+	RoleAdmin  = "admin"
+)
+
+// roles lists the roles from least to most privileged
+var roles = []string{RoleViewer, RoleEditor, RoleAdmin}
+
+// validRole reports whether role is one of the known roles
+func validRole(role string) bool {
+	return slices.Contains(roles, role)
+}
+
+// roleAtLeast reports whether role grants everything minimum does
+func roleAtLeast(role, minimum string) bool {
+	return slices.Index(roles, role) >= slices.Index(roles, minimum)
+}
+
+// defaultUserRole is the role of accounts that admins and API keys register, other than
+// the first, which becomes an admin
+func defaultUserRole() string {
+	role := getEnv("USER_DEFAULT_ROLE", RoleEditor)
+	if !validRole(role) {
+		log.Printf("Ignoring invalid USER_DEFAULT_ROLE=%q", role)
+		return RoleEditor
+	}
+	return role
+}
+
+// Role returns the principal's role. Admin API keys act as admins and other keys as
+// editors; anonymous requests have no role.
+func (p Principal) Role() string {
+	switch {
+	case p.User != nil:
+		return p.User.Role
+	case p.APIKey != nil && p.APIKey.Admin:
+		return RoleAdmin
+	case p.APIKey != nil:
+		return RoleEditor
+	default:
+		return ""
+	}
+}
+
+// requireRole lets the request through only if it was made with at least the given role.
+// While no keys or accounts exist every request is let through, as in authMiddleware.
+func requireRole(minimum string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !authEnabled() {
+			next(w, r)
+			return
+		}
+
+		role := requestPrincipal(r).Role()
+		if role == "" {
+			writeJSONError(w, http.StatusUnauthorized, "invalid or missing API key or login token")
+			return
+		}
+		if !roleAtLeast(role, minimum) {
+			writeJSONError(w, http.StatusForbidden, "this requires the "+minimum+" role")
+			return
+		}
+		next(w, r)
+	}
+}
+
+func listUsersHandler(w http.ResponseWriter, r *http.Request) {
+	list := users.List()
+	for i := range list {
+		list[i] = list[i].public()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+func updateUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	var reqBody struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !validRole(reqBody.Role) {
+		http.Error(w, "Role must be one of "+strings.Join(roles, ", "), http.StatusBadRequest)
+		return
+	}
+
+	user, err := users.SetRole(id, reqBody.Role)
+	if errors.Is(err, errUserNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, errLastAdmin) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to update user: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Changed role of user %s to %s", user.ID, user.Role)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user.public())
+}
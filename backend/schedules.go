@@ -0,0 +1,604 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/robfig/cron/v3"
+)
+
+// Schedule limits: runs must be at least a minute apart, and each schedule keeps its
+// latest runs
+const (
+	minScheduleInterval = time.Minute
+	scheduleRunHistory  = 20
+)
+
+// RunSkipped is the status of a scheduled run that didn't start because the previous
+// run was still going
+const RunSkipped = "skipped"
+
+// Errors returned by the ScheduleStore
+var (
+	errScheduleNotFound = errors.New("schedule not found")
+	errInvalidSchedule  = errors.New("invalid schedule")
+	errNotScheduleOwner = errors.New("only the schedule's owner can manage it")
+)
+
+// Schedule generates a blog for its topic every time its cron expression fires
+type Schedule struct {
+	ID    string `json:"id"`
+	Name  string `json:"name,omitempty"`
+	Topic string `json:"topic"`
+	// Cron is a five-field cron expression, such as "0 9 * * 1" for Mondays at 09:00, or
+	// a descriptor such as "@daily" or "@every 6h"
+	Cron string `json:"cron"`
+	// Timezone is the IANA time zone Cron is read in, the server's by default
+	Timezone string `json:"timezone,omitempty"`
+	Enabled  bool   `json:"enabled"`
+	// OwnerID is the user the generated blogs belong to
+	OwnerID   string    `json:"ownerId,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	// NextRunAt is when the schedule fires next, while it is enabled
+	NextRunAt *time.Time `json:"nextRunAt,omitempty"`
+	// Runs are the latest runs, newest first
+	Runs []ScheduleRun `json:"runs"`
+}
+
+// ScheduleRun records one firing of a schedule and the generation job it started
+type ScheduleRun struct {
+	JobID string `json:"jobId,omitempty"`
+	// Status follows the job's status, or is RunSkipped
+	Status     string     `json:"status"`
+	BlogID     string     `json:"blogId,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+// finished reports whether the run's job is done, failed or cancelled, or never started
+func (run ScheduleRun) finished() bool {
+	switch run.Status {
+	case JobDone, JobFailed, JobCancelled, RunSkipped:
+		return true
+	}
+	return false
+}
+
+// parseCron parses the schedule's cron expression in its time zone, rejecting
+// expressions that never fire or fire more often than minScheduleInterval
+func parseCron(expr, timezone string) (cron.Schedule, error) {
+	spec := strings.TrimSpace(expr)
+	if spec == "" {
+		return nil, fmt.Errorf("%w: cron is required", errInvalidSchedule)
+	}
+	if strings.HasPrefix(spec, "TZ=") || strings.HasPrefix(spec, "CRON_TZ=") {
+		return nil, fmt.Errorf("%w: set the time zone with timezone", errInvalidSchedule)
+	}
+	if timezone != "" {
+		if _, err := time.LoadLocation(timezone); err != nil {
+			return nil, fmt.Errorf("%w: unknown timezone %q", errInvalidSchedule, timezone)
+		}
+		spec = "CRON_TZ=" + timezone + " " + spec
+	}
+
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidSchedule, err)
+	}
+	first := schedule.Next(time.Now())
+	if first.IsZero() {
+		return nil, fmt.Errorf("%w: cron never fires", errInvalidSchedule)
+	}
+	if schedule.Next(first).Sub(first) < minScheduleInterval {
+		return nil, fmt.Errorf("%w: runs must be at least %s apart", errInvalidSchedule, minScheduleInterval)
+	}
+	return schedule, nil
+}
+
+// ScheduleStore holds the schedules in a JSON file, along with their run history, and
+// fires them with a cron runner
+type ScheduleStore struct {
+	mu        sync.Mutex
+	path      string
+	schedules map[string]*Schedule
+	runner    *cron.Cron
+	// entries maps the enabled schedules to their cron entries
+	entries map[string]cron.EntryID
+}
+
+var schedules = &ScheduleStore{
+	schedules: make(map[string]*Schedule),
+	entries:   make(map[string]cron.EntryID),
+}
+
+// schedulesFile is where schedules are saved, SCHEDULES_FILE or schedules.json in the data
+// directory
+func schedulesFile() string {
+	return getEnv("SCHEDULES_FILE", dataPath("schedules.json"))
+}
+
+// Load reads the schedules saved at path. A missing file means there are no schedules yet.
+func (s *ScheduleStore) Load(path string) error {
+	loaded := make(map[string]*Schedule)
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		var stored []Schedule
+		if err := json.Unmarshal(data, &stored); err != nil {
+			return fmt.Errorf("failed to parse %s: %v", path, err)
+		}
+		for _, schedule := range stored {
+			schedule := schedule
+			loaded[schedule.ID] = &schedule
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.path = path
+	s.schedules = loaded
+	return nil
+}
+
+// Start fires the enabled schedules from now on, and resumes following the runs whose
+// jobs were still going at the last shutdown. Call it after the job manager has started.
+func (s *ScheduleStore) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.runner = cron.New()
+	for id, schedule := range s.schedules {
+		if schedule.Enabled {
+			if err := s.activate(schedule); err != nil {
+				log.Printf("Not running schedule %s: %v", id, err)
+			}
+		}
+		for _, run := range schedule.Runs {
+			if !run.finished() && run.JobID != "" {
+				go s.follow(id, run.JobID)
+			}
+		}
+	}
+	s.runner.Start()
+}
+
+// Stop stops firing schedules, waiting for runs being started to be queued
+func (s *ScheduleStore) Stop(ctx context.Context) {
+	s.mu.Lock()
+	runner := s.runner
+	s.mu.Unlock()
+	if runner == nil {
+		return
+	}
+	select {
+	case <-runner.Stop().Done():
+	case <-ctx.Done():
+	}
+}
+
+// activate adds the schedule to the cron runner. The caller must hold s.mu.
+func (s *ScheduleStore) activate(schedule *Schedule) error {
+	if s.runner == nil {
+		return nil
+	}
+	parsed, err := parseCron(schedule.Cron, schedule.Timezone)
+	if err != nil {
+		return err
+	}
+	id := schedule.ID
+	s.entries[id] = s.runner.Schedule(parsed, cron.FuncJob(func() { s.run(id) }))
+	return nil
+}
+
+// deactivate removes the schedule from the cron runner. The caller must hold s.mu.
+func (s *ScheduleStore) deactivate(id string) {
+	if entry, ok := s.entries[id]; ok {
+		s.runner.Remove(entry)
+		delete(s.entries, id)
+	}
+}
+
+// view returns a copy of the schedule with its next run time. The caller must hold s.mu.
+func (s *ScheduleStore) view(schedule *Schedule) Schedule {
+	viewed := *schedule
+	viewed.Runs = slices.Clone(schedule.Runs)
+	if viewed.Runs == nil {
+		viewed.Runs = []ScheduleRun{}
+	}
+	if entry, ok := s.entries[schedule.ID]; ok {
+		if next := s.runner.Entry(entry).Next; !next.IsZero() {
+			viewed.NextRunAt = &next
+		}
+	}
+	return viewed
+}
+
+// List returns the schedules for which keep returns true, oldest first
+func (s *ScheduleStore) List(keep func(Schedule) bool) []Schedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	listed := []Schedule{}
+	for _, schedule := range s.schedules {
+		if keep(*schedule) {
+			listed = append(listed, s.view(schedule))
+		}
+	}
+	slices.SortFunc(listed, func(a, b Schedule) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	return listed
+}
+
+// Get returns the schedule with the ID
+func (s *ScheduleStore) Get(id string) (Schedule, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedule, ok := s.schedules[id]
+	if !ok {
+		return Schedule{}, false
+	}
+	return s.view(schedule), true
+}
+
+// Create validates the schedule, saves it and starts firing it if it is enabled
+func (s *ScheduleStore) Create(schedule Schedule) (Schedule, error) {
+	if _, err := parseCron(schedule.Cron, schedule.Timezone); err != nil {
+		return Schedule{}, err
+	}
+	now := time.Now()
+	schedule.ID = uuid.New().String()
+	schedule.CreatedAt = now
+	schedule.UpdatedAt = now
+	schedule.Runs = nil
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.schedules[schedule.ID] = &schedule
+	if err := s.save(); err != nil {
+		delete(s.schedules, schedule.ID)
+		return Schedule{}, err
+	}
+	if schedule.Enabled {
+		if err := s.activate(&schedule); err != nil {
+			return Schedule{}, err
+		}
+	}
+	return s.view(&schedule), nil
+}
+
+// Update applies fn to a copy of the schedule, then validates, saves and reschedules it.
+// fn returning an error leaves the schedule unchanged.
+func (s *ScheduleStore) Update(id string, fn func(schedule *Schedule) error) (Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.schedules[id]
+	if !ok {
+		return Schedule{}, errScheduleNotFound
+	}
+	updated := *current
+	if err := fn(&updated); err != nil {
+		return Schedule{}, err
+	}
+	if _, err := parseCron(updated.Cron, updated.Timezone); err != nil {
+		return Schedule{}, err
+	}
+	updated.UpdatedAt = time.Now()
+
+	s.schedules[id] = &updated
+	if err := s.save(); err != nil {
+		s.schedules[id] = current
+		return Schedule{}, err
+	}
+	s.deactivate(id)
+	if updated.Enabled {
+		if err := s.activate(&updated); err != nil {
+			return Schedule{}, err
+		}
+	}
+	return s.view(&updated), nil
+}
+
+// Delete stops firing the schedule and removes it. Runs already queued still complete.
+func (s *ScheduleStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedule, ok := s.schedules[id]
+	if !ok {
+		return errScheduleNotFound
+	}
+	delete(s.schedules, id)
+	if err := s.save(); err != nil {
+		s.schedules[id] = schedule
+		return err
+	}
+	s.deactivate(id)
+	return nil
+}
+
+// run queues a generation for the schedule's topic and follows the job, unless the
+// previous run is still going
+func (s *ScheduleStore) run(id string) {
+	s.mu.Lock()
+	schedule, ok := s.schedules[id]
+	if !ok {
+		s.mu.Unlock()
+		return
+	}
+	topic, ownerID := schedule.Topic, schedule.OwnerID
+	busy := len(schedule.Runs) > 0 && !schedule.Runs[0].finished()
+	s.mu.Unlock()
+
+	run := ScheduleRun{StartedAt: time.Now()}
+	if busy {
+		run.Status = RunSkipped
+		run.Error = "the previous run was still going"
+	} else if job, err := jobManager.Submit(topic, ownerID, GenerationOptions{}); err != nil {
+		run.Status = JobFailed
+		run.Error = err.Error()
+	} else {
+		run.JobID = job.ID
+		run.Status = job.Status
+	}
+	if run.finished() {
+		finished := run.StartedAt
+		run.FinishedAt = &finished
+		log.Printf("Scheduled generation %s for topic %q did not start: %s", id, topic, run.Error)
+	}
+
+	s.mu.Lock()
+	if schedule, ok := s.schedules[id]; ok {
+		schedule.Runs = append([]ScheduleRun{run}, schedule.Runs...)
+		if len(schedule.Runs) > scheduleRunHistory {
+			schedule.Runs = schedule.Runs[:scheduleRunHistory]
+		}
+		if err := s.save(); err != nil {
+			log.Printf("Failed to save the run of schedule %s: %v", id, err)
+		}
+	}
+	s.mu.Unlock()
+
+	if run.JobID != "" {
+		s.follow(id, run.JobID)
+	}
+}
+
+// follow records the progress of a run's job until it is done or has failed
+func (s *ScheduleStore) follow(id, jobID string) {
+	job, updates, unsubscribe, ok := jobManager.Subscribe(jobID)
+	if !ok {
+		s.recordJob(id, Job{ID: jobID, Status: JobFailed, Error: "the generation job was lost"})
+		return
+	}
+	defer unsubscribe()
+
+	for {
+		s.recordJob(id, job)
+		if job.finished() {
+			return
+		}
+		job = <-updates
+	}
+}
+
+// recordJob updates the schedule's run of the job with the job's status. Only the
+// outcome is saved, so the progress of running jobs doesn't rewrite the file.
+func (s *ScheduleStore) recordJob(id string, job Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedule, ok := s.schedules[id]
+	if !ok {
+		return
+	}
+	for i := range schedule.Runs {
+		run := &schedule.Runs[i]
+		if run.JobID != job.ID || run.Status == job.Status {
+			continue
+		}
+		run.Status = job.Status
+		run.BlogID = job.BlogID
+		run.Error = job.Error
+		if run.finished() {
+			now := time.Now()
+			run.FinishedAt = &now
+			if err := s.save(); err != nil {
+				log.Printf("Failed to save the run of schedule %s: %v", id, err)
+			}
+		}
+		return
+	}
+}
+
+// save writes the schedules to the store's file. The caller must hold s.mu.
+func (s *ScheduleStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+	stored := make([]Schedule, 0, len(s.schedules))
+	for _, schedule := range s.schedules {
+		stored = append(stored, *schedule)
+	}
+	slices.SortFunc(stored, func(a, b Schedule) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(s.path), 0755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, data, 0644)
+}
+
+// ScheduleRequest is the body of schedule create and update requests. Omitted fields keep
+// their current value on update.
+type ScheduleRequest struct {
+	Name     *string `json:"name"`
+	Topic    *string `json:"topic"`
+	Cron     *string `json:"cron"`
+	Timezone *string `json:"timezone"`
+	Enabled  *bool   `json:"enabled"`
+}
+
+// apply sets the request's fields on the schedule
+func (req ScheduleRequest) apply(schedule *Schedule) error {
+	if req.Name != nil {
+		schedule.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Topic != nil {
+		schedule.Topic = strings.TrimSpace(*req.Topic)
+	}
+	if req.Cron != nil {
+		schedule.Cron = strings.TrimSpace(*req.Cron)
+	}
+	if req.Timezone != nil {
+		schedule.Timezone = strings.TrimSpace(*req.Timezone)
+	}
+	if req.Enabled != nil {
+		schedule.Enabled = *req.Enabled
+	}
+	if schedule.Topic == "" {
+		return fmt.Errorf("%w: topic is required", errInvalidSchedule)
+	}
+	return nil
+}
+
+// decodeScheduleRequest reads a ScheduleRequest, answering 400 and returning false if
+// the body is invalid
+func decodeScheduleRequest(w http.ResponseWriter, r *http.Request) (ScheduleRequest, bool) {
+	var req ScheduleRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return ScheduleRequest{}, false
+	}
+	return req, true
+}
+
+// writeScheduleError answers with the status matching a ScheduleStore error
+func writeScheduleError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errScheduleNotFound):
+		http.Error(w, "Schedule not found", http.StatusNotFound)
+	case errors.Is(err, errNotScheduleOwner):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, errInvalidSchedule):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, "Failed to save schedule: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func writeSchedule(w http.ResponseWriter, status int, schedule Schedule) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(schedule)
+}
+
+func listSchedulesHandler(w http.ResponseWriter, r *http.Request) {
+	listed := schedules.List(func(schedule Schedule) bool {
+		return canManageOwnedBy(r, schedule.OwnerID)
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(listed)
+}
+
+func createScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeScheduleRequest(w, r)
+	if !ok {
+		return
+	}
+	user, _ := requestUser(r)
+	schedule := Schedule{OwnerID: user.ID, Enabled: true}
+	if err := req.apply(&schedule); err != nil {
+		writeScheduleError(w, err)
+		return
+	}
+
+	created, err := schedules.Create(schedule)
+	if err != nil {
+		writeScheduleError(w, err)
+		return
+	}
+	log.Printf("Created schedule %s for topic %q (%s)", created.ID, created.Topic, created.Cron)
+	w.Header().Set("Location", "/api/schedules/"+created.ID)
+	writeSchedule(w, http.StatusCreated, created)
+}
+
+func getScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	schedule, ok := schedules.Get(mux.Vars(r)["id"])
+	if !ok {
+		writeScheduleError(w, errScheduleNotFound)
+		return
+	}
+	if !canManageOwnedBy(r, schedule.OwnerID) {
+		writeScheduleError(w, errNotScheduleOwner)
+		return
+	}
+	writeSchedule(w, http.StatusOK, schedule)
+}
+
+func updateScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeScheduleRequest(w, r)
+	if !ok {
+		return
+	}
+	updated, err := schedules.Update(mux.Vars(r)["id"], func(schedule *Schedule) error {
+		if !canManageOwnedBy(r, schedule.OwnerID) {
+			return errNotScheduleOwner
+		}
+		return req.apply(schedule)
+	})
+	if err != nil {
+		writeScheduleError(w, err)
+		return
+	}
+	writeSchedule(w, http.StatusOK, updated)
+}
+
+func deleteScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	schedule, ok := schedules.Get(id)
+	if !ok {
+		writeScheduleError(w, errScheduleNotFound)
+		return
+	}
+	if !canManageOwnedBy(r, schedule.OwnerID) {
+		writeScheduleError(w, errNotScheduleOwner)
+		return
+	}
+	if err := schedules.Delete(id); err != nil {
+		writeScheduleError(w, err)
+		return
+	}
+	log.Printf("Deleted schedule %s", id)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+)
+
+// errSourcesNotFound is returned by stores for blogs without stored sources, such as
+// blogs generated before sources were kept
+var errSourcesNotFound = errors.New("no sources stored for the blog")
+
+// GenerationSources are the scraped contents a blog was written from, simulated ones
+// included
+type GenerationSources struct {
+	BlogID string `json:"blogId"`
+	// GeneratedAt is when the blog was last generated or updated from the sources (RFC 3339)
+	GeneratedAt string           `json:"generatedAt"`
+	Contents    []ScrapedContent `json:"contents"`
+}
+
+// ScrapedSource describes one of the scraped contents a blog was written from
+type ScrapedSource struct {
+	URL         string `json:"url"`
+	Title       string `json:"title"`
+	PublishedAt string `json:"publishedAt,omitempty"`
+	Simulated   bool   `json:"simulated,omitempty"`
+	// Characters is the length of the text passed to the generator
+	Characters int    `json:"characters"`
+	Text       string `json:"text,omitempty"`
+}
+
+// storeGenerationSources keeps the scraped contents the blog was generated from, replacing
+// those of its earlier generations. Failures are logged, since the blog itself was saved.
+func storeGenerationSources(blogID string, contents []ScrapedContent) {
+	sources := GenerationSources{
+		BlogID:      blogID,
+		GeneratedAt: time.Now().UTC().Format(time.RFC3339),
+		Contents:    contents,
+	}
+	if err := blogStore.SaveSources(sources); err != nil {
+		log.Printf("Failed to store the sources of blog %s: %v", blogID, err)
+	}
+}
+
+// addGenerationSources adds the scraped contents an update to the blog was written from to
+// its stored sources
+func addGenerationSources(blogID string, contents []ScrapedContent) {
+	sources, err := blogStore.Sources(blogID)
+	if err != nil && !errors.Is(err, errSourcesNotFound) {
+		log.Printf("Failed to load the sources of blog %s: %v", blogID, err)
+		return
+	}
+	merged := slices.Clone(sources.Contents)
+	for _, content := range contents {
+		if !slices.ContainsFunc(merged, func(c ScrapedContent) bool { return c.URL == content.URL }) {
+			merged = append(merged, content)
+		}
+	}
+	storeGenerationSources(blogID, merged)
+}
+
+// writeSourcesError writes the response for an error loading a blog or its sources
+func writeSourcesError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errInvalidBlogID):
+		http.Error(w, "Invalid blog ID", http.StatusBadRequest)
+	case errors.Is(err, errBlogNotFound):
+		http.Error(w, "Blog not found", http.StatusNotFound)
+	case errors.Is(err, errSourcesNotFound):
+		http.Error(w, "No sources were stored for this blog", http.StatusNotFound)
+	default:
+		http.Error(w, "Failed to load sources: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// blogSourcesHandler lists the scraped contents the blog was last generated from, with
+// their URL, title, publish date and text length. Editors who can manage the blog get the
+// text too with ?text=true.
+func blogSourcesHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	blog, err := getBlogByID(id)
+	if err == nil && !canReadBlog(r, blog) {
+		err = errBlogNotFound
+	}
+	if err != nil {
+		writeSourcesError(w, err)
+		return
+	}
+	sources, err := blogStore.Sources(id)
+	if err != nil {
+		writeSourcesError(w, err)
+		return
+	}
+
+	withText := r.URL.Query().Get("text") == "true" && canListUnpublished(r) && canManageBlog(r, blog)
+	listed := make([]ScrapedSource, 0, len(sources.Contents))
+	for _, content := range sources.Contents {
+		source := ScrapedSource{
+			URL:         content.URL,
+			Title:       content.Title,
+			PublishedAt: content.PublishedAt,
+			Simulated:   content.Simulated,
+			Characters:  utf8.RuneCountInString(content.Text),
+		}
+		if withText {
+			source.Text = content.Text
+		}
+		listed = append(listed, source)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		BlogID      string          `json:"blogId"`
+		GeneratedAt string          `json:"generatedAt"`
+		Sources     []ScrapedSource `json:"sources"`
+	}{id, sources.GeneratedAt, listed})
+}
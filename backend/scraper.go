@@ -0,0 +1,478 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"maps"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// Scraper defaults, overridable with SCRAPE_MIN_TEXT_LENGTH, SCRAPE_PARALLELISM, SCRAPE_DELAY,
+// SCRAPE_MAX_SOURCES, SCRAPE_MAX_DEPTH, SCRAPE_RETRY_ATTEMPTS, SCRAPE_RETRY_DELAY and
+// SCRAPE_TIMEOUT. The delay and parallelism apply to each domain unless the scrape config
+// file sets limits of its own for it.
+const (
+	defaultScrapeMinTextLength  = 200
+	defaultScrapeParallelism    = 4
+	defaultScrapeDelay          = 500 * time.Millisecond
+	defaultScrapeMaxSources     = 50
+	defaultScrapeMaxDepth       = 2
+	defaultScrapeRetryAttempts  = 3
+	defaultScrapeRetryBaseDelay = time.Second
+	defaultScrapeTimeout        = 90 * time.Second
+)
+
+// scrapeSource is a search page the scraper starts crawling from
+type scrapeSource struct {
+	name string
+	url  func(topic string) string
+}
+
+// scrapeSourceChain is tried in order until enough content has been collected
+var scrapeSourceChain = []scrapeSource{
+	{"Google News", func(topic string) string {
+		return "https://news.google.com/search?q=" + url.QueryEscape(topic)
+	}},
+	{"Bing News", func(topic string) string {
+		return "https://www.bing.com/news/search?q=" + url.QueryEscape(topic)
+	}},
+	{"Wikipedia", func(topic string) string {
+		return "https://en.wikipedia.org/wiki/" + url.PathEscape(strings.ReplaceAll(topic, " ", "_"))
+	}},
+}
+
+// defaultScrapeAllowedDomains lists the domains the scraper visits when no allowlist is configured
+var defaultScrapeAllowedDomains = []string{
+	"en.wikipedia.org",
+	"www.bbc.com",
+	"www.cnn.com",
+	"www.reuters.com",
+	"www.theguardian.com",
+	"news.google.com",
+	"www.bing.com",
+	"www.nytimes.com",
+	"www.forbes.com",
+	"techcrunch.com",
+	"www.wired.com",
+}
+
+// ScrapeConfig is the optional JSON file (SCRAPE_CONFIG_FILE, default config.json) that
+// configures the scraper
+type ScrapeConfig struct {
+	AllowedDomains []string `json:"allowedDomains"`
+	// Feeds are RSS or Atom feeds read before the search pages, unless SCRAPE_FEEDS is set
+	Feeds []string `json:"feeds"`
+	// Extractors adds or replaces site extractors, keyed by domain
+	Extractors map[string]SiteExtractor `json:"extractors"`
+	// DomainLimits sets the request rate of the domains matching each glob, such as
+	// *.wikipedia.org
+	DomainLimits map[string]ScrapeDomainLimit `json:"domainLimits"`
+}
+
+// ScrapeDomainLimit is the request rate of a domain. Durations are strings such as "2s",
+// and unset values are the scraper's defaults.
+type ScrapeDomainLimit struct {
+	Delay       string `json:"delay"`
+	RandomDelay string `json:"randomDelay"`
+	Parallelism int    `json:"parallelism"`
+}
+
+// loadScrapeConfig reads the scrape config file once. A missing file is not an error.
+var loadScrapeConfig = sync.OnceValue(func() ScrapeConfig {
+	var config ScrapeConfig
+	path := getEnv("SCRAPE_CONFIG_FILE", "config.json")
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return config
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &config)
+	}
+	if err != nil {
+		log.Printf("Ignoring scrape config %s: %v", path, err)
+		return ScrapeConfig{}
+	}
+	return config
+})
+
+// scrapeAllowedDomains returns the domains the scraper is allowed to visit: the server
+// configuration's allowedDomains (also set by SCRAPE_ALLOWED_DOMAINS), else allowedDomains
+// from the scrape config file, else the built-in list
+func scrapeAllowedDomains() []string {
+	if len(appConfig.AllowedDomains) > 0 {
+		return appConfig.AllowedDomains
+	}
+	if domains := loadScrapeConfig().AllowedDomains; len(domains) > 0 {
+		return domains
+	}
+	return defaultScrapeAllowedDomains
+}
+
+// scrapeLimitRules returns the collector's limit rules: those of the scrape config file,
+// longest glob first so specific domains win over wildcards, then one rule for each
+// allowed domain and a catch-all rule with the default delay and parallelism. Rules with
+// invalid durations are logged and skipped.
+func scrapeLimitRules(allowedDomains []string) []*colly.LimitRule {
+	delay := getEnvDuration("SCRAPE_DELAY", defaultScrapeDelay)
+	parallelism := max(getEnvInt("SCRAPE_PARALLELISM", defaultScrapeParallelism), 1)
+
+	var rules []*colly.LimitRule
+	limits := loadScrapeConfig().DomainLimits
+	globs := slices.SortedFunc(maps.Keys(limits), func(a, b string) int {
+		return cmp.Or(cmp.Compare(len(b), len(a)), cmp.Compare(a, b))
+	})
+	for _, glob := range globs {
+		limit := limits[glob]
+		rule := &colly.LimitRule{DomainGlob: glob, Delay: delay, Parallelism: parallelism}
+		var err error
+		if limit.Delay != "" {
+			rule.Delay, err = time.ParseDuration(limit.Delay)
+		}
+		if err == nil && limit.RandomDelay != "" {
+			rule.RandomDelay, err = time.ParseDuration(limit.RandomDelay)
+		}
+		if err != nil {
+			log.Printf("Ignoring scrape limits for %s: %v", glob, err)
+			continue
+		}
+		if limit.Parallelism > 0 {
+			rule.Parallelism = limit.Parallelism
+		}
+		rules = append(rules, rule)
+	}
+
+	// A rule limits all the domains it matches together, so each domain gets its own
+	for _, domain := range allowedDomains {
+		rules = append(rules, &colly.LimitRule{DomainGlob: domain, Delay: delay, Parallelism: parallelism})
+	}
+	return append(rules, &colly.LimitRule{DomainGlob: "*", Delay: delay, Parallelism: parallelism})
+}
+
+// scrapeResults collects scraped contents from concurrent colly callbacks, capped at maxCount
+type scrapeResults struct {
+	mu       sync.Mutex
+	contents []ScrapedContent
+	maxCount int
+	// pages counts the pages fetched
+	pages int
+	// bySource counts the contents found by crawling from each source in the chain
+	bySource map[string]int
+}
+
+// add appends the content found from source unless the cap has been reached, reporting
+// whether it was added
+func (r *scrapeResults) add(content ScrapedContent, source string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.contents) >= r.maxCount {
+		return false
+	}
+	r.contents = append(r.contents, content)
+	if r.bySource == nil {
+		r.bySource = make(map[string]int)
+	}
+	r.bySource[source]++
+	return true
+}
+
+// full reports whether the cap has been reached
+func (r *scrapeResults) full() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.contents) >= r.maxCount
+}
+
+// newScrapeCollector creates an async collector that follows links within the allowed
+// domains and records article-like content into results. Its requests, including those
+// already in flight, are cancelled when ctx is done. URLs disallowed by the site's
+// robots.txt are skipped unless SCRAPE_IGNORE_ROBOTS_TXT is set.
+func newScrapeCollector(ctx context.Context, results *scrapeResults, allowedDomains []string) *colly.Collector {
+	c := colly.NewCollector(
+		colly.MaxDepth(max(getEnvInt("SCRAPE_MAX_DEPTH", defaultScrapeMaxDepth), 1)),
+		colly.Async(true),
+		colly.StdlibContext(ctx),
+		colly.UserAgent("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36"),
+	)
+
+	c.AllowedDomains = allowedDomains
+	c.IgnoreRobotsTxt = getEnvBool("SCRAPE_IGNORE_ROBOTS_TXT", false)
+
+	if err := c.Limits(scrapeLimitRules(allowedDomains)); err != nil {
+		log.Printf("Failed to set scrape limits: %v", err)
+	}
+
+	// Articles are found with the extractor of the page's site, else the generic one
+	c.OnHTML("html", func(e *colly.HTMLElement) {
+		if results.full() {
+			return
+		}
+		extractor, _ := extractorFor(e.Request.URL.Hostname())
+		for _, content := range extractor.extract(e) {
+			if !results.add(content, e.Request.Ctx.Get("source")) {
+				return
+			}
+		}
+	})
+
+	c.OnHTML("a[href]", func(e *colly.HTMLElement) {
+		if results.full() {
+			return
+		}
+		e.Request.Visit(e.Attr("href"))
+	})
+
+	// Retry failed search pages with exponential backoff; failures of followed links are ignored
+	maxAttempts := max(getEnvInt("SCRAPE_RETRY_ATTEMPTS", defaultScrapeRetryAttempts), 1)
+	baseDelay := getEnvDuration("SCRAPE_RETRY_DELAY", defaultScrapeRetryBaseDelay)
+	c.OnError(func(resp *colly.Response, err error) {
+		request := resp.Request
+		if request.Depth > 1 || ctx.Err() != nil {
+			return
+		}
+
+		attempt, _ := request.Ctx.GetAny("attempt").(int)
+		attempt++
+		if attempt >= maxAttempts {
+			log.Printf("Giving up on %s after %d attempts: %v", request.URL, attempt, err)
+			return
+		}
+		request.Ctx.Put("attempt", attempt)
+
+		delay := baseDelay << (attempt - 1)
+		log.Printf("Failed to fetch %s (attempt %d/%d), retrying in %s: %v", request.URL, attempt, maxAttempts, delay, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		if err := request.Retry(); err != nil {
+			log.Printf("Failed to retry %s: %v", request.URL, err)
+		}
+	})
+
+	return c
+}
+
+// externalArticleTransport fetches the articles that feeds and search providers link to
+// outside the allowed domains. It refuses connections to non-public addresses, so those
+// links can't reach internal services.
+var externalArticleTransport http.RoundTripper = &http.Transport{
+	DialContext: (&net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: publicOnlyControl,
+	}).DialContext,
+	TLSHandshakeTimeout: 10 * time.Second,
+}
+
+// newExternalArticleCollector creates a collector like newScrapeCollector's for articles
+// outside the allowed domains. It fetches only the articles queued on it, without following
+// their links, through externalArticleTransport.
+func newExternalArticleCollector(ctx context.Context, results *scrapeResults) *colly.Collector {
+	c := newScrapeCollector(ctx, results, nil)
+	c.MaxDepth = 1
+	c.WithTransport(externalArticleTransport)
+	return c
+}
+
+// scrapeContentForTopic crawls from the articles of the configured feeds matching the
+// topic and those found by the search API, then from each source in scrapeSourceChain in
+// turn until enough content has been collected, returning the selected contents and the
+// number of pages fetched. A source that fails is skipped rather than failing the scrape.
+// Progress is reported after every page. Once ctx is done, pages being fetched are
+// cancelled, no further pages are requested and ctx's error is returned. Scraping stops
+// after SCRAPE_TIMEOUT, keeping whatever was collected by then.
+func scrapeContentForTopic(ctx context.Context, topic string, progress ProgressFunc) ([]ScrapedContent, int, error) {
+	scrapeCtx, cancel := context.WithTimeout(ctx, getEnvDuration("SCRAPE_TIMEOUT", defaultScrapeTimeout))
+	defer cancel()
+
+	results := &scrapeResults{maxCount: max(getEnvInt("SCRAPE_MAX_SOURCES", defaultScrapeMaxSources), 1)}
+	c := newScrapeCollector(scrapeCtx, results, scrapeAllowedDomains())
+	external := newExternalArticleCollector(scrapeCtx, results)
+	for _, collector := range []*colly.Collector{c, external} {
+		collector.OnRequest(func(r *colly.Request) {
+			if scrapeCtx.Err() != nil {
+				r.Abort()
+			}
+		})
+		collector.OnScraped(func(_ *colly.Response) {
+			results.mu.Lock()
+			results.pages++
+			event := ProgressEvent{Stage: StageScraping, Pages: results.pages, Sources: len(results.contents)}
+			results.mu.Unlock()
+			progress(event)
+		})
+	}
+	articles := articleCollectors{crawl: c, external: external}
+
+	// Articles linked from feeds and found by the search API are collected first, being
+	// more reliable than search pages
+	sourceNames := []string{feedSourceName}
+	if queueFeedArticles(scrapeCtx, articles, topic) > 0 {
+		articles.wait()
+	}
+	if !results.full() && scrapeCtx.Err() == nil {
+		name, queued := queueSearchResults(scrapeCtx, articles, topic)
+		if name != "" {
+			sourceNames = append(sourceNames, name)
+		}
+		if queued > 0 {
+			articles.wait()
+		}
+	}
+
+	for _, source := range scrapeSourceChain {
+		if results.full() || scrapeCtx.Err() != nil {
+			break
+		}
+
+		requestCtx := colly.NewContext()
+		requestCtx.Put("source", source.name)
+		err := c.Request("GET", source.url(topic), nil, requestCtx, nil)
+		if err != nil {
+			log.Printf("Skipping scrape source %s: %v", source.name, err)
+			continue
+		}
+		c.Wait()
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, results.pages, err
+	}
+	if scrapeCtx.Err() != nil {
+		log.Printf("Scraping for topic %q reached its deadline after %d pages", topic, results.pages)
+	}
+
+	results.mu.Lock()
+	total := len(results.contents)
+	var contributed []string
+	for _, source := range scrapeSourceChain {
+		sourceNames = append(sourceNames, source.name)
+	}
+	for _, name := range sourceNames {
+		if count := results.bySource[name]; count > 0 {
+			contributed = append(contributed, fmt.Sprintf("%s: %d", name, count))
+		}
+	}
+	results.mu.Unlock()
+	if len(contributed) == 0 {
+		log.Printf("Scraped no articles for topic %q", topic)
+	} else {
+		log.Printf("Scraped %d articles for topic %q (%s)", total, topic, strings.Join(contributed, ", "))
+	}
+
+	contents := filterScrapedContents(results.contents)
+
+	if len(contents) < 5 && getEnvBool("SCRAPE_PLACEHOLDER_CONTENT", false) {
+		contents = append(contents, placeholderContents(topic)...)
+	}
+
+	progress(ProgressEvent{Stage: StageScraping, Pages: results.pages, Sources: len(contents)})
+	return contents, results.pages, nil
+}
+
+// normalizeURL reduces a URL to a canonical form for deduplication: lowercase host,
+// no fragment, no tracking parameters, and no trailing slash
+func normalizeURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.TrimPrefix(strings.ToLower(u.Host), "www.")
+	u.Fragment = ""
+
+	query := u.Query()
+	for key := range query {
+		if strings.HasPrefix(key, "utm_") || key == "ref" || key == "fbclid" || key == "gclid" {
+			query.Del(key)
+		}
+	}
+	u.RawQuery = query.Encode()
+	u.Path = strings.TrimRight(u.Path, "/")
+
+	return u.String()
+}
+
+// textFingerprint hashes the text with case and whitespace differences removed
+func textFingerprint(text string) [sha256.Size]byte {
+	normalized := strings.Join(strings.Fields(strings.ToLower(text)), " ")
+	return sha256.Sum256([]byte(normalized))
+}
+
+// filterScrapedContents collapses entries with the same normalized URL or text, keeping the
+// longest text for each URL, and drops entries whose text is too short to be useful
+func filterScrapedContents(contents []ScrapedContent) []ScrapedContent {
+	minLength := getEnvInt("SCRAPE_MIN_TEXT_LENGTH", defaultScrapeMinTextLength)
+
+	byURL := make(map[string]int)
+	var deduped []ScrapedContent
+	for _, content := range contents {
+		key := normalizeURL(content.URL)
+		if i, ok := byURL[key]; ok {
+			if len(content.Text) > len(deduped[i].Text) {
+				deduped[i] = content
+			}
+			continue
+		}
+		byURL[key] = len(deduped)
+		deduped = append(deduped, content)
+	}
+
+	seenText := make(map[[sha256.Size]byte]bool)
+	filtered := make([]ScrapedContent, 0, len(deduped))
+	for _, content := range deduped {
+		content.Text = strings.TrimSpace(content.Text)
+		if len(content.Text) < minLength {
+			continue
+		}
+		fingerprint := textFingerprint(content.Text)
+		if seenText[fingerprint] {
+			continue
+		}
+		seenText[fingerprint] = true
+		filtered = append(filtered, content)
+	}
+
+	if dropped := len(contents) - len(filtered); dropped > 0 {
+		log.Printf("Dropped %d duplicate or short scraped entries, %d remain", dropped, len(filtered))
+	}
+	return filtered
+}
+
+// placeholderContents returns simulated articles for local development when scraping finds
+// too little. They are only used when SCRAPE_PLACEHOLDER_CONTENT=true.
+func placeholderContents(topic string) []ScrapedContent {
+	return []ScrapedContent{
+		{
+			URL:         "https://example.com/article1",
+			Title:       fmt.Sprintf("Latest developments on %s", topic),
+			Text:        fmt.Sprintf("This is a simulated article about %s. It contains information about the topic that would have been scraped from actual news sources.\n\nExperts have been discussing %s extensively.\n\nFurther research on %s is ongoing.", topic, topic, topic),
+			PublishedAt: time.Now().Format(time.RFC3339),
+			Simulated:   true,
+		},
+		{
+			URL:         "https://example.com/article2",
+			Title:       fmt.Sprintf("Historical context of %s", topic),
+			Text:        fmt.Sprintf("Here's some historical background on %s. This topic has evolved over time.\n\nMany factors have shaped %s today.\n\nCommunities have experienced %s differently.", topic, topic, topic),
+			PublishedAt: time.Now().AddDate(0, 0, -2).Format(time.RFC3339),
+			Simulated:   true,
+		},
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// articleServer serves a feed about solar power and its articles, recording the most
+// article requests that were in flight at once
+type articleServer struct {
+	*httptest.Server
+	mu          sync.Mutex
+	inFlight    int
+	maxInFlight int
+}
+
+func newArticleServer(t *testing.T, articles int) *articleServer {
+	t.Helper()
+	s := &articleServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			http.NotFound(w, r)
+		case "/feed.xml":
+			var items strings.Builder
+			for i := 1; i <= articles; i++ {
+				fmt.Fprintf(&items, "<item><title>Solar power news %d</title><link>%s/article/%d</link></item>", i, s.URL, i)
+			}
+			// The same article again with a tracking parameter, and a copy under another URL
+			fmt.Fprintf(&items, "<item><title>Solar power news 1</title><link>%s/article/1?utm_source=feed</link></item>", s.URL)
+			fmt.Fprintf(&items, "<item><title>Solar power news copy</title><link>%s/copy/2</link></item>", s.URL)
+			fmt.Fprintf(w, `<rss version="2.0"><channel>%s</channel></rss>`, items.String())
+		default:
+			s.mu.Lock()
+			s.inFlight++
+			s.maxInFlight = max(s.maxInFlight, s.inFlight)
+			s.mu.Unlock()
+			defer func() {
+				s.mu.Lock()
+				s.inFlight--
+				s.mu.Unlock()
+			}()
+			time.Sleep(20 * time.Millisecond)
+
+			number := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+			paragraph := fmt.Sprintf("Article %s explains how solar panels turn sunlight into electricity for homes and businesses.", number)
+			fmt.Fprintf(w, `<html><body><article><h1>Solar article %s</h1><p>%s</p><p>%s</p><p>%s</p><a href="/article/%s">again</a></article></body></html>`,
+				number, paragraph, paragraph+" More detail.", paragraph+" Even more detail.", number)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestScrapeContentForTopicConcurrently(t *testing.T) {
+	const articles = 8
+	server := newArticleServer(t, articles)
+
+	t.Setenv("SCRAPE_FEEDS", server.URL+"/feed.xml")
+	t.Setenv("SCRAPE_FEED_MAX_ITEMS", "20")
+	t.Setenv("SCRAPE_PARALLELISM", "2")
+	t.Setenv("SCRAPE_DELAY", "1ms")
+	t.Setenv("SCRAPE_MAX_DEPTH", "2")
+	t.Setenv("SCRAPE_PLACEHOLDER_CONTENT", "false")
+	t.Setenv("SEARCH_PROVIDER", "")
+	previous := appConfig.AllowedDomains
+	appConfig.AllowedDomains = []string{"127.0.0.1"}
+	t.Cleanup(func() { appConfig.AllowedDomains = previous })
+
+	var progressMu sync.Mutex
+	var events int
+	contents, pages, err := scrapeContentForTopic(context.Background(), "solar power", func(ProgressEvent) {
+		progressMu.Lock()
+		events++
+		progressMu.Unlock()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if server.maxInFlight > 2 {
+		t.Errorf("%d requests were in flight at once, want at most SCRAPE_PARALLELISM=2", server.maxInFlight)
+	}
+	if pages < articles {
+		t.Errorf("fetched %d pages, want at least %d", pages, articles)
+	}
+	if events == 0 {
+		t.Error("no progress was reported")
+	}
+
+	seenURLs := make(map[string]bool)
+	seenTexts := make(map[string]bool)
+	for _, content := range contents {
+		key := normalizeURL(content.URL)
+		if seenURLs[key] {
+			t.Errorf("%s was returned twice", content.URL)
+		}
+		seenURLs[key] = true
+		if seenTexts[content.Text] {
+			t.Errorf("%s repeats the text of another article", content.URL)
+		}
+		seenTexts[content.Text] = true
+	}
+	if len(contents) != articles {
+		t.Errorf("got %d contents, want %d", len(contents), articles)
+	}
+}
+
+func TestScrapeFeedsKeepsURLCase(t *testing.T) {
+	t.Setenv("SCRAPE_FEEDS", " https://News.Example.COM/Feeds/World.xml?Token=AbC ,, https://blog.example.com/RSS ")
+	want := []string{"https://news.example.com/Feeds/World.xml?Token=AbC", "https://blog.example.com/RSS"}
+	if got := scrapeFeeds(); !reflect.DeepEqual(got, want) {
+		t.Errorf("scrapeFeeds() = %q, want %q", got, want)
+	}
+}
+
+// scrapeFeedOutsideAllowlist scrapes the article server's feed with only example.com allowed
+func scrapeFeedOutsideAllowlist(t *testing.T, server *articleServer) []ScrapedContent {
+	t.Helper()
+	t.Setenv("SCRAPE_FEEDS", server.URL+"/feed.xml")
+	t.Setenv("SCRAPE_FEED_MAX_ITEMS", "20")
+	t.Setenv("SCRAPE_DELAY", "1ms")
+	t.Setenv("SCRAPE_RETRY_ATTEMPTS", "1")
+	t.Setenv("SCRAPE_PLACEHOLDER_CONTENT", "false")
+	t.Setenv("SEARCH_PROVIDER", "")
+	previous := appConfig.AllowedDomains
+	appConfig.AllowedDomains = []string{"example.com"}
+	t.Cleanup(func() { appConfig.AllowedDomains = previous })
+
+	contents, _, err := scrapeContentForTopic(context.Background(), "solar power", func(ProgressEvent) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return contents
+}
+
+func TestScrapeFeedArticlesOutsideAllowedDomains(t *testing.T) {
+	const articles = 4
+	server := newArticleServer(t, articles)
+	// The test server is on a loopback address, which the external transport refuses
+	previous := externalArticleTransport
+	externalArticleTransport = http.DefaultTransport
+	t.Cleanup(func() { externalArticleTransport = previous })
+
+	if contents := scrapeFeedOutsideAllowlist(t, server); len(contents) != articles {
+		t.Errorf("scraped %d articles from outside the allowed domains, want %d", len(contents), articles)
+	}
+}
+
+func TestScrapeRefusesPrivateArticlesOutsideAllowedDomains(t *testing.T) {
+	server := newArticleServer(t, 4)
+	if contents := scrapeFeedOutsideAllowlist(t, server); len(contents) != 0 {
+		t.Errorf("scraped %d articles from a loopback address, want none", len(contents))
+	}
+	if server.maxInFlight != 0 {
+		t.Error("an article was requested from a loopback address")
+	}
+}
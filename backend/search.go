@@ -0,0 +1,438 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/keyword"
+	"github.com/blevesearch/bleve/v2/analysis/lang/en"
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+// Field boosts used when ranking search results, so title hits rank above body hits
+const (
+	titleWeight   = 3.0
+	tagWeight     = 2.0
+	summaryWeight = 1.5
+	bodyWeight    = 1.0
+)
+
+// maxSearchFragments bounds how many highlighted snippets are returned per field
+const maxSearchFragments = 3
+
+// searchIndexVersion is stored in the index under searchIndexVersionKey and bumped when
+// the indexed fields change, so that indexes built with other fields are recreated
+const (
+	searchIndexVersion    = "4"
+	searchIndexVersionKey = "version"
+)
+
+// searchDocument is what gets indexed for each blog
+type searchDocument struct {
+	Title   string `json:"title"`
+	Tags    string `json:"tags"`
+	Summary string `json:"summary"`
+	Body    string `json:"body"`
+	// TagKeys holds the lowercased tags, indexed whole for exact tag filtering
+	TagKeys []string `json:"tagKeys"`
+	// OwnerID is indexed whole so that users only find their own blogs
+	OwnerID string `json:"ownerId"`
+	// Status is the blog's workflow status, indexed whole so searches find published blogs
+	Status string `json:"status"`
+	// Language is the blog's lowercased language tag, indexed whole for language filtering
+	Language string `json:"language"`
+	// Topic is the blog's lowercased topic, indexed whole for topic filtering
+	Topic string `json:"topic"`
+	// Date is the blog's YYYY-MM-DD date, indexed whole for date ranges
+	Date string `json:"date"`
+	// Simulated is set for blogs generated from placeholder content
+	Simulated bool `json:"simulated"`
+}
+
+// SearchIndex is a Bleve full-text index of the stored blogs
+type SearchIndex struct {
+	mu    sync.RWMutex
+	index bleve.Index
+}
+
+// SearchResult represents a single ranked search hit
+type SearchResult struct {
+	ID      string   `json:"id"`
+	Title   string   `json:"title"`
+	Summary string   `json:"summary"`
+	Tags    []string `json:"tags"`
+	Date    string   `json:"date"`
+	Score   float64  `json:"score"`
+	// Highlights maps a field (title, summary or body) to snippets with the matches in <mark> tags
+	Highlights map[string][]string `json:"highlights,omitempty"`
+}
+
+// SearchResponse is a page of search results along with the total number of matches
+type SearchResponse struct {
+	Results []SearchResult `json:"results"`
+	Total   int            `json:"total"`
+	Page    int            `json:"page"`
+	Limit   int            `json:"limit"`
+}
+
+// searchIndex starts out in memory; initSearchIndex replaces it with the configured index
+var searchIndex = mustNewMemSearchIndex()
+
+// newSearchMapping analyzes text fields as English, so searches match other word forms,
+// and indexes the filter fields whole
+func newSearchMapping() *mapping.IndexMappingImpl {
+	indexMapping := bleve.NewIndexMapping()
+	indexMapping.DefaultAnalyzer = en.AnalyzerName
+
+	exact := bleve.NewTextFieldMapping()
+	exact.Analyzer = keyword.Name
+	exact.Store = false
+	exact.IncludeTermVectors = false
+	indexMapping.DefaultMapping.AddFieldMappingsAt("tagKeys", exact)
+	indexMapping.DefaultMapping.AddFieldMappingsAt("ownerId", exact)
+	indexMapping.DefaultMapping.AddFieldMappingsAt("status", exact)
+	indexMapping.DefaultMapping.AddFieldMappingsAt("language", exact)
+	indexMapping.DefaultMapping.AddFieldMappingsAt("topic", exact)
+	indexMapping.DefaultMapping.AddFieldMappingsAt("date", exact)
+	flag := bleve.NewBooleanFieldMapping()
+	flag.Store = false
+	indexMapping.DefaultMapping.AddFieldMappingsAt("simulated", flag)
+	return indexMapping
+}
+
+func mustNewMemSearchIndex() *SearchIndex {
+	index, err := bleve.NewMemOnly(newSearchMapping())
+	if err != nil {
+		panic(err)
+	}
+	return &SearchIndex{index: index}
+}
+
+// openSearchIndex opens the index at path, creating it if it doesn't exist or was built
+// for another searchIndexVersion. An empty path keeps the index in memory. created reports
+// whether the index is new and needs filling.
+func openSearchIndex(path string) (idx *SearchIndex, created bool, err error) {
+	if path == "" {
+		return mustNewMemSearchIndex(), true, nil
+	}
+
+	index, err := bleve.Open(path)
+	if err == nil {
+		version, versionErr := index.GetInternal([]byte(searchIndexVersionKey))
+		if versionErr == nil && string(version) == searchIndexVersion {
+			return &SearchIndex{index: index}, false, nil
+		}
+		log.Printf("Search index at %s was built by another version, recreating it", path)
+		index.Close()
+		if err := os.RemoveAll(path); err != nil {
+			return nil, false, err
+		}
+		err = bleve.ErrorIndexPathDoesNotExist
+	}
+	if !errors.Is(err, bleve.ErrorIndexPathDoesNotExist) {
+		return nil, false, err
+	}
+
+	index, err = bleve.New(path, newSearchMapping())
+	if err != nil {
+		return nil, false, err
+	}
+	if err := index.SetInternal([]byte(searchIndexVersionKey), []byte(searchIndexVersion)); err != nil {
+		index.Close()
+		return nil, false, err
+	}
+	return &SearchIndex{index: index}, true, nil
+}
+
+// tokenize lowercases text and splits it into alphanumeric terms
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// newSearchDocument extracts the searchable text of a blog
+func newSearchDocument(blog BlogPost) searchDocument {
+	var body []string
+	for _, block := range blog.Content {
+		if block.Type == "paragraph" || block.Type == "heading" {
+			body = append(body, block.Text)
+		}
+	}
+
+	tagKeys := make([]string, 0, len(blog.Tags))
+	for _, tag := range blog.Tags {
+		tagKeys = append(tagKeys, strings.ToLower(tag))
+	}
+
+	return searchDocument{
+		Title:     blog.Title,
+		Tags:      strings.Join(blog.Tags, ", "),
+		Summary:   blog.Summary,
+		Body:      strings.Join(body, "\n\n"),
+		TagKeys:   tagKeys,
+		OwnerID:   blog.OwnerID,
+		Status:    blogStatus(blog),
+		Language:  strings.ToLower(blogLanguage(blog)),
+		Topic:     strings.ToLower(blog.Topic),
+		Date:      blog.Date,
+		Simulated: blog.Simulated,
+	}
+}
+
+// Add indexes the blog, replacing any previous entry with the same ID
+func (idx *SearchIndex) Add(blog BlogPost) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	if err := idx.index.Index(blog.ID, newSearchDocument(blog)); err != nil {
+		log.Printf("Failed to index blog %s: %v", blog.ID, err)
+	}
+}
+
+// Remove drops the blog from the index
+func (idx *SearchIndex) Remove(id string) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	if err := idx.index.Delete(id); err != nil {
+		log.Printf("Failed to remove blog %s from the search index: %v", id, err)
+	}
+}
+
+// Search returns the page of blogs containing every term of the query, highest score first,
+// with highlighted snippets. A non-empty tag restricts the results to blogs with that tag,
+// and the filters in opts apply as they do to listings: opts.OwnerID to the blogs of that
+// user, opts.Status to the blogs in that status, opts.Language to the blogs in that
+// language or one of its regional variants, opts.Topic to the blogs whose topic contains
+// it, opts.From and opts.To to the blogs dated between them, and opts.ExcludeSimulated
+// leaves out the blogs generated from placeholder content.
+func (idx *SearchIndex) Search(text, tag string, opts ListOptions) (*bleve.SearchResult, error) {
+	var terms []query.Query
+	for _, term := range tokenize(text) {
+		fields := []struct {
+			name  string
+			boost float64
+		}{{"title", titleWeight}, {"tags", tagWeight}, {"summary", summaryWeight}, {"body", bodyWeight}}
+
+		var matches []query.Query
+		for _, field := range fields {
+			match := bleve.NewMatchQuery(term)
+			match.SetField(field.name)
+			match.SetBoost(field.boost)
+			matches = append(matches, match)
+		}
+		terms = append(terms, bleve.NewDisjunctionQuery(matches...))
+	}
+	if tag != "" {
+		tagQuery := bleve.NewTermQuery(strings.ToLower(tag))
+		tagQuery.SetField("tagKeys")
+		terms = append(terms, tagQuery)
+	}
+	if opts.OwnerID != "" {
+		ownerQuery := bleve.NewTermQuery(opts.OwnerID)
+		ownerQuery.SetField("ownerId")
+		terms = append(terms, ownerQuery)
+	}
+	if opts.Status != "" {
+		statusQuery := bleve.NewTermQuery(opts.Status)
+		statusQuery.SetField("status")
+		terms = append(terms, statusQuery)
+	}
+	if opts.Language != "" {
+		language := strings.ToLower(opts.Language)
+		languageQuery := bleve.NewTermQuery(language)
+		languageQuery.SetField("language")
+		variantQuery := bleve.NewPrefixQuery(language + "-")
+		variantQuery.SetField("language")
+		terms = append(terms, bleve.NewDisjunctionQuery(languageQuery, variantQuery))
+	}
+	if opts.Topic != "" {
+		topicQuery := bleve.NewRegexpQuery(".*" + regexp.QuoteMeta(strings.ToLower(opts.Topic)) + ".*")
+		topicQuery.SetField("topic")
+		terms = append(terms, topicQuery)
+	}
+	if opts.From != "" || opts.To != "" {
+		inclusive := true
+		dateQuery := bleve.NewTermRangeInclusiveQuery(opts.From, opts.To, &inclusive, &inclusive)
+		dateQuery.SetField("date")
+		terms = append(terms, dateQuery)
+	}
+	if opts.ExcludeSimulated {
+		simulatedQuery := bleve.NewBoolFieldQuery(false)
+		simulatedQuery.SetField("simulated")
+		terms = append(terms, simulatedQuery)
+	}
+
+	// Pages are bounded as parsePage bounds them, so that the offset can't overflow
+	from := (min(max(opts.Page, 1), maxPage) - 1) * min(opts.Limit, maxPageLimit)
+	request := bleve.NewSearchRequestOptions(bleve.NewConjunctionQuery(terms...), opts.Limit, from, false)
+	request.Highlight = bleve.NewHighlightWithStyle("html")
+	request.Highlight.Fields = []string{"title", "summary", "body"}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.index.Search(request)
+}
+
+// Rebuild replaces the index contents with the given blogs
+func (idx *SearchIndex) Rebuild(blogs []BlogPost) error {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	keep := make(map[string]bool, len(blogs))
+	batch := idx.index.NewBatch()
+	for _, blog := range blogs {
+		keep[blog.ID] = true
+		if err := batch.Index(blog.ID, newSearchDocument(blog)); err != nil {
+			return err
+		}
+	}
+
+	// Drop blogs that are no longer stored
+	count, err := idx.index.DocCount()
+	if err != nil {
+		return err
+	}
+	all, err := idx.index.Search(bleve.NewSearchRequestOptions(bleve.NewMatchAllQuery(), int(count), 0, false))
+	if err != nil {
+		return err
+	}
+	for _, hit := range all.Hits {
+		if !keep[hit.ID] {
+			batch.Delete(hit.ID)
+		}
+	}
+
+	return idx.index.Batch(batch)
+}
+
+// DocCount returns the number of indexed blogs
+func (idx *SearchIndex) DocCount() (uint64, error) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.index.DocCount()
+}
+
+// initSearchIndex opens the index at SEARCH_INDEX_PATH, or keeps it in memory when unset,
+// and fills it from storage unless a previously built index was found
+func initSearchIndex() {
+	path := getEnv("SEARCH_INDEX_PATH", "")
+	idx, created, err := openSearchIndex(path)
+	if err != nil {
+		log.Printf("Failed to open search index at %s, keeping it in memory: %v", path, err)
+		idx, created = mustNewMemSearchIndex(), true
+	}
+
+	searchIndex.mu.Lock()
+	old := searchIndex.index
+	searchIndex.index = idx.index
+	searchIndex.mu.Unlock()
+	old.Close()
+
+	if !created {
+		log.Printf("Loaded search index from %s", path)
+		return
+	}
+	if err := reindexBlogs(); err != nil {
+		log.Printf("Failed to build search index: %v", err)
+	}
+}
+
+// reindexBlogs rebuilds the search index from every stored blog
+func reindexBlogs() error {
+	blogs, err := getAllBlogs()
+	if err != nil {
+		return err
+	}
+	return searchIndex.Rebuild(blogs)
+}
+
+func searchBlogsHandler(w http.ResponseWriter, r *http.Request) {
+	text := strings.TrimSpace(r.URL.Query().Get("q"))
+	if len(tokenize(text)) == 0 {
+		http.Error(w, "Query parameter q is required", http.StatusBadRequest)
+		return
+	}
+
+	opts, err := parseListOptions(r)
+	if errors.Is(err, errUnpublishedListing) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	tag := strings.TrimSpace(r.URL.Query().Get("tag"))
+
+	found, err := searchIndex.Search(text, tag, opts)
+	if err != nil {
+		http.Error(w, "Failed to search blogs: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	results := []SearchResult{}
+	for _, hit := range found.Hits {
+		blog, err := getBlogByID(hit.ID)
+		if err != nil {
+			log.Printf("Search index references unreadable blog %s: %v", hit.ID, err)
+			continue
+		}
+		results = append(results, SearchResult{
+			ID:         blog.ID,
+			Title:      blog.Title,
+			Summary:    blog.Summary,
+			Tags:       blog.Tags,
+			Date:       blog.Date,
+			Score:      hit.Score,
+			Highlights: highlights(hit.Fragments),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SearchResponse{
+		Results: results,
+		Total:   int(found.Total),
+		Page:    opts.Page,
+		Limit:   opts.Limit,
+	})
+}
+
+// highlights keeps at most maxSearchFragments snippets per field
+func highlights(fragments map[string][]string) map[string][]string {
+	if len(fragments) == 0 {
+		return nil
+	}
+	trimmed := make(map[string][]string, len(fragments))
+	for field, snippets := range fragments {
+		trimmed[field] = snippets[:min(len(snippets), maxSearchFragments)]
+	}
+	return trimmed
+}
+
+func reindexHandler(w http.ResponseWriter, r *http.Request) {
+	err := reindexBlogs()
+	if err != nil {
+		http.Error(w, "Failed to rebuild search index: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	count, err := searchIndex.DocCount()
+	if err != nil {
+		http.Error(w, "Failed to count indexed blogs: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]uint64{"blogs": count})
+}
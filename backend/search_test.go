@@ -0,0 +1,169 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// searchTestBlogs are indexed by newTestSearchIndex
+var searchTestBlogs = []BlogPost{
+	{ID: "title", Title: "Solar energy explained", Summary: "An overview", Tags: []string{"Energy"}, Status: StatusPublished,
+		Topic: "Solar power", Date: "2024-03-01",
+		Content: []BlogContent{{Type: "paragraph", Text: "Panels on roofs."}}},
+	{ID: "body", Title: "Renewables", Summary: "Wind and water", Tags: []string{"Climate"}, Status: StatusPublished,
+		Topic: "renewable energy", Date: "2024-04-15", Simulated: true,
+		Content: []BlogContent{{Type: "paragraph", Text: "Solar farms and solar energy storage are growing."}}},
+	{ID: "draft", Title: "Solar energy draft", Summary: "Unfinished", Tags: []string{"energy"}, Status: StatusDraft, OwnerID: "alice",
+		Topic: "energy (draft)", Date: "2024-05-01",
+		Content: []BlogContent{{Type: "paragraph", Text: "Work in progress."}}},
+	{ID: "german", Title: "Solarenergie und solar energy", Summary: "Auf Deutsch", GenerationOptions: GenerationOptions{Language: "de-AT"}, Status: StatusPublished,
+		Topic: "Solarenergie", Date: "2024-06-01",
+		Content: []BlogContent{{Type: "paragraph", Text: "Sonnenkraft."}}},
+	{ID: "image", Title: "Wind turbines", Summary: "Blades", Status: StatusPublished,
+		Content: []BlogContent{{Type: "image", URL: "https://images.example.com/solar.png", Alt: "solar"}}},
+}
+
+func newTestSearchIndex(t *testing.T) *SearchIndex {
+	t.Helper()
+	idx := mustNewMemSearchIndex()
+	t.Cleanup(func() { idx.index.Close() })
+	for _, blog := range searchTestBlogs {
+		idx.Add(blog)
+	}
+	return idx
+}
+
+// searchIDs returns the IDs of the hits in order
+func searchIDs(t *testing.T, idx *SearchIndex, text, tag string, opts ListOptions) []string {
+	t.Helper()
+	if opts.Limit == 0 {
+		opts.Limit = 10
+	}
+	if opts.Page == 0 {
+		opts.Page = 1
+	}
+	found, err := idx.Search(text, tag, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, hit := range found.Hits {
+		ids = append(ids, hit.ID)
+	}
+	return ids
+}
+
+func TestSearchIndexFilters(t *testing.T) {
+	idx := newTestSearchIndex(t)
+
+	tests := []struct {
+		name string
+		text string
+		tag  string
+		opts ListOptions
+		want []string
+	}{
+		{name: "every term must match", text: "solar storage", want: []string{"body"}},
+		{name: "other word forms match", text: "panel", want: []string{"title"}},
+		{name: "no match", text: "nuclear", want: nil},
+		{name: "images aren't searched", text: "blades solar", want: nil},
+		{name: "tag is exact and case-insensitive", text: "solar", tag: "ENERGY", want: []string{"draft", "title"}},
+		{name: "status", text: "solar", opts: ListOptions{Status: StatusDraft}, want: []string{"draft"}},
+		{name: "owner", text: "solar", opts: ListOptions{OwnerID: "alice"}, want: []string{"draft"}},
+		{name: "language matches regional variants", text: "solar", opts: ListOptions{Language: "de"}, want: []string{"german"}},
+		{name: "regional language", text: "solar", opts: ListOptions{Language: "de-AT"}, want: []string{"german"}},
+		{name: "other region", text: "solar", opts: ListOptions{Language: "de-CH"}, want: nil},
+		{name: "topic contains the text", text: "solar", opts: ListOptions{Topic: "solar"}, want: []string{"german", "title"}},
+		{name: "topic ignores case", text: "solar", opts: ListOptions{Topic: "POWER"}, want: []string{"title"}},
+		{name: "topic with regexp characters", text: "solar", opts: ListOptions{Topic: "(draft)"}, want: []string{"draft"}},
+		{name: "simulated excluded", text: "solar", opts: ListOptions{ExcludeSimulated: true}, want: []string{"draft", "german", "title"}},
+		{name: "from date", text: "solar", opts: ListOptions{From: "2024-04-15"}, want: []string{"body", "draft", "german"}},
+		{name: "to date", text: "solar", opts: ListOptions{To: "2024-04-15"}, want: []string{"body", "title"}},
+		{name: "single day", text: "solar", opts: ListOptions{From: "2024-05-01", To: "2024-05-01"}, want: []string{"draft"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := searchIDs(t, idx, tt.text, tt.tag, tt.opts)
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchIndexRanksTitleAboveBody(t *testing.T) {
+	idx := newTestSearchIndex(t)
+
+	got := searchIDs(t, idx, "solar energy", "", ListOptions{Status: StatusPublished, Language: "en"})
+	if len(got) != 2 || got[0] != "title" || got[1] != "body" {
+		t.Errorf("got %v, want the title match before the body match", got)
+	}
+}
+
+func TestSearchIndexPagesAndHighlights(t *testing.T) {
+	idx := newTestSearchIndex(t)
+
+	first := searchIDs(t, idx, "solar", "", ListOptions{Page: 1, Limit: 2})
+	second := searchIDs(t, idx, "solar", "", ListOptions{Page: 2, Limit: 2})
+	if len(first) != 2 || len(second) != 2 || slices.ContainsFunc(second, func(id string) bool { return slices.Contains(first, id) }) {
+		t.Errorf("pages %v and %v, want two distinct pages of two", first, second)
+	}
+
+	found, err := idx.Search("storage", "", ListOptions{Page: 1, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.Total != 1 {
+		t.Fatalf("total = %d, want 1", found.Total)
+	}
+	snippets := highlights(found.Hits[0].Fragments)["body"]
+	if len(snippets) == 0 || !strings.Contains(snippets[0], "<mark>storage</mark>") {
+		t.Errorf("body highlights = %v, want the match in <mark> tags", snippets)
+	}
+}
+
+func TestSearchPageBounds(t *testing.T) {
+	idx := newTestSearchIndex(t)
+	for _, page := range []int{0, maxPage} {
+		if ids := searchIDs(t, idx, "solar", "", ListOptions{Page: page, Limit: maxPageLimit}); page == maxPage && len(ids) != 0 {
+			t.Errorf("page %d: hits %v, want none", page, ids)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	searchBlogsHandler(rec, httptest.NewRequest("GET", "/api/search?q=solar&page=922337203685477582", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("overflowing page: status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestSearchIndexRemoveAndRebuild(t *testing.T) {
+	idx := newTestSearchIndex(t)
+
+	idx.Remove("body")
+	if got := searchIDs(t, idx, "storage", "", ListOptions{}); len(got) != 0 {
+		t.Errorf("removed blog still found: %v", got)
+	}
+
+	if err := idx.Rebuild(searchTestBlogs[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if count, _ := idx.DocCount(); count != 1 {
+		t.Errorf("%d blogs indexed after rebuilding with one", count)
+	}
+	if got := searchIDs(t, idx, "solar", "", ListOptions{}); !slices.Equal(got, []string{"title"}) {
+		t.Errorf("got %v after rebuilding, want [title]", got)
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	got := tokenize("  Go's  GENERICS, in 2024!")
+	want := []string{"go", "s", "generics", "in", "2024"}
+	if !slices.Equal(got, want) {
+		t.Errorf("tokenize = %v, want %v", got, want)
+	}
+}
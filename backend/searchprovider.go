@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// defaultSearchMaxResults is how many article URLs are requested from the search provider,
+// overridable with SEARCH_MAX_RESULTS
+const defaultSearchMaxResults = 20
+
+// SearchProvider finds articles about a topic with a search API
+type SearchProvider interface {
+	// Name is the name the provider's articles are counted under
+	Name() string
+	// Search returns the URLs of up to count articles about the topic, best first
+	Search(ctx context.Context, topic string, count int) ([]string, error)
+	// Ready reports why the provider can't be used, such as a missing API key
+	Ready() error
+}
+
+// searchProviders are the providers SEARCH_PROVIDER may select
+var searchProviders = map[string]SearchProvider{
+	"brave":   braveSearch{},
+	"serpapi": serpAPISearch{},
+}
+
+// errUnknownSearchProvider is returned when SEARCH_PROVIDER names no search provider
+var errUnknownSearchProvider = errors.New("unknown SEARCH_PROVIDER")
+
+// selectedSearchProvider returns the search provider named by SEARCH_PROVIDER, or nil if
+// none is configured and the scraper only crawls search pages
+func selectedSearchProvider() (SearchProvider, error) {
+	name := getEnv("SEARCH_PROVIDER", "")
+	if name == "" {
+		return nil, nil
+	}
+	provider, ok := searchProviders[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q, expected one of %s", errUnknownSearchProvider, name, strings.Join(slices.Sorted(maps.Keys(searchProviders)), ", "))
+	}
+	return provider, nil
+}
+
+// searchGet sends a GET request to a search API and decodes its JSON response into out
+func searchGet(ctx context.Context, endpoint string, query url.Values, headers map[string]string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint+"?"+query.Encode(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	return doJSONRequest(req, out)
+}
+
+// braveSearch searches with the Brave News Search API
+type braveSearch struct{}
+
+func (braveSearch) Name() string { return "Brave Search API" }
+
+func (braveSearch) Ready() error {
+	_, err := requireEnv("BRAVE_SEARCH_API_KEY")
+	return err
+}
+
+func (braveSearch) Search(ctx context.Context, topic string, count int) ([]string, error) {
+	apiKey, err := requireEnv("BRAVE_SEARCH_API_KEY")
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Results []struct {
+			URL string `json:"url"`
+		} `json:"results"`
+	}
+	endpoint := getEnv("BRAVE_SEARCH_ENDPOINT", "https://api.search.brave.com/res/v1/news/search")
+	// Brave returns at most 50 news results per request
+	query := url.Values{"q": {topic}, "count": {fmt.Sprint(min(count, 50))}}
+	if err := searchGet(ctx, endpoint, query, map[string]string{"X-Subscription-Token": apiKey}, &result); err != nil {
+		return nil, fmt.Errorf("Brave search failed: %w", err)
+	}
+	urls := make([]string, 0, len(result.Results))
+	for _, article := range result.Results {
+		urls = append(urls, article.URL)
+	}
+	return urls, nil
+}
+
+// serpAPISearch searches Google News through SerpApi
+type serpAPISearch struct{}
+
+func (serpAPISearch) Name() string { return "SerpApi" }
+
+func (serpAPISearch) Ready() error {
+	_, err := requireEnv("SERPAPI_API_KEY")
+	return err
+}
+
+func (serpAPISearch) Search(ctx context.Context, topic string, count int) ([]string, error) {
+	apiKey, err := requireEnv("SERPAPI_API_KEY")
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		NewsResults []struct {
+			Link string `json:"link"`
+		} `json:"news_results"`
+	}
+	endpoint := getEnv("SERPAPI_ENDPOINT", "https://serpapi.com/search.json")
+	query := url.Values{"engine": {"google_news"}, "q": {topic}, "api_key": {apiKey}}
+	if err := searchGet(ctx, endpoint, query, nil, &result); err != nil {
+		return nil, fmt.Errorf("SerpApi search failed: %w", err)
+	}
+	urls := make([]string, 0, len(result.NewsResults))
+	for _, article := range result.NewsResults {
+		if article.Link != "" && len(urls) < count {
+			urls = append(urls, article.Link)
+		}
+	}
+	return urls, nil
+}
+
+// articleCollectors fetch the articles found by feeds and search providers: crawl those
+// within the scraper's allowed domains, following their links, and external the others
+type articleCollectors struct {
+	crawl    *colly.Collector
+	external *colly.Collector
+}
+
+// queue queues the article URLs on the collector for their host, counting the contents
+// found from them under source, and returns how many were queued. URLs that aren't http(s)
+// are skipped.
+func (a articleCollectors) queue(urls []string, source string) int {
+	queued := 0
+	for _, articleURL := range urls {
+		u, err := url.Parse(articleURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+			continue
+		}
+		c := a.external
+		if hostAllowed(u.Hostname(), a.crawl.AllowedDomains) {
+			c = a.crawl
+		}
+		requestCtx := colly.NewContext()
+		requestCtx.Put("source", source)
+		if err := c.Request("GET", articleURL, nil, requestCtx, nil); err != nil {
+			continue
+		}
+		queued++
+	}
+	return queued
+}
+
+// wait waits for both collectors to finish their requests
+func (a articleCollectors) wait() {
+	a.crawl.Wait()
+	a.external.Wait()
+}
+
+// queueSearchResults queues the articles the search provider selected by SEARCH_PROVIDER
+// finds for the topic, returning the provider's name and how many were queued. Without a
+// provider, or if the search fails, nothing is queued.
+func queueSearchResults(ctx context.Context, articles articleCollectors, topic string) (string, int) {
+	provider, err := selectedSearchProvider()
+	if err != nil {
+		log.Printf("Skipping search API: %v", err)
+		return "", 0
+	}
+	if provider == nil {
+		return "", 0
+	}
+	urls, err := provider.Search(ctx, topic, max(getEnvInt("SEARCH_MAX_RESULTS", defaultSearchMaxResults), 1))
+	if err != nil {
+		log.Printf("Skipping %s: %v", provider.Name(), err)
+		return provider.Name(), 0
+	}
+	return provider.Name(), articles.queue(urls, provider.Name())
+}
+
+// checkSearchProvider verifies that the search provider selected by SEARCH_PROVIDER, if
+// any, can be used
+func checkSearchProvider() error {
+	provider, err := selectedSearchProvider()
+	if err != nil || provider == nil {
+		return err
+	}
+	return provider.Ready()
+}
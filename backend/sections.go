@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// maxSectionInstructionLength bounds the instruction sent with a section rewrite
+const maxSectionInstructionLength = 500
+
+// Errors returned when rewriting a section of a blog
+var (
+	errInvalidSection = errors.New("invalid section")
+	errSectionChanged = errors.New("the section was edited while it was being rewritten")
+)
+
+// sectionSystemPrompt describes the JSON format a rewritten section must have
+const sectionSystemPrompt = `You are an editor rewriting one section of a blog post.
+Rewrite only the blocks you are given, keeping the facts, the order of ideas and the style of the rest of the post unless the instruction says otherwise.
+Respond with a JSON object with "content", the list of blocks replacing the section.
+Each block has a "type" of "heading" (with "text" and a "level" of 1 or 2), "paragraph" (with "text") or "image" (with "url", "alt" and "caption").
+Copy image blocks unchanged, keeping their "url".
+Paragraphs have "sources", the list of {"url", "title"} source articles their facts come from; keep the sources of the facts you keep.`
+
+// SectionRewrite selects the content blocks to rewrite, either one block by Index or the
+// blocks from Start to End inclusive, with an optional instruction for the model
+type SectionRewrite struct {
+	Index       *int   `json:"index"`
+	Start       *int   `json:"start"`
+	End         *int   `json:"end"`
+	Instruction string `json:"instruction"`
+}
+
+// bounds returns the range of blocks selected in content as a slice range
+func (s SectionRewrite) bounds(content []BlogContent) (int, int, error) {
+	var start, end int
+	switch {
+	case s.Index != nil && s.Start == nil && s.End == nil:
+		start, end = *s.Index, *s.Index
+	case s.Index == nil && s.Start != nil && s.End != nil:
+		start, end = *s.Start, *s.End
+	default:
+		return 0, 0, fmt.Errorf("%w: give either index or both start and end", errInvalidSection)
+	}
+	if start < 0 || end < start || end >= len(content) {
+		return 0, 0, fmt.Errorf("%w: blocks %d-%d are out of range, the blog has %d blocks", errInvalidSection, start, end, len(content))
+	}
+	return start, end + 1, nil
+}
+
+// sectionPrompt asks for the blocks to be rewritten, giving the blog's title, topic and
+// style as context
+func sectionPrompt(blog BlogPost, blocks []BlogContent, instruction string) (string, error) {
+	section, err := json.MarshalIndent(blocks, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	var prompt strings.Builder
+	fmt.Fprintf(&prompt, "The blog post is titled %q and is about %q.\n", blog.Title, blog.Topic)
+	prompt.WriteString(blog.stylePrompt())
+	if instruction != "" {
+		fmt.Fprintf(&prompt, "Rewrite the section following this instruction: %s\n", instruction)
+	} else {
+		prompt.WriteString("Rewrite the section so it reads better.\n")
+	}
+	fmt.Fprintf(&prompt, "\nThe section's blocks:\n%s\n", section)
+	return prompt.String(), nil
+}
+
+// rewriteSection runs the blocks through the model, returning the blocks to replace them
+// with. Images can be kept or dropped but not added.
+func rewriteSection(ctx context.Context, completer Completer, blog BlogPost, blocks []BlogContent, instruction string) ([]BlogContent, error) {
+	prompt, err := sectionPrompt(blog, blocks, instruction)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, getEnvDuration("GENERATION_TIMEOUT", defaultGenerationTimeout))
+	defer cancel()
+	text, usage, err := completer.Complete(ctx, sectionSystemPrompt, prompt)
+	recordUsage(ctx, 1, usage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rewrite section: %w", err)
+	}
+
+	var response struct {
+		Content []BlogContent `json:"content"`
+	}
+	if err := decodeModelJSON(text, &response); err != nil {
+		return nil, fmt.Errorf("%w: section is not valid JSON: %v", errInvalidLlamaResponse, err)
+	}
+	if len(response.Content) == 0 {
+		return nil, fmt.Errorf("%w: the rewritten section has no blocks", errInvalidLlamaResponse)
+	}
+	attributeSources(response.Content, blog.Sources)
+	for i, block := range response.Content {
+		if block.Type == "heading" && block.Level == 0 {
+			response.Content[i].Level = 1
+		}
+		if err := validateBlock(response.Content[i]); err != nil {
+			return nil, fmt.Errorf("%w: block %d: %v", errInvalidLlamaResponse, i, err)
+		}
+		if block.Type == "image" && !slices.ContainsFunc(blocks, func(original BlogContent) bool { return original.URL == block.URL }) {
+			return nil, fmt.Errorf("%w: block %d is an image that wasn't in the section", errInvalidLlamaResponse, i)
+		}
+	}
+	return response.Content, nil
+}
+
+// regenerateSectionHandler rewrites the blocks selected by a SectionRewrite with the
+// model and splices the result into the blog's content, returning the updated blog
+func regenerateSectionHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	var rewrite SectionRewrite
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&rewrite); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	rewrite.Instruction = strings.TrimSpace(rewrite.Instruction)
+	if len(rewrite.Instruction) > maxSectionInstructionLength {
+		http.Error(w, fmt.Sprintf("The instruction can have at most %d characters", maxSectionInstructionLength), http.StatusBadRequest)
+		return
+	}
+
+	existing, err := getBlogByID(id)
+	if errors.Is(err, errInvalidBlogID) {
+		http.Error(w, "Invalid blog ID", http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, errBlogNotFound) {
+		http.Error(w, "Blog not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to load blog: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !canManageBlog(r, existing) {
+		http.Error(w, errNotBlogOwner.Error(), http.StatusForbidden)
+		return
+	}
+	completer, err := selectedCompleter()
+	if errors.Is(err, errCompletionUnsupported) {
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	start, end, err := rewrite.bounds(existing.Content)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	section := existing.Content[start:end]
+
+	blog, err := trackGeneration(r.Context(), existing, func(ctx context.Context) (BlogPost, error) {
+		blocks, err := rewriteSection(ctx, completer, existing, section, rewrite.Instruction)
+		if err != nil {
+			return BlogPost{}, err
+		}
+		return updateBlogPost(id, func(blog *BlogPost) error {
+			// The blog may have been edited while the model was writing
+			if end > len(blog.Content) || !reflect.DeepEqual(blog.Content[start:end], section) {
+				return errSectionChanged
+			}
+			blog.Content = append(append(append([]BlogContent{}, blog.Content[:start]...), blocks...), blog.Content[end:]...)
+			blog.ReadingTime = estimateReadingTime(blog.Content)
+			blog.LengthMismatch = checkLength(blog.Content, blog.Length) != nil
+			return nil
+		})
+	})
+	if errors.Is(err, errBlogNotFound) {
+		http.Error(w, "Blog not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, errSectionChanged) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to regenerate section: "+err.Error(), generationErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(blog)
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// defaultShutdownGracePeriod bounds how long shutdown waits for in-flight requests
+const defaultShutdownGracePeriod = 30 * time.Second
+
+// inFlightRequests counts the requests currently being served, so shutdown can report
+// how many it drained
+var inFlightRequests atomic.Int64
+
+// trackInFlight counts requests while they are being served
+func trackInFlight(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inFlightRequests.Add(1)
+		defer inFlightRequests.Add(-1)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+)
+
+// sitemapMaxURLs is the maximum number of URLs allowed in a single sitemap by the spec
+const sitemapMaxURLs = 50000
+
+const sitemapNamespace = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+// SitemapURL represents a single <url> entry in a sitemap
+type SitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// SitemapURLSet represents a sitemap document
+type SitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	URLs    []SitemapURL `xml:"url"`
+}
+
+// SitemapEntry represents a single <sitemap> entry in a sitemap index
+type SitemapEntry struct {
+	Loc string `xml:"loc"`
+}
+
+// SitemapIndex represents a sitemap index document pointing at paged sitemaps
+type SitemapIndex struct {
+	XMLName  xml.Name       `xml:"sitemapindex"`
+	Xmlns    string         `xml:"xmlns,attr"`
+	Sitemaps []SitemapEntry `xml:"sitemap"`
+}
+
+// canonicalURL builds the public URL of a blog from the configured base URL
+func canonicalURL(blog BlogPost) string {
+	return fmt.Sprintf("%s/blogs/%s", publicBaseURL(), blog.ID)
+}
+
+// isDerivedCanonicalURL reports whether the blog's canonical URL is unset or its URL on
+// this backend, as canonicalURL builds it under the current or an earlier base URL, rather
+// than one set by a user
+func isDerivedCanonicalURL(blog BlogPost) bool {
+	return blog.CanonicalURL == "" || strings.HasSuffix(blog.CanonicalURL, "/blogs/"+blog.ID)
+}
+
+// blogLink returns the blog's canonical URL: the one set by a user, else the blog's URL
+// under the current base URL
+func blogLink(blog BlogPost) string {
+	if !isDerivedCanonicalURL(blog) {
+		return blog.CanonicalURL
+	}
+	return canonicalURL(blog)
+}
+
+// sitemapCache holds the sitemap entries until a blog is stored or deleted, so crawlers
+// don't read every blog on each request
+var sitemapCache struct {
+	sync.Mutex
+	urls []SitemapURL
+	// version is bumped on every change, so a rebuild that raced with one isn't cached
+	version uint64
+	built   uint64
+}
+
+// invalidateSitemap makes the next sitemap request rebuild the entries from storage
+func invalidateSitemap() {
+	sitemapCache.Lock()
+	defer sitemapCache.Unlock()
+	sitemapCache.version++
+}
+
+// sitemapURLs returns one sitemap entry per published blog, building them on first use
+// and after blogs change
+func sitemapURLs() ([]SitemapURL, error) {
+	sitemapCache.Lock()
+	if sitemapCache.urls != nil && sitemapCache.built == sitemapCache.version {
+		urls := sitemapCache.urls
+		sitemapCache.Unlock()
+		return urls, nil
+	}
+	version := sitemapCache.version
+	sitemapCache.Unlock()
+
+	blogs, err := getAllBlogs()
+	if err != nil {
+		return nil, err
+	}
+	urls := make([]SitemapURL, 0, len(blogs))
+	for _, blog := range blogs {
+		if blogStatus(blog) != StatusPublished {
+			continue
+		}
+		urls = append(urls, SitemapURL{Loc: blogLink(blog), LastMod: blogLastMod(blog)})
+	}
+
+	sitemapCache.Lock()
+	if sitemapCache.version == version {
+		sitemapCache.urls, sitemapCache.built = urls, version
+	}
+	sitemapCache.Unlock()
+	return urls, nil
+}
+
+// blogLastMod returns when the blog was last stored, falling back to its date for blogs
+// stored before modification times were recorded
+func blogLastMod(blog BlogPost) string {
+	if blog.UpdatedAt != "" {
+		return blog.UpdatedAt
+	}
+	return blog.Date
+}
+
+func sitemapHandler(w http.ResponseWriter, r *http.Request) {
+	urls, err := sitemapURLs()
+	if err != nil {
+		http.Error(w, "Failed to build sitemap: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if len(urls) <= sitemapMaxURLs {
+		writeXML(w, "application/xml; charset=utf-8", SitemapURLSet{Xmlns: sitemapNamespace, URLs: urls})
+		return
+	}
+
+	// Too many URLs for a single sitemap, so point at paged sitemaps instead
+	index := SitemapIndex{Xmlns: sitemapNamespace}
+	pages := (len(urls) + sitemapMaxURLs - 1) / sitemapMaxURLs
+	for page := 1; page <= pages; page++ {
+		index.Sitemaps = append(index.Sitemaps, SitemapEntry{
+			Loc: fmt.Sprintf("%s/sitemap-%d.xml", publicBaseURL(), page),
+		})
+	}
+	writeXML(w, "application/xml; charset=utf-8", index)
+}
+
+func sitemapPageHandler(w http.ResponseWriter, r *http.Request) {
+	page, err := strconv.Atoi(mux.Vars(r)["page"])
+	if err != nil || page < 1 {
+		http.Error(w, "Invalid sitemap page", http.StatusBadRequest)
+		return
+	}
+
+	urls, err := sitemapURLs()
+	if err != nil {
+		http.Error(w, "Failed to build sitemap: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	start := (page - 1) * sitemapMaxURLs
+	if start >= len(urls) {
+		http.Error(w, "Sitemap page not found", http.StatusNotFound)
+		return
+	}
+	end := min(start+sitemapMaxURLs, len(urls))
+
+	writeXML(w, "application/xml; charset=utf-8", SitemapURLSet{Xmlns: sitemapNamespace, URLs: urls[start:end]})
+}
+
+// writeXML encodes v as an XML document with the given content type, escaping all values
+func writeXML(w http.ResponseWriter, contentType string, v interface{}) {
+	w.Header().Set("Content-Type", contentType)
+	w.Write([]byte(xml.Header))
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		log.Printf("Failed to encode XML response: %v", err)
+	}
+}
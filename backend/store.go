@@ -0,0 +1,429 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// errBlogNotFound is returned by stores when no blog has the requested ID
+var errBlogNotFound = errors.New("blog not found")
+
+// errInvalidBlogID is returned for IDs that aren't UUIDs, which also rules out path traversal
+var errInvalidBlogID = errors.New("invalid blog ID")
+
+// BlogStore persists blogs
+type BlogStore interface {
+	Save(blog BlogPost) error
+	GetByID(id string) (BlogPost, error)
+	// List returns the blogs matching opts in the requested order. A zero Limit returns every match.
+	List(opts ListOptions) ([]BlogPost, error)
+	// Count returns how many blogs match opts, ignoring pagination
+	Count(opts ListOptions) (int, error)
+	// Delete removes the blog along with its revisions and sources
+	Delete(id string) error
+	// SaveRevision stores a revision of a blog, replacing any revision with the same number,
+	// and drops the blog's revisions that are keep or more revisions older than it
+	SaveRevision(revision BlogRevision, keep int) error
+	// Revisions returns the blog's stored revisions, oldest first
+	Revisions(blogID string) ([]BlogRevision, error)
+	GetRevision(blogID string, number int) (BlogRevision, error)
+	// SaveSources stores the scraped contents a blog was generated from, replacing those
+	// stored for it before
+	SaveSources(sources GenerationSources) error
+	// Sources returns the scraped contents stored for the blog
+	Sources(blogID string) (GenerationSources, error)
+	// Unreadable returns the stored blogs that can't be decoded, which List skips
+	Unreadable() ([]BlogReadError, error)
+}
+
+// BlogReadError identifies a stored blog that couldn't be decoded
+type BlogReadError struct {
+	ID    string `json:"id"`
+	Error string `json:"error"`
+}
+
+// blogStore is the store used by the handlers, chosen at startup by newBlogStore
+var blogStore BlogStore = NewFileStore("./data/blogs")
+
+// blogDataDir is the directory of the file store, BLOG_DATA_DIR or blogs in the data directory
+func blogDataDir() string {
+	return getEnv("BLOG_DATA_DIR", dataPath("blogs"))
+}
+
+// newBlogStore creates the store selected by STORAGE_BACKEND (sqlite, file or postgres). A new SQLite
+// database is seeded with any blogs the file store left in BLOG_DATA_DIR.
+func newBlogStore() (BlogStore, error) {
+	fileStore := NewFileStore(blogDataDir())
+
+	switch backend := getEnv("STORAGE_BACKEND", "sqlite"); backend {
+	case "file":
+		return fileStore, nil
+	case "sqlite":
+		store, err := NewSQLiteStore(getEnv("SQLITE_PATH", dataPath("blogs.db")))
+		if err != nil {
+			return nil, err
+		}
+		err = importBlogs(store, fileStore)
+		if err != nil {
+			store.Close()
+			return nil, fmt.Errorf("failed to import blog files: %w", err)
+		}
+		return store, nil
+	case "postgres":
+		dsn := getEnv("DATABASE_URL", "")
+		if dsn == "" {
+			return nil, fmt.Errorf("DATABASE_URL is required for the postgres backend")
+		}
+		return NewPostgresStore(dsn)
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_BACKEND %q", backend)
+	}
+}
+
+// importBlogs copies every blog in from into an empty store. Stores that already hold
+// blogs are left alone so the import only runs once.
+func importBlogs(to BlogStore, from BlogStore) error {
+	count, err := to.Count(ListOptions{})
+	if err != nil || count > 0 {
+		return err
+	}
+
+	blogs, err := from.List(ListOptions{})
+	if err != nil {
+		return err
+	}
+	for _, blog := range blogs {
+		err = to.Save(blog)
+		if err != nil {
+			return err
+		}
+	}
+	if len(blogs) > 0 {
+		log.Printf("Imported %d blogs from JSON files", len(blogs))
+	}
+	return nil
+}
+
+// validateBlogID rejects IDs that aren't UUIDs
+func validateBlogID(id string) error {
+	if strings.Contains(id, "/") || strings.Contains(id, "..") {
+		return errInvalidBlogID
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return errInvalidBlogID
+	}
+	return nil
+}
+
+// FileStore stores each blog as a JSON file named after its ID
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore creates a FileStore rooted at dir
+func NewFileStore(dir string) *FileStore {
+	return &FileStore{dir: dir}
+}
+
+// blogFilePath returns the path of the blog's JSON file, rejecting IDs that aren't UUIDs
+func (s *FileStore) blogFilePath(id string) (string, error) {
+	if err := validateBlogID(id); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.dir, id+".json"), nil
+}
+
+func (s *FileStore) Save(blog BlogPost) error {
+	filePath, err := s.blogFilePath(blog.ID)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(s.dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temp file and rename it into place so a crash can't leave a truncated blog
+	tmp, err := os.CreateTemp(s.dir, "."+blog.ID+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	encoder := json.NewEncoder(tmp)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(blog)
+	if err == nil {
+		// CreateTemp uses 0600; keep the permissions os.Create used to give
+		err = tmp.Chmod(0644)
+	}
+	closeErr := tmp.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+	return os.Rename(tmp.Name(), filePath)
+}
+
+func (s *FileStore) GetByID(id string) (BlogPost, error) {
+	filePath, err := s.blogFilePath(id)
+	if err != nil {
+		return BlogPost{}, err
+	}
+	file, err := os.Open(filePath)
+	if os.IsNotExist(err) {
+		return BlogPost{}, errBlogNotFound
+	}
+	if err != nil {
+		return BlogPost{}, err
+	}
+	defer file.Close()
+
+	var blog BlogPost
+	err = json.NewDecoder(file).Decode(&blog)
+	return blog, err
+}
+
+// all reads every blog in the directory, skipping files that can't be read
+func (s *FileStore) all() ([]BlogPost, error) {
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []BlogPost{}, nil
+		}
+		return nil, err
+	}
+
+	var blogs []BlogPost
+	for _, file := range files {
+		if filepath.Ext(file.Name()) == ".json" {
+			blog, err := s.GetByID(strings.TrimSuffix(file.Name(), ".json"))
+			if err != nil {
+				log.Printf("Warning: skipping unreadable blog file %s: %v", file.Name(), err)
+				continue
+			}
+			blogs = append(blogs, blog)
+		}
+	}
+	return blogs, nil
+}
+
+func (s *FileStore) Unreadable() ([]BlogReadError, error) {
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []BlogReadError{}, nil
+		}
+		return nil, err
+	}
+
+	unreadable := []BlogReadError{}
+	for _, file := range files {
+		if filepath.Ext(file.Name()) == ".json" {
+			id := strings.TrimSuffix(file.Name(), ".json")
+			if _, err := s.GetByID(id); err != nil {
+				unreadable = append(unreadable, BlogReadError{ID: id, Error: err.Error()})
+			}
+		}
+	}
+	return unreadable, nil
+}
+
+func (s *FileStore) List(opts ListOptions) ([]BlogPost, error) {
+	blogs, err := s.all()
+	if err != nil {
+		return nil, err
+	}
+
+	blogs = filterBlogs(blogs, opts)
+	sortBlogs(blogs, opts.Sort)
+	if opts.Limit > 0 {
+		blogs = paginate(blogs, opts)
+	}
+	return blogs, nil
+}
+
+func (s *FileStore) Count(opts ListOptions) (int, error) {
+	blogs, err := s.all()
+	if err != nil {
+		return 0, err
+	}
+	return len(filterBlogs(blogs, opts)), nil
+}
+
+func (s *FileStore) Delete(id string) error {
+	filePath, err := s.blogFilePath(id)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(filePath)
+	if os.IsNotExist(err) {
+		return errBlogNotFound
+	}
+	if err != nil {
+		return err
+	}
+	err = os.Remove(filepath.Join(s.dir, "sources", id+".json"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.RemoveAll(filepath.Join(s.dir, "revisions", id))
+}
+
+// revisionDir returns the directory holding the blog's revisions, one JSON file per
+// revision named after its number
+func (s *FileStore) revisionDir(blogID string) (string, error) {
+	if err := validateBlogID(blogID); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.dir, "revisions", blogID), nil
+}
+
+func (s *FileStore) SaveRevision(revision BlogRevision, keep int) error {
+	dir, err := s.revisionDir(revision.Blog.ID)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(revision, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, fmt.Sprintf(".%d.json.tmp", revision.Number))
+	err = os.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp, filepath.Join(dir, fmt.Sprintf("%d.json", revision.Number)))
+	if err != nil {
+		return err
+	}
+
+	numbers, err := revisionNumbers(dir)
+	if err != nil {
+		return err
+	}
+	for _, number := range numbers {
+		if number <= revision.Number-keep {
+			os.Remove(filepath.Join(dir, fmt.Sprintf("%d.json", number)))
+		}
+	}
+	return nil
+}
+
+// revisionNumbers returns the numbers of the revisions stored in dir, in ascending order
+func revisionNumbers(dir string) ([]int, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var numbers []int
+	for _, file := range files {
+		number, err := strconv.Atoi(strings.TrimSuffix(file.Name(), ".json"))
+		if err == nil && filepath.Ext(file.Name()) == ".json" {
+			numbers = append(numbers, number)
+		}
+	}
+	slices.Sort(numbers)
+	return numbers, nil
+}
+
+func (s *FileStore) Revisions(blogID string) ([]BlogRevision, error) {
+	dir, err := s.revisionDir(blogID)
+	if err != nil {
+		return nil, err
+	}
+	numbers, err := revisionNumbers(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	revisions := []BlogRevision{}
+	for _, number := range numbers {
+		revision, err := s.GetRevision(blogID, number)
+		if err != nil {
+			log.Printf("Warning: skipping unreadable revision %d of blog %s: %v", number, blogID, err)
+			continue
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, nil
+}
+
+func (s *FileStore) GetRevision(blogID string, number int) (BlogRevision, error) {
+	dir, err := s.revisionDir(blogID)
+	if err != nil {
+		return BlogRevision{}, err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, fmt.Sprintf("%d.json", number)))
+	if os.IsNotExist(err) {
+		return BlogRevision{}, errRevisionNotFound
+	}
+	if err != nil {
+		return BlogRevision{}, err
+	}
+
+	var revision BlogRevision
+	err = json.Unmarshal(data, &revision)
+	return revision, err
+}
+
+// SaveSources stores the sources as sources/{blogID}.json
+func (s *FileStore) SaveSources(sources GenerationSources) error {
+	if err := validateBlogID(sources.BlogID); err != nil {
+		return err
+	}
+	dir := filepath.Join(s.dir, "sources")
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(sources, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, "."+sources.BlogID+".json.tmp")
+	err = os.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, sources.BlogID+".json"))
+}
+
+func (s *FileStore) Sources(blogID string) (GenerationSources, error) {
+	if err := validateBlogID(blogID); err != nil {
+		return GenerationSources{}, err
+	}
+	data, err := os.ReadFile(filepath.Join(s.dir, "sources", blogID+".json"))
+	if os.IsNotExist(err) {
+		return GenerationSources{}, errSourcesNotFound
+	}
+	if err != nil {
+		return GenerationSources{}, err
+	}
+
+	var sources GenerationSources
+	err = json.Unmarshal(data, &sources)
+	return sources, err
+}
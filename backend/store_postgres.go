@@ -0,0 +1,385 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// postgresMigrations are applied in order, each exactly once, and recorded in
+// schema_migrations. Append new migrations; never edit ones that have shipped.
+var postgresMigrations = []string{
+	`CREATE TABLE IF NOT EXISTS blogs (
+		id TEXT PRIMARY KEY,
+		date TEXT NOT NULL,
+		reading_time INTEGER NOT NULL,
+		simulated BOOLEAN NOT NULL DEFAULT FALSE,
+		data JSONB NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS blogs_date_idx ON blogs (date)`,
+	`CREATE TABLE IF NOT EXISTS blog_revisions (
+		blog_id TEXT NOT NULL,
+		number INTEGER NOT NULL,
+		created_at TEXT NOT NULL,
+		data JSONB NOT NULL,
+		PRIMARY KEY (blog_id, number)
+	)`,
+	`CREATE TABLE IF NOT EXISTS blog_sources (
+		blog_id TEXT PRIMARY KEY,
+		generated_at TEXT NOT NULL,
+		data JSONB NOT NULL
+	)`,
+}
+
+// postgresMigrationLock is the advisory lock key that keeps instances starting at the same
+// time from applying migrations concurrently
+const postgresMigrationLock = 7265421
+
+// PostgresStore stores blogs in PostgreSQL so several instances can share them, keeping
+// the fields used for filtering and sorting in their own columns next to the JSON document
+type PostgresStore struct {
+	db *sql.DB
+}
+
+// NewPostgresStore connects to the database at dsn and applies any pending migrations
+func NewPostgresStore(dsn string) (*PostgresStore, error) {
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, err
+	}
+	err = db.Ping()
+	if err == nil {
+		err = migratePostgres(db)
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &PostgresStore{db: db}, nil
+}
+
+// migratePostgres applies the migrations that haven't been recorded in schema_migrations
+func migratePostgres(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`SELECT pg_advisory_xact_lock($1)`, postgresMigrationLock)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		return err
+	}
+
+	var current int
+	err = tx.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current)
+	if err != nil {
+		return err
+	}
+
+	for i := current; i < len(postgresMigrations); i++ {
+		version := i + 1
+		_, err = tx.Exec(postgresMigrations[i])
+		if err != nil {
+			return fmt.Errorf("migration %d: %w", version, err)
+		}
+		_, err = tx.Exec(`INSERT INTO schema_migrations (version) VALUES ($1)`, version)
+		if err != nil {
+			return err
+		}
+		log.Printf("Applied Postgres migration %d", version)
+	}
+	return tx.Commit()
+}
+
+// Close closes the database
+func (s *PostgresStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *PostgresStore) Save(blog BlogPost) error {
+	if err := validateBlogID(blog.ID); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(blog)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`INSERT INTO blogs (id, date, reading_time, simulated, data) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (id) DO UPDATE SET date = excluded.date, reading_time = excluded.reading_time,
+		simulated = excluded.simulated, data = excluded.data`,
+		blog.ID, blog.Date, blog.ReadingTime, blog.Simulated, string(data))
+	return err
+}
+
+func (s *PostgresStore) GetByID(id string) (BlogPost, error) {
+	if err := validateBlogID(id); err != nil {
+		return BlogPost{}, err
+	}
+
+	var data string
+	err := s.db.QueryRow(`SELECT data FROM blogs WHERE id = $1`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return BlogPost{}, errBlogNotFound
+	}
+	if err != nil {
+		return BlogPost{}, err
+	}
+
+	var blog BlogPost
+	err = json.Unmarshal([]byte(data), &blog)
+	return blog, err
+}
+
+// where builds the WHERE clause selecting the blogs matching opts
+func (s *PostgresStore) where(opts ListOptions) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if opts.ExcludeSimulated {
+		conditions = append(conditions, `NOT simulated`)
+	}
+	if opts.Tag != "" {
+		conditions = append(conditions, `EXISTS (SELECT 1 FROM jsonb_array_elements_text(data->'tags') AS tag WHERE lower(tag) = lower(`+arg(opts.Tag)+`))`)
+	}
+	if opts.Topic != "" {
+		conditions = append(conditions, `strpos(lower(data->>'topic'), lower(`+arg(opts.Topic)+`)) > 0`)
+	}
+	if opts.From != "" {
+		conditions = append(conditions, `date >= `+arg(opts.From))
+	}
+	if opts.To != "" {
+		conditions = append(conditions, `date <= `+arg(opts.To))
+	}
+	if opts.OwnerID != "" {
+		conditions = append(conditions, `data->>'ownerId' = `+arg(opts.OwnerID))
+	}
+	if opts.Status == StatusPublished {
+		conditions = append(conditions, `coalesce(data->>'status', '') IN ('', `+arg(opts.Status)+`)`)
+	} else if opts.Status != "" {
+		conditions = append(conditions, `data->>'status' = `+arg(opts.Status))
+	}
+
+	if opts.Language != "" {
+		language := arg(opts.Language)
+		conditions = append(conditions, `(lower(coalesce(nullif(data->>'language', ''), `+arg(defaultBlogLanguage)+`)) = lower(`+language+`)
+			OR lower(data->>'language') LIKE lower(`+language+`) || '-%')`)
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+func (s *PostgresStore) List(opts ListOptions) ([]BlogPost, error) {
+	query := `SELECT id, data FROM blogs`
+	clause, args := s.where(opts)
+	query += clause
+
+	switch opts.Sort {
+	case SortDateAsc:
+		query += ` ORDER BY date ASC, id ASC`
+	case SortReadingTimeAsc:
+		query += ` ORDER BY reading_time ASC, id ASC`
+	case SortReadingTimeDesc:
+		query += ` ORDER BY reading_time DESC, id ASC`
+	default:
+		query += ` ORDER BY date DESC, id ASC`
+	}
+
+	if opts.Limit > 0 {
+		query += fmt.Sprintf(` LIMIT $%d OFFSET $%d`, len(args)+1, len(args)+2)
+		args = append(args, opts.Limit, (max(opts.Page, 1)-1)*opts.Limit)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	blogs := []BlogPost{}
+	for rows.Next() {
+		var id, data string
+		err = rows.Scan(&id, &data)
+		if err != nil {
+			return nil, err
+		}
+		var blog BlogPost
+		if err := json.Unmarshal([]byte(data), &blog); err != nil {
+			log.Printf("Warning: skipping unreadable blog %s: %v", id, err)
+			continue
+		}
+		blogs = append(blogs, blog)
+	}
+	return blogs, rows.Err()
+}
+
+func (s *PostgresStore) Count(opts ListOptions) (int, error) {
+	clause, args := s.where(opts)
+	var count int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM blogs`+clause, args...).Scan(&count)
+	return count, err
+}
+
+func (s *PostgresStore) Delete(id string) error {
+	if err := validateBlogID(id); err != nil {
+		return err
+	}
+
+	result, err := s.db.Exec(`DELETE FROM blogs WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errBlogNotFound
+	}
+	_, err = s.db.Exec(`DELETE FROM blog_revisions WHERE blog_id = $1`, id)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`DELETE FROM blog_sources WHERE blog_id = $1`, id)
+	return err
+}
+
+func (s *PostgresStore) SaveRevision(revision BlogRevision, keep int) error {
+	if err := validateBlogID(revision.Blog.ID); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(revision.Blog)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`INSERT INTO blog_revisions (blog_id, number, created_at, data) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (blog_id, number) DO UPDATE SET created_at = excluded.created_at, data = excluded.data`,
+		revision.Blog.ID, revision.Number, revision.CreatedAt, string(data))
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`DELETE FROM blog_revisions WHERE blog_id = $1 AND number <= $2`, revision.Blog.ID, revision.Number-keep)
+	return err
+}
+
+func (s *PostgresStore) Revisions(blogID string) ([]BlogRevision, error) {
+	if err := validateBlogID(blogID); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`SELECT number, created_at, data FROM blog_revisions WHERE blog_id = $1 ORDER BY number`, blogID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []BlogRevision{}
+	for rows.Next() {
+		var revision BlogRevision
+		var data string
+		err = rows.Scan(&revision.Number, &revision.CreatedAt, &data)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(data), &revision.Blog); err != nil {
+			log.Printf("Warning: skipping unreadable revision %d of blog %s: %v", revision.Number, blogID, err)
+			continue
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, rows.Err()
+}
+
+func (s *PostgresStore) GetRevision(blogID string, number int) (BlogRevision, error) {
+	if err := validateBlogID(blogID); err != nil {
+		return BlogRevision{}, err
+	}
+
+	revision := BlogRevision{Number: number}
+	var data string
+	err := s.db.QueryRow(`SELECT created_at, data FROM blog_revisions WHERE blog_id = $1 AND number = $2`, blogID, number).Scan(&revision.CreatedAt, &data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return BlogRevision{}, errRevisionNotFound
+	}
+	if err != nil {
+		return BlogRevision{}, err
+	}
+	err = json.Unmarshal([]byte(data), &revision.Blog)
+	return revision, err
+}
+
+func (s *PostgresStore) Unreadable() ([]BlogReadError, error) {
+	rows, err := s.db.Query(`SELECT id, data FROM blogs`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	unreadable := []BlogReadError{}
+	for rows.Next() {
+		var id, data string
+		err = rows.Scan(&id, &data)
+		if err != nil {
+			return nil, err
+		}
+		var blog BlogPost
+		if err := json.Unmarshal([]byte(data), &blog); err != nil {
+			unreadable = append(unreadable, BlogReadError{ID: id, Error: err.Error()})
+		}
+	}
+	return unreadable, rows.Err()
+}
+
+func (s *PostgresStore) SaveSources(sources GenerationSources) error {
+	if err := validateBlogID(sources.BlogID); err != nil {
+		return err
+	}
+	data, err := json.Marshal(sources.Contents)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO blog_sources (blog_id, generated_at, data) VALUES ($1, $2, $3)
+		ON CONFLICT (blog_id) DO UPDATE SET generated_at = EXCLUDED.generated_at, data = EXCLUDED.data`,
+		sources.BlogID, sources.GeneratedAt, string(data))
+	return err
+}
+
+func (s *PostgresStore) Sources(blogID string) (GenerationSources, error) {
+	if err := validateBlogID(blogID); err != nil {
+		return GenerationSources{}, err
+	}
+	sources := GenerationSources{BlogID: blogID}
+	var data string
+	err := s.db.QueryRow(`SELECT generated_at, data FROM blog_sources WHERE blog_id = $1`, blogID).Scan(&sources.GeneratedAt, &data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return GenerationSources{}, errSourcesNotFound
+	}
+	if err != nil {
+		return GenerationSources{}, err
+	}
+	err = json.Unmarshal([]byte(data), &sources.Contents)
+	return sources, err
+}
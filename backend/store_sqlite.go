@@ -0,0 +1,346 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+// SQLiteStore stores blogs in a SQLite database, keeping the fields used for
+// filtering and sorting in their own columns next to the full JSON document
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStore opens (creating if needed) the SQLite database at path
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite only supports a single writer
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS blogs (
+		id TEXT PRIMARY KEY,
+		date TEXT NOT NULL,
+		reading_time INTEGER NOT NULL,
+		simulated INTEGER NOT NULL DEFAULT 0,
+		data TEXT NOT NULL
+	)`)
+	if err == nil {
+		_, err = db.Exec(`CREATE TABLE IF NOT EXISTS blog_revisions (
+			blog_id TEXT NOT NULL,
+			number INTEGER NOT NULL,
+			created_at TEXT NOT NULL,
+			data TEXT NOT NULL,
+			PRIMARY KEY (blog_id, number)
+		)`)
+	}
+	if err == nil {
+		_, err = db.Exec(`CREATE TABLE IF NOT EXISTS blog_sources (
+			blog_id TEXT PRIMARY KEY,
+			generated_at TEXT NOT NULL,
+			data TEXT NOT NULL
+		)`)
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &SQLiteStore{db: db}, nil
+}
+
+// Close closes the database
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLiteStore) Save(blog BlogPost) error {
+	if err := validateBlogID(blog.ID); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(blog)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`INSERT INTO blogs (id, date, reading_time, simulated, data) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET date = excluded.date, reading_time = excluded.reading_time,
+		simulated = excluded.simulated, data = excluded.data`,
+		blog.ID, blog.Date, blog.ReadingTime, blog.Simulated, string(data))
+	return err
+}
+
+func (s *SQLiteStore) GetByID(id string) (BlogPost, error) {
+	if err := validateBlogID(id); err != nil {
+		return BlogPost{}, err
+	}
+
+	var data string
+	err := s.db.QueryRow(`SELECT data FROM blogs WHERE id = ?`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return BlogPost{}, errBlogNotFound
+	}
+	if err != nil {
+		return BlogPost{}, err
+	}
+
+	var blog BlogPost
+	err = json.Unmarshal([]byte(data), &blog)
+	return blog, err
+}
+
+// where builds the WHERE clause selecting the blogs matching opts
+func (s *SQLiteStore) where(opts ListOptions) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	if opts.ExcludeSimulated {
+		conditions = append(conditions, `simulated = 0`)
+	}
+	if opts.Tag != "" {
+		conditions = append(conditions, `EXISTS (SELECT 1 FROM json_each(data, '$.tags') WHERE lower(value) = lower(?))`)
+		args = append(args, opts.Tag)
+	}
+	if opts.Topic != "" {
+		conditions = append(conditions, `instr(lower(json_extract(data, '$.topic')), lower(?)) > 0`)
+		args = append(args, opts.Topic)
+	}
+	if opts.From != "" {
+		conditions = append(conditions, `date >= ?`)
+		args = append(args, opts.From)
+	}
+	if opts.To != "" {
+		conditions = append(conditions, `date <= ?`)
+		args = append(args, opts.To)
+	}
+	if opts.OwnerID != "" {
+		conditions = append(conditions, `json_extract(data, '$.ownerId') = ?`)
+		args = append(args, opts.OwnerID)
+	}
+	if opts.Status == StatusPublished {
+		conditions = append(conditions, `coalesce(json_extract(data, '$.status'), '') IN ('', ?)`)
+		args = append(args, opts.Status)
+	} else if opts.Status != "" {
+		conditions = append(conditions, `json_extract(data, '$.status') = ?`)
+		args = append(args, opts.Status)
+	}
+
+	if opts.Language != "" {
+		conditions = append(conditions, `(lower(coalesce(nullif(json_extract(data, '$.language'), ''), ?)) = lower(?)
+			OR lower(json_extract(data, '$.language')) LIKE lower(?) || '-%')`)
+		args = append(args, defaultBlogLanguage, opts.Language, opts.Language)
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+func (s *SQLiteStore) List(opts ListOptions) ([]BlogPost, error) {
+	query := `SELECT id, data FROM blogs`
+	clause, args := s.where(opts)
+	query += clause
+
+	switch opts.Sort {
+	case SortDateAsc:
+		query += ` ORDER BY date ASC, id ASC`
+	case SortReadingTimeAsc:
+		query += ` ORDER BY reading_time ASC, id ASC`
+	case SortReadingTimeDesc:
+		query += ` ORDER BY reading_time DESC, id ASC`
+	default:
+		query += ` ORDER BY date DESC, id ASC`
+	}
+
+	if opts.Limit > 0 {
+		query += ` LIMIT ? OFFSET ?`
+		args = append(args, opts.Limit, (max(opts.Page, 1)-1)*opts.Limit)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	blogs := []BlogPost{}
+	for rows.Next() {
+		var id, data string
+		err = rows.Scan(&id, &data)
+		if err != nil {
+			return nil, err
+		}
+		var blog BlogPost
+		if err := json.Unmarshal([]byte(data), &blog); err != nil {
+			log.Printf("Warning: skipping unreadable blog %s: %v", id, err)
+			continue
+		}
+		blogs = append(blogs, blog)
+	}
+	return blogs, rows.Err()
+}
+
+func (s *SQLiteStore) Unreadable() ([]BlogReadError, error) {
+	rows, err := s.db.Query(`SELECT id, data FROM blogs`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	unreadable := []BlogReadError{}
+	for rows.Next() {
+		var id, data string
+		err = rows.Scan(&id, &data)
+		if err != nil {
+			return nil, err
+		}
+		var blog BlogPost
+		if err := json.Unmarshal([]byte(data), &blog); err != nil {
+			unreadable = append(unreadable, BlogReadError{ID: id, Error: err.Error()})
+		}
+	}
+	return unreadable, rows.Err()
+}
+
+func (s *SQLiteStore) Count(opts ListOptions) (int, error) {
+	clause, args := s.where(opts)
+	var count int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM blogs`+clause, args...).Scan(&count)
+	return count, err
+}
+
+func (s *SQLiteStore) Delete(id string) error {
+	if err := validateBlogID(id); err != nil {
+		return err
+	}
+
+	result, err := s.db.Exec(`DELETE FROM blogs WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errBlogNotFound
+	}
+	_, err = s.db.Exec(`DELETE FROM blog_revisions WHERE blog_id = ?`, id)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`DELETE FROM blog_sources WHERE blog_id = ?`, id)
+	return err
+}
+
+func (s *SQLiteStore) SaveRevision(revision BlogRevision, keep int) error {
+	if err := validateBlogID(revision.Blog.ID); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(revision.Blog)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`INSERT INTO blog_revisions (blog_id, number, created_at, data) VALUES (?, ?, ?, ?)
+		ON CONFLICT(blog_id, number) DO UPDATE SET created_at = excluded.created_at, data = excluded.data`,
+		revision.Blog.ID, revision.Number, revision.CreatedAt, string(data))
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`DELETE FROM blog_revisions WHERE blog_id = ? AND number <= ?`, revision.Blog.ID, revision.Number-keep)
+	return err
+}
+
+func (s *SQLiteStore) Revisions(blogID string) ([]BlogRevision, error) {
+	if err := validateBlogID(blogID); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`SELECT number, created_at, data FROM blog_revisions WHERE blog_id = ? ORDER BY number`, blogID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []BlogRevision{}
+	for rows.Next() {
+		var revision BlogRevision
+		var data string
+		err = rows.Scan(&revision.Number, &revision.CreatedAt, &data)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(data), &revision.Blog); err != nil {
+			log.Printf("Warning: skipping unreadable revision %d of blog %s: %v", revision.Number, blogID, err)
+			continue
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, rows.Err()
+}
+
+func (s *SQLiteStore) GetRevision(blogID string, number int) (BlogRevision, error) {
+	if err := validateBlogID(blogID); err != nil {
+		return BlogRevision{}, err
+	}
+
+	revision := BlogRevision{Number: number}
+	var data string
+	err := s.db.QueryRow(`SELECT created_at, data FROM blog_revisions WHERE blog_id = ? AND number = ?`, blogID, number).Scan(&revision.CreatedAt, &data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return BlogRevision{}, errRevisionNotFound
+	}
+	if err != nil {
+		return BlogRevision{}, err
+	}
+	err = json.Unmarshal([]byte(data), &revision.Blog)
+	return revision, err
+}
+
+func (s *SQLiteStore) SaveSources(sources GenerationSources) error {
+	if err := validateBlogID(sources.BlogID); err != nil {
+		return err
+	}
+	data, err := json.Marshal(sources.Contents)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO blog_sources (blog_id, generated_at, data) VALUES (?, ?, ?)
+		ON CONFLICT(blog_id) DO UPDATE SET generated_at = excluded.generated_at, data = excluded.data`,
+		sources.BlogID, sources.GeneratedAt, string(data))
+	return err
+}
+
+func (s *SQLiteStore) Sources(blogID string) (GenerationSources, error) {
+	if err := validateBlogID(blogID); err != nil {
+		return GenerationSources{}, err
+	}
+	sources := GenerationSources{BlogID: blogID}
+	var data string
+	err := s.db.QueryRow(`SELECT generated_at, data FROM blog_sources WHERE blog_id = ?`, blogID).Scan(&sources.GeneratedAt, &data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return GenerationSources{}, errSourcesNotFound
+	}
+	if err != nil {
+		return GenerationSources{}, err
+	}
+	err = json.Unmarshal([]byte(data), &sources.Contents)
+	return sources, err
+}
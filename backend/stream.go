@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// streamGenerationOptions reads the generation options from the query string, named as in
+// the JSON body of POST /api/generate-blog
+func streamGenerationOptions(query url.Values) GenerationOptions {
+	return GenerationOptions{
+		Instructions: strings.TrimSpace(query.Get("instructions")),
+		Tone:         strings.TrimSpace(query.Get("tone")),
+		Audience:     strings.TrimSpace(query.Get("audience")),
+		Length:       strings.TrimSpace(query.Get("length")),
+		Language:     strings.TrimSpace(query.Get("language")),
+	}
+}
+
+// streamGenerateBlogHandler runs the generation pipeline for ?topic= and reports its progress
+// as Server-Sent Events: "scraping", "generating" and "generated" events carrying a
+// ProgressEvent, then a "done" event with the saved BlogPost or an "error" event.
+// Disconnecting cancels the pipeline.
+func streamGenerateBlogHandler(w http.ResponseWriter, r *http.Request) {
+	topic := strings.TrimSpace(r.URL.Query().Get("topic"))
+	if topic == "" {
+		http.Error(w, "Topic is required", http.StatusBadRequest)
+		return
+	}
+	opts := streamGenerationOptions(r.URL.Query())
+	if err := opts.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// Scraping progress arrives from concurrent collector callbacks
+	var mu sync.Mutex
+	send := func(event string, data interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err := writeSSE(w, event, data); err != nil {
+			log.Printf("Failed to send %s event: %v", event, err)
+			return
+		}
+		flusher.Flush()
+	}
+
+	user, _ := requestUser(r)
+	blog, err := generateBlog(r.Context(), topic, user.ID, opts, func(event ProgressEvent) {
+		send(event.Stage, event)
+	})
+	if r.Context().Err() != nil {
+		log.Printf("Client disconnected, stopped generation for topic %q", topic)
+		return
+	}
+	if err != nil {
+		send("error", map[string]interface{}{
+			"error":    err.Error(),
+			"status":   generationErrorStatus(err),
+			"attempts": generationAttempts(err),
+		})
+		return
+	}
+	send("done", blog)
+}
+
+// writeSSE writes one Server-Sent Event with a JSON payload
+func writeSSE(w http.ResponseWriter, event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+	return err
+}
@@ -0,0 +1,872 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Subscription modes: regenerate rewrites the blog from all current sources, append adds
+// an update section written from the new sources only
+const (
+	SubscriptionRegenerate = "regenerate"
+	SubscriptionAppend     = "append"
+)
+
+// Subscription defaults and limits
+const (
+	defaultSubscriptionFrequency = "24h"
+	minSubscriptionFrequency     = time.Hour
+	defaultMinNewSources         = 3
+	subscriptionRefreshHistory   = 20
+	// subscriptionKnownSources bounds how many source URLs a subscription remembers
+	subscriptionKnownSources = 1000
+	// subscriptionCheckInterval is how often due subscriptions are looked for
+	subscriptionCheckInterval = time.Minute
+)
+
+// Errors returned by the SubscriptionStore
+var (
+	errSubscriptionNotFound   = errors.New("subscription not found")
+	errInvalidSubscription    = errors.New("invalid subscription")
+	errNotSubscriptionOwner   = errors.New("only the subscription's owner can manage it")
+	errSubscriptionRefreshing = errors.New("subscription is already being refreshed")
+)
+
+// Subscription keeps a blog about a topic up to date, re-scraping the topic at its
+// frequency and updating the blog once enough new sources have appeared
+type Subscription struct {
+	ID    string `json:"id"`
+	Topic string `json:"topic"`
+	// BlogID is the blog kept up to date, generated at the first refresh if not given
+	BlogID string `json:"blogId,omitempty"`
+	// Frequency is how often the topic is re-scraped, as a Go duration such as "24h"
+	Frequency string `json:"frequency"`
+	Mode      string `json:"mode"`
+	// MinNewSources is how many sources the blog doesn't cite yet must appear before it
+	// is updated
+	MinNewSources int    `json:"minNewSources"`
+	Enabled       bool   `json:"enabled"`
+	OwnerID       string `json:"ownerId,omitempty"`
+	// KnownSources are the URLs of the sources the blog was last generated or updated from
+	KnownSources  []string   `json:"knownSources,omitempty"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	UpdatedAt     time.Time  `json:"updatedAt"`
+	LastCheckedAt *time.Time `json:"lastCheckedAt,omitempty"`
+	NextCheckAt   time.Time  `json:"nextCheckAt"`
+	// Refreshes are the latest checks, newest first
+	Refreshes []SubscriptionRefresh `json:"refreshes"`
+}
+
+// public returns the subscription without its known sources
+func (sub Subscription) public() Subscription {
+	sub.KnownSources = nil
+	sub.Refreshes = slices.Clone(sub.Refreshes)
+	if sub.Refreshes == nil {
+		sub.Refreshes = []SubscriptionRefresh{}
+	}
+	return sub
+}
+
+// SubscriptionRefresh records one check of a subscription's topic
+type SubscriptionRefresh struct {
+	CheckedAt time.Time `json:"checkedAt"`
+	// NewSources counts the scraped sources the blog doesn't cite yet
+	NewSources int `json:"newSources"`
+	// Updated is set when the blog was generated or updated
+	Updated bool   `json:"updated"`
+	BlogID  string `json:"blogId,omitempty"`
+	// Summary describes what changed, or why nothing did
+	Summary string `json:"summary,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// parseFrequency parses a subscription frequency, rejecting ones below minSubscriptionFrequency
+func parseFrequency(raw string) (time.Duration, error) {
+	frequency, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, fmt.Errorf("%w: frequency must be a duration such as 24h", errInvalidSubscription)
+	}
+	if frequency < minSubscriptionFrequency {
+		return 0, fmt.Errorf("%w: frequency must be at least %s", errInvalidSubscription, minSubscriptionFrequency)
+	}
+	return frequency, nil
+}
+
+// validate checks the subscription's settings
+func (sub Subscription) validate() error {
+	if sub.Topic == "" {
+		return fmt.Errorf("%w: topic is required", errInvalidSubscription)
+	}
+	if _, err := parseFrequency(sub.Frequency); err != nil {
+		return err
+	}
+	if sub.Mode != SubscriptionRegenerate && sub.Mode != SubscriptionAppend {
+		return fmt.Errorf("%w: mode must be %s or %s", errInvalidSubscription, SubscriptionRegenerate, SubscriptionAppend)
+	}
+	if sub.MinNewSources < 1 {
+		return fmt.Errorf("%w: minNewSources must be at least 1", errInvalidSubscription)
+	}
+	return nil
+}
+
+// SubscriptionStore holds the subscriptions in a JSON file and refreshes them when due
+type SubscriptionStore struct {
+	mu            sync.Mutex
+	path          string
+	subscriptions map[string]*Subscription
+	// refreshing holds the subscriptions being refreshed
+	refreshing map[string]bool
+	ctx        context.Context
+	cancel     context.CancelFunc
+	done       chan struct{}
+}
+
+var subscriptions = &SubscriptionStore{
+	subscriptions: make(map[string]*Subscription),
+	refreshing:    make(map[string]bool),
+}
+
+// subscriptionsFile is where subscriptions are saved, SUBSCRIPTIONS_FILE or
+// subscriptions.json in the data directory
+func subscriptionsFile() string {
+	return getEnv("SUBSCRIPTIONS_FILE", dataPath("subscriptions.json"))
+}
+
+// Load reads the subscriptions saved at path. A missing file means there are none yet.
+func (s *SubscriptionStore) Load(path string) error {
+	loaded := make(map[string]*Subscription)
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		var stored []Subscription
+		if err := json.Unmarshal(data, &stored); err != nil {
+			return fmt.Errorf("failed to parse %s: %v", path, err)
+		}
+		for _, sub := range stored {
+			sub := sub
+			loaded[sub.ID] = &sub
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.path = path
+	s.subscriptions = loaded
+	return nil
+}
+
+// Start checks for due subscriptions every subscriptionCheckInterval, refreshing them one
+// at a time
+func (s *SubscriptionStore) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.done != nil {
+		return
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.done = make(chan struct{})
+
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(subscriptionCheckInterval)
+		defer ticker.Stop()
+		for {
+			for _, id := range s.due(time.Now()) {
+				if s.ctx.Err() != nil {
+					return
+				}
+				s.Refresh(s.ctx, id)
+			}
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop cancels the refresh in progress and stops checking subscriptions
+func (s *SubscriptionStore) Stop(ctx context.Context) {
+	s.mu.Lock()
+	cancel, done := s.cancel, s.done
+	s.mu.Unlock()
+	if cancel == nil {
+		return
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
+
+// due returns the enabled subscriptions whose next check is at or before now
+func (s *SubscriptionStore) due(now time.Time) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ids []string
+	for id, sub := range s.subscriptions {
+		if sub.Enabled && !sub.NextCheckAt.After(now) {
+			ids = append(ids, id)
+		}
+	}
+	slices.SortFunc(ids, func(a, b string) int {
+		return s.subscriptions[a].NextCheckAt.Compare(s.subscriptions[b].NextCheckAt)
+	})
+	return ids
+}
+
+// List returns the subscriptions for which keep returns true, oldest first
+func (s *SubscriptionStore) List(keep func(Subscription) bool) []Subscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	listed := []Subscription{}
+	for _, sub := range s.sorted() {
+		if keep(sub) {
+			listed = append(listed, sub.public())
+		}
+	}
+	return listed
+}
+
+// Get returns the subscription with the ID
+func (s *SubscriptionStore) Get(id string) (Subscription, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub, ok := s.subscriptions[id]
+	if !ok {
+		return Subscription{}, false
+	}
+	return sub.public(), true
+}
+
+// Create validates and saves the subscription, which is first checked right away
+func (s *SubscriptionStore) Create(sub Subscription) (Subscription, error) {
+	if err := sub.validate(); err != nil {
+		return Subscription{}, err
+	}
+	now := time.Now()
+	sub.ID = uuid.New().String()
+	sub.CreatedAt = now
+	sub.UpdatedAt = now
+	sub.NextCheckAt = now
+	sub.Refreshes = nil
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.subscriptions[sub.ID] = &sub
+	if err := s.save(); err != nil {
+		delete(s.subscriptions, sub.ID)
+		return Subscription{}, err
+	}
+	return sub.public(), nil
+}
+
+// Update applies fn to a copy of the subscription, then validates and saves it. A changed
+// frequency applies from the last check. fn returning an error leaves it unchanged.
+func (s *SubscriptionStore) Update(id string, fn func(sub *Subscription) error) (Subscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.subscriptions[id]
+	if !ok {
+		return Subscription{}, errSubscriptionNotFound
+	}
+	updated := *current
+	if err := fn(&updated); err != nil {
+		return Subscription{}, err
+	}
+	if err := updated.validate(); err != nil {
+		return Subscription{}, err
+	}
+	if updated.Frequency != current.Frequency && updated.LastCheckedAt != nil {
+		frequency, _ := parseFrequency(updated.Frequency)
+		updated.NextCheckAt = updated.LastCheckedAt.Add(frequency)
+	}
+	updated.UpdatedAt = time.Now()
+
+	s.subscriptions[id] = &updated
+	if err := s.save(); err != nil {
+		s.subscriptions[id] = current
+		return Subscription{}, err
+	}
+	return updated.public(), nil
+}
+
+// Delete removes the subscription. The blog it kept up to date is left as is.
+func (s *SubscriptionStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub, ok := s.subscriptions[id]
+	if !ok {
+		return errSubscriptionNotFound
+	}
+	delete(s.subscriptions, id)
+	if err := s.save(); err != nil {
+		s.subscriptions[id] = sub
+		return err
+	}
+	return nil
+}
+
+// Refresh re-scrapes the subscription's topic and updates its blog if enough new sources
+// appeared, recording the check. It returns errSubscriptionRefreshing if a refresh of the
+// subscription is already running.
+func (s *SubscriptionStore) Refresh(ctx context.Context, id string) error {
+	sub, err := s.begin(id)
+	if err != nil {
+		return err
+	}
+	s.complete(ctx, sub)
+	return nil
+}
+
+// RefreshNow starts a refresh of the subscription in the background, as Refresh does
+func (s *SubscriptionStore) RefreshNow(id string) error {
+	sub, err := s.begin(id)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	ctx := s.ctx
+	s.mu.Unlock()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	go s.complete(ctx, sub)
+	return nil
+}
+
+// begin marks the subscription as being refreshed and schedules its next check, returning
+// a copy of it
+func (s *SubscriptionStore) begin(id string) (Subscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.subscriptions[id]
+	if !ok {
+		return Subscription{}, errSubscriptionNotFound
+	}
+	if s.refreshing[id] {
+		return Subscription{}, errSubscriptionRefreshing
+	}
+	s.refreshing[id] = true
+	// Schedule the next check now, so a slow or failing refresh isn't retried every minute
+	frequency, _ := parseFrequency(current.Frequency)
+	current.NextCheckAt = time.Now().Add(frequency)
+	return *current, nil
+}
+
+// complete runs the refresh begun for sub and records it
+func (s *SubscriptionStore) complete(ctx context.Context, sub Subscription) {
+	refresh, blogID, known := refreshSubscription(ctx, sub)
+	if refresh.Error != "" {
+		log.Printf("Refreshing subscription %s to topic %q failed: %s", sub.ID, sub.Topic, refresh.Error)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := sub.ID
+	delete(s.refreshing, id)
+	current, ok := s.subscriptions[id]
+	if !ok {
+		return
+	}
+	if ctx.Err() != nil {
+		// Interrupted by shutdown, so check again at the next start
+		current.NextCheckAt = refresh.CheckedAt
+		return
+	}
+	current.LastCheckedAt = &refresh.CheckedAt
+	current.BlogID = blogID
+	if known != nil {
+		current.KnownSources = known
+	}
+	current.Refreshes = append([]SubscriptionRefresh{refresh}, current.Refreshes...)
+	if len(current.Refreshes) > subscriptionRefreshHistory {
+		current.Refreshes = current.Refreshes[:subscriptionRefreshHistory]
+	}
+	if err := s.save(); err != nil {
+		log.Printf("Failed to save the refresh of subscription %s: %v", id, err)
+	}
+}
+
+// refreshSubscription checks the subscription's topic for new sources and updates or
+// generates its blog. It returns the check, the ID of the blog now kept up to date, and
+// the sources to remember if the blog changed.
+func refreshSubscription(ctx context.Context, sub Subscription) (SubscriptionRefresh, string, []string) {
+	refresh := SubscriptionRefresh{CheckedAt: time.Now(), BlogID: sub.BlogID}
+	fail := func(err error) (SubscriptionRefresh, string, []string) {
+		refresh.Error = err.Error()
+		return refresh, sub.BlogID, nil
+	}
+
+	var blog BlogPost
+	if sub.BlogID != "" {
+		var err error
+		blog, err = getBlogByID(sub.BlogID)
+		if errors.Is(err, errBlogNotFound) {
+			// The blog was deleted, so the next update generates a new one
+			sub.BlogID = ""
+			refresh.BlogID = ""
+		} else if err != nil {
+			return fail(err)
+		}
+	}
+
+	scraped, _, err := scrapeContentForTopic(ctx, sub.Topic, func(ProgressEvent) {})
+	if err != nil {
+		return fail(fmt.Errorf("failed to scrape content: %w", err))
+	}
+	known := make(map[string]bool)
+	for _, url := range sub.KnownSources {
+		known[url] = true
+	}
+	for _, source := range blog.Sources {
+		known[source.URL] = true
+	}
+	var fresh []ScrapedContent
+	for _, content := range scraped {
+		if !content.Simulated && !known[content.URL] {
+			fresh = append(fresh, content)
+		}
+	}
+	refresh.NewSources = len(fresh)
+
+	if sub.BlogID != "" && len(fresh) < sub.MinNewSources {
+		refresh.Summary = fmt.Sprintf("%d new sources, %d needed for an update", len(fresh), sub.MinNewSources)
+		return refresh, sub.BlogID, nil
+	}
+
+	var updated BlogPost
+	switch {
+	case sub.BlogID == "":
+		if len(scraped) == 0 {
+			return fail(errNoContent)
+		}
+		updated, err = refreshBlog(ctx, BlogPost{
+			ID:      uuid.New().String(),
+			Date:    time.Now().Format("2006-01-02"),
+			Topic:   sub.Topic,
+			OwnerID: sub.OwnerID,
+		}, scraped)
+		refresh.Summary = fmt.Sprintf("Generated the blog from %d sources", len(scraped))
+	case sub.Mode == SubscriptionAppend:
+		var appended int
+		updated, appended, err = appendBlogUpdate(ctx, blog, fresh)
+		refresh.Summary = fmt.Sprintf("%s. Appended an update section with %d paragraphs", describeNewSources(fresh), appended)
+	default:
+		updated, err = refreshBlog(ctx, regenerationBase(blog), scraped)
+		refresh.Summary = blogDiffSummary(blog, updated, fresh)
+	}
+	if err != nil {
+		refresh.Summary = ""
+		return fail(err)
+	}
+
+	refresh.Updated = true
+	refresh.BlogID = updated.ID
+	remembered := slices.Clone(sub.KnownSources)
+	for _, content := range scraped {
+		if !slices.Contains(remembered, content.URL) {
+			remembered = append(remembered, content.URL)
+		}
+	}
+	if len(remembered) > subscriptionKnownSources {
+		remembered = remembered[len(remembered)-subscriptionKnownSources:]
+	}
+	return refresh, updated.ID, remembered
+}
+
+// appendBlogUpdate generates an update from the new sources and appends it to the blog as
+// a dated section, citing the sources. It returns the updated blog and the number of
+// paragraphs added. The update is tracked like any other generation.
+func appendBlogUpdate(ctx context.Context, blog BlogPost, fresh []ScrapedContent) (BlogPost, int, error) {
+	paragraphs := 0
+	updated, err := trackGeneration(ctx, regenerationBase(blog), func(ctx context.Context) (BlogPost, error) {
+		var updated BlogPost
+		var err error
+		updated, paragraphs, err = generateBlogUpdate(ctx, blog, fresh)
+		return updated, err
+	})
+	return updated, paragraphs, err
+}
+
+// generateBlogUpdate runs the generate and save steps of appendBlogUpdate. An update with
+// low confidence moves the blog back to draft, as regenerating it would.
+func generateBlogUpdate(ctx context.Context, blog BlogPost, fresh []ScrapedContent) (BlogPost, int, error) {
+	recordSources(ctx, len(fresh))
+	ctx, cancel := context.WithTimeout(ctx, getEnvDuration("GENERATION_TIMEOUT", defaultGenerationTimeout))
+	defer cancel()
+
+	response, err := GenerateBlogWithLlamaIndex(ctx, LlamaIndexRequest{
+		Topic:             blog.Topic,
+		Contents:          fresh,
+		GenerationOptions: blog.GenerationOptions,
+	})
+	attempts, usage := response.Attempts, response.Usage
+	if generationAttempts(err) > 0 {
+		attempts, usage = generationAttempts(err), generationUsage(err)
+	}
+	recordUsage(ctx, attempts, usage)
+	if err != nil {
+		return BlogPost{}, 0, fmt.Errorf("failed to generate update: %w", err)
+	}
+	lowConfidence, err := checkConfidence(blog.Topic, response.Confidence)
+	if err != nil {
+		return BlogPost{}, 0, err
+	}
+
+	section := []BlogContent{{Type: "heading", Level: 2, Text: "Update: " + time.Now().Format("January 2, 2006")}}
+	if summary := strings.TrimSpace(response.Summary); summary != "" {
+		section = append(section, BlogContent{Type: "paragraph", Text: summary})
+	}
+	for _, block := range response.Content {
+		switch block.Type {
+		case "paragraph":
+			section = append(section, block)
+		case "heading":
+			// Keep the update's own headings below its section heading
+			block.Level = max(block.Level, 3)
+			section = append(section, block)
+		}
+	}
+	paragraphs := 0
+	for _, block := range section {
+		if block.Type == "paragraph" {
+			paragraphs++
+		}
+	}
+
+	sources, _ := blogSources(fresh)
+	attributeSources(section, sources)
+	updated, err := updateBlogPost(blog.ID, func(blog *BlogPost) error {
+		blog.Content = append(blog.Content, section...)
+		for _, source := range sources {
+			if !slices.ContainsFunc(blog.Sources, func(s BlogSource) bool { return s.URL == source.URL }) {
+				blog.Sources = append(blog.Sources, source)
+			}
+		}
+		blog.ReadingTime = estimateReadingTime(blog.Content)
+		if lowConfidence {
+			blog.LowConfidence = true
+			if blogStatus(*blog) != StatusDraft {
+				changeBlogStatus(blog, StatusDraft, "")
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return BlogPost{}, 0, fmt.Errorf("failed to save update: %w", err)
+	}
+	addGenerationSources(updated.ID, fresh)
+	return updated, paragraphs, nil
+}
+
+// describeNewSources summarizes the new sources, naming the first few
+func describeNewSources(fresh []ScrapedContent) string {
+	const named = 3
+	titles := make([]string, 0, named)
+	for _, content := range fresh[:min(named, len(fresh))] {
+		title := content.Title
+		if title == "" {
+			title = content.URL
+		}
+		titles = append(titles, fmt.Sprintf("%q", title))
+	}
+	description := fmt.Sprintf("%d new sources: %s", len(fresh), strings.Join(titles, ", "))
+	if len(fresh) > named {
+		description += fmt.Sprintf(" and %d more", len(fresh)-named)
+	}
+	return description
+}
+
+// blogDiffSummary describes how a regeneration changed the blog: the new sources, the
+// title, and the sections added and removed
+func blogDiffSummary(before, after BlogPost, fresh []ScrapedContent) string {
+	parts := []string{describeNewSources(fresh)}
+	if before.Title != after.Title {
+		parts = append(parts, fmt.Sprintf("Title changed from %q to %q", before.Title, after.Title))
+	}
+	headings := func(blog BlogPost) []string {
+		var texts []string
+		for _, block := range blog.Content {
+			if block.Type == "heading" {
+				texts = append(texts, block.Text)
+			}
+		}
+		return texts
+	}
+	beforeHeadings, afterHeadings := headings(before), headings(after)
+	var added, removed []string
+	for _, heading := range afterHeadings {
+		if !slices.Contains(beforeHeadings, heading) {
+			added = append(added, fmt.Sprintf("%q", heading))
+		}
+	}
+	for _, heading := range beforeHeadings {
+		if !slices.Contains(afterHeadings, heading) {
+			removed = append(removed, fmt.Sprintf("%q", heading))
+		}
+	}
+	if len(added) > 0 {
+		parts = append(parts, "Added sections "+strings.Join(added, ", "))
+	}
+	if len(removed) > 0 {
+		parts = append(parts, "Removed sections "+strings.Join(removed, ", "))
+	}
+	if len(added) == 0 && len(removed) == 0 {
+		parts = append(parts, "Same sections, rewritten")
+	}
+	return strings.Join(parts, ". ")
+}
+
+// sorted returns copies of the subscriptions, oldest first. The caller must hold s.mu.
+func (s *SubscriptionStore) sorted() []Subscription {
+	sorted := make([]Subscription, 0, len(s.subscriptions))
+	for _, sub := range s.subscriptions {
+		sorted = append(sorted, *sub)
+	}
+	slices.SortFunc(sorted, func(a, b Subscription) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	return sorted
+}
+
+// save writes the subscriptions to the store's file. The caller must hold s.mu.
+func (s *SubscriptionStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s.sorted(), "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(s.path), 0755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, data, 0644)
+}
+
+// SubscriptionRequest is the body of subscription create and update requests. Omitted
+// fields keep their current value on update; topic and blogId can only be set on create.
+type SubscriptionRequest struct {
+	Topic         *string `json:"topic"`
+	BlogID        *string `json:"blogId"`
+	Frequency     *string `json:"frequency"`
+	Mode          *string `json:"mode"`
+	MinNewSources *int    `json:"minNewSources"`
+	Enabled       *bool   `json:"enabled"`
+}
+
+// apply sets the request's settings on the subscription
+func (req SubscriptionRequest) apply(sub *Subscription) {
+	if req.Frequency != nil {
+		sub.Frequency = strings.TrimSpace(*req.Frequency)
+	}
+	if req.Mode != nil {
+		sub.Mode = strings.TrimSpace(*req.Mode)
+	}
+	if req.MinNewSources != nil {
+		sub.MinNewSources = *req.MinNewSources
+	}
+	if req.Enabled != nil {
+		sub.Enabled = *req.Enabled
+	}
+}
+
+// decodeSubscriptionRequest reads a SubscriptionRequest, answering 400 and returning
+// false if the body is invalid
+func decodeSubscriptionRequest(w http.ResponseWriter, r *http.Request) (SubscriptionRequest, bool) {
+	var req SubscriptionRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return SubscriptionRequest{}, false
+	}
+	return req, true
+}
+
+// writeSubscriptionError answers with the status matching a SubscriptionStore error
+func writeSubscriptionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errSubscriptionNotFound):
+		http.Error(w, "Subscription not found", http.StatusNotFound)
+	case errors.Is(err, errNotSubscriptionOwner):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, errInvalidSubscription):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, errSubscriptionRefreshing):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, "Failed to save subscription: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func writeSubscription(w http.ResponseWriter, status int, sub Subscription) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(sub)
+}
+
+// manageableSubscription returns the subscription with the ID in the request's path,
+// answering 404 or 403 and returning false if it doesn't exist or belongs to another user
+func manageableSubscription(w http.ResponseWriter, r *http.Request) (Subscription, bool) {
+	sub, ok := subscriptions.Get(mux.Vars(r)["id"])
+	if !ok {
+		writeSubscriptionError(w, errSubscriptionNotFound)
+		return Subscription{}, false
+	}
+	if !canManageOwnedBy(r, sub.OwnerID) {
+		writeSubscriptionError(w, errNotSubscriptionOwner)
+		return Subscription{}, false
+	}
+	return sub, true
+}
+
+func listSubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
+	listed := subscriptions.List(func(sub Subscription) bool {
+		return canManageOwnedBy(r, sub.OwnerID)
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(listed)
+}
+
+func createSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeSubscriptionRequest(w, r)
+	if !ok {
+		return
+	}
+	user, _ := requestUser(r)
+	sub := Subscription{
+		Frequency:     defaultSubscriptionFrequency,
+		Mode:          SubscriptionRegenerate,
+		MinNewSources: defaultMinNewSources,
+		Enabled:       true,
+		OwnerID:       user.ID,
+	}
+	if req.Topic != nil {
+		sub.Topic = strings.TrimSpace(*req.Topic)
+	}
+	if req.BlogID != nil && *req.BlogID != "" {
+		blog, err := getBlogByID(*req.BlogID)
+		if errors.Is(err, errBlogNotFound) || errors.Is(err, errInvalidBlogID) {
+			http.Error(w, "Blog not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to load blog: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !canManageBlog(r, blog) {
+			http.Error(w, errNotBlogOwner.Error(), http.StatusForbidden)
+			return
+		}
+		sub.BlogID = blog.ID
+		sub.OwnerID = blog.OwnerID
+		if sub.Topic == "" {
+			sub.Topic = blog.Topic
+		}
+		// The blog's current sources aren't new
+		for _, source := range blog.Sources {
+			sub.KnownSources = append(sub.KnownSources, source.URL)
+		}
+	}
+	req.apply(&sub)
+
+	created, err := subscriptions.Create(sub)
+	if err != nil {
+		writeSubscriptionError(w, err)
+		return
+	}
+	log.Printf("Created subscription %s to topic %q, refreshed every %s", created.ID, created.Topic, created.Frequency)
+	w.Header().Set("Location", "/api/subscriptions/"+created.ID)
+	writeSubscription(w, http.StatusCreated, created)
+}
+
+func getSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	sub, ok := manageableSubscription(w, r)
+	if !ok {
+		return
+	}
+	writeSubscription(w, http.StatusOK, sub)
+}
+
+func updateSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeSubscriptionRequest(w, r)
+	if !ok {
+		return
+	}
+	if req.Topic != nil || req.BlogID != nil {
+		http.Error(w, "topic and blogId can't be changed, create a new subscription instead", http.StatusBadRequest)
+		return
+	}
+	updated, err := subscriptions.Update(mux.Vars(r)["id"], func(sub *Subscription) error {
+		if !canManageOwnedBy(r, sub.OwnerID) {
+			return errNotSubscriptionOwner
+		}
+		req.apply(sub)
+		return nil
+	})
+	if err != nil {
+		writeSubscriptionError(w, err)
+		return
+	}
+	writeSubscription(w, http.StatusOK, updated)
+}
+
+func deleteSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	sub, ok := manageableSubscription(w, r)
+	if !ok {
+		return
+	}
+	if err := subscriptions.Delete(sub.ID); err != nil {
+		writeSubscriptionError(w, err)
+		return
+	}
+	log.Printf("Deleted subscription %s", sub.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// refreshSubscriptionHandler checks the subscription's topic now, in the background. The
+// outcome is added to the subscription's refreshes.
+func refreshSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	sub, ok := manageableSubscription(w, r)
+	if !ok {
+		return
+	}
+
+	if err := subscriptions.RefreshNow(sub.ID); err != nil {
+		writeSubscriptionError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", "/api/subscriptions/"+sub.ID)
+	w.WriteHeader(http.StatusAccepted)
+}
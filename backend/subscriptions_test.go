@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestAppendBlogUpdateIsTrackedAndChecksConfidence(t *testing.T) {
+	for _, action := range []string{"draft", "reject"} {
+		useImageURLStore(t, "https://blog.example.com")
+		previousLog, previousJobs := generationLog, jobManager
+		t.Cleanup(func() { generationLog, jobManager = previousLog, previousJobs })
+		generationLog = &GenerationLog{size: defaultGenerationLogSize}
+		jobManager = &JobManager{slots: make(chan struct{}, 1)}
+		t.Setenv("MIN_CONFIDENCE", "0.5")
+		t.Setenv("MIN_CONFIDENCE_ACTION", action)
+		useGenerator(t, &fakeGenerator{results: []fakeResult{{response: LlamaIndexResponse{
+			Title:      "Solar update",
+			Summary:    "Prices fell again.",
+			Content:    []BlogContent{{Type: "paragraph", Text: "Panel prices fell by a tenth this year."}},
+			Confidence: 0.2,
+			Usage:      TokenUsage{InputTokens: 10, OutputTokens: 5},
+		}}}})
+
+		blog := revisionTestBlog()
+		blog.Topic = "Solar power"
+		blog.Status = StatusPublished
+		if err := saveBlogPost(blog); err != nil {
+			t.Fatal(err)
+		}
+		fresh := []ScrapedContent{{URL: "https://news.example.com/solar", Title: "Solar news", Text: "Panel prices fell."}}
+
+		updated, paragraphs, err := appendBlogUpdate(context.Background(), blog, fresh)
+		stored, getErr := getBlogByID(blog.ID)
+		if getErr != nil {
+			t.Fatal(getErr)
+		}
+		if action == "reject" {
+			if !errors.Is(err, errLowConfidence) {
+				t.Errorf("reject: err %v, want %v", err, errLowConfidence)
+			}
+			if len(stored.Content) != len(blog.Content) || stored.Status != StatusPublished {
+				t.Errorf("reject: stored blog changed to %d blocks, status %s", len(stored.Content), stored.Status)
+			}
+		} else {
+			if err != nil {
+				t.Fatal(err)
+			}
+			if paragraphs != 2 || len(updated.Content) != len(blog.Content)+3 {
+				t.Errorf("draft: appended %d paragraphs, %d blocks, want 2 paragraphs after a heading", paragraphs, len(updated.Content)-len(blog.Content))
+			}
+			if stored.Status != StatusDraft || !stored.LowConfidence {
+				t.Errorf("draft: stored status %s, low confidence %v, want a low-confidence draft", stored.Status, stored.LowConfidence)
+			}
+		}
+
+		records := generationLog.Query(GenerationQuery{Page: 1, Limit: 10}).Generations
+		if len(records) != 1 || records[0].BlogID != blog.ID || records[0].Sources != 1 || records[0].Usage.InputTokens != 10 {
+			t.Errorf("%s: generation log %+v, want the update with its source and usage", action, records)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"unicode/utf8"
+)
+
+// defaultSummaryMinChars is the length below which a summary is flagged for review
+const defaultSummaryMinChars = 40
+
+// truncateAtWord shortens s to at most maxChars characters, cutting at the last word
+// boundary and appending an ellipsis
+func truncateAtWord(s string, maxChars int) string {
+	if utf8.RuneCountInString(s) <= maxChars {
+		return s
+	}
+
+	runes := []rune(s)
+	cut := string(runes[:max(maxChars-1, 0)])
+	if i := strings.LastIndexAny(cut, " \t\n"); i > 0 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " \t\n,;:.-") + "…"
+}
+
+// processSummary applies the configured summary length rules. It returns the summary to
+// store, the original summary if it was truncated, and whether the summary looks too short.
+func processSummary(summary string) (string, string, bool) {
+	summary = strings.TrimSpace(summary)
+	original := ""
+
+	if maxChars := getEnvInt("SUMMARY_MAX_CHARS", 0); maxChars > 0 && utf8.RuneCountInString(summary) > maxChars {
+		original = summary
+		summary = truncateAtWord(summary, maxChars)
+		log.Printf("Truncated summary from %d to %d characters", utf8.RuneCountInString(original), utf8.RuneCountInString(summary))
+	}
+
+	needsReview := utf8.RuneCountInString(summary) < getEnvInt("SUMMARY_MIN_CHARS", defaultSummaryMinChars)
+	return summary, original, needsReview
+}
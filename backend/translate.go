@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// errTranslationNotFound is returned when a blog has no translation into the requested
+// language
+var errTranslationNotFound = errors.New("translation not found")
+
+// translationSystemPrompt is the system prompt of every translation request
+const translationSystemPrompt = `You are a translator working on a blog post.
+Translate the text you are given into the requested language, keeping its meaning, tone and formatting.
+Leave names, code, URLs and quotes in their original form when they have no usual translation.
+Respond in the format you are asked for, without notes or explanations.`
+
+// translationMetadata is the part of a blog translated in one request, the content blocks
+// being translated one at a time
+type translationMetadata struct {
+	Title   string   `json:"title"`
+	Summary string   `json:"summary"`
+	Tags    []string `json:"tags"`
+}
+
+// translator translates a blog's text with the model, adding up its calls and usage
+type translator struct {
+	completer Completer
+	language  string
+	calls     int
+	usage     TokenUsage
+}
+
+// complete sends a translation prompt to the model
+func (t *translator) complete(ctx context.Context, prompt string) (string, error) {
+	text, usage, err := t.completer.Complete(ctx, translationSystemPrompt, prompt)
+	t.calls++
+	t.usage = t.usage.Add(usage)
+	if err != nil {
+		return "", fmt.Errorf("failed to translate blog: %w", err)
+	}
+	return strings.TrimSpace(text), nil
+}
+
+// text translates a piece of plain text, leaving empty text alone
+func (t *translator) text(ctx context.Context, text string) (string, error) {
+	if strings.TrimSpace(text) == "" {
+		return text, nil
+	}
+	prompt := fmt.Sprintf("Translate this text into %s (%s). Respond with only the translation.\n\n%s", languageName(t.language), t.language, text)
+	translated, err := t.complete(ctx, prompt)
+	if err != nil {
+		return "", err
+	}
+	if translated == "" {
+		return "", fmt.Errorf("%w: the translation is empty", errInvalidLlamaResponse)
+	}
+	return translated, nil
+}
+
+// metadata translates the blog's title, summary and tags
+func (t *translator) metadata(ctx context.Context, blog BlogPost) (translationMetadata, error) {
+	original, err := json.MarshalIndent(translationMetadata{Title: blog.Title, Summary: blog.Summary, Tags: blog.Tags}, "", "  ")
+	if err != nil {
+		return translationMetadata{}, err
+	}
+	prompt := fmt.Sprintf("Translate the values of this JSON object into %s (%s), keeping its keys and the number of tags. Respond with the translated JSON object.\n\n%s", languageName(t.language), t.language, original)
+	text, err := t.complete(ctx, prompt)
+	if err != nil {
+		return translationMetadata{}, err
+	}
+
+	var translated translationMetadata
+	if err := decodeModelJSON(text, &translated); err != nil {
+		return translationMetadata{}, fmt.Errorf("%w: translated title and summary are not valid JSON: %v", errInvalidLlamaResponse, err)
+	}
+	if strings.TrimSpace(translated.Title) == "" {
+		return translationMetadata{}, fmt.Errorf("%w: the translated title is empty", errInvalidLlamaResponse)
+	}
+	return translated, nil
+}
+
+// translateBlog returns a copy of the blog with its title, summary, tags and each content
+// block translated into the language. Images keep their URLs, with their alt text and
+// caption translated. The copy has no identity or workflow state of its own yet.
+func translateBlog(ctx context.Context, completer Completer, blog BlogPost, language string) (BlogPost, error) {
+	ctx, cancel := context.WithTimeout(ctx, getEnvDuration("GENERATION_TIMEOUT", defaultGenerationTimeout))
+	defer cancel()
+	t := &translator{completer: completer, language: language}
+	defer func() { recordUsage(ctx, t.calls, t.usage) }()
+
+	metadata, err := t.metadata(ctx, blog)
+	if err != nil {
+		return BlogPost{}, err
+	}
+
+	content := make([]BlogContent, len(blog.Content))
+	for i, block := range blog.Content {
+		switch block.Type {
+		case "heading", "paragraph":
+			block.Text, err = t.text(ctx, block.Text)
+		case "image":
+			block.Alt, err = t.text(ctx, block.Alt)
+			if err == nil {
+				block.Caption, err = t.text(ctx, block.Caption)
+			}
+		}
+		if err != nil {
+			return BlogPost{}, fmt.Errorf("block %d: %w", i, err)
+		}
+		content[i] = block
+	}
+
+	translation := blog
+	translation.Title = metadata.Title
+	translation.Summary = metadata.Summary
+	translation.Tags = metadata.Tags
+	translation.Content = content
+	translation.ReadingTime = estimateReadingTime(content)
+	translation.Language = language
+	translation.LengthMismatch = checkLength(content, blog.Length) != nil
+	translation.OriginalSummary = ""
+	translation.SummaryNeedsReview = false
+	translation.TranslationOf = blog.ID
+	translation.Translations = nil
+	return translation, nil
+}
+
+// saveTranslation stores a translation of the blog with sourceID and links it from there.
+// A translation replacing an earlier one into the same language keeps its ID, slug and
+// workflow status as a new revision; new translations are drafts with the ID newID.
+func saveTranslation(sourceID, newID string, translation BlogPost) (BlogPost, error) {
+	blogStorageMu.Lock()
+	defer blogStorageMu.Unlock()
+
+	source, err := blogStore.GetByID(sourceID)
+	if err != nil {
+		return BlogPost{}, err
+	}
+
+	existing, err := blogStore.GetByID(source.Translations[translation.Language])
+	switch {
+	case err == nil:
+		translation = withBookkeeping(translation, existing)
+	case errors.Is(err, errBlogNotFound), errors.Is(err, errInvalidBlogID):
+		translation.ID = newID
+		translation.Slug = slugify(translation.Title)
+		translation.Date = time.Now().Format("2006-01-02")
+		translation.Status = StatusDraft
+		translation.SubmittedAt = ""
+		translation.PublishedAt = ""
+		translation.StatusChanges = nil
+		translation.Publications = nil
+		translation.Revision = 0
+		// The source's canonical URL was copied along with it
+		translation.CanonicalURL = ""
+	default:
+		return BlogPost{}, err
+	}
+	if err := storeBlogPost(&translation); err != nil {
+		return BlogPost{}, fmt.Errorf("failed to save translation: %w", err)
+	}
+
+	if source.Translations[translation.Language] != translation.ID {
+		if source.Translations == nil {
+			source.Translations = make(map[string]string)
+		}
+		source.Translations[translation.Language] = translation.ID
+		if err := storeBlogPost(&source); err != nil {
+			return BlogPost{}, fmt.Errorf("failed to link translation: %w", err)
+		}
+	}
+	return translation, nil
+}
+
+// unlinkTranslation removes a deleted translation from the blog it was translated from.
+// The caller must hold blogStorageMu.
+func unlinkTranslation(translation BlogPost) {
+	source, err := blogStore.GetByID(translation.TranslationOf)
+	if err != nil {
+		return
+	}
+	for language, id := range source.Translations {
+		if id == translation.ID {
+			delete(source.Translations, language)
+		}
+	}
+	if err := storeBlogPost(&source); err != nil {
+		log.Printf("Failed to unlink translation %s from blog %s: %v", translation.ID, source.ID, err)
+	}
+}
+
+// blogTranslation returns the variant of the blog in the language: the blog itself, the
+// blog it was translated from or one of their translations. A language without a region
+// matches its regional variants, so de finds a de-AT translation.
+func blogTranslation(blog BlogPost, raw string) (BlogPost, error) {
+	language, err := parseLanguage(raw)
+	if err != nil {
+		return BlogPost{}, err
+	}
+	if strings.EqualFold(blogLanguage(blog), language) {
+		return blog, nil
+	}
+	if blog.TranslationOf != "" {
+		source, err := getBlogByID(blog.TranslationOf)
+		if err != nil && !errors.Is(err, errBlogNotFound) {
+			return BlogPost{}, err
+		}
+		if err == nil {
+			blog = source
+		}
+	}
+	if matchesLanguage(blogLanguage(blog), language) {
+		return blog, nil
+	}
+
+	id, ok := blog.Translations[language]
+	if !ok {
+		for _, tag := range slices.Sorted(maps.Keys(blog.Translations)) {
+			if matchesLanguage(tag, language) {
+				id, ok = blog.Translations[tag], true
+				break
+			}
+		}
+	}
+	if !ok {
+		return BlogPost{}, fmt.Errorf("%w: the blog has no translation into %s", errTranslationNotFound, language)
+	}
+	translation, err := getBlogByID(id)
+	if errors.Is(err, errBlogNotFound) {
+		return BlogPost{}, fmt.Errorf("%w: the blog has no translation into %s", errTranslationNotFound, language)
+	}
+	return translation, err
+}
+
+// translateBlogHandler translates a blog into {"language": "..."} with the model, storing
+// the result as a blog linked from the original and returning it. Translating a
+// translation translates its original, and translating into a language again replaces the
+// earlier translation.
+func translateBlogHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	var reqBody struct {
+		Language string `json:"language"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	language, err := parseLanguage(reqBody.Language)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	source, err := getBlogByID(id)
+	if err == nil && source.TranslationOf != "" {
+		source, err = getBlogByID(source.TranslationOf)
+	}
+	if errors.Is(err, errInvalidBlogID) {
+		http.Error(w, "Invalid blog ID", http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, errBlogNotFound) {
+		http.Error(w, "Blog not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to load blog: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !canManageBlog(r, source) {
+		http.Error(w, errNotBlogOwner.Error(), http.StatusForbidden)
+		return
+	}
+	if strings.EqualFold(blogLanguage(source), language) {
+		http.Error(w, "The blog is already in "+language, http.StatusBadRequest)
+		return
+	}
+	completer, err := selectedCompleter()
+	if errors.Is(err, errCompletionUnsupported) {
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	translationID := source.Translations[language]
+	if translationID == "" {
+		translationID = uuid.New().String()
+	}
+	base := BlogPost{ID: translationID, Topic: source.Topic, OwnerID: source.OwnerID}
+	blog, err := trackGeneration(r.Context(), base, func(ctx context.Context) (BlogPost, error) {
+		translation, err := translateBlog(ctx, completer, source, language)
+		if err != nil {
+			return BlogPost{}, err
+		}
+		return saveTranslation(source.ID, translationID, translation)
+	})
+	if errors.Is(err, errBlogNotFound) {
+		http.Error(w, "Blog not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to translate blog: "+err.Error(), generationErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(blog)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"syscall"
+)
+
+// errForbiddenURL is returned for URLs the server refuses to fetch on a client's behalf
+var errForbiddenURL = errors.New("URL is not allowed")
+
+// defaultImageHosts are the image hosts used by the generator in addition to the scrape allowlist
+var defaultImageHosts = []string{
+	"images.pexels.com",
+	"via.placeholder.com",
+}
+
+// reservedRanges are non-public ranges the net.IP methods don't cover
+var reservedRanges = []*net.IPNet{
+	mustParseCIDR("0.0.0.0/8"),     // "this network"
+	mustParseCIDR("100.64.0.0/10"), // carrier-grade NAT
+	mustParseCIDR("192.0.0.0/24"),  // IETF protocol assignments
+	mustParseCIDR("198.18.0.0/15"), // benchmarking
+	mustParseCIDR("240.0.0.0/4"),   // reserved, including broadcast
+	mustParseCIDR("64:ff9b::/96"),  // NAT64, which can reach private IPv4 addresses
+}
+
+func mustParseCIDR(cidr string) *net.IPNet {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return network
+}
+
+// imageAllowedHosts returns the hosts the image proxy may fetch from, configurable with a
+// comma-separated IMAGE_ALLOWED_HOSTS
+func imageAllowedHosts() []string {
+	if raw := getEnv("IMAGE_ALLOWED_HOSTS", ""); raw != "" {
+		return splitList(raw)
+	}
+	return append(append([]string{}, scrapeAllowedDomains()...), defaultImageHosts...)
+}
+
+// splitList splits a comma-separated list of case-insensitive entries, lowercasing them and
+// dropping empty ones
+func splitList(raw string) []string {
+	items := splitTrimmedList(raw)
+	for i, item := range items {
+		items[i] = strings.ToLower(item)
+	}
+	return items
+}
+
+// splitTrimmedList splits a comma-separated list, trimming the entries and dropping empty
+// ones but keeping their case
+func splitTrimmedList(raw string) []string {
+	var items []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// hostAllowed reports whether host equals, or is a subdomain of, one of the allowed hosts
+func hostAllowed(host string, allowed []string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, entry := range allowed {
+		if host == entry || strings.HasSuffix(host, "."+entry) {
+			return true
+		}
+	}
+	return false
+}
+
+// isPublicIP reports whether ip is routable on the public internet
+func isPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() ||
+		ip.IsUnspecified() {
+		return false
+	}
+	for _, network := range reservedRanges {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// validateImageURL checks that the URL is http(s) on its default port, on an allowed host,
+// and resolves only to public IPs
+func validateImageURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errForbiddenURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("%w: scheme %q", errForbiddenURL, u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("%w: missing host", errForbiddenURL)
+	}
+	if port := u.Port(); port != "" && port != "80" && port != "443" {
+		return nil, fmt.Errorf("%w: port %s", errForbiddenURL, port)
+	}
+	if u.User != nil {
+		return nil, fmt.Errorf("%w: credentials in URL", errForbiddenURL)
+	}
+	if !hostAllowed(u.Hostname(), imageAllowedHosts()) {
+		return nil, fmt.Errorf("%w: host %s is not allowlisted", errForbiddenURL, u.Hostname())
+	}
+
+	ips, err := net.LookupIP(u.Hostname())
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %v", u.Hostname(), err)
+	}
+	for _, ip := range ips {
+		if !isPublicIP(ip) {
+			return nil, fmt.Errorf("%w: %s resolves to non-public address %s", errForbiddenURL, u.Hostname(), ip)
+		}
+	}
+	return u, nil
+}
+
+// publicOnlyControl is a net.Dialer Control hook that refuses connections to non-public
+// addresses, so DNS answers that change after validation can't reach internal services
+func publicOnlyControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !isPublicIP(ip) {
+		return fmt.Errorf("%w: connection to non-public address %s", errForbiddenURL, host)
+	}
+	return nil
+}
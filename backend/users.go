@@ -0,0 +1,405 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Account defaults, overridable with JWT_TTL
+const (
+	defaultJWTTTL     = 24 * time.Hour
+	minPasswordLength = 8
+)
+
+// Errors returned by the UserStore
+var (
+	errEmailTaken         = errors.New("an account with this email already exists")
+	errInvalidCredentials = errors.New("invalid email or password")
+	errUserNotFound       = errors.New("user not found")
+	errLastAdmin          = errors.New("the last admin can't lose the admin role")
+	errRegistrationClosed = errors.New("registration requires an admin login, an API key or the bootstrap token")
+)
+
+// User is an account that can log in and owns the blogs it generates
+type User struct {
+	ID           string    `json:"id"`
+	Email        string    `json:"email"`
+	Role         string    `json:"role"`
+	PasswordHash string    `json:"passwordHash,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// public returns the user without its password hash
+func (u User) public() User {
+	u.PasswordHash = ""
+	return u
+}
+
+// UserStore holds the accounts in a JSON file
+type UserStore struct {
+	mu    sync.Mutex
+	path  string
+	users map[string]*User
+}
+
+var users = &UserStore{users: make(map[string]*User)}
+
+// usersFile is where accounts are saved, USERS_FILE or users.json in the data directory
+func usersFile() string {
+	return getEnv("USERS_FILE", dataPath("users.json"))
+}
+
+// Load reads the accounts saved at path. A missing file means there are no accounts yet.
+func (s *UserStore) Load(path string) error {
+	loaded := make(map[string]*User)
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		var stored []User
+		if err := json.Unmarshal(data, &stored); err != nil {
+			return fmt.Errorf("failed to parse %s: %v", path, err)
+		}
+		for _, user := range stored {
+			user := user
+			// Accounts registered before roles existed could already generate blogs
+			if user.Role == "" {
+				user.Role = RoleEditor
+			}
+			loaded[user.ID] = &user
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.path = path
+	s.users = loaded
+	return nil
+}
+
+// Enabled reports whether any account exists
+func (s *UserStore) Enabled() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.users) > 0
+}
+
+// Get returns the account with the ID
+func (s *UserStore) Get(id string) (User, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return User{}, false
+	}
+	return *user, true
+}
+
+// List returns the accounts, oldest first
+func (s *UserStore) List() []User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sorted()
+}
+
+// SetRole changes the account's role, refusing to demote the last admin
+func (s *UserStore) SetRole(id, role string) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return User{}, errUserNotFound
+	}
+	if user.Role == RoleAdmin && role != RoleAdmin {
+		admins := 0
+		for _, other := range s.users {
+			if other.Role == RoleAdmin {
+				admins++
+			}
+		}
+		if admins == 1 {
+			return User{}, errLastAdmin
+		}
+	}
+
+	previous := user.Role
+	user.Role = role
+	if err := s.save(); err != nil {
+		user.Role = previous
+		return User{}, err
+	}
+	return *user, nil
+}
+
+// Register creates an account, rejecting an email that is already registered. roleFor
+// picks the account's role, told whether it is the first account, or rejects the
+// registration. It is called with s.mu held.
+func (s *UserStore) Register(email, password string, roleFor func(first bool) (string, error)) (User, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return User{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.users {
+		if strings.EqualFold(existing.Email, email) {
+			return User{}, errEmailTaken
+		}
+	}
+	role, err := roleFor(len(s.users) == 0)
+	if err != nil {
+		return User{}, err
+	}
+	user := &User{
+		ID:           uuid.New().String(),
+		Email:        email,
+		Role:         role,
+		PasswordHash: string(hash),
+		CreatedAt:    time.Now(),
+	}
+	s.users[user.ID] = user
+	if err := s.save(); err != nil {
+		delete(s.users, user.ID)
+		return User{}, err
+	}
+	return *user, nil
+}
+
+// Authenticate returns the account with the email if the password matches
+func (s *UserStore) Authenticate(email, password string) (User, error) {
+	s.mu.Lock()
+	var found *User
+	for _, user := range s.users {
+		if strings.EqualFold(user.Email, email) {
+			found = user
+			break
+		}
+	}
+	s.mu.Unlock()
+
+	if found == nil {
+		return User{}, errInvalidCredentials
+	}
+	if bcrypt.CompareHashAndPassword([]byte(found.PasswordHash), []byte(password)) != nil {
+		return User{}, errInvalidCredentials
+	}
+	return *found, nil
+}
+
+// save writes the accounts. The caller must hold s.mu.
+func (s *UserStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(s.sorted(), "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(s.path), 0755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, data, 0600)
+}
+
+// sorted returns copies of the accounts, oldest first. The caller must hold s.mu.
+func (s *UserStore) sorted() []User {
+	list := make([]User, 0, len(s.users))
+	for _, user := range s.users {
+		list = append(list, *user)
+	}
+	slices.SortFunc(list, func(a, b User) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return list
+}
+
+// jwtSecret signs the login tokens. Without JWT_SECRET a random secret is used, so tokens
+// stop working when the server restarts.
+var jwtSecret = sync.OnceValue(func() []byte {
+	if secret := getEnv("JWT_SECRET", ""); secret != "" {
+		return []byte(secret)
+	}
+	log.Println("Warning: JWT_SECRET is not set, login tokens will be invalid after a restart")
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(err)
+	}
+	return secret
+})
+
+// issueToken returns a signed JWT identifying the user, valid for JWT_TTL
+func issueToken(user User) (string, time.Time, error) {
+	now := time.Now()
+	expires := now.Add(getEnvDuration("JWT_TTL", defaultJWTTTL))
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Subject:   user.ID,
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(expires),
+	})
+	signed, err := token.SignedString(jwtSecret())
+	return signed, expires, err
+}
+
+// userFromToken returns the account identified by a valid, unexpired token
+func userFromToken(raw string) (User, bool) {
+	var claims jwt.RegisteredClaims
+	_, err := jwt.ParseWithClaims(raw, &claims, func(*jwt.Token) (interface{}, error) {
+		return jwtSecret(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return User{}, false
+	}
+	return users.Get(claims.Subject)
+}
+
+// Credentials is the body of the register and login requests
+type Credentials struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	// BootstrapToken is BOOTSTRAP_TOKEN, letting registration create the first account
+	BootstrapToken string `json:"bootstrapToken,omitempty"`
+}
+
+// AuthResponse carries a login token and the account it identifies
+type AuthResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	User      User      `json:"user"`
+}
+
+// decodeCredentials reads the credentials in the request body, responding with 400 and
+// reporting false if they are missing
+func decodeCredentials(w http.ResponseWriter, r *http.Request) (Credentials, bool) {
+	var credentials Credentials
+	if err := json.NewDecoder(r.Body).Decode(&credentials); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return credentials, false
+	}
+	credentials.Email = strings.TrimSpace(credentials.Email)
+	if credentials.Email == "" || credentials.Password == "" {
+		http.Error(w, "Email and password are required", http.StatusBadRequest)
+		return credentials, false
+	}
+	return credentials, true
+}
+
+func writeAuthResponse(w http.ResponseWriter, status int, user User) {
+	token, expires, err := issueToken(user)
+	if err != nil {
+		http.Error(w, "Failed to issue token: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(AuthResponse{Token: token, ExpiresAt: expires, User: user.public()})
+}
+
+// registrationRole returns the role of an account registered by the request, as Register
+// expects. The first account becomes an admin when an admin API key or BOOTSTRAP_TOKEN
+// creates it, or while the server has neither keys nor a bootstrap token. Admins and admin
+// API keys create later accounts with USER_DEFAULT_ROLE. Anyone else may only sign up as a viewer,
+// and only with OPEN_REGISTRATION=true.
+func registrationRole(r *http.Request, bootstrapToken string) func(first bool) (string, error) {
+	principal := requestPrincipal(r)
+	privileged := principal.Role() == RoleAdmin
+	expected := getEnv("BOOTSTRAP_TOKEN", "")
+	bootstrapped := expected != "" && subtle.ConstantTimeCompare([]byte(bootstrapToken), []byte(expected)) == 1
+	unprotected := expected == "" && !apiKeys.Enabled()
+
+	return func(first bool) (string, error) {
+		switch {
+		case first && (privileged || bootstrapped || unprotected):
+			return RoleAdmin, nil
+		case first:
+			return "", errRegistrationClosed
+		case privileged:
+			return defaultUserRole(), nil
+		case getEnvBool("OPEN_REGISTRATION", false):
+			return RoleViewer, nil
+		default:
+			return "", errRegistrationClosed
+		}
+	}
+}
+
+func registerHandler(w http.ResponseWriter, r *http.Request) {
+	credentials, ok := decodeCredentials(w, r)
+	if !ok {
+		return
+	}
+	if _, err := mail.ParseAddress(credentials.Email); err != nil {
+		http.Error(w, "Email is not a valid address", http.StatusBadRequest)
+		return
+	}
+	if len(credentials.Password) < minPasswordLength {
+		http.Error(w, fmt.Sprintf("Password must be at least %d characters", minPasswordLength), http.StatusBadRequest)
+		return
+	}
+
+	user, err := users.Register(credentials.Email, credentials.Password, registrationRole(r, credentials.BootstrapToken))
+	if errors.Is(err, errEmailTaken) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if errors.Is(err, errRegistrationClosed) {
+		writeJSONError(w, http.StatusForbidden, err.Error())
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to register: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Registered user %s", user.ID)
+
+	writeAuthResponse(w, http.StatusCreated, user)
+}
+
+func loginHandler(w http.ResponseWriter, r *http.Request) {
+	credentials, ok := decodeCredentials(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := users.Authenticate(credentials.Email, credentials.Password)
+	if err != nil {
+		writeJSONError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	writeAuthResponse(w, http.StatusOK, user)
+}
+
+func currentUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := requestUser(r)
+	if !ok {
+		writeJSONError(w, http.StatusUnauthorized, "a login token is required")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user.public())
+}
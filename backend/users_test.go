@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// useAuthStores replaces the account and API key stores with empty ones for the test,
+// loading the configured keys
+func useAuthStores(t *testing.T, keys ...ConfigAPIKey) {
+	t.Helper()
+	previousUsers, previousKeys := users, apiKeys
+	t.Cleanup(func() { users, apiKeys = previousUsers, previousKeys })
+
+	t.Setenv("API_KEY", "")
+	users = &UserStore{users: make(map[string]*User)}
+	apiKeys = &APIKeyStore{keys: make(map[string]*APIKey)}
+	if err := apiKeys.Load(keys, filepath.Join(t.TempDir(), "api-keys.json")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// register posts the body to the registration endpoint through authMiddleware with the
+// credential, returning the response
+func register(t *testing.T, body, credential string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/register", strings.NewReader(body))
+	if credential != "" {
+		req.Header.Set("X-API-Key", credential)
+	}
+	rec := httptest.NewRecorder()
+	authMiddleware(http.HandlerFunc(registerHandler)).ServeHTTP(rec, req)
+	return rec
+}
+
+// registeredRole returns the role of the account in a registration response
+func registeredRole(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	var response AuthResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("decoding response %q: %v", rec.Body.String(), err)
+	}
+	return response.User.Role
+}
+
+func TestRegisterWithoutAuthMakesFirstAccountAdmin(t *testing.T) {
+	useAuthStores(t)
+	t.Setenv("BOOTSTRAP_TOKEN", "")
+	t.Setenv("OPEN_REGISTRATION", "")
+
+	rec := register(t, `{"email": "first@example.com", "password": "password1"}`, "")
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("first registration: status %d: %s", rec.Code, rec.Body)
+	}
+	if role := registeredRole(t, rec); role != RoleAdmin {
+		t.Errorf("first account role = %q, want %q", role, RoleAdmin)
+	}
+
+	rec = register(t, `{"email": "second@example.com", "password": "password2"}`, "")
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("anonymous second registration: status %d, want %d", rec.Code, http.StatusForbidden)
+	}
+}
+
+func TestRegisterFirstAccountWithAPIKeys(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		credential string
+		wantStatus int
+	}{
+		{"anonymous", `{"email": "a@example.com", "password": "password1"}`, "", http.StatusForbidden},
+		{"wrong bootstrap token", `{"email": "a@example.com", "password": "password1", "bootstrapToken": "nope"}`, "", http.StatusForbidden},
+		{"bootstrap token", `{"email": "a@example.com", "password": "password1", "bootstrapToken": "boot"}`, "", http.StatusCreated},
+		{"admin API key", `{"email": "a@example.com", "password": "password1"}`, "admin-key", http.StatusCreated},
+		{"editor API key", `{"email": "a@example.com", "password": "password1"}`, "ci-key", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useAuthStores(t, ConfigAPIKey{Name: "ci", Key: "ci-key"}, ConfigAPIKey{Name: "admin", Key: "admin-key", Admin: true})
+			t.Setenv("BOOTSTRAP_TOKEN", "boot")
+
+			rec := register(t, tt.body, tt.credential)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if rec.Code == http.StatusCreated && registeredRole(t, rec) != RoleAdmin {
+				t.Errorf("first account isn't an admin")
+			}
+		})
+	}
+}
+
+func TestRegisterLaterAccounts(t *testing.T) {
+	tests := []struct {
+		name       string
+		open       string
+		credential string
+		wantStatus int
+		wantRole   string
+	}{
+		{"anonymous", "", "", http.StatusForbidden, ""},
+		{"anonymous with open registration", "true", "", http.StatusCreated, RoleViewer},
+		{"admin API key", "", "admin-key", http.StatusCreated, RoleEditor},
+		{"editor API key", "", "ci-key", http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useAuthStores(t, ConfigAPIKey{Name: "ci", Key: "ci-key"}, ConfigAPIKey{Name: "admin", Key: "admin-key", Admin: true})
+			t.Setenv("OPEN_REGISTRATION", tt.open)
+			t.Setenv("USER_DEFAULT_ROLE", "")
+			if rec := register(t, `{"email": "admin@example.com", "password": "password1"}`, "admin-key"); rec.Code != http.StatusCreated {
+				t.Fatalf("registering the first account: status %d: %s", rec.Code, rec.Body)
+			}
+
+			rec := register(t, `{"email": "later@example.com", "password": "password2"}`, tt.credential)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantRole != "" {
+				if role := registeredRole(t, rec); role != tt.wantRole {
+					t.Errorf("role = %q, want %q", role, tt.wantRole)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,605 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Events delivered to webhooks
+const (
+	EventGenerationStarted   = "generation.started"
+	EventGenerationCompleted = "generation.completed"
+	EventGenerationFailed    = "generation.failed"
+	EventBlogDeleted         = "blog.deleted"
+)
+
+// webhookEvents lists the events a webhook can subscribe to
+var webhookEvents = []string{
+	EventGenerationStarted,
+	EventGenerationCompleted,
+	EventGenerationFailed,
+	EventBlogDeleted,
+}
+
+// Webhook delivery defaults, overridable with WEBHOOK_MAX_ATTEMPTS and WEBHOOK_RETRY_DELAY.
+// The retry delay doubles after each failed attempt.
+const (
+	defaultWebhookMaxAttempts = 5
+	defaultWebhookRetryDelay  = 5 * time.Second
+	webhookDeliveryLogSize    = 50
+)
+
+// Delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// errWebhookNotFound is returned for unknown webhook IDs
+var errWebhookNotFound = errors.New("webhook not found")
+
+// Webhook is a URL that receives signed JSON payloads for the events it subscribed to
+type Webhook struct {
+	ID     string   `json:"id"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	// OwnerID is the user who registered the webhook. Webhooks with an owner receive the
+	// events of that user's blogs, the others every event.
+	OwnerID string `json:"ownerId,omitempty"`
+	// Secret signs the payloads. It is only returned when the webhook is created.
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// public returns the webhook without its secret
+func (h Webhook) public() Webhook {
+	h.Secret = ""
+	return h
+}
+
+// receives reports whether the webhook subscribed to the event
+func (h Webhook) receives(event WebhookEvent) bool {
+	return slices.Contains(h.Events, event.Type) && (h.OwnerID == "" || h.OwnerID == event.ownerID)
+}
+
+// WebhookEvent is the JSON payload delivered to webhooks
+type WebhookEvent struct {
+	// ID identifies the event, and stays the same when a delivery is retried
+	ID        string      `json:"id"`
+	Type      string      `json:"event"`
+	CreatedAt time.Time   `json:"createdAt"`
+	Data      interface{} `json:"data"`
+	// ownerID is the owner of the blog the event is about
+	ownerID string
+}
+
+// GenerationEventData is the data of the generation events
+type GenerationEventData struct {
+	Topic  string     `json:"topic"`
+	BlogID string     `json:"blogId"`
+	Error  string     `json:"error,omitempty"`
+	Blog   *EventBlog `json:"blog,omitempty"`
+}
+
+// BlogDeletedEventData is the data of blog.deleted events
+type BlogDeletedEventData struct {
+	BlogID string     `json:"blogId"`
+	Blog   *EventBlog `json:"blog,omitempty"`
+}
+
+// EventBlog describes the blog an event is about
+type EventBlog struct {
+	ID            string   `json:"id"`
+	Title         string   `json:"title"`
+	Summary       string   `json:"summary"`
+	Status        string   `json:"status"`
+	Tags          []string `json:"tags"`
+	URL           string   `json:"url"`
+	FeaturedImage string   `json:"featuredImage,omitempty"`
+}
+
+// eventBlog describes the blog for event payloads, with links that work outside the backend
+func eventBlog(blog BlogPost) *EventBlog {
+	described := &EventBlog{
+		ID:      blog.ID,
+		Title:   blog.Title,
+		Summary: blog.Summary,
+		Status:  blogStatus(blog),
+		Tags:    blog.Tags,
+		URL:     blogLink(blog),
+	}
+	if blog.FeaturedImage != "" {
+		described.FeaturedImage = remoteImageURL(blog.FeaturedImage)
+	}
+	return described
+}
+
+// WebhookDelivery records the delivery of an event to a webhook, across its attempts
+type WebhookDelivery struct {
+	ID        string `json:"id"`
+	WebhookID string `json:"webhookId"`
+	EventID   string `json:"eventId"`
+	Event     string `json:"event"`
+	// Status is DeliveryPending while attempts remain, then DeliverySucceeded or DeliveryFailed
+	Status   string `json:"status"`
+	Attempts int    `json:"attempts"`
+	// StatusCode and Error describe the last attempt
+	StatusCode int       `json:"statusCode,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// WebhookStore holds the webhooks in a JSON file, and the latest deliveries to each in memory
+type WebhookStore struct {
+	mu    sync.Mutex
+	path  string
+	hooks map[string]*Webhook
+	// deliveries holds the latest webhookDeliveryLogSize deliveries of each webhook, oldest first
+	deliveries map[string][]*WebhookDelivery
+}
+
+var webhooks = &WebhookStore{
+	hooks:      make(map[string]*Webhook),
+	deliveries: make(map[string][]*WebhookDelivery),
+}
+
+// webhooksFile is where webhooks are saved, WEBHOOKS_FILE or webhooks.json in the data directory
+func webhooksFile() string {
+	return getEnv("WEBHOOKS_FILE", dataPath("webhooks.json"))
+}
+
+// Load reads the webhooks saved at path. A missing file means there are no webhooks yet.
+func (s *WebhookStore) Load(path string) error {
+	loaded := make(map[string]*Webhook)
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		var stored []Webhook
+		if err := json.Unmarshal(data, &stored); err != nil {
+			return fmt.Errorf("failed to parse %s: %v", path, err)
+		}
+		for _, hook := range stored {
+			hook := hook
+			loaded[hook.ID] = &hook
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.path = path
+	s.hooks = loaded
+	return nil
+}
+
+// List returns the webhooks for which keep returns true, without their secrets, oldest first
+func (s *WebhookStore) List(keep func(Webhook) bool) []Webhook {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hooks := []Webhook{}
+	for _, hook := range s.sorted() {
+		if keep(hook) {
+			hooks = append(hooks, hook.public())
+		}
+	}
+	return hooks
+}
+
+// Get returns the webhook with the ID
+func (s *WebhookStore) Get(id string) (Webhook, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hook, ok := s.hooks[id]
+	if !ok {
+		return Webhook{}, false
+	}
+	return *hook, true
+}
+
+// Create registers a webhook with a new signing secret and saves it
+func (s *WebhookStore) Create(target string, events []string, ownerID string) (Webhook, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return Webhook{}, err
+	}
+	hook := &Webhook{
+		ID:        uuid.New().String(),
+		URL:       target,
+		Events:    events,
+		OwnerID:   ownerID,
+		Secret:    "whsec_" + base64.RawURLEncoding.EncodeToString(secret),
+		CreatedAt: time.Now(),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.hooks[hook.ID] = hook
+	if err := s.save(); err != nil {
+		delete(s.hooks, hook.ID)
+		return Webhook{}, err
+	}
+	return *hook, nil
+}
+
+// Delete removes the webhook and its delivery log
+func (s *WebhookStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hook, ok := s.hooks[id]
+	if !ok {
+		return errWebhookNotFound
+	}
+	delete(s.hooks, id)
+	if err := s.save(); err != nil {
+		s.hooks[id] = hook
+		return err
+	}
+	delete(s.deliveries, id)
+	return nil
+}
+
+// Deliveries returns copies of the webhook's latest deliveries, newest first
+func (s *WebhookStore) Deliveries(id string) []WebhookDelivery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	logged := s.deliveries[id]
+	deliveries := make([]WebhookDelivery, 0, len(logged))
+	for i := len(logged) - 1; i >= 0; i-- {
+		deliveries = append(deliveries, *logged[i])
+	}
+	return deliveries
+}
+
+// subscribers returns the webhooks that receive the event
+func (s *WebhookStore) subscribers(event WebhookEvent) []Webhook {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var hooks []Webhook
+	for _, hook := range s.sorted() {
+		if hook.receives(event) {
+			hooks = append(hooks, hook)
+		}
+	}
+	return hooks
+}
+
+// logDelivery adds a pending delivery to the webhook's log, dropping the oldest past
+// webhookDeliveryLogSize
+func (s *WebhookStore) logDelivery(hook Webhook, event WebhookEvent) string {
+	now := time.Now()
+	delivery := &WebhookDelivery{
+		ID:        uuid.New().String(),
+		WebhookID: hook.ID,
+		EventID:   event.ID,
+		Event:     event.Type,
+		Status:    DeliveryPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	logged := append(s.deliveries[hook.ID], delivery)
+	if len(logged) > webhookDeliveryLogSize {
+		logged = slices.Clone(logged[len(logged)-webhookDeliveryLogSize:])
+	}
+	s.deliveries[hook.ID] = logged
+	return delivery.ID
+}
+
+// updateDelivery applies fn to the logged delivery, if it is still logged
+func (s *WebhookStore) updateDelivery(hookID, id string, fn func(delivery *WebhookDelivery)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, delivery := range s.deliveries[hookID] {
+		if delivery.ID == id {
+			fn(delivery)
+			delivery.UpdatedAt = time.Now()
+			return
+		}
+	}
+}
+
+// sorted returns copies of the webhooks, oldest first. The caller must hold s.mu.
+func (s *WebhookStore) sorted() []Webhook {
+	hooks := make([]Webhook, 0, len(s.hooks))
+	for _, hook := range s.hooks {
+		hooks = append(hooks, *hook)
+	}
+	slices.SortFunc(hooks, func(a, b Webhook) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	return hooks
+}
+
+// save writes the webhooks to the store's file. The caller must hold s.mu.
+func (s *WebhookStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s.sorted(), "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(s.path), 0755)
+	if err != nil {
+		return err
+	}
+	// The file holds the signing secrets
+	return os.WriteFile(s.path, data, 0600)
+}
+
+// webhookClient delivers payloads. Unless WEBHOOK_ALLOW_PRIVATE=true it refuses to connect
+// to non-public addresses, so webhooks can't be used to reach internal services. Redirects
+// aren't followed, so they count as failed attempts.
+var webhookClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: func(network, address string, conn syscall.RawConn) error {
+				if getEnvBool("WEBHOOK_ALLOW_PRIVATE", false) {
+					return nil
+				}
+				return publicOnlyControl(network, address, conn)
+			},
+		}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	},
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// emitEvent delivers an event about a blog owned by ownerID to the webhooks subscribed to it
+// and the chat notifiers, in the background
+func emitEvent(eventType, ownerID string, data interface{}) {
+	event := WebhookEvent{
+		ID:        uuid.New().String(),
+		Type:      eventType,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+		ownerID:   ownerID,
+	}
+	notifyChats(event)
+	hooks := webhooks.subscribers(event)
+	if len(hooks) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Failed to encode %s event: %v", eventType, err)
+		return
+	}
+	for _, hook := range hooks {
+		go deliverWebhook(hook, event, body, webhooks.logDelivery(hook, event))
+	}
+}
+
+// deliverWebhook posts the payload to the webhook, retrying failed attempts with a doubling
+// delay, and records the outcome in the delivery log
+func deliverWebhook(hook Webhook, event WebhookEvent, body []byte, deliveryID string) {
+	maxAttempts := max(getEnvInt("WEBHOOK_MAX_ATTEMPTS", defaultWebhookMaxAttempts), 1)
+	delay := getEnvDuration("WEBHOOK_RETRY_DELAY", defaultWebhookRetryDelay)
+
+	for attempt := 1; ; attempt++ {
+		statusCode, err := postWebhook(hook, event, body)
+		retry := err != nil && attempt < maxAttempts && retryableDelivery(statusCode)
+		webhooks.updateDelivery(hook.ID, deliveryID, func(delivery *WebhookDelivery) {
+			delivery.Attempts = attempt
+			delivery.StatusCode = statusCode
+			delivery.Error = ""
+			switch {
+			case err == nil:
+				delivery.Status = DeliverySucceeded
+			case retry:
+				delivery.Error = err.Error()
+			default:
+				delivery.Status = DeliveryFailed
+				delivery.Error = err.Error()
+			}
+		})
+		if !retry {
+			if err != nil {
+				log.Printf("Delivering %s event %s to webhook %s failed after %d attempts: %v", event.Type, event.ID, hook.ID, attempt, err)
+			}
+			return
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// retryableDelivery reports whether an attempt that got statusCode, or no response when
+// it is zero, is worth retrying. Other client errors mean the receiver rejected the payload.
+func retryableDelivery(statusCode int) bool {
+	return statusCode == 0 || statusCode == http.StatusTooManyRequests || statusCode >= 500
+}
+
+// postWebhook makes one delivery attempt, returning the response status
+func postWebhook(hook Webhook, event WebhookEvent, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "blog-generator-webhooks")
+	req.Header.Set("X-Webhook-ID", event.ID)
+	req.Header.Set("X-Webhook-Event", event.Type)
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", "sha256="+signWebhook(hook.Secret, timestamp, body))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// signWebhook returns the hex HMAC-SHA256 of "timestamp.body" keyed with the secret.
+// Signing the timestamp lets receivers reject replayed deliveries.
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// validateWebhookURL checks that the webhook URL is an absolute http(s) URL
+func validateWebhookURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("scheme must be http or https")
+	}
+	if u.Hostname() == "" {
+		return fmt.Errorf("missing host")
+	}
+	return nil
+}
+
+// webhookEventList validates the requested events, defaulting to every event
+func webhookEventList(requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		return slices.Clone(webhookEvents), nil
+	}
+	var events []string
+	for _, event := range requested {
+		if !slices.Contains(webhookEvents, event) {
+			return nil, fmt.Errorf("unknown event %q, events are %s", event, strings.Join(webhookEvents, ", "))
+		}
+		if !slices.Contains(events, event) {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// manageableWebhook returns the webhook with the ID in the request's path, answering
+// 404 or 403 and returning false if it doesn't exist or belongs to another user
+func manageableWebhook(w http.ResponseWriter, r *http.Request) (Webhook, bool) {
+	hook, ok := webhooks.Get(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return Webhook{}, false
+	}
+	if !canManageOwnedBy(r, hook.OwnerID) {
+		http.Error(w, "only the webhook's owner can manage it", http.StatusForbidden)
+		return Webhook{}, false
+	}
+	return hook, true
+}
+
+func listWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	hooks := webhooks.List(func(hook Webhook) bool {
+		return canManageOwnedBy(r, hook.OwnerID)
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hooks)
+}
+
+func createWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	var reqBody struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&reqBody); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	reqBody.URL = strings.TrimSpace(reqBody.URL)
+	if err := validateWebhookURL(reqBody.URL); err != nil {
+		http.Error(w, "Invalid webhook URL: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	events, err := webhookEventList(reqBody.Events)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, _ := requestUser(r)
+	hook, err := webhooks.Create(reqBody.URL, events, user.ID)
+	if err != nil {
+		http.Error(w, "Failed to create webhook: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Created webhook %s for %s", hook.ID, strings.Join(hook.Events, ", "))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(hook)
+}
+
+func deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	hook, ok := manageableWebhook(w, r)
+	if !ok {
+		return
+	}
+	err := webhooks.Delete(hook.ID)
+	if errors.Is(err, errWebhookNotFound) {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to delete webhook: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Deleted webhook %s", hook.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func webhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	hook, ok := manageableWebhook(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(webhooks.Deliveries(hook.ID))
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// verifyWebhookSignature checks a delivery the way the README tells receivers to
+func verifyWebhookSignature(secret string, r *http.Request, body []byte) bool {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(r.Header.Get("X-Webhook-Timestamp") + "." + string(body)))
+	return hmac.Equal([]byte(r.Header.Get("X-Webhook-Signature")), []byte("sha256="+hex.EncodeToString(mac.Sum(nil))))
+}
+
+func TestSignWebhook(t *testing.T) {
+	body := []byte(`{"event":"blog.deleted"}`)
+	signature := signWebhook("secret", "1700000000", body)
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		body      string
+	}{
+		{"other secret", "other", "1700000000", string(body)},
+		{"replayed with a new timestamp", "secret", "1700000060", string(body)},
+		{"tampered body", "secret", "1700000000", `{"event":"blog.created"}`},
+	}
+	for _, tt := range tests {
+		if signWebhook(tt.secret, tt.timestamp, []byte(tt.body)) == signature {
+			t.Errorf("%s: signature unchanged", tt.name)
+		}
+	}
+	if signWebhook("secret", "1700000000", body) != signature {
+		t.Error("signature isn't deterministic")
+	}
+}
+
+func TestPostWebhookSignsDeliveries(t *testing.T) {
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE", "true")
+	hook := Webhook{ID: "hook", Secret: "whsec", Events: []string{EventBlogDeleted}}
+	verified := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		verified = verifyWebhookSignature(hook.Secret, r, body) && !verifyWebhookSignature("wrong", r, body)
+	}))
+	defer server.Close()
+	hook.URL = server.URL
+
+	if _, err := postWebhook(hook, WebhookEvent{ID: "event", Type: EventBlogDeleted}, []byte(`{"event":"blog.deleted"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if !verified {
+		t.Error("the delivery's signature didn't verify with the webhook's secret")
+	}
+}
+
+func TestWebhookClientRefusesPrivateAddresses(t *testing.T) {
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE", "")
+	hit := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { hit = true }))
+	defer server.Close()
+
+	_, err := postWebhook(Webhook{URL: server.URL, Secret: "whsec"}, WebhookEvent{ID: "event"}, []byte(`{}`))
+	if !errors.Is(err, errForbiddenURL) || hit {
+		t.Errorf("delivering to %s: %v, reached %v, want %v", server.URL, err, hit, errForbiddenURL)
+	}
+}
+
+func TestWebhookReceives(t *testing.T) {
+	event := WebhookEvent{Type: EventBlogDeleted, ownerID: "alice"}
+	tests := []struct {
+		name string
+		hook Webhook
+		want bool
+	}{
+		{"global", Webhook{Events: []string{EventBlogDeleted}}, true},
+		{"owner's", Webhook{Events: []string{EventBlogDeleted}, OwnerID: "alice"}, true},
+		{"another owner's", Webhook{Events: []string{EventBlogDeleted}, OwnerID: "bob"}, false},
+		{"other events", Webhook{Events: []string{EventGenerationStarted}}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.hook.receives(event); got != tt.want {
+			t.Errorf("%s webhook: receives = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
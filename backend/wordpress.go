@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// wordPressPublisher publishes blogs through the WordPress REST API, authenticating with
+// an application password
+type wordPressPublisher struct {
+	api           string
+	authorization string
+}
+
+// wordPressPost is the body of a WordPress create or update post request
+type wordPressPost struct {
+	Title         string `json:"title"`
+	Content       string `json:"content"`
+	Excerpt       string `json:"excerpt"`
+	Status        string `json:"status"`
+	Tags          []int  `json:"tags"`
+	FeaturedMedia int    `json:"featured_media,omitempty"`
+}
+
+// wordPressObject is the part of a WordPress post, media or tag response the publisher uses
+type wordPressObject struct {
+	ID        int    `json:"id"`
+	Link      string `json:"link"`
+	SourceURL string `json:"source_url"`
+	Name      string `json:"name"`
+}
+
+// newWordPressPublisher configures the WordPress target from WORDPRESS_URL,
+// WORDPRESS_USERNAME and WORDPRESS_APP_PASSWORD
+func newWordPressPublisher() (Publisher, error) {
+	site := strings.TrimRight(getEnv("WORDPRESS_URL", ""), "/")
+	username := getEnv("WORDPRESS_USERNAME", "")
+	password := getEnv("WORDPRESS_APP_PASSWORD", "")
+	if site == "" || username == "" || password == "" {
+		return nil, fmt.Errorf("%w: set WORDPRESS_URL, WORDPRESS_USERNAME and WORDPRESS_APP_PASSWORD", errPublisherNotConfigured)
+	}
+	return &wordPressPublisher{
+		api:           site + "/wp-json/wp/v2",
+		authorization: "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password)),
+	}, nil
+}
+
+// Publish creates or updates the WordPress post. Images served by this backend are
+// uploaded to the media library, once per image, and the featured image becomes the
+// post's featured media.
+func (p *wordPressPublisher) Publish(ctx context.Context, blog BlogPost, previous *Publication, opts PublishOptions) (Publication, error) {
+	publication := Publication{Assets: make(map[string]RemoteAsset)}
+	if previous != nil {
+		for key, asset := range previous.Assets {
+			publication.Assets[key] = asset
+		}
+	}
+	upload := func(raw string) (RemoteAsset, bool) {
+		key := assetKey(raw)
+		if asset, ok := publication.Assets[key]; ok {
+			return asset, true
+		}
+		data, contentType, ok := readExportImage(raw)
+		if !ok {
+			return RemoteAsset{}, false
+		}
+		asset, err := p.uploadMedia(ctx, data, contentType)
+		if err != nil {
+			log.Printf("Linking image %s instead of uploading it to WordPress: %v", raw, err)
+			return RemoteAsset{}, false
+		}
+		publication.Assets[key] = asset
+		return asset, true
+	}
+
+	content, err := blogContentHTML(blog, func(raw string) string {
+		if asset, ok := upload(raw); ok {
+			return asset.URL
+		}
+		return remoteImageURL(raw)
+	})
+	if err != nil {
+		return Publication{}, err
+	}
+	tags, err := p.tagIDs(ctx, blog.Tags)
+	if err != nil {
+		return Publication{}, fmt.Errorf("failed to look up tags: %w", err)
+	}
+	post := wordPressPost{
+		Title:   blog.Title,
+		Content: content,
+		Excerpt: blog.Summary,
+		Status:  "publish",
+		Tags:    tags,
+	}
+	if opts.Status == StatusDraft {
+		post.Status = "draft"
+	}
+	if blog.FeaturedImage != "" {
+		if asset, ok := upload(blog.FeaturedImage); ok {
+			post.FeaturedMedia, _ = strconv.Atoi(asset.ID)
+		}
+	}
+
+	var created wordPressObject
+	endpoint := p.api + "/posts"
+	if previous != nil {
+		endpoint += "/" + url.PathEscape(previous.RemoteID)
+	}
+	err = publishRequest(ctx, http.MethodPost, endpoint, p.headers(), post, &created)
+	var remoteErr *publishError
+	if previous != nil && errors.As(err, &remoteErr) && remoteErr.StatusCode == http.StatusNotFound {
+		// The post was deleted on WordPress, so create it again
+		err = publishRequest(ctx, http.MethodPost, p.api+"/posts", p.headers(), post, &created)
+	}
+	if err != nil {
+		return Publication{}, err
+	}
+
+	publication.RemoteID = strconv.Itoa(created.ID)
+	publication.URL = created.Link
+	return publication, nil
+}
+
+func (p *wordPressPublisher) headers() map[string]string {
+	return map[string]string{"Authorization": p.authorization}
+}
+
+// uploadMedia adds the image to the WordPress media library
+func (p *wordPressPublisher) uploadMedia(ctx context.Context, data []byte, contentType string) (RemoteAsset, error) {
+	headers := p.headers()
+	headers["Content-Type"] = contentType
+	headers["Content-Disposition"] = fmt.Sprintf(`attachment; filename="image.%s"`, imageExtensions[contentType])
+
+	var media wordPressObject
+	err := publishRequest(ctx, http.MethodPost, p.api+"/media", headers, bytes.NewReader(data), &media)
+	if err != nil {
+		return RemoteAsset{}, err
+	}
+	return RemoteAsset{ID: strconv.Itoa(media.ID), URL: media.SourceURL}, nil
+}
+
+// tagIDs returns the IDs of the WordPress tags with the given names, creating the ones
+// that don't exist yet
+func (p *wordPressPublisher) tagIDs(ctx context.Context, names []string) ([]int, error) {
+	ids := []int{}
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		var matches []wordPressObject
+		err := publishRequest(ctx, http.MethodGet, p.api+"/tags?per_page=100&search="+url.QueryEscape(name), p.headers(), nil, &matches)
+		if err != nil {
+			return nil, err
+		}
+		id := 0
+		for _, tag := range matches {
+			// Names come back HTML-escaped
+			if strings.EqualFold(html.UnescapeString(tag.Name), name) {
+				id = tag.ID
+				break
+			}
+		}
+		if id == 0 {
+			var tag wordPressObject
+			err := publishRequest(ctx, http.MethodPost, p.api+"/tags", p.headers(), map[string]string{"name": name}, &tag)
+			if err != nil {
+				return nil, err
+			}
+			id = tag.ID
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
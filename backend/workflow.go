@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// maxStatusChanges bounds how many status changes a blog keeps, dropping the oldest
+const maxStatusChanges = 50
+
+// Errors returned when changing a blog's status
+var (
+	errInvalidStatus     = fmt.Errorf("status must be one of %s, %s, %s", StatusDraft, StatusInReview, StatusPublished)
+	errInvalidTransition = errors.New("invalid status change")
+)
+
+// blogStatuses are the workflow statuses a blog may have
+var blogStatuses = []string{StatusDraft, StatusInReview, StatusPublished}
+
+// blogTransitions lists the statuses each status may change to. Drafts are sent for review
+// or published directly, reviews end in publication or back in draft, and published blogs
+// are unpublished back to drafts.
+var blogTransitions = map[string][]string{
+	StatusDraft:     {StatusInReview, StatusPublished},
+	StatusInReview:  {StatusDraft, StatusPublished},
+	StatusPublished: {StatusDraft},
+}
+
+// StatusChange records a blog moving from one workflow status to another
+type StatusChange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	// At is when the status changed (RFC 3339)
+	At string `json:"at"`
+	// UserID is who changed it, empty for API keys and automatic changes
+	UserID string `json:"userId,omitempty"`
+}
+
+// blogStatus returns the blog's workflow status. Blogs stored before statuses existed have
+// none and count as published.
+func blogStatus(blog BlogPost) string {
+	if blog.Status == "" {
+		return StatusPublished
+	}
+	return blog.Status
+}
+
+// changeBlogStatus moves the blog to the status, stamping when it was submitted for review
+// or published and recording the change
+func changeBlogStatus(blog *BlogPost, status, userID string) error {
+	from := blogStatus(*blog)
+	if !slices.Contains(blogStatuses, status) {
+		return errInvalidStatus
+	}
+	if !slices.Contains(blogTransitions[from], status) {
+		return fmt.Errorf("%w: a blog can't go from %s to %s", errInvalidTransition, from, status)
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	blog.Status = status
+	switch status {
+	case StatusInReview:
+		blog.SubmittedAt = now
+	case StatusPublished:
+		blog.PublishedAt = now
+	}
+	if from == StatusPublished {
+		blog.PublishedAt = ""
+	}
+
+	blog.StatusChanges = append(blog.StatusChanges, StatusChange{From: from, To: status, At: now, UserID: userID})
+	if len(blog.StatusChanges) > maxStatusChanges {
+		blog.StatusChanges = blog.StatusChanges[len(blog.StatusChanges)-maxStatusChanges:]
+	}
+	return nil
+}
+
+// canListUnpublished reports whether the request may list drafts and blogs in review,
+// which takes the editor role once credentials are enforced
+func canListUnpublished(r *http.Request) bool {
+	return !authEnabled() || roleAtLeast(requestPrincipal(r).Role(), RoleEditor)
+}
+
+// canReadBlog reports whether the request may read the blog: published blogs are public,
+// while drafts and blogs in review are only shown to the editors who can manage them
+func canReadBlog(r *http.Request, blog BlogPost) bool {
+	return blogStatus(blog) == StatusPublished || (canListUnpublished(r) && canManageBlog(r, blog))
+}
+
+// updateBlogStatusHandler moves a blog through the workflow with {"status": "..."},
+// returning the updated blog
+func updateBlogStatusHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	var reqBody struct {
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !slices.Contains(blogStatuses, reqBody.Status) {
+		http.Error(w, errInvalidStatus.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, _ := requestUser(r)
+	blog, err := updateBlogPost(id, func(blog *BlogPost) error {
+		if !canManageBlog(r, *blog) {
+			return errNotBlogOwner
+		}
+		return changeBlogStatus(blog, reqBody.Status, user.ID)
+	})
+	if errors.Is(err, errNotBlogOwner) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, errInvalidBlogID) {
+		http.Error(w, "Invalid blog ID", http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, errBlogNotFound) {
+		http.Error(w, "Blog not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, errInvalidTransition) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to update blog: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(blog)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// withUser returns the request as made by the logged-in user
+func withUser(r *http.Request, user User) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), principalContextKey{}, Principal{User: &user}))
+}
+
+func TestUnpublishedBlogsAreHidden(t *testing.T) {
+	useImageURLStore(t, "https://blog.example.com")
+	useAuthStores(t, ConfigAPIKey{Name: "ci", Key: "editor-key"})
+	blog := revisionTestBlog()
+	blog.Status = StatusDraft
+	if err := saveBlogPost(blog); err != nil {
+		t.Fatal(err)
+	}
+
+	handlers := map[string]http.HandlerFunc{
+		"/api/blogs/{id}":                 getBlogByIDHandler,
+		"/api/blogs/{id}/markdown":        markdownExportHandler,
+		"/api/blogs/{id}/sources":         blogSourcesHandler,
+		"/api/blogs/{id}/revisions":       listRevisionsHandler,
+		"/api/blogs/{id}/revisions/{rev}": getRevisionHandler,
+	}
+	get := func(pattern, key string) int {
+		router := mux.NewRouter()
+		router.HandleFunc(pattern, handlers[pattern])
+		path := "/api/blogs/" + blog.ID
+		switch pattern {
+		case "/api/blogs/{id}/markdown":
+			path += "/markdown"
+		case "/api/blogs/{id}/sources":
+			path += "/sources"
+		case "/api/blogs/{id}/revisions":
+			path += "/revisions"
+		case "/api/blogs/{id}/revisions/{rev}":
+			path += "/revisions/1"
+		}
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		rec := httptest.NewRecorder()
+		authMiddleware(router).ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	for pattern := range handlers {
+		if status := get(pattern, ""); status != http.StatusNotFound {
+			t.Errorf("anonymous GET %s of a draft: status %d, want 404", pattern, status)
+		}
+	}
+	for _, pattern := range []string{"/api/blogs/{id}", "/api/blogs/{id}/markdown", "/api/blogs/{id}/revisions", "/api/blogs/{id}/revisions/{rev}"} {
+		if status := get(pattern, "editor-key"); status != http.StatusOK {
+			t.Errorf("editor GET %s of their draft: status %d, want 200", pattern, status)
+		}
+	}
+
+	if _, err := updateBlogPost(blog.ID, func(blog *BlogPost) error {
+		return changeBlogStatus(blog, StatusPublished, "")
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for _, pattern := range []string{"/api/blogs/{id}", "/api/blogs/{id}/markdown", "/api/blogs/{id}/revisions", "/api/blogs/{id}/revisions/{rev}"} {
+		if status := get(pattern, ""); status != http.StatusOK {
+			t.Errorf("anonymous GET %s of a published blog: status %d, want 200", pattern, status)
+		}
+	}
+}
+
+func TestCanReadBlogOwnedByAnotherEditor(t *testing.T) {
+	useAuthStores(t)
+	user, err := users.Register("owner@example.com", "password1", func(bool) (string, error) { return RoleEditor, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := users.Register("other@example.com", "password1", func(bool) (string, error) { return RoleEditor, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	draft := BlogPost{ID: revisionTestBlogID, Status: StatusInReview, OwnerID: user.ID}
+
+	if !canReadBlog(withUser(httptest.NewRequest(http.MethodGet, "/", nil), user), draft) {
+		t.Error("the owner can't read their blog in review")
+	}
+	if canReadBlog(withUser(httptest.NewRequest(http.MethodGet, "/", nil), other), draft) {
+		t.Error("another editor can read the blog in review")
+	}
+}
@@ -5,6 +5,36 @@ import { Card, CardContent } from "@/components/ui/card";
 import { Loader2 } from "lucide-react";
 import BlogPost from "./components/BlogPost";
 
+const JOB_POLL_INTERVAL_MS = 2000;
+
+// Sent on generation requests when the backend is configured with an API_KEY
+const authHeaders = import.meta.env.VITE_API_KEY
+  ? { "X-API-Key": import.meta.env.VITE_API_KEY }
+  : {};
+
+// Polls the generation job until it finishes, resolving with the generated blog's ID
+async function waitForJob(jobId) {
+  for (;;) {
+    const response = await fetch(`/api/jobs/${jobId}`);
+    if (!response.ok) {
+      throw new Error("Failed to check generation status");
+    }
+
+    const job = await response.json();
+    if (job.status === "done") {
+      return job.blogId;
+    }
+    if (job.status === "failed") {
+      throw new Error(job.error || "Failed to generate blog post");
+    }
+    if (job.status === "cancelled") {
+      throw new Error("Blog generation was cancelled");
+    }
+
+    await new Promise((resolve) => setTimeout(resolve, JOB_POLL_INTERVAL_MS));
+  }
+}
+
 function App() {
   const [topic, setTopic] = useState("");
   const [loading, setLoading] = useState(false);
@@ -23,6 +53,7 @@ function App() {
         method: "POST",
         headers: {
           "Content-Type": "application/json",
+          ...authHeaders,
         },
         body: JSON.stringify({ topic }),
       });
@@ -31,7 +62,15 @@ function App() {
         throw new Error("Failed to generate blog post");
       }
 
-      const data = await response.json();
+      const { jobId } = await response.json();
+      const blogId = await waitForJob(jobId);
+
+      const blogResponse = await fetch(`/api/blogs/${blogId}`);
+      if (!blogResponse.ok) {
+        throw new Error("Failed to load generated blog post");
+      }
+
+      const data = await blogResponse.json();
       setBlogData(data);
     } catch (err) {
       setError(err.message || "Something went wrong");
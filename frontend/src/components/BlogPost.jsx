@@ -1,6 +1,21 @@
 import React from "react";
 import { Card, CardContent } from "@/components/ui/card";
 
+// Widths the backend resizes stored images to
+const imageWidths = [320, 768, 1280];
+
+// Lets the browser pick a resized copy of images stored by the backend
+const imageSrcSet = (url) => {
+  if (!url || !url.includes("/api/images/")) return undefined;
+  return imageWidths.map((width) => `${url}?w=${width} ${width}w`).join(", ");
+};
+
+// Numbers a paragraph's cited source by its position in the blog's sources
+const citationNumber = (blog, source, idx) => {
+  const position = (blog.sources || []).findIndex((s) => s.url === source.url);
+  return position >= 0 ? position + 1 : idx + 1;
+};
+
 function BlogPost({ blog }) {
   if (!blog) return null;
 
@@ -42,6 +57,19 @@ function BlogPost({ blog }) {
           return (
             <p key={idx} className="mb-4 text-gray-800 leading-relaxed">
               {block.text}
+              {(block.sources || []).map((source, sourceIdx) => (
+                <sup key={sourceIdx} className="ml-0.5">
+                  <a
+                    href={source.url}
+                    title={source.title || source.url}
+                    target="_blank"
+                    rel="noopener noreferrer"
+                    className="text-blue-600 hover:underline"
+                  >
+                    [{citationNumber(blog, source, sourceIdx)}]
+                  </a>
+                </sup>
+              ))}
             </p>
           );
 
@@ -50,6 +78,8 @@ function BlogPost({ blog }) {
             <div key={idx} className="my-6">
               <img
                 src={block.url}
+                srcSet={imageSrcSet(block.url)}
+                sizes="(min-width: 768px) 768px, 100vw"
                 alt={block.alt || "Blog image"}
                 className="rounded-lg w-full max-h-96 object-cover"
                 onError={(e) => {
@@ -116,6 +146,8 @@ function BlogPost({ blog }) {
           <div className="w-full h-64 md:h-80 relative overflow-hidden">
             <img
               src={blog.featuredImage}
+              srcSet={imageSrcSet(blog.featuredImage)}
+              sizes="100vw"
               alt={blog.title || "Featured image"}
               className="rounded-lg w-full max-h-96 object-cover"
               onError={(e) => {